@@ -3,6 +3,7 @@ package main
 import (
 	"aika/config"
 	"aika/internal/handler"
+	"aika/internal/metrics"
 	"aika/internal/repository"
 	"aika/traits/database"
 	"aika/traits/logger"
@@ -10,12 +11,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"go.uber.org/zap"
 )
 
 func main() {
+	startedAt := time.Now()
 	zapLogger, err := logger.NewLogger()
 	if err != nil {
 		panic(err)
@@ -27,31 +30,85 @@ func main() {
 		return
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Initialize database
-	db, err := database.InitDatabase(cfg.DBPath)
+	db, err := database.InitDatabase(ctx, cfg.DBPath, database.Options{
+		JournalMode:  cfg.DBJournalMode,
+		BusyTimeout:  cfg.DBBusyTimeout,
+		MaxOpenConns: cfg.DBMaxOpenConns,
+		ForeignKeys:  cfg.DBForeignKeys,
+	})
 	if err != nil {
 		zapLogger.Error("error initializing database", zap.Error(err))
+		cancel()
 		return
 	}
 	defer db.Close()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	redisClient, err := database.ConnectRedis(ctx, zapLogger)
-	if err != nil {
-		zapLogger.Fatal("error conn to redis", zap.Error(err))
+	redisOpts := database.RedisOptions{
+		Addr:         cfg.RedisAddr,
+		Password:     cfg.RedisPassword,
+		DB:           cfg.RedisDB,
+		TLS:          cfg.RedisTLS,
+		PoolSize:     cfg.RedisPoolSize,
+		DialTimeout:  cfg.RedisDialTimeout,
+		ReadTimeout:  cfg.RedisReadTimeout,
+		WriteTimeout: cfg.RedisWriteTimeout,
+	}
+	redisClient, redisErr := database.ConnectRedis(ctx, redisOpts, zapLogger)
+	if redisErr != nil {
+		if !cfg.RedisStartDegraded {
+			zapLogger.Error("error conn to redis", zap.String("addr", cfg.RedisAddr), zap.Error(redisErr))
+			cancel()
+			return
+		}
+		zapLogger.Error("Redis is unavailable at startup, starting with in-memory chat state", zap.String("addr", cfg.RedisAddr), zap.Error(redisErr))
+		redisClient = database.OpenRedis(redisOpts)
 	}
+	defer database.CloseRedis(redisClient, zapLogger)
 
-	redisRepo := repository.NewRedisClient(redisClient)
+	redisClient.AddHook(metrics.RedisHook{})
+	redisRepo := repository.NewFailoverStore(repository.NewRedisClient(redisClient), repository.NewMemoryStore(), cfg.RedisFailoverThreshold, zapLogger)
+	if redisErr != nil {
+		redisRepo.MarkDegraded(redisErr)
+	}
+	go redisRepo.Monitor(ctx, cfg.RedisProbeInterval)
 
 	handl := handler.NewHandler(zapLogger, cfg, ctx, db, redisRepo)
+	handl.SetStartedAt(startedAt)
+	poll := newPollWatch()
 	opts := []bot.Option{
+		bot.WithHTTPClient(botPollTimeout, poll),
 		bot.WithAllowedUpdates([]string{"message", "callback_query"}), // <— add this
+		bot.WithMiddlewares(handl.RecoverMiddleware, handler.BotMetricsMiddleware, handl.BanMiddleware),
 		bot.WithMessageTextHandler("/admin", bot.MatchTypeExact, handl.AdminHandler),
 		bot.WithMessageTextHandler("📢 Хабарлама (Messages)", bot.MatchTypeExact, handl.AdminHandler),
 		bot.WithMessageTextHandler("❌ Жабу (Close)", bot.MatchTypeExact, handl.AdminHandler),
+		bot.WithMessageTextHandler("📊 Экспорт (Тіркелгендер)", bot.MatchTypeExact, handl.AdminHandler),
+		bot.WithMessageTextHandler("📈 Статистика", bot.MatchTypeExact, handl.AdminHandler),
+		bot.WithMessageTextHandler("📄 Соңғы есеп", bot.MatchTypeExact, handl.AdminHandler),
+		bot.WithMessageTextHandler("🚩 Шағымдар", bot.MatchTypeExact, handl.AdminHandler),
+		bot.WithMessageTextHandler("/ban", bot.MatchTypePrefix, handl.BanCommandHandler),
+		bot.WithMessageTextHandler("/unban", bot.MatchTypePrefix, handl.BanCommandHandler),
+		bot.WithMessageTextHandler("/mediatest", bot.MatchTypeExact, handl.MediaTestHandler),
+		bot.WithMessageTextHandler("/delete_profile", bot.MatchTypeExact, handl.DeleteProfileCommand),
+		bot.WithMessageTextHandler("/unsubscribe", bot.MatchTypeExact, handl.UnsubscribeCommand),
+		bot.WithMessageTextHandler("/subscribe", bot.MatchTypeExact, handl.SubscribeCommand),
+		bot.WithMessageTextHandler("/next", bot.MatchTypeExact, handl.NextCommand),
+		bot.WithMessageTextHandler("/order", bot.MatchTypeExact, handl.OrderCommand),
 		bot.WithCallbackQueryDataHandler("select_", bot.MatchTypePrefix, handl.InlineHandler),
 		bot.WithCallbackQueryDataHandler("exit", bot.MatchTypePrefix, handl.CallbackHandlerExit),
+		bot.WithCallbackQueryDataHandler("next", bot.MatchTypeExact, handl.CallbackHandlerNext),
 		bot.WithCallbackQueryDataHandler("delete_", bot.MatchTypePrefix, handl.DeleteMessageHandler),
+		bot.WithCallbackQueryDataHandler("bcancel", bot.MatchTypeExact, handl.BroadcastCancelHandler),
+		bot.WithCallbackQueryDataHandler("brun_", bot.MatchTypePrefix, handl.BroadcastRunHandler),
+		bot.WithCallbackQueryDataHandler("btpl_", bot.MatchTypePrefix, handl.BroadcastTemplateHandler),
+		bot.WithCallbackQueryDataHandler("bprotect", bot.MatchTypeExact, handl.BroadcastProtectHandler),
+		bot.WithCallbackQueryDataHandler("bsend_", bot.MatchTypePrefix, handl.BroadcastConfirmHandler),
+		bot.WithCallbackQueryDataHandler("bsched_", bot.MatchTypePrefix, handl.ScheduledBroadcastHandler),
+		bot.WithCallbackQueryDataHandler("export_", bot.MatchTypePrefix, handl.ExportFormatHandler),
+		bot.WithCallbackQueryDataHandler("report_", bot.MatchTypePrefix, handl.ReportActionHandler),
 		bot.WithDefaultHandler(handl.DefaultHandler),
 	}
 
@@ -71,7 +128,21 @@ func main() {
 	}()
 
 	go handl.StartWebServer(ctx, b)
+	handl.NotifyInterruptedBroadcasts(ctx, b)
 	zapLogger.Info("Starting web server", zap.String("port", cfg.Port))
 	zapLogger.Info("Bot started successfully")
-	b.Start(ctx)
+	supervisor := botSupervisor{
+		logger:      zapLogger,
+		maxRestarts: cfg.BotMaxRestarts,
+		backoff:     cfg.BotRestartBackoff,
+		maxBackoff:  cfg.BotRestartMaxBackoff,
+
+		stallTimeout: cfg.BotStallTimeout,
+		lastPoll:     poll.LastPoll,
+	}
+	if err := supervisor.run(ctx, b.Start); err != nil {
+		zapLogger.Error("Bot stopped", zap.Error(err))
+		cancel()
+	}
+	handl.Shutdown(cfg.ShutdownTimeout)
 }
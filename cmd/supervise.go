@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// botPollTimeout is the long-poll window of getUpdates, the client's default
+const botPollTimeout = time.Minute
+
+// pollWatch wraps the bot's HTTP client and notes when a getUpdates call last came
+// back from Telegram, so the supervisor can tell a live poller from a stuck one
+type pollWatch struct {
+	client bot.HttpClient
+	last   atomic.Int64
+}
+
+func newPollWatch() *pollWatch {
+	return &pollWatch{client: &http.Client{Timeout: botPollTimeout}}
+}
+
+func (p *pollWatch) Do(req *http.Request) (*http.Response, error) {
+	resp, err := p.client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusOK && strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		p.last.Store(time.Now().UnixNano())
+	}
+	return resp, err
+}
+
+// LastPoll is when getUpdates last answered, the zero time before the first answer
+func (p *pollWatch) LastPoll() time.Time {
+	if n := p.last.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// botSupervisor keeps the bot's update loop polling. bot.Start only returns once
+// its ctx is done and getUpdates retries failed calls forever, so a poller that
+// keeps failing or hangs looks alive from outside; the supervisor watches when
+// getUpdates last answered and restarts Start when that is longer than
+// stallTimeout ago. Handler panics are caught by the bot's RecoverMiddleware.
+type botSupervisor struct {
+	logger *zap.Logger
+	// maxRestarts bounds the restarts in a row, 0 means no limit
+	maxRestarts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	// stallTimeout is how long getUpdates may go without an answer; 0 turns the watchdog off
+	stallTimeout time.Duration
+	// lastPoll reports when getUpdates last answered, see pollWatch
+	lastPoll func() time.Time
+	// after waits out a backoff, time.After when nil
+	after func(time.Duration) <-chan time.Time
+}
+
+// run calls start until ctx is done. start is expected to block until its ctx is
+// done; when it stalls or returns early it is started again after a backoff that
+// doubles up to maxBackoff. A run that lasted longer than maxBackoff counts as
+// healthy and resets the backoff and the restart count. Only start is restarted:
+// the web server, Redis and the database stay up meanwhile.
+func (s botSupervisor) run(ctx context.Context, start func(context.Context)) error {
+	// a zero backoff would restart a failing loop without pause
+	s.backoff = max(s.backoff, 100*time.Millisecond)
+	s.maxBackoff = max(s.maxBackoff, s.backoff)
+	if s.after == nil {
+		s.after = time.After
+	}
+	backoff := s.backoff
+	restarts := 0
+	for {
+		began := time.Now()
+		err := s.runOnce(ctx, start)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(began) > s.maxBackoff {
+			backoff, restarts = s.backoff, 0
+		}
+		if s.maxRestarts > 0 && restarts >= s.maxRestarts {
+			return fmt.Errorf("bot stopped %d times in a row, giving up: %w", restarts+1, err)
+		}
+		restarts++
+		s.logger.Error("Bot update loop stopped, restarting",
+			zap.Int("restart", restarts),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.after(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// runOnce runs start until it returns or the poller stalls; a stall cancels the
+// ctx start runs with and waits for it to wind down
+func (s botSupervisor) runOnce(ctx context.Context, start func(context.Context)) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		start(runCtx)
+	}()
+
+	var check <-chan time.Time
+	if s.stallTimeout > 0 && s.lastPoll != nil {
+		ticker := time.NewTicker(s.stallTimeout / 4)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+	// answers from before this run don't count for it
+	began := time.Now()
+	for {
+		select {
+		case <-done:
+			return errors.New("update loop returned")
+		case <-check:
+		}
+		last := s.lastPoll()
+		if last.Before(began) {
+			last = began
+		}
+		if idle := time.Since(last); idle > s.stallTimeout {
+			cancel()
+			<-done
+			return fmt.Errorf("getUpdates has not answered for %s", idle.Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordDelays is an after hook that notes each backoff and fires at once
+func recordDelays(delays *[]time.Duration) func(time.Duration) <-chan time.Time {
+	return func(d time.Duration) <-chan time.Time {
+		*delays = append(*delays, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+}
+
+func TestBotSupervisorBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var delays []time.Duration
+	s := botSupervisor{
+		logger:     zap.NewNop(),
+		backoff:    10 * time.Second,
+		maxBackoff: 40 * time.Second,
+		after:      recordDelays(&delays),
+	}
+
+	calls := 0
+	err := s.run(ctx, func(ctx context.Context) {
+		calls++
+		switch calls {
+		case 1, 2, 3, 4:
+			return
+		default:
+			// the loop comes up and runs until shutdown
+			cancel()
+			<-ctx.Done()
+		}
+	})
+	if err != nil {
+		t.Fatalf("run = %v, want nil after ctx cancel", err)
+	}
+	if calls != 5 {
+		t.Errorf("start called %d times, want 5", calls)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("backoffs = %v, want %v", delays, want)
+	}
+}
+
+func TestBotSupervisorMaxRestarts(t *testing.T) {
+	var delays []time.Duration
+	s := botSupervisor{
+		logger:      zap.NewNop(),
+		maxRestarts: 3,
+		backoff:     time.Second,
+		maxBackoff:  time.Minute,
+		after:       recordDelays(&delays),
+	}
+
+	calls := 0
+	err := s.run(context.Background(), func(context.Context) { calls++ })
+	if err == nil {
+		t.Fatal("run = nil, want an error after maxRestarts")
+	}
+	if calls != 4 {
+		t.Errorf("start called %d times, want 4 (one run and 3 restarts)", calls)
+	}
+	if len(delays) != 3 {
+		t.Errorf("waited %d backoffs, want 3", len(delays))
+	}
+}
+
+func TestBotSupervisorStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := botSupervisor{
+		logger:  zap.NewNop(),
+		backoff: time.Second,
+		// shutdown arrives while the supervisor waits out the backoff
+		after: func(time.Duration) <-chan time.Time {
+			cancel()
+			return make(chan time.Time)
+		},
+	}
+
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx, func(context.Context) { calls++ })
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after ctx was cancelled")
+	}
+	if calls != 1 {
+		t.Errorf("start called %d times, want 1", calls)
+	}
+}
+
+func TestBotSupervisorRestartsStalledPoller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var delays []time.Duration
+	var last atomic.Int64
+	s := botSupervisor{
+		logger:       zap.NewNop(),
+		backoff:      time.Second,
+		maxBackoff:   time.Minute,
+		stallTimeout: 40 * time.Millisecond,
+		lastPoll:     func() time.Time { return time.Unix(0, last.Load()) },
+		after:        recordDelays(&delays),
+	}
+
+	calls := 0
+	err := s.run(ctx, func(ctx context.Context) {
+		calls++
+		if calls < 3 {
+			// like bot.Start with a hung getUpdates: no answers, no return until ctx is done
+			<-ctx.Done()
+			return
+		}
+		// the third run polls fine for longer than stallTimeout, then the bot shuts down
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		stop := time.After(200 * time.Millisecond)
+		for {
+			select {
+			case <-ctx.Done():
+				t.Error("a polling run was cancelled")
+				return
+			case <-stop:
+				cancel()
+				<-ctx.Done()
+				return
+			case now := <-ticker.C:
+				last.Store(now.UnixNano())
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("run = %v, want nil after ctx cancel", err)
+	}
+	if calls != 3 {
+		t.Errorf("start called %d times, want 3", calls)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("backoffs = %v, want %v", delays, want)
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusConflict)
+		}
+		io.WriteString(w, `{"ok":true,"result":[]}`)
+	}))
+	defer srv.Close()
+	p := newPollWatch()
+	post := func(path string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		resp, err := p.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	post("/botTOKEN/sendMessage")
+	post("/botTOKEN/getUpdates?fail=1")
+	if last := p.LastPoll(); !last.IsZero() {
+		t.Fatalf("LastPoll = %v before getUpdates answered", last)
+	}
+	before := time.Now()
+	post("/botTOKEN/getUpdates")
+	if last := p.LastPoll(); last.Before(before) {
+		t.Errorf("LastPoll = %v, want after %v", last, before)
+	}
+}
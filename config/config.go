@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -10,7 +13,111 @@ type Config struct {
 	DBPath      string
 	ChannelName string
 	MiniAppURL  string
-	AdminID     int64
+	// AdminID is the primary admin: alerts about unauthorized access go there
+	AdminID int64
+	// AdminIDs are everyone allowed into the admin panel, AdminID included
+	AdminIDs []int64
+
+	// CORS: only AllowedOrigins are echoed back; CORSAllowAll (dev only) sends "*"
+	AllowedOrigins []string
+	CORSAllowAll   bool
+
+	// AccessLogLevel is the zap level of per-request web logs ("off" disables them)
+	AccessLogLevel string
+
+	// SQLite connection tuning
+	DBJournalMode  string
+	DBBusyTimeout  time.Duration
+	DBMaxOpenConns int
+	DBForeignKeys  bool
+
+	// Redis connection
+	RedisAddr         string
+	RedisPassword     string
+	RedisDB           int
+	RedisTLS          bool
+	RedisPoolSize     int
+	RedisDialTimeout  time.Duration
+	RedisReadTimeout  time.Duration
+	RedisWriteTimeout time.Duration
+	// RedisFailoverThreshold consecutive connection errors move the chat state to memory;
+	// while there, Redis is pinged every RedisProbeInterval
+	RedisFailoverThreshold int
+	RedisProbeInterval     time.Duration
+	// RedisStartDegraded starts the bot on the in-memory chat state when Redis is
+	// unreachable at startup, instead of exiting
+	RedisStartDegraded bool
+
+	// Featured profiles carousel
+	FeaturedLimit          int
+	FeaturedRefresh        time.Duration
+	FeaturedWeightRecent   float64
+	FeaturedWeightComplete float64
+	FeaturedWeightPopular  float64
+	FeaturedWeightVerified float64
+	FeaturedWeightBoosted  float64
+
+	// SkipPenalty scales how much a high skip rate pushes a profile down in nearby/featured (0 disables)
+	SkipPenalty float64
+
+	// Channel mirror batching
+	MirrorBatch         bool
+	MirrorFlushInterval time.Duration
+	MirrorBatchSize     int
+
+	// Admin exports: files are written to ExcelDir and removed after ExcelRetention,
+	// or right after a successful upload when ExcelDeleteAfterSend is set
+	ExcelDir             string
+	ExcelRetention       time.Duration
+	ExcelDeleteAfterSend bool
+
+	// OnlineWindow is how recently a user must have used the bot to show as online
+	OnlineWindow time.Duration
+
+	// ChatIdleTimeout ends a chat after this long without a relayed message
+	ChatIdleTimeout time.Duration
+	// PartnerTTL expires a pair's partner mappings after this long without a relayed
+	// message, as a backstop for pairs the idle sweeper misses
+	PartnerTTL time.Duration
+
+	// BroadcastRate is how many broadcast messages per second are sent; Telegram
+	// allows about 30 to different chats
+	BroadcastRate float64
+
+	// Scheduled broadcasts: send times are typed in ScheduleTimezone, and due
+	// broadcasts are looked for every SchedulePollInterval
+	ScheduleTimezone     string
+	SchedulePollInterval time.Duration
+
+	// Orders (/order): OrderPrice is the unit price in tenge, 0 turns ordering off;
+	// OrderPaymentInfo tells buyers where to pay, e.g. a Kaspi number
+	OrderPrice       int
+	OrderMaxCount    int
+	OrderPaymentInfo string
+
+	// PanicNotifyAdmins sends admins a short alert when a bot update handler panics
+	PanicNotifyAdmins bool
+
+	// The bot's update loop is restarted when getUpdates has not answered for
+	// BotStallTimeout (0 = never), waiting BotRestartBackoff doubled up to
+	// BotRestartMaxBackoff; after BotMaxRestarts restarts in a row (0 = no limit)
+	// the process shuts down
+	BotStallTimeout      time.Duration
+	BotMaxRestarts       int
+	BotRestartBackoff    time.Duration
+	BotRestartMaxBackoff time.Duration
+
+	// ShutdownTimeout is the grace period shutdown gives in-flight broadcasts,
+	// background jobs and open web requests to finish
+	ShutdownTimeout time.Duration
+
+	// Prometheus /metrics: served on MetricsAddr (e.g. ":9090") when set, otherwise on the
+	// public web port, where it needs MetricsToken as a bearer token and is off without one
+	MetricsAddr  string
+	MetricsToken string
+
+	// MediaTestFiles maps a broadcast msg type to a sample file_id/URL used by /mediatest
+	MediaTestFiles map[string]string
 }
 
 func NewConfig() (*Config, error) {
@@ -29,12 +136,160 @@ func NewConfig() (*Config, error) {
 		dbPath = "./aika.db"
 	}
 
+	miniAppURL := "https://erek001.bnna.dev"
+
+	adminID := int64(800703982)
+	adminIDs := []int64{adminID}
+	for _, id := range envInt64List("ADMIN_IDS") {
+		if id != adminID {
+			adminIDs = append(adminIDs, id)
+		}
+	}
+
 	return &Config{
 		Token:       token,
 		Port:        port,
 		DBPath:      dbPath,
 		ChannelName: "@jaiAngmeAitamyz",
-		MiniAppURL:  "https://erek001.bnna.dev",
-		AdminID:     800703982,
+		MiniAppURL:  miniAppURL,
+		AdminID:     adminID,
+		AdminIDs:    adminIDs,
+
+		AllowedOrigins: envList("ALLOWED_ORIGINS", []string{miniAppURL}),
+		CORSAllowAll:   envBool("CORS_ALLOW_ALL", false),
+
+		AccessLogLevel: envString("ACCESS_LOG_LEVEL", "info"),
+
+		DBJournalMode:  envString("DB_JOURNAL_MODE", "WAL"),
+		DBBusyTimeout:  envDuration("DB_BUSY_TIMEOUT", 5*time.Second),
+		DBMaxOpenConns: envInt("DB_MAX_OPEN_CONNS", 0),
+		DBForeignKeys:  envBool("DB_FOREIGN_KEYS", true),
+
+		RedisAddr:         envString("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:     envString("REDIS_PASSWORD", ""),
+		RedisDB:           envInt("REDIS_DB", 0),
+		RedisTLS:          envBool("REDIS_TLS", false),
+		RedisPoolSize:     envInt("REDIS_POOL_SIZE", 10),
+		RedisDialTimeout:  envDuration("REDIS_DIAL_TIMEOUT", 5*time.Second),
+		RedisReadTimeout:  envDuration("REDIS_READ_TIMEOUT", 3*time.Second),
+		RedisWriteTimeout: envDuration("REDIS_WRITE_TIMEOUT", 3*time.Second),
+
+		RedisFailoverThreshold: envInt("REDIS_FAILOVER_THRESHOLD", 5),
+		RedisProbeInterval:     envDuration("REDIS_PROBE_INTERVAL", 5*time.Second),
+		RedisStartDegraded:     envBool("REDIS_START_DEGRADED", false),
+
+		FeaturedLimit:          envInt("FEATURED_LIMIT", 20),
+		FeaturedRefresh:        envDuration("FEATURED_REFRESH", 10*time.Minute),
+		FeaturedWeightRecent:   envFloat("FEATURED_WEIGHT_RECENT", 1.0),
+		FeaturedWeightComplete: envFloat("FEATURED_WEIGHT_COMPLETE", 1.0),
+		FeaturedWeightPopular:  envFloat("FEATURED_WEIGHT_POPULAR", 0.5),
+		FeaturedWeightVerified: envFloat("FEATURED_WEIGHT_VERIFIED", 1.0),
+		FeaturedWeightBoosted:  envFloat("FEATURED_WEIGHT_BOOSTED", 2.0),
+
+		SkipPenalty: envFloat("SKIP_PENALTY", 1.0),
+
+		MirrorBatch:         envBool("MIRROR_BATCH", false),
+		MirrorFlushInterval: envDuration("MIRROR_FLUSH_INTERVAL", 5*time.Second),
+		MirrorBatchSize:     envInt("MIRROR_BATCH_SIZE", 20),
+
+		ExcelDir:       envString("EXCEL_DIR", "./excel"),
+		ExcelRetention: envDuration("EXCEL_RETENTION", 24*time.Hour),
+
+		ExcelDeleteAfterSend: envBool("EXCEL_DELETE_AFTER_SEND", true),
+
+		OnlineWindow: envDuration("ONLINE_WINDOW", 5*time.Minute),
+
+		ChatIdleTimeout: envDuration("CHAT_IDLE_TIMEOUT", 30*time.Minute),
+		PartnerTTL:      envDuration("PARTNER_TTL", 48*time.Hour),
+
+		BroadcastRate: envFloat("BROADCAST_RATE", 30),
+
+		ScheduleTimezone:     envString("SCHEDULE_TIMEZONE", "Asia/Almaty"),
+		SchedulePollInterval: envDuration("SCHEDULE_POLL_INTERVAL", 30*time.Second),
+
+		OrderPrice:       envInt("ORDER_PRICE", 0),
+		OrderMaxCount:    envInt("ORDER_MAX_COUNT", 10),
+		OrderPaymentInfo: envString("ORDER_PAYMENT_INFO", ""),
+
+		PanicNotifyAdmins: envBool("PANIC_NOTIFY_ADMINS", true),
+
+		BotStallTimeout:      envDuration("BOT_STALL_TIMEOUT", 3*time.Minute),
+		BotMaxRestarts:       envInt("BOT_MAX_RESTARTS", 10),
+		BotRestartBackoff:    envDuration("BOT_RESTART_BACKOFF", time.Second),
+		BotRestartMaxBackoff: envDuration("BOT_RESTART_MAX_BACKOFF", time.Minute),
+
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+
+		MetricsAddr:  envString("METRICS_ADDR", ""),
+		MetricsToken: envString("METRICS_TOKEN", ""),
+
+		MediaTestFiles: map[string]string{
+			"photo":     os.Getenv("MEDIATEST_PHOTO"),
+			"video":     os.Getenv("MEDIATEST_VIDEO"),
+			"document":  os.Getenv("MEDIATEST_DOCUMENT"),
+			"audio":     os.Getenv("MEDIATEST_AUDIO"),
+			"animation": os.Getenv("MEDIATEST_ANIMATION"),
+			"sticker":   os.Getenv("MEDIATEST_STICKER"),
+		},
 	}, nil
 }
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma-separated list, dropping empty items
+func envList(key string, def []string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return def
+	}
+	return out
+}
+
+// envInt64List reads a comma-separated list of IDs, dropping items that don't parse
+func envInt64List(key string) []int64 {
+	var out []int64
+	for _, item := range envList(key, nil) {
+		if v, err := strconv.ParseInt(item, 10, 64); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envFloat(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"aika/internal/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exportHeaders are the canonical just columns written by -export
+var exportHeaders = []string{"id_user", "userName", "dataRegistred", "created_at"}
+
+type exportOptions struct {
+	// Dir is where just_users_export_<timestamp>.xlsx is created
+	Dir string
+	// Since is the first dataRegistred kept and Until the first one past the
+	// range; zero means unbounded
+	Since, Until time.Time
+	Progress     bool
+}
+
+// parseDateFlag reads a -since/-until value: a date or a full registration timestamp.
+// With end set the result is just past the value, so -until 2024-12-31 keeps the whole day.
+func parseDateFlag(name, v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, ok := repository.ParseRegDate(v)
+	if !ok {
+		return time.Time{}, fmt.Errorf("-%s: unparseable date %q (want YYYY-MM-DD or %q)", name, v, repository.RegDateLayout)
+	}
+	if end {
+		if len(strings.TrimSpace(v)) == len(time.DateOnly) {
+			return t.AddDate(0, 0, 1), nil
+		}
+		return t.Add(time.Second), nil
+	}
+	return t, nil
+}
+
+// exportJustToXLSX writes the just table, oldest first, to a new xlsx and returns its path.
+// Rows go through excelize's StreamWriter, so memory stays flat however big the table is.
+// The date filter runs on the parsed dataRegistred, not on the raw text, because older
+// rows still hold it in several formats; rows whose date cannot be parsed are left out
+// whenever a bound is set.
+func exportJustToXLSX(ctx context.Context, db *sql.DB, opts exportOptions) (string, int, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("create %s: %w", opts.Dir, err)
+	}
+	path := filepath.Join(opts.Dir, fmt.Sprintf("just_users_export_%s.xlsx", time.Now().Format("20060102_150405")))
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "just"
+	f.SetSheetName("Sheet1", sheet)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return "", 0, err
+	}
+	sw.SetColWidth(1, len(exportHeaders), 22)
+	header := make([]interface{}, len(exportHeaders))
+	for i, h := range exportHeaders {
+		header[i] = h
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return "", 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT id_user, userName, dataRegistred, COALESCE(created_at, '') FROM just ORDER BY created_at, id`)
+	if err != nil {
+		return "", 0, fmt.Errorf("query just: %w", err)
+	}
+	defer rows.Close()
+
+	filtered := !opts.Since.IsZero() || !opts.Until.IsZero()
+	var written, read, undated int
+	for rows.Next() {
+		var userID int64
+		var userName, dataReg, createdAt string
+		if err := rows.Scan(&userID, &userName, &dataReg, &createdAt); err != nil {
+			return "", 0, fmt.Errorf("scan just: %w", err)
+		}
+		read++
+		if opts.Progress && read%progressEvery == 0 {
+			log.Printf("… %d rows read, %d written", read, written)
+		}
+		if filtered {
+			t, ok := repository.ParseRegDate(dataReg)
+			if !ok {
+				undated++
+				continue
+			}
+			if (!opts.Since.IsZero() && t.Before(opts.Since)) || (!opts.Until.IsZero() && !t.Before(opts.Until)) {
+				continue
+			}
+		}
+		written++
+		cell, _ := excelize.CoordinatesToCellName(1, written+1)
+		if err := sw.SetRow(cell, []interface{}{userID, userName, dataReg, createdAt}); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, fmt.Errorf("read just: %w", err)
+	}
+	if undated > 0 {
+		log.Printf("Left out %d rows with an unparseable dataRegistred", undated)
+	}
+
+	if err := sw.Flush(); err != nil {
+		return "", 0, err
+	}
+	if err := f.SaveAs(path); err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, written, nil
+}
@@ -0,0 +1,84 @@
+package domain
+
+import "time"
+
+// Broadcast run statuses
+const (
+	BroadcastRunning   = "running"
+	BroadcastCompleted = "completed"
+	BroadcastCancelled = "cancelled"
+	BroadcastDropped   = "dropped"
+)
+
+// BroadcastPayload is the message an admin composed for a broadcast.
+// Location, venue, contact and dice messages carry their data in dedicated fields rather than in Caption.
+type BroadcastPayload struct {
+	Type      string  `json:"type"`
+	FileID    string  `json:"file_id,omitempty"`
+	Caption   string  `json:"caption,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Phone     string  `json:"phone,omitempty"`
+	FirstName string  `json:"first_name,omitempty"`
+	LastName  string  `json:"last_name,omitempty"`
+	// Title and Address describe a venue
+	Title   string `json:"title,omitempty"`
+	Address string `json:"address,omitempty"`
+	// Emoji picks the dice kind: 🎲, 🎯, 🏀, ⚽, 🎳 or 🎰
+	Emoji string `json:"emoji,omitempty"`
+	// Items holds the album members of a "media_group" payload
+	Items []BroadcastMediaItem `json:"items,omitempty"`
+	// Unprotected lets recipients forward and save the message. It is inverted so
+	// that payloads stored before it existed keep the protected default.
+	Unprotected bool `json:"unprotected,omitempty"`
+}
+
+// BroadcastMediaItem is one photo, video, document or audio of an album
+type BroadcastMediaItem struct {
+	Type    string `json:"type"`
+	FileID  string `json:"file_id"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// Scheduled broadcast statuses
+const (
+	ScheduledPending   = "pending"
+	ScheduledRunning   = "running"
+	ScheduledSent      = "sent"
+	ScheduledFailed    = "failed"
+	ScheduledCancelled = "cancelled"
+)
+
+// ScheduledBroadcast is a broadcast queued to start at RunAt
+type ScheduledBroadcast struct {
+	ID       int64
+	AdminID  int64
+	Audience string
+	Payload  BroadcastPayload
+	RunAt    time.Time
+	Status   string
+	Error    string
+}
+
+// BroadcastTemplate is a saved broadcast message an admin can send again by name
+type BroadcastTemplate struct {
+	ID        int64
+	Name      string
+	Payload   BroadcastPayload
+	CreatedBy int64
+}
+
+// BroadcastRun is one admin broadcast. NextIndex is the position in the
+// snapshotted recipient list the next send starts from.
+type BroadcastRun struct {
+	ID        int64
+	AdminID   int64
+	Audience  string
+	Payload   BroadcastPayload
+	Total     int
+	NextIndex int
+	Sent      int
+	Failed    int
+	Status    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,10 @@
+package domain
+
+// RelayedMessage is a message the anonymous chat relayed, with the copies its
+// delete button removes on both sides
+type RelayedMessage struct {
+	SenderID      int64 `json:"sender_id"`
+	SenderMsgIDs  []int `json:"sender_msg_ids"`
+	PartnerID     int64 `json:"partner_id"`
+	PartnerMsgIDs []int `json:"partner_msg_ids"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// ReceivedLike is a profile that liked the current user
+type ReceivedLike struct {
+	User    User
+	Mutual  bool
+	LikedAt time.Time
+}
+
+// SkipStats is how often a profile was passed on compared to how often it was liked
+type SkipStats struct {
+	Skips int
+	Likes int
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Order statuses
+const (
+	// OrderNew is an order whose receipt an admin still has to check
+	OrderNew = "new"
+)
+
+// Order is a purchase placed through the /order flow
+type Order struct {
+	ID     int64
+	UserID int64 // Telegram ID
+	Count  int
+	// Amount is Count times the unit price at the time of the order, in tenge
+	Amount  int
+	Contact string
+	// ReceiptType is "photo" or "document", the message type the receipt came as
+	ReceiptType   string
+	ReceiptFileID string
+	Status        string
+	CreatedAt     time.Time
+}
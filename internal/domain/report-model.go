@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Report statuses
+const (
+	ReportPending   = "pending"
+	ReportBanned    = "banned"
+	ReportDismissed = "dismissed"
+)
+
+// Report is a user's complaint about a profile or a message, waiting for an admin
+type Report struct {
+	ID             int64
+	ReporterTgID   int64
+	ReportedUserID string // users.id
+	ReportedTgID   int64
+	Reason         string
+	// Context is what the reporter attached, e.g. the offending message text
+	Context   string
+	Status    string
+	CreatedAt time.Time
+}
@@ -20,8 +20,29 @@ type User struct {
 	Longitude  *float64
 	AboutUser  string
 	AvatarPath string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	// AvatarWidth/AvatarHeight are the processed avatar size in pixels (0 when unknown)
+	AvatarWidth  int
+	AvatarHeight int
+	// HideAge/HideAbout/HideDistance hide those fields from viewers who aren't a match
+	HideAge      bool
+	HideAbout    bool
+	HideDistance bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// HidesAny reports whether any profile field is hidden from non-matches
+func (u *User) HidesAny() bool {
+	return u.HideAge || u.HideAbout || u.HideDistance
+}
+
+// UserPreferences are a user's remembered nearby filters; nil fields are unset
+type UserPreferences struct {
+	UserID   int64 // Telegram ID
+	Sex      string
+	AgeMin   *int
+	AgeMax   *int
+	RadiusKm *float64
 }
 
 type UserState struct {
@@ -30,4 +51,24 @@ type UserState struct {
 	Count         int    `json:"count"`
 	Contact       string `json:"contact"`
 	IsPaid        bool   `json:"is_paid"`
+
+	// Protected is the ProtectContent choice for the broadcast being composed;
+	// the broadcast menu starts it at true
+	Protected bool `json:"protected"`
+	// Pending is the composed broadcast waiting for the admin's confirmation
+	Pending *BroadcastPayload `json:"pending,omitempty"`
+
+	// Receipt of the order being placed, set once IsPaid is
+	ReceiptType   string `json:"receipt_type,omitempty"`
+	ReceiptFileID string `json:"receipt_file_id,omitempty"`
+}
+
+// FeaturedCandidate is a profile considered for the featured carousel
+type FeaturedCandidate struct {
+	User  User
+	Likes int
+	Skips int
+	// Verified is set by an admin; Boosted while users.boosted_until is in the future
+	Verified bool
+	Boosted  bool
 }
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+const (
+	ctxRequestIDKey ctxKey = "aika_request_id"
+	ctxLoggerKey    ctxKey = "aika_logger"
+)
+
+// requestIDMiddleware tags every request with an id: a UUID sent by a proxy in
+// X-Request-Id is kept, anything else is replaced by a new one. The id is echoed in
+// the response header and stored in the context together with a logger carrying it.
+func (h *Handler) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if _, err := uuid.Parse(id); err != nil {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		fields := []zap.Field{zap.String("request_id", id)}
+		if tgID, err := h.verifiedTGID(r); err == nil {
+			fields = append(fields, zap.Int64("tg_id", tgID))
+		}
+		ctx := context.WithValue(r.Context(), ctxRequestIDKey, id)
+		ctx = context.WithValue(ctx, ctxLoggerKey, h.logger.With(fields...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestLogger returns the request-scoped logger stored by requestIDMiddleware, or fallback
+func requestLogger(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(ctxLoggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *statusRecorder) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (Flush, deadlines)
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// accessLogMiddleware logs one line per request at cfg.AccessLogLevel; "off" disables it
+func (h *Handler) accessLogMiddleware(next http.Handler) http.Handler {
+	if h.cfg.AccessLogLevel == "off" {
+		return next
+	}
+	level, err := zapcore.ParseLevel(h.cfg.AccessLogLevel)
+	if err != nil {
+		h.logger.Warn("access log: unknown level, using info", zap.String("level", h.cfg.AccessLogLevel))
+		level = zapcore.InfoLevel
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// the request logger already carries request_id and tg_id
+		ce := requestLogger(r.Context(), h.logger).Check(level, "http request")
+		if ce == nil {
+			return
+		}
+		ce.Write(
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rec.status),
+			zap.Int("size", rec.size),
+			zap.Duration("duration", time.Since(start)),
+		)
+	})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogFields(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	core, logs := observer.New(zapcore.InfoLevel)
+	h.logger = zap.New(core)
+	h.cfg.AccessLogLevel = "info"
+	handler := h.requestIDMiddleware(h.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/like?x=1", nil)
+	signAs(r, 42)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if rec.Header().Get(requestIDHeader) == "" {
+		t.Fatal("no request id in the response header")
+	}
+	entries := logs.FilterMessage("http request").All()
+	if len(entries) != 1 {
+		t.Fatalf("%d access log lines, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]interface{}{
+		"method":     "POST",
+		"path":       "/api/like",
+		"status":     int64(http.StatusTeapot),
+		"size":       int64(len("short and stout")),
+		"request_id": rec.Header().Get(requestIDHeader),
+		"tg_id":      int64(42),
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v (%T), want %v", k, fields[k], fields[k], v)
+		}
+	}
+	if d, ok := fields["duration"].(time.Duration); !ok || d < 5*time.Millisecond {
+		t.Errorf("duration = %v, want at least 5ms", fields["duration"])
+	}
+}
+
+func TestAccessLogLevel(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	core, logs := observer.New(zapcore.DebugLevel)
+	h.logger = zap.New(core)
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	for _, tt := range []struct {
+		level string
+		want  zapcore.Level
+		lines int
+	}{
+		{"debug", zapcore.DebugLevel, 1},
+		{"warn", zapcore.WarnLevel, 1},
+		{"off", 0, 0},
+	} {
+		h.cfg.AccessLogLevel = tt.level
+		h.accessLogMiddleware(ok).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		entries := logs.TakeAll()
+		if len(entries) != tt.lines {
+			t.Fatalf("%s: %d lines, want %d", tt.level, len(entries), tt.lines)
+		}
+		if tt.lines > 0 && entries[0].Level != tt.want {
+			t.Errorf("%s: logged at %s", tt.level, entries[0].Level)
+		}
+	}
+}
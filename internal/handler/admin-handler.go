@@ -3,31 +3,40 @@ package handler
 import (
 	"aika/internal/domain"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
-	"sync/atomic"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
-func (h *Handler) AdminHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+// IsAdmin reports whether userID may use the admin panel
+func (h *Handler) IsAdmin(userID int64) bool {
+	return slices.Contains(h.cfg.AdminIDs, userID)
+}
 
-	var adminId int64
-	switch update.Message.From.ID {
-	case h.cfg.AdminID:
-		adminId = h.cfg.AdminID
-	default:
-		h.logger.Warn("SomeOne is trying to get admin root", zap.Any("user_id", update.Message.From.ID))
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: h.cfg.AdminID,
-			Text:   fmt.Sprintf("SomeOne is trying to get admin root, user_id: %d", update.Message.From.ID),
-		})
+// requireAdmin lets admins through; anyone else is logged and reported to the primary admin
+func (h *Handler) requireAdmin(ctx context.Context, b *bot.Bot, userID int64) bool {
+	if h.IsAdmin(userID) {
+		return true
+	}
+	h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", userID))
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: h.cfg.AdminID,
+		Text:   fmt.Sprintf("SomeOne is trying to get admin root, user_id: %d", userID),
+	})
+	return false
+}
+
+func (h *Handler) AdminHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
 	}
 
 	h.logger.Info("Admin handler", zap.Any("update", update))
@@ -47,6 +56,16 @@ func (h *Handler) AdminHandler(ctx context.Context, b *bot.Bot, update *models.U
 				{Text: "📢 Хабарлама (Messages)"},
 				{Text: "❌ Жабу (Close)"},
 			},
+			{
+				{Text: "📊 Экспорт (Тіркелгендер)"},
+			},
+			{
+				{Text: "📈 Статистика"},
+				{Text: "📄 Соңғы есеп"},
+			},
+			{
+				{Text: "🚩 Шағымдар"},
+			},
 		},
 		ResizeKeyboard:  true,
 		Selective:       true,
@@ -72,8 +91,17 @@ func (h *Handler) AdminHandler(ctx context.Context, b *bot.Bot, update *models.U
 	case "📢 Хабарлама (Messages)":
 		h.handleBroadcastMenu(ctx, b, update)
 
+	case "📊 Экспорт (Тіркелгендер)":
+		h.askExportFormat(ctx, b, update, "just")
+	case "📈 Статистика":
+		h.handleStatistics(ctx, b, update)
+	case "📄 Соңғы есеп":
+		h.handleLastReport(ctx, b, update)
+	case "🚩 Шағымдар":
+		h.handleReports(ctx, b, update)
+
 	case "❌ Жабу (Close)":
-		h.handleCloseAdmin(ctx, b)
+		h.handleCloseAdmin(ctx, b, adminId)
 	default:
 		if state != nil && state.State == stateAdminPanel {
 			_, err := b.SendMessage(ctx, &bot.SendMessageParams{
@@ -89,17 +117,9 @@ func (h *Handler) AdminHandler(ctx context.Context, b *bot.Bot, update *models.U
 }
 
 func (h *Handler) SendMessage(ctx context.Context, b *bot.Bot, update *models.Update) {
-
-	var adminId int64
-	switch update.Message.From.ID {
-	case h.cfg.AdminID:
-		adminId = h.cfg.AdminID
-	default:
-		h.logger.Warn("SomeOne is trying to get admin root", zap.Any("user_id", update.Message.From.ID))
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: h.cfg.AdminID,
-			Text:   fmt.Sprintf("SomeOne is trying to get admin root, user_id: %d", update.Message.From.ID),
-		})
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
 	}
 
 	adminState, errRedis := h.redisClient.GetUserState(ctx, adminId)
@@ -120,16 +140,22 @@ func (h *Handler) SendMessage(ctx context.Context, b *bot.Bot, update *models.Up
 
 	switch update.Message.Text {
 	case "📢 Барлығына жіберу":
-		h.startBroadcast(ctx, b, update, "all")
+		h.startBroadcast(ctx, b, update, audienceAll)
+		return
+	case "👤 Анкета толтырғандарға":
+		h.startBroadcast(ctx, b, update, audienceRegistered)
+		return
+	case "🟢 Белсенділерге (30 күн)":
+		h.startBroadcast(ctx, b, update, audienceActive)
 		return
-	case "🛍 Клиенттерге жіберу":
-		h.startBroadcast(ctx, b, update, "clients")
+	case "❤️ Лайк басқандарға":
+		h.startBroadcast(ctx, b, update, audienceLikers)
 		return
-	case "🎲 Лото қатысушыларына":
-		h.startBroadcast(ctx, b, update, "loto")
+	case templatesButton:
+		h.handleTemplates(ctx, b, adminId)
 		return
-	case "👥 Тіркелгендерге":
-		h.startBroadcast(ctx, b, update, "just")
+	case scheduledButton:
+		h.handleScheduledList(ctx, b, adminId)
 		return
 	case "🔙 Артқа (Back)":
 		if err := h.redisClient.DeleteUserState(ctx, adminId); err != nil {
@@ -151,23 +177,23 @@ func (h *Handler) SendMessage(ctx context.Context, b *bot.Bot, update *models.Up
 		return
 	}
 
-	broadcastType := ""
-	if adminState != nil {
-		broadcastType = adminState.BroadCastType
+	payload := h.parseMessage(update.Message)
+	if payload.Type == "" {
+		// the admin stays in broadcast state and can send something else
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: adminId,
+			Text:   "⚠️ Бұл хабарлама түріне қолдау жоқ. Мәтін, фото, видео, файл, аудио, GIF, стикер, ойын сүйегі, локация, орын немесе контакт жіберіңіз.",
+		})
+		return
 	}
-	h.logger.Info("Starting broadcast", zap.String("type", broadcastType))
 
-	msgType, fileId, caption := h.parseMessage(update.Message)
-
-	var userIds []int64
-	var err error
+	h.previewBroadcast(ctx, b, adminId, adminState, payload)
+}
 
-	switch broadcastType {
-	case "all":
-		userIds, err = h.userRepo.GetAllJustUserIDs(ctx)
-	default:
-		err = fmt.Errorf("unknown broadcast type: %s", broadcastType)
-	}
+// launchBroadcast snapshots the audience and sends payload to it. The admin is told
+// about failures; the error is returned for callers that record the outcome.
+func (h *Handler) launchBroadcast(ctx context.Context, b *bot.Bot, adminId int64, broadcastType string, payload domain.BroadcastPayload) error {
+	userIds, err := h.broadcastAudience(ctx, broadcastType)
 
 	if err != nil {
 		h.logger.Error("Failed to load user ids", zap.Error(err))
@@ -178,11 +204,9 @@ func (h *Handler) SendMessage(ctx context.Context, b *bot.Bot, update *models.Up
 		if sendErr != nil {
 			h.logger.Error("Failed to send error message", zap.Error(sendErr))
 		}
-		return
+		return fmt.Errorf("load audience: %w", err)
 	}
 
-	userIds = userIds[1:3]
-
 	if len(userIds) == 0 {
 		_, sendErr := b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: adminId,
@@ -191,108 +215,159 @@ func (h *Handler) SendMessage(ctx context.Context, b *bot.Bot, update *models.Up
 		if sendErr != nil {
 			h.logger.Error("Failed to send no users message", zap.Error(sendErr))
 		}
+		return errors.New("no recipients")
+	}
+
+	if !h.beginBroadcast() {
+		h.replyShuttingDown(ctx, b, adminId)
+		return errors.New("shutting down")
+	}
+
+	run := &domain.BroadcastRun{
+		AdminID:  adminId,
+		Audience: broadcastType,
+		Payload:  payload,
+	}
+	// snapshot the recipients so a resumed run walks the same list in the same order
+	if err := h.broadcastRepo.CreateRun(ctx, run, userIds); err != nil {
+		h.logger.Error("Failed to create broadcast run", zap.Error(err))
+		h.broadcasts.Done()
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: adminId,
+			Text:   "❌ Қате: хабарлама жіберуді бастау мүмкін болмады",
+		})
+		return fmt.Errorf("create run: %w", err)
+	}
+
+	return h.runBroadcast(ctx, b, run, userIds)
+}
+
+const (
+	broadcastCancelData = "bcancel"
+	// broadcastBatchSize is how many sends go out between cancel-flag checks (about a second at 30 msg/s)
+	broadcastBatchSize = 30
+)
+
+// BroadcastCancelHandler handles the "⛔️ Тоқтату" button on the broadcast progress message
+func (h *Handler) BroadcastCancelHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+	adminId := update.CallbackQuery.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", adminId))
 		return
 	}
 
-	statusMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: adminId,
-		Text:   fmt.Sprintf("📤 Хабарлама жіберіліп жатыр...\n👥 Жалпы: %d пайдаланушы", len(userIds)),
+	text := "⛔️ Тоқтатылып жатыр..."
+	if err := h.redisClient.SetBroadcastCancel(ctx, adminId); err != nil {
+		h.logger.Error("Failed to set broadcast cancel flag", zap.Error(err))
+		text = "❌ Тоқтату мүмкін болмады"
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
 	})
+}
+
+const broadcastProtectData = "bprotect"
+
+// broadcastProtected is the admin's current ProtectContent choice; without a
+// broadcast in progress it is the protected default
+func (h *Handler) broadcastProtected(ctx context.Context, adminId int64) bool {
+	state, err := h.redisClient.GetUserState(ctx, adminId)
 	if err != nil {
-		h.logger.Error("Failed to send status message", zap.Error(err))
-		return
+		h.logger.Error("Failed to get admin state from Redis", zap.Error(err))
 	}
+	if state == nil || state.State != stateBroadcast {
+		return true
+	}
+	return state.Protected
+}
 
-	limiter := rate.NewLimiter(rate.Every(time.Second/30), 1)
+func protectLabel(protected bool) string {
+	if protected {
+		return "🔒 Қорғау: қосулы"
+	}
+	return "🔓 Қорғау: өшірулі"
+}
 
-	var wg sync.WaitGroup
-	var successCount, failedCount int64
-	for i := 0; i < len(userIds); i++ {
-		if err := limiter.Wait(ctx); err != nil {
-			h.logger.Error("Rate limiter wait error", zap.Error(err))
-			break
-		}
-		wg.Add(1)
-		go func(userId int64) {
-			defer wg.Done()
-			if err := h.sendToUser(ctx, b, userId, msgType, fileId, caption); err != nil {
-				atomic.AddInt64(&failedCount, 1)
-				h.logger.Warn("Failed to send message to user", zap.Int64("user", userId), zap.Error(err))
-			} else {
-				atomic.AddInt64(&successCount, 1)
-			}
-		}(userIds[i])
-	}
-
-	wg.Wait()
-	// Send final results
-	finalSuccess := atomic.LoadInt64(&successCount)
-	finalFailed := atomic.LoadInt64(&failedCount)
-	successRate := float64(finalSuccess) / float64(len(userIds)) * 100
-
-	finalText := fmt.Sprintf(`✅ ХАБАРЛАМА ЖІБЕРУ АЯҚТАЛДЫ!
-
-👥 Жалпы: %d пайдаланушы
-✅ Сәтті: %d
-❌ Қате: %d
-📊 Сәттілік: %.1f%%
-
-📋 Хабарлама түрі: %s
-⏰ Уақыт: %s`,
-		len(userIds),
-		finalSuccess,
-		finalFailed,
-		successRate,
-		h.getBroadcastTypeName(broadcastType),
-		time.Now().Format("2006-01-02 15:04:05"))
-
-	if statusMsg != nil {
-		b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:    adminId,
-			MessageID: statusMsg.ID,
-			Text:      finalText,
-		})
+func protectToggleText(protected bool) (string, models.InlineKeyboardMarkup) {
+	text, button := "🔒 Қорғау қосулы: алушылар хабарламаны бөлісе де, сақтай да алмайды.", "🔓 Бөлісуге рұқсат беру"
+	if !protected {
+		text, button = "🔓 Қорғау өшірулі: алушылар хабарламаны бөлісіп, сақтай алады.", "🔒 Қорғауды қосу"
+	}
+	return text, models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{{{Text: button, CallbackData: broadcastProtectData}}},
 	}
+}
 
-	// Log broadcast results
-	h.logger.Info("Broadcast completed",
-		zap.String("type", broadcastType),
-		zap.Int("total", len(userIds)),
-		zap.Int64("success", finalSuccess),
-		zap.Int64("failed", finalFailed),
-		zap.Float64("success_rate", successRate))
+// sendProtectToggle shows the ProtectContent switch for the broadcast being composed
+func (h *Handler) sendProtectToggle(ctx context.Context, b *bot.Bot, adminId int64, protected bool) {
+	text, kb := protectToggleText(protected)
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text, ReplyMarkup: kb}); err != nil {
+		h.logger.Error("Failed to send protect toggle", zap.Error(err))
+	}
+}
 
-	if err := h.redisClient.DeleteUserState(ctx, adminId); err != nil {
-		h.logger.Error("Failed to delete admin state from Redis", zap.Error(err))
+// BroadcastProtectHandler flips ProtectContent for the broadcast being composed
+func (h *Handler) BroadcastProtectHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	adminId := cq.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", adminId))
+		return
+	}
+
+	state, err := h.redisClient.GetUserState(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to get admin state from Redis", zap.Error(err))
+	}
+	if state == nil || state.State != stateBroadcast {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "Хабарлама жазылып жатқан жоқ"})
+		return
+	}
+	state.Protected = !state.Protected
+	if err := h.redisClient.SaveUserState(ctx, adminId, state); err != nil {
+		h.logger.Error("Failed to save broadcast state to Redis", zap.Error(err))
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "❌ Қате"})
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID})
+
+	if msg := cq.Message.Message; msg != nil {
+		text, kb := protectToggleText(state.Protected)
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{ChatID: msg.Chat.ID, MessageID: msg.ID, Text: text, ReplyMarkup: kb})
 	}
-	time.Sleep(2 * time.Second)
-	h.AdminHandler(ctx, b, &models.Update{
-		Message: &models.Message{
-			From: &models.User{ID: adminId},
-			Text: "/admin",
-		},
-	})
 }
 
 // Helper methods for admin panel
 func (h *Handler) handleBroadcastMenu(ctx context.Context, b *bot.Bot, update *models.Update) {
-	var adminId int64
-	switch update.Message.From.ID {
-	case h.cfg.AdminID:
-		adminId = h.cfg.AdminID
-	default:
-		h.logger.Warn("SomeOne is trying to get admin root", zap.Any("user_id", update.Message.From.ID))
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: h.cfg.AdminID,
-			Text:   fmt.Sprintf("SomeOne is trying to get admin root, user_id: %d", update.Message.From.ID),
-		})
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
 	}
 
 	// Get counts for each category
-	allCount, _ := h.userRepo.GetAllJustUserIDs(ctx)
+	counts := make(map[string]int, 4)
+	for _, audience := range []string{audienceAll, audienceRegistered, audienceActive, audienceLikers} {
+		ids, err := h.broadcastAudience(ctx, audience)
+		if err != nil {
+			h.logger.Error("Failed to count broadcast audience", zap.String("audience", audience), zap.Error(err))
+		}
+		counts[audience] = len(ids)
+	}
+	optOutCount, err := h.userRepo.CountBroadcastOptOut(ctx)
+	if err != nil {
+		h.logger.Error("Failed to count broadcast opt-outs", zap.Error(err))
+	}
 
 	broadcastState := &domain.UserState{
-		State: stateBroadcast,
+		State:     stateBroadcast,
+		Protected: true,
 	}
 	if err := h.redisClient.SaveUserState(ctx, adminId, broadcastState); err != nil {
 		h.logger.Error("Failed to save broadcast state to Redis", zap.Error(err))
@@ -302,6 +377,14 @@ func (h *Handler) handleBroadcastMenu(ctx context.Context, b *bot.Bot, update *m
 		Keyboard: [][]models.KeyboardButton{
 			{
 				{Text: "📢 Барлығына жіберу"},
+				{Text: "👤 Анкета толтырғандарға"},
+			},
+			{
+				{Text: "🟢 Белсенділерге (30 күн)"},
+				{Text: "❤️ Лайк басқандарға"},
+			},
+			{
+				{Text: "🔙 Артқа (Back)"},
 			},
 		},
 		ResizeKeyboard:  true,
@@ -312,16 +395,17 @@ func (h *Handler) handleBroadcastMenu(ctx context.Context, b *bot.Bot, update *m
 
 📊 Қол жетімді аудитория:
 • 👥 Барлық пайдаланушылар: %d
-• 🛍 Клиенттер: %d  
-• 🎲 Лото қатысушылары: %d
-• 📅 Тіркелгендер: %d
+• 👤 Анкета толтырғандар: %d
+• 🟢 Соңғы 30 күнде белсенділер: %d
+• ❤️ Лайк басқандар: %d
+• 🔕 Бас тартқандар: %d
 
 ⚠️ Ескерту: Хабарлама барлық таңдалған пайдаланушыларға жіберіледі. Сақ болыңыз!
 
 Қайсы топқа хабарлама жіберуді қалайсыз?`,
-		len(allCount), len(allCount), len(allCount), len(allCount))
+		counts[audienceAll], counts[audienceRegistered], counts[audienceActive], counts[audienceLikers], optOutCount)
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:      adminId,
 		Text:        message,
 		ReplyMarkup: broadcastKeyboard,
@@ -329,25 +413,20 @@ func (h *Handler) handleBroadcastMenu(ctx context.Context, b *bot.Bot, update *m
 	if err != nil {
 		h.logger.Error("Failed to send broadcast menu", zap.Error(err))
 	}
+	h.sendProtectToggle(ctx, b, adminId, broadcastState.Protected)
 }
 
 func (h *Handler) startBroadcast(ctx context.Context, b *bot.Bot, update *models.Update, broadcastType string) {
-	var adminId int64
-	switch update.Message.From.ID {
-	case h.cfg.AdminID:
-		adminId = h.cfg.AdminID
-	default:
-		h.logger.Warn("SomeOne is trying to get admin root", zap.Any("user_id", update.Message.From.ID))
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: h.cfg.AdminID,
-			Text:   fmt.Sprintf("SomeOne is trying to get admin root, user_id: %d", update.Message.From.ID),
-		})
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
 	}
 
-	// Set admin to broadcast state
+	// Set admin to broadcast state, keeping the protect choice made in the menu
 	broadCastState := &domain.UserState{
 		State:         stateBroadcast,
 		BroadCastType: broadcastType,
+		Protected:     h.broadcastProtected(ctx, adminId),
 	}
 	if err := h.redisClient.SaveUserState(ctx, adminId, broadCastState); err != nil {
 		h.logger.Error("Failed to save broadcast state to Redis", zap.Error(err))
@@ -360,6 +439,7 @@ func (h *Handler) startBroadcast(ctx context.Context, b *bot.Bot, update *models
 		Text: fmt.Sprintf(`📝 ХАБАРЛАМА ЖАЗУ
 
 🎯 Мақсатты аудитория: %s
+%s
 
 💡 Қолдаулатын форматтар:
 • 📝 Мәтін хабарлама
@@ -368,10 +448,16 @@ func (h *Handler) startBroadcast(ctx context.Context, b *bot.Bot, update *models
 • 📎 Файл + мәтін
 • 🎵 Аудио
 • 🎬 GIF анимация
+• 🌟 Стикер
+• 🎲 Ойын сүйегі (dice)
+• 📍 Локация
+• 🏢 Орын (venue)
+• 👤 Контакт
 
-Хабарламаңызды жіберіңіз:`, targetDescription),
+Хабарламаңызды жіберіңіз немесе сақталған үлгіні таңдаңыз:`, targetDescription, protectLabel(broadCastState.Protected)),
 		ReplyMarkup: &models.ReplyKeyboardMarkup{
 			Keyboard: [][]models.KeyboardButton{
+				{{Text: templatesButton}, {Text: scheduledButton}},
 				{{Text: "🔙 Артқа (Back)"}},
 			},
 			ResizeKeyboard:  true,
@@ -385,27 +471,23 @@ func (h *Handler) startBroadcast(ctx context.Context, b *bot.Bot, update *models
 
 func (h *Handler) getBroadcastTypeName(broadcastType string) string {
 	switch broadcastType {
-	case "all":
+	case audienceAll:
 		return "Барлық пайдаланушылар"
-	case "clients":
-		return "Барлық клиенттер"
-	case "loto":
-		return "Лото қатысушылары"
-	case "just":
-		return "Тіркелген пайдаланушылар"
+	case audienceRegistered:
+		return "Анкета толтырғандар"
+	case audienceActive:
+		return "Соңғы 30 күнде белсенділер"
+	case audienceLikers:
+		return "Лайк басқандар"
 	default:
 		return "Белгісіз"
 	}
 }
 
-// sendExcelFile sends the Excel file to admin via Telegram
-func (h *Handler) sendExcelFile(ctx context.Context, b *bot.Bot, update *models.Update, filePath, caption string) {
-	var adminId int64
-	if update.Message.From.ID == h.cfg.AdminID {
-		adminId = h.cfg.AdminID
-	} else {
-		adminId = h.cfg.AdminID
-	}
+// sendExportFile sends an export file (xlsx or csv) to admin via Telegram.
+// Unless keep is set, the file is removed once Telegram has accepted the upload.
+func (h *Handler) sendExportFile(ctx context.Context, b *bot.Bot, update *models.Update, filePath, caption string, keep bool) {
+	adminId := update.Message.From.ID
 	// Check if file exists and get file info
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -425,7 +507,7 @@ func (h *Handler) sendExcelFile(ctx context.Context, b *bot.Bot, update *models.
 	// Send document
 	file, err := os.Open(filePath)
 	if err != nil {
-		h.logger.Error("Failed to open Excel file", zap.Error(err))
+		h.logger.Error("Failed to open export file", zap.Error(err))
 		return
 	}
 	defer file.Close()
@@ -433,39 +515,36 @@ func (h *Handler) sendExcelFile(ctx context.Context, b *bot.Bot, update *models.
 	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
 		ChatID:   adminId,
 		Document: &models.InputFileUpload{Filename: filepath.Base(filePath), Data: file},
-		//Caption:  caption + "\n\n📁 Файл: " + filepath.Base(filePath) + "\n📊 Өлшемі: " + formatFileSize(fileInfo.Size()),
+		Caption:  caption + "\n\n📁 Файл: " + filepath.Base(filePath),
 	})
 
 	if err != nil {
-		h.logger.Error("Failed to send Excel file", zap.Error(err), zap.String("file", filePath))
+		h.logger.Error("Failed to send export file", zap.Error(err), zap.String("file", filePath))
 		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: adminId,
-			Text:   "❌ Excel файлын жіберу мүмкін болмады. Файл жергілікті сақталды: " + filePath,
+			Text:   "❌ Экспорт файлын жіберу мүмкін болмады. Файл жергілікті сақталды: " + filePath,
 		})
-	} else {
-		h.logger.Info("Excel file sent successfully", zap.String("file", filePath))
-
-		// Optional: Delete file after successful send to save space
-		// Uncomment the lines below if you want to auto-delete files
-		/*
-			go func() {
-				time.Sleep(5 * time.Minute) // Wait 5 minutes then delete
-				if err := os.Remove(filePath); err != nil {
-					h.logger.Warn("Failed to delete Excel file", zap.Error(err))
-				}
-			}()
-		*/
+		return
+	}
+	h.logger.Info("Export file sent successfully", zap.String("file", filePath))
+	if keep || !h.cfg.ExcelDeleteAfterSend {
+		// the export janitor removes the file once ExcelRetention has passed
+		return
+	}
+	file.Close()
+	if err := os.Remove(filePath); err != nil {
+		h.logger.Warn("Failed to remove sent export file", zap.String("file", filePath), zap.Error(err))
 	}
 }
 
-func (h *Handler) handleCloseAdmin(ctx context.Context, b *bot.Bot) {
-	if err := h.redisClient.DeleteUserState(ctx, h.cfg.AdminID); err != nil {
+func (h *Handler) handleCloseAdmin(ctx context.Context, b *bot.Bot, adminId int64) {
+	if err := h.redisClient.DeleteUserState(ctx, adminId); err != nil {
 		h.logger.Error("Failed to delete admin state from Redis", zap.Error(err))
 	}
 
 	// Remove keyboard
 	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: h.cfg.AdminID,
+		ChatID: adminId,
 		Text:   "✅ Админ панелі жабылды",
 		ReplyMarkup: &models.ReplyKeyboardRemove{
 			RemoveKeyboard: true,
@@ -476,53 +555,125 @@ func (h *Handler) handleCloseAdmin(ctx context.Context, b *bot.Bot) {
 	}
 }
 
-// sendToUser отправляет одному пользователю указанное сообщение
-func (h *Handler) sendToUser(ctx context.Context, b *bot.Bot, chatID int64, msgType, fileID, caption string) error {
-	switch msgType {
+// sendToUser отправляет одному пользователю указанное сообщение;
+// ProtectContent включён, если p.Unprotected не задан
+func (h *Handler) sendToUser(ctx context.Context, b *bot.Bot, chatID int64, p domain.BroadcastPayload) error {
+	protect := !p.Unprotected
+	var err error
+	switch p.Type {
 	case "text":
-		_, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: caption, ProtectContent: true})
-		return err
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: p.Caption, ProtectContent: protect})
 	case "photo":
-		_, err := b.SendPhoto(ctx, &bot.SendPhotoParams{ChatID: chatID, Photo: &models.InputFileString{Data: fileID}, Caption: caption, ProtectContent: true})
-		return err
+		_, err = b.SendPhoto(ctx, &bot.SendPhotoParams{ChatID: chatID, Photo: &models.InputFileString{Data: p.FileID}, Caption: p.Caption, ProtectContent: protect})
 	case "video":
-		_, err := b.SendVideo(ctx, &bot.SendVideoParams{ChatID: chatID, Video: &models.InputFileString{Data: fileID}, Caption: caption, ProtectContent: true})
-		return err
+		_, err = b.SendVideo(ctx, &bot.SendVideoParams{ChatID: chatID, Video: &models.InputFileString{Data: p.FileID}, Caption: p.Caption, ProtectContent: protect})
 	case "document":
-		_, err := b.SendDocument(ctx, &bot.SendDocumentParams{ChatID: chatID, Document: &models.InputFileString{Data: fileID}, Caption: caption, ProtectContent: true})
-		return err
+		_, err = b.SendDocument(ctx, &bot.SendDocumentParams{ChatID: chatID, Document: &models.InputFileString{Data: p.FileID}, Caption: p.Caption, ProtectContent: protect})
 	case "video_note":
-		_, err := b.SendVideoNote(ctx, &bot.SendVideoNoteParams{ChatID: chatID, VideoNote: &models.InputFileString{Data: fileID}, ProtectContent: true})
-		return err
+		_, err = b.SendVideoNote(ctx, &bot.SendVideoNoteParams{ChatID: chatID, VideoNote: &models.InputFileString{Data: p.FileID}, ProtectContent: protect})
 	case "audio":
-		_, err := b.SendAudio(ctx, &bot.SendAudioParams{ChatID: chatID, Audio: &models.InputFileString{Data: fileID}, ProtectContent: true})
-		return err
+		_, err = b.SendAudio(ctx, &bot.SendAudioParams{ChatID: chatID, Audio: &models.InputFileString{Data: p.FileID}, ProtectContent: protect})
+	case "animation":
+		_, err = b.SendAnimation(ctx, &bot.SendAnimationParams{ChatID: chatID, Animation: &models.InputFileString{Data: p.FileID}, Caption: p.Caption, ProtectContent: protect})
+	case "sticker":
+		_, err = b.SendSticker(ctx, &bot.SendStickerParams{ChatID: chatID, Sticker: &models.InputFileString{Data: p.FileID}, ProtectContent: protect})
+	case "dice":
+		// every recipient gets their own roll
+		_, err = b.SendDice(ctx, &bot.SendDiceParams{ChatID: chatID, Emoji: p.Emoji, ProtectContent: protect})
+	case "location":
+		_, err = b.SendLocation(ctx, &bot.SendLocationParams{ChatID: chatID, Latitude: p.Latitude, Longitude: p.Longitude, ProtectContent: protect})
+	case "venue":
+		_, err = b.SendVenue(ctx, &bot.SendVenueParams{ChatID: chatID, Latitude: p.Latitude, Longitude: p.Longitude, Title: p.Title, Address: p.Address, ProtectContent: protect})
+	case "contact":
+		_, err = b.SendContact(ctx, &bot.SendContactParams{ChatID: chatID, PhoneNumber: p.Phone, FirstName: p.FirstName, LastName: p.LastName, ProtectContent: protect})
+	case "media_group":
+		_, err = b.SendMediaGroup(ctx, &bot.SendMediaGroupParams{ChatID: chatID, Media: inputMedia(p.Items), ProtectContent: protect})
 	default:
-		return nil
+		err = fmt.Errorf("unsupported message type %q", p.Type)
+	}
+	if isUnreachable(err) {
+		h.markUnreachable(ctx, chatID)
 	}
+	return err
 }
 
-func (h *Handler) parseMessage(msg *models.Message) (msgType, fileId, caption string) {
+// MediaTestHandler handles /mediatest: sends one sample of every broadcast type to the admin
+// and reports which ones went through.
+func (h *Handler) MediaTestHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+	adminId := update.Message.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Any("user_id", adminId))
+		return
+	}
+
+	report := "🧪 Медиа тест нәтижесі:\n"
+	for _, msgType := range []string{"text", "photo", "video", "document", "audio", "animation", "sticker", "dice"} {
+		fileID := ""
+		if msgType != "text" && msgType != "dice" {
+			fileID = h.cfg.MediaTestFiles[msgType]
+			if fileID == "" {
+				report += fmt.Sprintf("\n⏭ %s: үлгі файл жоқ (MEDIATEST_%s)", msgType, strings.ToUpper(msgType))
+				continue
+			}
+		}
+		p := domain.BroadcastPayload{Type: msgType, FileID: fileID, Caption: fmt.Sprintf("🧪 Тест: %s", msgType), Emoji: "🎲"}
+		if err := h.sendToUser(ctx, b, adminId, p); err != nil {
+			h.logger.Warn("mediatest: send failed", zap.String("type", msgType), zap.Error(err))
+			report += fmt.Sprintf("\n❌ %s: %s", msgType, err.Error())
+			continue
+		}
+		report += fmt.Sprintf("\n✅ %s", msgType)
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: report}); err != nil {
+		h.logger.Error("Failed to send mediatest report", zap.Error(err))
+	}
+}
+
+// parseMessage turns the admin's message into a broadcast payload; Type is empty for unsupported messages
+func (h *Handler) parseMessage(msg *models.Message) domain.BroadcastPayload {
 	switch {
 	case msg.Text != "":
-		return "text", "", msg.Text
+		return domain.BroadcastPayload{Type: "text", Caption: msg.Text}
 	case len(msg.Photo) > 0:
-		return "photo", msg.Photo[len(msg.Photo)-1].FileID, msg.Caption
+		return domain.BroadcastPayload{Type: "photo", FileID: msg.Photo[len(msg.Photo)-1].FileID, Caption: msg.Caption}
 	case msg.Video != nil:
-		return "video", msg.Video.FileID, msg.Caption
+		return domain.BroadcastPayload{Type: "video", FileID: msg.Video.FileID, Caption: msg.Caption}
+	// GIFs also arrive with Document set, so animation has to be checked first
+	case msg.Animation != nil:
+		return domain.BroadcastPayload{Type: "animation", FileID: msg.Animation.FileID, Caption: msg.Caption}
 	case msg.Document != nil:
-		return "document", msg.Document.FileID, msg.Caption
+		return domain.BroadcastPayload{Type: "document", FileID: msg.Document.FileID, Caption: msg.Caption}
 	case msg.VideoNote != nil:
-		return "video_note", msg.VideoNote.FileID, msg.Caption
+		return domain.BroadcastPayload{Type: "video_note", FileID: msg.VideoNote.FileID}
 	case msg.Audio != nil:
-		return "audio", msg.Audio.FileID, msg.Caption
+		return domain.BroadcastPayload{Type: "audio", FileID: msg.Audio.FileID, Caption: msg.Caption}
+	case msg.Sticker != nil:
+		return domain.BroadcastPayload{Type: "sticker", FileID: msg.Sticker.FileID}
+	case msg.Dice != nil:
+		return domain.BroadcastPayload{Type: "dice", Emoji: msg.Dice.Emoji}
+	// venues also arrive with Location set
+	case msg.Venue != nil:
+		return domain.BroadcastPayload{
+			Type:      "venue",
+			Latitude:  msg.Venue.Location.Latitude,
+			Longitude: msg.Venue.Location.Longitude,
+			Title:     msg.Venue.Title,
+			Address:   msg.Venue.Address,
+		}
 	case msg.Location != nil:
-		locationStr := fmt.Sprintf("%.6f,%.6f", msg.Location.Latitude, msg.Location.Longitude)
-		return "location", "", locationStr
+		return domain.BroadcastPayload{Type: "location", Latitude: msg.Location.Latitude, Longitude: msg.Location.Longitude}
 	case msg.Contact != nil:
-		contactStr := fmt.Sprintf("%s: %s", msg.Contact.FirstName, msg.Contact.PhoneNumber)
-		return "contact", "", contactStr
+		return domain.BroadcastPayload{
+			Type:      "contact",
+			Phone:     msg.Contact.PhoneNumber,
+			FirstName: msg.Contact.FirstName,
+			LastName:  msg.Contact.LastName,
+		}
 	default:
-		return "", "", ""
+		return domain.BroadcastPayload{}
 	}
 }
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBroadcastProtectContent(t *testing.T) {
+	payloads := map[string]domain.BroadcastPayload{
+		"sendMessage":    {Type: "text", Caption: "hello"},
+		"sendPhoto":      {Type: "photo", FileID: "f"},
+		"sendVideo":      {Type: "video", FileID: "f"},
+		"sendDocument":   {Type: "document", FileID: "f"},
+		"sendVideoNote":  {Type: "video_note", FileID: "f"},
+		"sendAudio":      {Type: "audio", FileID: "f"},
+		"sendAnimation":  {Type: "animation", FileID: "f"},
+		"sendSticker":    {Type: "sticker", FileID: "f"},
+		"sendDice":       {Type: "dice", Emoji: "🎲"},
+		"sendLocation":   {Type: "location", Latitude: 43.2, Longitude: 76.9},
+		"sendVenue":      {Type: "venue", Latitude: 43.2, Longitude: 76.9, Title: "Cafe", Address: "Abay 1"},
+		"sendContact":    {Type: "contact", Phone: "+77001234567", FirstName: "Aru"},
+		"sendMediaGroup": {Type: "media_group", Items: []domain.BroadcastMediaItem{{Type: "photo", FileID: "a"}, {Type: "video", FileID: "b"}}},
+	}
+
+	for _, protected := range []bool{true, false} {
+		h, mem, fake, b := newTestHandler(t)
+		ctx := context.Background()
+		admin := h.cfg.AdminIDs[0]
+		if err := mem.SaveUserState(ctx, admin, &domain.UserState{State: stateBroadcast, BroadCastType: audienceAll, Protected: true}); err != nil {
+			t.Fatal(err)
+		}
+		if !protected {
+			// the inline toggle in the broadcast menu
+			h.BroadcastProtectHandler(ctx, b, &models.Update{CallbackQuery: &models.CallbackQuery{ID: "cq", From: models.User{ID: admin}, Data: broadcastProtectData}})
+		}
+		state, err := mem.GetUserState(ctx, admin)
+		if err != nil || state.Protected != protected {
+			t.Fatalf("state = %+v, %v; want Protected %v", state, err, protected)
+		}
+
+		for method, p := range payloads {
+			fake.Calls()
+			h.previewBroadcast(ctx, b, admin, state, p)
+			var sent *apiCall
+			for _, c := range fake.Calls() {
+				if c.Method == method && (method != "sendMessage" || c.Params["text"] == p.Caption) {
+					sent = &c
+				}
+			}
+			if sent == nil {
+				t.Fatalf("%s: no %s call", p.Type, method)
+			}
+			if got := sent.Params["protect_content"] == "true"; got != protected {
+				t.Errorf("%s with Protected %v: protect_content = %q", p.Type, protected, sent.Params["protect_content"])
+			}
+			saved, err := mem.GetUserState(ctx, admin)
+			if err != nil || saved.Pending == nil || saved.Pending.Unprotected == protected {
+				t.Errorf("%s with Protected %v: pending payload = %+v, %v", p.Type, protected, saved.Pending, err)
+			}
+		}
+	}
+}
+
+func TestMediaTestReportsEveryType(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	h.cfg.MediaTestFiles = map[string]string{"photo": "p", "video": "v", "document": "d", "animation": "a"}
+	fake.Fail("sendVideo", 400, "Bad Request: wrong file identifier/HTTP URL specified")
+	mediatest := func(from int64) {
+		h.MediaTestHandler(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: from}, Chat: models.Chat{ID: from}, Text: "/mediatest"}})
+	}
+
+	mediatest(42)
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("non-admin triggered %s", formatCalls(calls))
+	}
+
+	mediatest(h.cfg.AdminIDs[0])
+	calls := fake.Calls()
+	want := []string{"sendMessage", "sendPhoto", "sendVideo", "sendDocument", "sendAnimation", "sendDice", "sendMessage"}
+	if got := methods(calls); !slices.Equal(got, want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+	report := calls[len(calls)-1].Params["text"]
+	for _, line := range []string{
+		"✅ text", "✅ photo", "❌ video", "✅ document", "✅ animation", "✅ dice",
+		"⏭ audio: үлгі файл жоқ (MEDIATEST_AUDIO)", "⏭ sticker: үлгі файл жоқ (MEDIATEST_STICKER)",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("report lacks %q:\n%s", line, report)
+		}
+	}
+	if !strings.Contains(report, "wrong file identifier") {
+		t.Errorf("report doesn't say why video failed:\n%s", report)
+	}
+}
+
+func TestAdminRepliesGoToRequester(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	h.cfg.AdminIDs = []int64{1000, 2000, 3000}
+	h.cfg.ExcelDir = t.TempDir()
+	if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: 1, UserName: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	press := func(admin int64, text string) {
+		h.AdminHandler(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: admin}, Chat: models.Chat{ID: admin}, Text: text}})
+	}
+
+	for _, admin := range h.cfg.AdminIDs {
+		for _, text := range []string{"/admin", "📈 Статистика", "📄 Соңғы есеп", "📊 Экспорт (Тіркелгендер)", "❌ Жабу (Close)"} {
+			press(admin, text)
+		}
+		calls := fake.Calls()
+		if len(calls) == 0 {
+			t.Fatalf("admin %d got no replies", admin)
+		}
+		for _, c := range calls {
+			if c.Params["chat_id"] != fmt.Sprint(admin) {
+				t.Errorf("admin %d pressed a button, but %s went to chat %q", admin, c.Method, c.Params["chat_id"])
+			}
+		}
+	}
+
+	// the export file is sent from a background worker
+	for _, admin := range h.cfg.AdminIDs {
+		h.ExportFormatHandler(ctx, b, &models.Update{CallbackQuery: &models.CallbackQuery{
+			ID: "cq", From: models.User{ID: admin}, Data: exportCallbackPrefix + "just_" + exportCSV,
+		}})
+	}
+	if left := h.workers.Wait(5 * time.Second); len(left) > 0 {
+		t.Fatalf("exports still running: %v", left)
+	}
+	documents := map[string]int{}
+	for _, c := range fake.Calls() {
+		if c.Method == "sendDocument" {
+			documents[c.Params["chat_id"]]++
+		}
+	}
+	want := map[string]int{"1000": 1, "2000": 1, "3000": 1}
+	if !maps.Equal(documents, want) {
+		t.Errorf("export files per chat = %v, want one for each admin", documents)
+	}
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	uploadsRoot    = "uploads"
+	avatarDir      = "uploads/avatars"
+	avatarMaxEdge  = 1080
+	avatarJPEGQual = 85
+	thumbMaxEdge   = 200
+	avatarMaxBytes = 8 << 20
+	// avatarMaxPixels caps the decoded size: a small file can declare a huge canvas,
+	// and decoding allocates all of it
+	avatarMaxPixels = 40_000_000
+)
+
+var (
+	errInvalidImage   = errors.New("invalid image")
+	errAvatarTooLarge = errors.New("avatar too large")
+	errAvatarTooBig   = errors.New("avatar dimensions too large")
+)
+
+// savedAvatar describes a processed avatar written to disk
+type savedAvatar struct {
+	Path   string
+	Width  int
+	Height int
+}
+
+// saveAvatar decodes a JPEG/PNG/WebP upload of at most avatarMaxBytes and
+// avatarMaxPixels, downscales it to avatarMaxEdge on the long edge and re-encodes it
+// as JPEG. Only the processed file is stored, so EXIF (including GPS) never reaches disk.
+func saveAvatar(src io.Reader, telegramID int64, filename string) (*savedAvatar, error) {
+	data, err := io.ReadAll(io.LimitReader(src, avatarMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > avatarMaxBytes {
+		return nil, errAvatarTooLarge
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	switch http.DetectContentType(head) {
+	case "image/jpeg", "image/png", "image/webp":
+	default:
+		return nil, fmt.Errorf("%w: unsupported content type", errInvalidImage)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > avatarMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", errAvatarTooBig, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+	img = downscale(img, avatarMaxEdge)
+
+	if err := os.MkdirAll(avatarDir, 0755); err != nil {
+		return nil, err
+	}
+	base := sanitizeFilename(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	path := filepath.Join(avatarDir, fmt.Sprintf("%d_%d_%s.jpg", telegramID, time.Now().Unix(), base))
+
+	if err := writeJPEG(path, img); err != nil {
+		return nil, err
+	}
+
+	// Thumbnail is best effort: list cards fall back to the full image without it
+	if err := os.MkdirAll(filepath.Dir(avatarThumbPath(path)), 0755); err == nil {
+		_ = writeJPEG(avatarThumbPath(path), downscale(img, thumbMaxEdge))
+	}
+
+	b := img.Bounds()
+	return &savedAvatar{Path: path, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// avatarThumbPath maps uploads/avatars/x.jpg to uploads/avatars/thumbs/x.jpg
+func avatarThumbPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "thumbs", filepath.Base(path))
+}
+
+func writeJPEG(path string, img image.Image) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(dst, img, &jpeg.Options{Quality: avatarJPEGQual}); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// downscale shrinks img so its long edge is at most maxEdge; smaller images are returned as is
+func downscale(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return img
+	}
+	if w >= h {
+		h = h * maxEdge / w
+		w = maxEdge
+	} else {
+		w = w * maxEdge / h
+		h = maxEdge
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// AvatarHandler serves /avatars/{userID}[?size=thumb] from the user's stored avatar_path.
+// Only files inside uploadsRoot are served.
+func (h *Handler) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := strings.TrimPrefix(r.URL.Path, "/avatars/")
+	if userID == "" || strings.Contains(userID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	u, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		logger.Error("avatar: lookup failed", zap.String("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if u == nil || strings.TrimSpace(u.AvatarPath) == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := u.AvatarPath
+	if r.URL.Query().Get("size") == "thumb" {
+		if _, err := os.Stat(avatarThumbPath(path)); err == nil {
+			path = avatarThumbPath(path)
+		}
+	}
+	full, ok := insideUploads(path)
+	if !ok {
+		logger.Warn("avatar: path outside uploads root", zap.String("user_id", userID), zap.String("path", path))
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// insideUploads resolves path and reports whether it stays under uploadsRoot
+func insideUploads(path string) (string, bool) {
+	root, err := filepath.Abs(uploadsRoot)
+	if err != nil {
+		return "", false
+	}
+	full, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return full, true
+}
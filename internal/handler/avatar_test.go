@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// pngHeader is a PNG that declares w×h pixels but carries no image data, like a
+// decompression bomb's header
+func pngHeader(w, h uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 2 // 8-bit RGB
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestSaveAvatarRejectsHugeDimensions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, err := saveAvatar(bytes.NewReader(pngHeader(50000, 50000)), 1, "bomb.png")
+	if !errors.Is(err, errAvatarTooBig) {
+		t.Fatalf("err = %v, want errAvatarTooBig", err)
+	}
+	if _, err := os.Stat(avatarDir); !os.IsNotExist(err) {
+		t.Error("something was written for a rejected avatar")
+	}
+}
+
+func TestSaveAvatarDownscales(t *testing.T) {
+	t.Chdir(t.TempDir())
+	img := image.NewRGBA(image.Rect(0, 0, 2000, 1000))
+	img.Set(10, 10, color.White)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	saved, err := saveAvatar(&buf, 1, "me.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Width != avatarMaxEdge || saved.Height != avatarMaxEdge/2 {
+		t.Errorf("size = %dx%d", saved.Width, saved.Height)
+	}
+	if _, err := os.Stat(avatarThumbPath(saved.Path)); err != nil {
+		t.Errorf("thumbnail: %v", err)
+	}
+}
+
+func TestSaveAvatarThumbnail(t *testing.T) {
+	t.Chdir(t.TempDir())
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	for x := 0; x < 800; x++ {
+		for y := 0; y < 600; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := saveAvatar(&buf, 1, "me.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := os.Stat(saved.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(avatarThumbPath(saved.Path))
+	if err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	defer f.Close()
+	thumb, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if thumb.Width != thumbMaxEdge || thumb.Height != thumbMaxEdge*3/4 {
+		t.Errorf("thumbnail size = %dx%d, want %dx%d", thumb.Width, thumb.Height, thumbMaxEdge, thumbMaxEdge*3/4)
+	}
+	if st, _ := f.Stat(); st.Size() >= full.Size() {
+		t.Errorf("thumbnail is %d bytes, avatar %d; want it smaller", st.Size(), full.Size())
+	}
+}
+
+func TestSaveAvatarRejectsNonImages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for name, data := range map[string][]byte{
+		"text":      []byte("hello"),
+		"truncated": pngHeader(10, 10)[:20],
+	} {
+		if _, err := saveAvatar(bytes.NewReader(data), 1, name); !errors.Is(err, errInvalidImage) {
+			t.Errorf("%s: err = %v, want errInvalidImage", name, err)
+		}
+	}
+}
+
+func TestSaveAvatarRejectsOversizedAndWrongType(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// a JPEG signature followed by more than avatarMaxBytes
+	huge := append([]byte("\xff\xd8\xff\xe0"), make([]byte, avatarMaxBytes)...)
+	if _, err := saveAvatar(bytes.NewReader(huge), 1, "huge.jpg"); !errors.Is(err, errAvatarTooLarge) {
+		t.Errorf("oversized: err = %v, want errAvatarTooLarge", err)
+	}
+
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 10, 10), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveAvatar(&gifData, 1, "anim.gif"); !errors.Is(err, errInvalidImage) {
+		t.Errorf("gif: err = %v, want errInvalidImage", err)
+	}
+	if _, err := os.Stat(avatarDir); !os.IsNotExist(err) {
+		t.Error("something was written for a rejected avatar")
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	errCodeForbidden = "forbidden"
+	// bannedNoticeTTL limits how often a banned user is told about the ban
+	bannedNoticeTTL = time.Hour
+	bannedText      = "🚫 Сіз бұғатталдыңыз. Ботты пайдалана алмайсыз."
+)
+
+// isBanned checks the Redis cache first and falls back to banned_users, caching
+// the answer. Errors fail open: a broken lookup must not lock everyone out.
+func (h *Handler) isBanned(ctx context.Context, tgID int64) bool {
+	if h.IsAdmin(tgID) {
+		return false
+	}
+	banned, ok, err := h.redisClient.GetBanCache(ctx, tgID)
+	if err != nil {
+		h.logger.Warn("ban cache read failed", zap.Int64("tg_id", tgID), zap.Error(err))
+	}
+	if ok {
+		return banned
+	}
+	banned, err = h.banRepo.IsBanned(ctx, tgID)
+	if err != nil {
+		h.logger.Error("ban check failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		return false
+	}
+	if err := h.redisClient.SetBanCache(ctx, tgID, banned); err != nil {
+		h.logger.Warn("ban cache write failed", zap.Int64("tg_id", tgID), zap.Error(err))
+	}
+	return banned
+}
+
+// banUser bans tgID, refreshes the cache and takes the user out of matchmaking
+func (h *Handler) banUser(ctx context.Context, b *bot.Bot, tgID int64, reason string) error {
+	if err := h.banRepo.BanUser(ctx, tgID, reason); err != nil {
+		return err
+	}
+	if err := h.redisClient.SetBanCache(ctx, tgID, true); err != nil {
+		h.logger.Warn("ban cache write failed", zap.Int64("tg_id", tgID), zap.Error(err))
+	}
+	h.endChat(ctx, b, tgID)
+	return nil
+}
+
+// unbanUser lifts a ban; it reports false when tgID was not banned
+func (h *Handler) unbanUser(ctx context.Context, tgID int64) (bool, error) {
+	ok, err := h.banRepo.UnbanUser(ctx, tgID)
+	if err != nil {
+		return false, err
+	}
+	if err := h.redisClient.SetBanCache(ctx, tgID, false); err != nil {
+		h.logger.Warn("ban cache write failed", zap.Int64("tg_id", tgID), zap.Error(err))
+	}
+	return ok, nil
+}
+
+// notifyBanned tells a banned user about the ban, at most once per bannedNoticeTTL
+func (h *Handler) notifyBanned(ctx context.Context, b *bot.Bot, tgID int64) {
+	allowed, _, err := h.redisClient.HitOnce(ctx, fmt.Sprintf("rl:ban_notice:%d", tgID), bannedNoticeTTL)
+	if err != nil || !allowed {
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: tgID, Text: bannedText})
+}
+
+// BanMiddleware drops messages and callbacks from banned users before any handler
+// runs, so commands registered on their own (/next, the next button, /subscribe...)
+// are covered as well as DefaultHandler
+func (h *Handler) BanMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		var fromID int64
+		switch {
+		case update.Message != nil && update.Message.From != nil:
+			fromID = update.Message.From.ID
+		case update.CallbackQuery != nil:
+			fromID = update.CallbackQuery.From.ID
+		}
+		if fromID != 0 && h.isBanned(ctx, fromID) {
+			if update.CallbackQuery != nil {
+				b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID, Text: bannedText})
+			}
+			h.notifyBanned(ctx, b, fromID)
+			return
+		}
+		next(ctx, b, update)
+	}
+}
+
+// banMiddleware answers 403 to API calls from banned users. The caller is taken
+// from the signed initData, which a banned user can't swap for another ID.
+func (h *Handler) banMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && h.bannedCaller(r) {
+			h.writeError(w, http.StatusForbidden, errCodeForbidden, "banned")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) bannedCaller(r *http.Request) bool {
+	tgID, err := h.verifiedTGID(r)
+	return err == nil && h.isBanned(r.Context(), tgID)
+}
+
+// BanCommandHandler handles the admin commands "/ban <tg_id> [reason]" and "/unban <tg_id>"
+func (h *Handler) BanCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+	fields := strings.Fields(update.Message.Text)
+	cmd := fields[0]
+	if cmd != "/ban" && cmd != "/unban" {
+		return
+	}
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
+	}
+	reply := func(text string) {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text})
+	}
+	if len(fields) < 2 {
+		reply(fmt.Sprintf("Қолданылуы: %s <telegram_id>", cmd))
+		return
+	}
+	tgID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || tgID <= 0 {
+		reply("❌ Қате ID: " + fields[1])
+		return
+	}
+
+	if cmd == "/unban" {
+		ok, err := h.unbanUser(ctx, tgID)
+		switch {
+		case err != nil:
+			h.logger.Error("unban failed", zap.Int64("tg_id", tgID), zap.Error(err))
+			reply("❌ Қате: бұғаттан шығару мүмкін болмады")
+		case !ok:
+			reply(fmt.Sprintf("ℹ️ %d бұғатталмаған", tgID))
+		default:
+			h.logger.Info("user unbanned", zap.Int64("tg_id", tgID), zap.Int64("admin", adminId))
+			reply(fmt.Sprintf("✅ %d бұғаттан шығарылды", tgID))
+		}
+		return
+	}
+
+	if h.IsAdmin(tgID) {
+		reply("❌ Админді бұғаттауға болмайды")
+		return
+	}
+	reason := strings.Join(fields[2:], " ")
+	if err := h.banUser(ctx, b, tgID, reason); err != nil {
+		h.logger.Error("ban failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		reply("❌ Қате: бұғаттау мүмкін болмады")
+		return
+	}
+	h.logger.Info("user banned", zap.Int64("tg_id", tgID), zap.Int64("admin", adminId), zap.String("reason", reason))
+	reply(fmt.Sprintf("🚫 %d бұғатталды", tgID))
+}
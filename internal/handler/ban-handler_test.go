@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBanMiddlewareStopsEveryUpdate(t *testing.T) {
+	h, _, f, b := newTestHandler(t)
+	ctx := context.Background()
+	if err := h.banRepo.BanUser(ctx, 42, "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := map[string]*models.Update{
+		"/next":          {Message: &models.Message{From: &models.User{ID: 42}, Chat: models.Chat{ID: 42}, Text: "/next"}},
+		"/subscribe":     {Message: &models.Message{From: &models.User{ID: 42}, Chat: models.Chat{ID: 42}, Text: "/subscribe"}},
+		"next button":    {CallbackQuery: &models.CallbackQuery{ID: "cb", From: models.User{ID: 42}, Data: nextPartnerData}},
+		"select button":  {CallbackQuery: &models.CallbackQuery{ID: "cb", From: models.User{ID: 42}, Data: "select_7"}},
+		"delete profile": {Message: &models.Message{From: &models.User{ID: 42}, Chat: models.Chat{ID: 42}, Text: "/delete_profile"}},
+	}
+	for name, update := range updates {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			h.BanMiddleware(func(context.Context, *bot.Bot, *models.Update) { called = true })(ctx, b, update)
+			if called {
+				t.Fatal("handler ran for a banned user")
+			}
+		})
+	}
+
+	// the ban notice is rate limited, callbacks are still answered every time
+	var notices, answers int
+	for _, c := range f.Calls() {
+		switch c.Method {
+		case "sendMessage":
+			notices++
+		case "answerCallbackQuery":
+			answers++
+		}
+	}
+	if notices != 1 || answers != 2 {
+		t.Errorf("notices = %d, answers = %d, want 1 and 2", notices, answers)
+	}
+}
+
+func TestBanMiddlewareLetsOthersThrough(t *testing.T) {
+	h, _, _, b := newTestHandler(t)
+	ctx := context.Background()
+	admin := h.cfg.AdminIDs[0]
+	// an admin can't lock themselves out
+	if err := h.banRepo.BanUser(ctx, admin, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{7, admin} {
+		called := false
+		update := &models.Update{Message: &models.Message{From: &models.User{ID: id}, Text: "/next"}}
+		h.BanMiddleware(func(context.Context, *bot.Bot, *models.Update) { called = true })(ctx, b, update)
+		if !called {
+			t.Errorf("user %d was stopped", id)
+		}
+	}
+}
+
+func TestBannedUserCannotJoinThePool(t *testing.T) {
+	h, mem, _, b := newTestHandler(t)
+	ctx := context.Background()
+	h.banRepo.BanUser(ctx, 42, "")
+
+	next := h.BanMiddleware(h.NextCommand)
+	next(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: 42}, Text: "/next"}})
+	if n, _ := mem.CountWaitingUsers(ctx); n != 0 {
+		t.Fatalf("waiting = %d, want 0", n)
+	}
+
+	// someone banned while already waiting is not paired
+	mem.AddUser(ctx, 43)
+	h.banRepo.BanUser(ctx, 43, "")
+	next(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: 7}, Text: "/next"}})
+	if partner, _ := mem.GetUserPartner(ctx, 7); partner != 0 {
+		t.Fatalf("7 was paired with %d", partner)
+	}
+}
+
+func TestBanHTTPMiddleware(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.banRepo.BanUser(context.Background(), 42, "")
+	handler := h.banMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for id, want := range map[int64]int{42: http.StatusForbidden, 7: http.StatusOK} {
+		r := signAs(httptest.NewRequest(http.MethodGet, "/api/user/me", nil), id)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != want {
+			t.Errorf("user %d: status = %d, want %d", id, rec.Code, want)
+		}
+	}
+}
+
+func TestBanHTTPMiddlewareUsesInitData(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.banRepo.BanUser(context.Background(), 42, "")
+	handler := h.banMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"banned initData", map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusForbidden},
+		{"banned initData, spoofed id", map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now()), "X-Telegram-Id": "7"}, http.StatusForbidden},
+		{"other user's initData", map[string]string{initDataHeader: signInitData(testBotToken, 7, time.Now())}, http.StatusOK},
+		{"forged initData", map[string]string{initDataHeader: signInitData("2:other", 42, time.Now())}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/me", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// telegramRefused reports whether err is a Telegram API error of the given kind
+// (bot.ErrorForbidden, bot.ErrorBadRequest, ...) whose description contains one of
+// descs; no descs matches any description. The client wraps the sentinel as
+// "<sentinel>, <description>", and the description is also looked for in errors
+// that lost the sentinel along the way.
+func telegramRefused(err, kind error, descs ...string) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !errors.Is(err, kind) && !strings.HasPrefix(msg, kind.Error()) {
+		return false
+	}
+	if len(descs) == 0 {
+		return true
+	}
+	for _, d := range descs {
+		if strings.Contains(msg, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockedErr reports whether Telegram refused a send with HTTP 403: the recipient
+// blocked the bot, deleted their account or never started it
+func isBlockedErr(err error) bool {
+	return telegramRefused(err, bot.ErrorForbidden) ||
+		err != nil && strings.Contains(strings.ToLower(err.Error()), "bot was blocked by the user")
+}
+
+// isDeactivated reports whether the recipient's account was deleted
+func isDeactivated(err error) bool {
+	return telegramRefused(err, bot.ErrorForbidden, "user is deactivated")
+}
+
+// isChatNotFound reports whether the recipient's chat doesn't exist (anymore)
+func isChatNotFound(err error) bool {
+	return telegramRefused(err, bot.ErrorBadRequest, "chat not found")
+}
+
+// isUnreachable reports whether no message will get through to the recipient until
+// they write to the bot again
+func isUnreachable(err error) bool {
+	return isBlockedErr(err) || isChatNotFound(err)
+}
+
+// markUnreachable flags userID in the just table so broadcasts skip them; the flag
+// is cleared when they next write to the bot
+func (h *Handler) markUnreachable(ctx context.Context, userID int64) {
+	if err := h.userRepo.SetUnreachable(context.WithoutCancel(ctx), userID, true); err != nil {
+		h.logger.Warn("Failed to mark user unreachable", zap.Int64("user_id", userID), zap.Error(err))
+	}
+}
+
+// handleBlocked ends the anonymous chat between userID and partnerID after the
+// partner blocked the bot, and tells userID to find someone else
+func (h *Handler) handleBlocked(ctx context.Context, b *bot.Bot, userID, partnerID int64) {
+	h.logger.Info("partner blocked the bot, closing chat", zap.Int64("user_id", userID), zap.Int64("partner_id", partnerID))
+	h.markUnreachable(ctx, partnerID)
+	if _, err := h.redisClient.RemoveUser(ctx, userID); err != nil {
+		h.logger.Error("Ошибка при удалении пользователя", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: userID,
+		Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
+	})
+}
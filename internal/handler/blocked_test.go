@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+)
+
+// botAPIError returns the error the client gives for a Bot API error response
+func botAPIError(t *testing.T, code int, description string) error {
+	t.Helper()
+	f, b := newFakeTelegram(t)
+	f.Fail("sendMessage", code, description)
+	_, err := b.SendMessage(context.Background(), &bot.SendMessageParams{ChatID: 1, Text: "hi"})
+	if err == nil {
+		t.Fatalf("%d %q: send succeeded", code, description)
+	}
+	return err
+}
+
+func TestTelegramErrorClassifiers(t *testing.T) {
+	tests := []struct {
+		name                               string
+		err                                error
+		blocked, deactivated, chatNotFound bool
+	}{
+		{
+			name:    "403 bot was blocked",
+			err:     botAPIError(t, 403, "Forbidden: bot was blocked by the user"),
+			blocked: true,
+		},
+		{
+			name:        "403 user is deactivated",
+			err:         botAPIError(t, 403, "Forbidden: user is deactivated"),
+			blocked:     true,
+			deactivated: true,
+		},
+		{
+			name:         "400 chat not found",
+			err:          botAPIError(t, 400, "Bad Request: chat not found"),
+			chatNotFound: true,
+		},
+		{
+			name:    "wrapped 403",
+			err:     fmt.Errorf("relay to 42: %w", botAPIError(t, 403, "Forbidden: bot was blocked by the user")),
+			blocked: true,
+		},
+		{
+			name:         "wrapped 400 chat not found",
+			err:          fmt.Errorf("broadcast: %w", botAPIError(t, 400, "Bad Request: chat not found")),
+			chatNotFound: true,
+		},
+		{
+			name:    "403 bot can't initiate conversation",
+			err:     botAPIError(t, 403, "Forbidden: bot can't initiate conversation with a user"),
+			blocked: true,
+		},
+		{
+			name:    "403 bot was kicked",
+			err:     botAPIError(t, 403, "Forbidden: bot was kicked from the group chat"),
+			blocked: true,
+		},
+		{
+			// the sentinel is gone, only the description is left
+			name:    "blocked text without the sentinel",
+			err:     errors.New("send failed: Forbidden: bot was blocked by the user"),
+			blocked: true,
+		},
+		{name: "other 400", err: botAPIError(t, 400, "Bad Request: message text is empty")},
+		{name: "429", err: botAPIError(t, 429, "Too Many Requests: retry after 1")},
+		{name: "network error", err: errors.New("dial tcp: connection refused")},
+		{name: "nil"},
+	}
+	for _, tt := range tests {
+		if got := isBlockedErr(tt.err); got != tt.blocked {
+			t.Errorf("%s: isBlockedErr = %v, want %v", tt.name, got, tt.blocked)
+		}
+		if got := isDeactivated(tt.err); got != tt.deactivated {
+			t.Errorf("%s: isDeactivated = %v, want %v", tt.name, got, tt.deactivated)
+		}
+		if got := isChatNotFound(tt.err); got != tt.chatNotFound {
+			t.Errorf("%s: isChatNotFound = %v, want %v", tt.name, got, tt.chatNotFound)
+		}
+		if got, want := isUnreachable(tt.err), tt.blocked || tt.chatNotFound; got != want {
+			t.Errorf("%s: isUnreachable = %v, want %v", tt.name, got, want)
+		}
+	}
+}
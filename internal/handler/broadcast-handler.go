@@ -0,0 +1,558 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"aika/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// broadcastCheckpointEvery is how many sends go by between Redis checkpoints
+	broadcastCheckpointEvery = 100
+	// broadcastFlushEvery is how many sends go by between checkpoint flushes to SQLite
+	broadcastFlushEvery = 1000
+
+	// The status message is edited after broadcastProgressEvery sends or
+	// broadcastProgressInterval, whichever comes first, but never within
+	// broadcastProgressMinGap of the previous edit: Telegram throttles frequent edits
+	// of one message, and edits share the 30 msg/s budget with the broadcast itself.
+	broadcastProgressEvery    = 200
+	broadcastProgressInterval = 5 * time.Second
+	broadcastProgressMinGap   = 2 * time.Second
+
+	// broadcastMaxRetries is how many times a send is retried after a 429
+	broadcastMaxRetries = 3
+	// defaultBroadcastRate is used when cfg.BroadcastRate is not positive
+	defaultBroadcastRate = 30
+
+	broadcastResumePrefix = "brun_resume_"
+	broadcastDropPrefix   = "brun_drop_"
+)
+
+// Broadcast audiences offered in the broadcast menu
+const (
+	audienceAll        = "all"
+	audienceRegistered = "registered"
+	audienceActive     = "active"
+	audienceLikers     = "likers"
+
+	// activeAudienceDays is the window for audienceActive
+	activeAudienceDays = 30
+)
+
+// broadcastAudience loads the recipients of a broadcast type; opted-out users are never included
+func (h *Handler) broadcastAudience(ctx context.Context, audience string) ([]int64, error) {
+	switch audience {
+	case audienceAll:
+		return h.userRepo.GetBroadcastAudience(ctx)
+	case audienceRegistered:
+		return h.userRepo.GetRegisteredAudience(ctx)
+	case audienceActive:
+		return h.userRepo.GetActiveAudience(ctx, activeAudienceDays)
+	case audienceLikers:
+		return h.userRepo.GetLikersAudience(ctx)
+	default:
+		return nil, fmt.Errorf("unknown broadcast type: %s", audience)
+	}
+}
+
+// beginBroadcast registers a broadcast with the shutdown tracker.
+// It returns false once shutdown has started; otherwise the caller must call h.broadcasts.Done.
+func (h *Handler) beginBroadcast() bool {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+	if h.broadcastsClose {
+		return false
+	}
+	h.broadcasts.Add(1)
+	return true
+}
+
+// WaitBroadcasts stops new broadcasts from starting and waits up to timeout for
+// running ones to reach a checkpoint. It reports whether they all finished in time.
+func (h *Handler) WaitBroadcasts(timeout time.Duration) bool {
+	h.broadcastMu.Lock()
+	h.broadcastsClose = true
+	h.broadcastMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.broadcasts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// replyShuttingDown tells the admin a broadcast can't start because the bot is stopping
+func (h *Handler) replyShuttingDown(ctx context.Context, b *bot.Bot, adminId int64) {
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: adminId,
+		Text:   "⏳ Бот қайта іске қосылып жатыр, хабарлама жіберу кейінірек мүмкін болады.",
+	})
+}
+
+var (
+	errBroadcastCancelled   = errors.New("cancelled by admin")
+	errBroadcastInterrupted = errors.New("interrupted by shutdown")
+)
+
+// runBroadcast sends the run's message to userIds starting at run.NextIndex.
+// Progress is checkpointed so an interrupted run can be resumed without resending.
+// When ctx is cancelled the current batch still goes out, then the run stops and
+// stays resumable. Callers must have registered the run with beginBroadcast.
+// It returns nil only when the run reached its last recipient;
+// errBroadcastCancelled and errBroadcastInterrupted tell how it was cut short.
+func (h *Handler) runBroadcast(ctx context.Context, b *bot.Bot, run *domain.BroadcastRun, userIds []int64) error {
+	defer h.broadcasts.Done()
+	adminId := run.AdminID
+	// a batch that has started is finished even during shutdown
+	sendCtx := context.WithoutCancel(ctx)
+
+	// a stale flag from an earlier run must not stop this one
+	if err := h.redisClient.ClearBroadcastCancel(ctx, adminId); err != nil {
+		h.logger.Error("Failed to clear broadcast cancel flag", zap.Error(err))
+	}
+
+	statusText := fmt.Sprintf("📤 Хабарлама жіберіліп жатыр...\n👥 Жалпы: %d пайдаланушы", len(userIds))
+	if run.NextIndex > 0 {
+		statusText = fmt.Sprintf("📤 Хабарлама жіберу жалғасуда...\n👥 Жалпы: %d пайдаланушы\n▶️ Басталатын орын: %d", len(userIds), run.NextIndex+1)
+	}
+	cancelMarkup := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "⛔️ Тоқтату", CallbackData: broadcastCancelData}},
+		},
+	}
+	statusMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      adminId,
+		Text:        statusText,
+		ReplyMarkup: cancelMarkup,
+	})
+	if err != nil {
+		h.logger.Error("Failed to send status message", zap.Error(err))
+		return fmt.Errorf("send status message: %w", err)
+	}
+
+	perSecond := h.cfg.BroadcastRate
+	if perSecond <= 0 {
+		perSecond = defaultBroadcastRate
+	}
+	limiter := rate.NewLimiter(rate.Limit(perSecond), 1)
+	var pause broadcastPause
+
+	var wg sync.WaitGroup
+	var failuresMu sync.Mutex
+	var failures []broadcastFailure
+	successCount, failedCount := int64(run.Sent), int64(run.Failed)
+	var blockedCount int64
+	next := run.NextIndex
+	lastCheckpoint, lastFlush := next, next
+	progress := newBroadcastProgress(next, h.now())
+	cancelled := false
+	for next < len(userIds) && !cancelled && ctx.Err() == nil {
+		if stop, err := h.redisClient.IsBroadcastCancelled(ctx, adminId); err != nil {
+			h.logger.Error("Failed to check broadcast cancel flag", zap.Error(err))
+		} else if stop {
+			cancelled = true
+			break
+		}
+
+		end := min(next+broadcastBatchSize, len(userIds))
+		for _, userId := range userIds[next:end] {
+			pause.wait(sendCtx)
+			if err := limiter.Wait(sendCtx); err != nil {
+				h.logger.Error("Rate limiter wait error", zap.Error(err))
+				cancelled = true
+				break
+			}
+			wg.Add(1)
+			go func(userId int64) {
+				defer wg.Done()
+				if err := h.sendWithRetry(sendCtx, &pause, userId, func() error {
+					return h.sendToUser(sendCtx, b, userId, run.Payload)
+				}); err != nil {
+					atomic.AddInt64(&failedCount, 1)
+					if isBlockedErr(err) {
+						atomic.AddInt64(&blockedCount, 1)
+					}
+					class := broadcastErrorClass(err)
+					metrics.BroadcastSends.WithLabelValues(class).Inc()
+					failuresMu.Lock()
+					failures = append(failures, broadcastFailure{UserID: userId, Class: class, Err: err.Error()})
+					failuresMu.Unlock()
+					h.logger.Warn("Failed to send message to user", zap.Int64("user", userId), zap.Error(err))
+				} else {
+					atomic.AddInt64(&successCount, 1)
+					metrics.BroadcastSends.WithLabelValues("sent").Inc()
+				}
+			}(userId)
+			next++
+		}
+		// finish the batch before looking at the cancel flag again
+		wg.Wait()
+
+		sent, failed := int(atomic.LoadInt64(&successCount)), int(atomic.LoadInt64(&failedCount))
+		if next-lastCheckpoint >= broadcastCheckpointEvery {
+			lastCheckpoint = next
+			if err := h.redisClient.SaveBroadcastCheckpoint(ctx, run.ID, next, sent, failed); err != nil {
+				h.logger.Error("Failed to save broadcast checkpoint", zap.Int64("run", run.ID), zap.Error(err))
+			}
+		}
+		if next-lastFlush >= broadcastFlushEvery {
+			lastFlush = next
+			if err := h.broadcastRepo.SaveProgress(ctx, run.ID, next, sent, failed); err != nil {
+				h.logger.Error("Failed to flush broadcast progress", zap.Int64("run", run.ID), zap.Error(err))
+			}
+		}
+		if next < len(userIds) && progress.due(next, h.now()) {
+			_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+				ChatID:      adminId,
+				MessageID:   statusMsg.ID,
+				Text:        broadcastProgressText(next, len(userIds), sent, failed, int(atomic.LoadInt64(&blockedCount))),
+				ReplyMarkup: cancelMarkup,
+			})
+			if err != nil {
+				h.logger.Warn("Failed to update broadcast progress", zap.Int64("run", run.ID), zap.Error(err))
+			}
+		}
+	}
+
+	wg.Wait()
+	// Send final results
+	finalSuccess := atomic.LoadInt64(&successCount)
+	finalFailed := atomic.LoadInt64(&failedCount)
+	// an empty recipient list (e.g. a resumed run whose snapshot is gone) is 0%, not NaN
+	var successRate float64
+	if len(userIds) > 0 {
+		successRate = float64(finalSuccess) / float64(len(userIds)) * 100
+	}
+
+	// a shutdown leaves the run marked running so it is offered for resume on the next start
+	if ctx.Err() != nil {
+		if err := h.redisClient.SaveBroadcastCheckpoint(sendCtx, run.ID, next, int(finalSuccess), int(finalFailed)); err != nil {
+			h.logger.Error("Failed to save broadcast checkpoint", zap.Int64("run", run.ID), zap.Error(err))
+		}
+		if err := h.broadcastRepo.SaveProgress(sendCtx, run.ID, next, int(finalSuccess), int(finalFailed)); err != nil {
+			h.logger.Error("Failed to flush broadcast progress", zap.Int64("run", run.ID), zap.Error(err))
+		}
+		b.EditMessageText(sendCtx, &bot.EditMessageTextParams{
+			ChatID:    adminId,
+			MessageID: statusMsg.ID,
+			Text:      fmt.Sprintf("⏸ Бот тоқтатылды, хабарлама жіберу үзілді.\n📨 Жіберілді: %d / %d\n\nҚайта іске қосылғанда жалғастыруға болады.", next, len(userIds)),
+		})
+		h.logger.Warn("Broadcast interrupted by shutdown", zap.Int64("run", run.ID), zap.Int("next_index", next))
+		return errBroadcastInterrupted
+	}
+
+	status := domain.BroadcastCompleted
+	if cancelled {
+		status = domain.BroadcastCancelled
+	}
+	if err := h.broadcastRepo.FinishRun(ctx, run.ID, status, next, int(finalSuccess), int(finalFailed)); err != nil {
+		h.logger.Error("Failed to finish broadcast run", zap.Int64("run", run.ID), zap.Error(err))
+	}
+	if err := h.redisClient.DeleteBroadcastCheckpoint(ctx, run.ID); err != nil {
+		h.logger.Error("Failed to delete broadcast checkpoint", zap.Error(err))
+	}
+	if err := h.redisClient.ClearBroadcastCancel(ctx, adminId); err != nil {
+		h.logger.Error("Failed to clear broadcast cancel flag", zap.Error(err))
+	}
+
+	title := "✅ ХАБАРЛАМА ЖІБЕРУ АЯҚТАЛДЫ!"
+	if cancelled {
+		title = fmt.Sprintf("⛔️ ХАБАРЛАМА ЖІБЕРУ ТОҚТАТЫЛДЫ!\n\n📨 Тоқтағанға дейін жіберілді: %d", finalSuccess+finalFailed)
+	}
+
+	finalText := fmt.Sprintf(`%s
+
+👥 Жалпы: %d пайдаланушы
+✅ Сәтті: %d
+❌ Қате: %d
+🚫 Ботты бұғаттағандар: %d
+📊 Сәттілік: %.1f%%
+
+📋 Хабарлама түрі: %s
+⏰ Уақыт: %s`,
+		title,
+		len(userIds),
+		finalSuccess,
+		finalFailed,
+		atomic.LoadInt64(&blockedCount),
+		successRate,
+		h.getBroadcastTypeName(run.Audience),
+		time.Now().Format("2006-01-02 15:04:05"))
+
+	if statusMsg != nil {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    adminId,
+			MessageID: statusMsg.ID,
+			Text:      finalText,
+		})
+	}
+
+	// Log broadcast results
+	h.logger.Info("Broadcast completed",
+		zap.Int64("run", run.ID),
+		zap.String("type", run.Audience),
+		zap.Bool("cancelled", cancelled),
+		zap.Int("total", len(userIds)),
+		zap.Int64("success", finalSuccess),
+		zap.Int64("failed", finalFailed),
+		zap.Int64("blocked", atomic.LoadInt64(&blockedCount)),
+		zap.Float64("success_rate", successRate))
+
+	if len(failures) > 0 {
+		h.sendBroadcastReport(ctx, b, run, failures, int(finalSuccess))
+	}
+
+	if err := h.redisClient.DeleteUserState(ctx, adminId); err != nil {
+		h.logger.Error("Failed to delete admin state from Redis", zap.Error(err))
+	}
+	time.Sleep(2 * time.Second)
+	h.AdminHandler(ctx, b, &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: adminId},
+			Text: "/admin",
+		},
+	})
+	if cancelled {
+		return errBroadcastCancelled
+	}
+	return nil
+}
+
+// NotifyInterruptedBroadcasts asks the admin what to do with runs a previous process left unfinished
+func (h *Handler) NotifyInterruptedBroadcasts(ctx context.Context, b *bot.Bot) {
+	runs, err := h.broadcastRepo.GetRunningRuns(ctx)
+	if err != nil {
+		h.logger.Error("Failed to load interrupted broadcasts", zap.Error(err))
+		return
+	}
+	for _, run := range runs {
+		h.applyCheckpoint(ctx, run)
+		h.logger.Info("Found interrupted broadcast", zap.Int64("run", run.ID), zap.Int("next_index", run.NextIndex), zap.Int("total", run.Total))
+
+		text := fmt.Sprintf(`⚠️ ХАБАРЛАМА ЖІБЕРУ ҮЗІЛІП ҚАЛДЫ
+
+📋 Хабарлама түрі: %s
+👥 Жалпы: %d пайдаланушы
+📨 Жіберілді: %d
+⏰ Басталған уақыты: %s
+
+Жалғастырасыз ба?`,
+			h.getBroadcastTypeName(run.Audience),
+			run.Total,
+			run.NextIndex,
+			run.CreatedAt.Format("2006-01-02 15:04:05"))
+
+		id := strconv.FormatInt(run.ID, 10)
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: run.AdminID,
+			Text:   text,
+			ReplyMarkup: &models.InlineKeyboardMarkup{
+				InlineKeyboard: [][]models.InlineKeyboardButton{
+					{
+						{Text: "▶️ Жалғастыру", CallbackData: broadcastResumePrefix + id},
+						{Text: "✖️ Болдырмау", CallbackData: broadcastDropPrefix + id},
+					},
+				},
+			},
+		})
+		if err != nil {
+			h.logger.Error("Failed to notify admin about interrupted broadcast", zap.Int64("run", run.ID), zap.Error(err))
+		}
+	}
+}
+
+// applyCheckpoint moves the run forward to its Redis checkpoint, which is newer than the SQLite copy
+func (h *Handler) applyCheckpoint(ctx context.Context, run *domain.BroadcastRun) {
+	next, sent, failed, ok, err := h.redisClient.GetBroadcastCheckpoint(ctx, run.ID)
+	if err != nil {
+		h.logger.Warn("Failed to read broadcast checkpoint", zap.Int64("run", run.ID), zap.Error(err))
+		return
+	}
+	if ok && next > run.NextIndex {
+		run.NextIndex, run.Sent, run.Failed = next, sent, failed
+	}
+}
+
+// BroadcastRunHandler handles the "жалғастыру / болдырмау" buttons for an interrupted run
+func (h *Handler) BroadcastRunHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+	cq := update.CallbackQuery
+	if !h.IsAdmin(cq.From.ID) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", cq.From.ID))
+		return
+	}
+
+	resume := strings.HasPrefix(cq.Data, broadcastResumePrefix)
+	raw := strings.TrimPrefix(strings.TrimPrefix(cq.Data, broadcastResumePrefix), broadcastDropPrefix)
+	runID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		h.logger.Warn("Bad broadcast run callback", zap.String("data", cq.Data))
+		return
+	}
+
+	run, err := h.broadcastRepo.GetRun(ctx, runID)
+	if err != nil {
+		h.logger.Error("Failed to load broadcast run", zap.Int64("run", runID), zap.Error(err))
+	}
+	if run == nil || run.Status != domain.BroadcastRunning {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: cq.ID,
+			Text:            "Бұл хабарлама жіберу бұрын аяқталған",
+		})
+		return
+	}
+	h.applyCheckpoint(ctx, run)
+
+	// drop the buttons so the run can't be resumed twice from the same message
+	if cq.Message.Message != nil {
+		b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:    cq.Message.Message.Chat.ID,
+			MessageID: cq.Message.Message.ID,
+		})
+	}
+
+	if !resume {
+		if err := h.broadcastRepo.FinishRun(ctx, run.ID, domain.BroadcastDropped, run.NextIndex, run.Sent, run.Failed); err != nil {
+			h.logger.Error("Failed to drop broadcast run", zap.Int64("run", run.ID), zap.Error(err))
+		}
+		if err := h.redisClient.DeleteBroadcastCheckpoint(ctx, run.ID); err != nil {
+			h.logger.Error("Failed to delete broadcast checkpoint", zap.Error(err))
+		}
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: cq.ID,
+			Text:            "✖️ Болдырылмады",
+		})
+		return
+	}
+
+	userIds, err := h.broadcastRepo.GetRunRecipients(ctx, run.ID)
+	if err != nil {
+		h.logger.Error("Failed to load broadcast recipients", zap.Int64("run", run.ID), zap.Error(err))
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: cq.ID,
+			Text:            "❌ Қате: тізімді алу мүмкін болмады",
+		})
+		return
+	}
+	if !h.beginBroadcast() {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID})
+		h.replyShuttingDown(ctx, b, run.AdminID)
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: cq.ID,
+		Text:            "▶️ Жалғасуда...",
+	})
+	if err := h.runBroadcast(ctx, b, run, userIds); err != nil {
+		h.logger.Info("Resumed broadcast stopped early", zap.Int64("run", run.ID), zap.Error(err))
+	}
+}
+
+// broadcastProgress decides when the status message of a running broadcast is edited
+type broadcastProgress struct {
+	lastDone int
+	lastEdit time.Time
+}
+
+func newBroadcastProgress(done int, now time.Time) *broadcastProgress {
+	return &broadcastProgress{lastDone: done, lastEdit: now}
+}
+
+// due reports whether an edit should go out now with done recipients processed,
+// and if so records it
+func (p *broadcastProgress) due(done int, now time.Time) bool {
+	since := now.Sub(p.lastEdit)
+	if done == p.lastDone || since < broadcastProgressMinGap {
+		return false
+	}
+	if done-p.lastDone < broadcastProgressEvery && since < broadcastProgressInterval {
+		return false
+	}
+	p.lastDone, p.lastEdit = done, now
+	return true
+}
+
+func broadcastProgressText(done, total, sent, failed, blocked int) string {
+	return fmt.Sprintf(`📤 Хабарлама жіберіліп жатыр... %d%%
+
+📨 Өңделді: %d / %d
+✅ Сәтті: %d
+❌ Қате: %d
+🚫 Ботты бұғаттағандар: %d`,
+		done*100/total, done, total, sent, failed, blocked)
+}
+
+// broadcastPause holds every sender of a broadcast back after Telegram answers 429:
+// retry_after applies to the bot as a whole, not only to the chat that hit it
+type broadcastPause struct {
+	until atomic.Int64 // unix nanoseconds
+}
+
+// extend pushes the pause out to at least d from now
+func (p *broadcastPause) extend(d time.Duration) {
+	t := time.Now().Add(d).UnixNano()
+	for {
+		cur := p.until.Load()
+		if cur >= t || p.until.CompareAndSwap(cur, t) {
+			return
+		}
+	}
+}
+
+// wait sleeps until the pause is over or ctx is done
+func (p *broadcastPause) wait(ctx context.Context) {
+	d := time.Until(time.Unix(0, p.until.Load()))
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// sendWithRetry calls send, and on a 429 waits out retry_after and tries the same
+// user again, up to broadcastMaxRetries times. Other errors are returned at once.
+func (h *Handler) sendWithRetry(ctx context.Context, pause *broadcastPause, userId int64, send func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := send()
+		var tooMany *bot.TooManyRequestsError
+		if err == nil || !errors.As(err, &tooMany) || attempt == broadcastMaxRetries {
+			return err
+		}
+		retryAfter := time.Duration(tooMany.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		h.logger.Warn("Broadcast throttled by Telegram, retrying",
+			zap.Int64("user", userId), zap.Duration("retry_after", retryAfter), zap.Int("attempt", attempt+1))
+		pause.extend(retryAfter)
+		pause.wait(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+}
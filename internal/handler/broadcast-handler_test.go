@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBroadcastRetriesAfter429(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	id := scheduleBroadcast(t, h, 3)
+	fake.Throttle("sendMessage", "2", 1)
+
+	start := time.Now()
+	h.runDueBroadcasts(context.Background(), b)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("broadcast finished in %s, before retry_after ran out", elapsed)
+	}
+
+	if status, errText := scheduledStatus(t, h, id); status != domain.ScheduledSent {
+		t.Fatalf("status = %q (%s), want sent", status, errText)
+	}
+	var sent, failed int
+	if err := h.db.QueryRow(`SELECT sent, failed FROM broadcast_runs`).Scan(&sent, &failed); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 || failed != 0 {
+		t.Fatalf("sent=%d failed=%d, want 3 and 0", sent, failed)
+	}
+	perChat := map[string]int{}
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			perChat[c.Params["chat_id"]]++
+		}
+	}
+	if perChat["1"] != 1 || perChat["2"] != 2 || perChat["3"] != 1 {
+		t.Fatalf("sends per chat = %v, want user 2 retried once", perChat)
+	}
+}
+
+func TestSendWithRetryGivesUp(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out broadcastMaxRetries retry_after seconds")
+	}
+	h, _, _, _ := newTestHandler(t)
+	var pause broadcastPause
+	attempts := 0
+	err := h.sendWithRetry(context.Background(), &pause, 7, func() error {
+		attempts++
+		return &bot.TooManyRequestsError{Message: "Too Many Requests", RetryAfter: 0}
+	})
+	var tooMany *bot.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("err = %v, want the last 429", err)
+	}
+	if attempts != broadcastMaxRetries+1 {
+		t.Fatalf("%d attempts, want %d", attempts, broadcastMaxRetries+1)
+	}
+}
+
+func TestSendWithRetryOtherErrors(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	var pause broadcastPause
+	attempts := 0
+	boom := errors.New("Forbidden: bot was blocked by the user")
+	err := h.sendWithRetry(context.Background(), &pause, 7, func() error {
+		attempts++
+		return boom
+	})
+	if err != boom || attempts != 1 {
+		t.Fatalf("err = %v after %d attempts, want %v after 1", err, attempts, boom)
+	}
+}
+
+func TestBroadcastProgressEdits(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	// every look at the clock is a second later, so a fast run still spans minutes
+	start := time.Now()
+	var ticks int64
+	h.now = func() time.Time {
+		ticks++
+		return start.Add(time.Duration(ticks) * time.Second)
+	}
+	scheduleBroadcast(t, h, 1000)
+	h.runDueBroadcasts(context.Background(), b)
+
+	var done []int
+	for _, c := range fake.Calls() {
+		if c.Method != "editMessageText" || !strings.Contains(c.Params["text"], "Өңделді") {
+			continue
+		}
+		var n, total int
+		if _, err := fmt.Sscanf(c.Params["text"][strings.Index(c.Params["text"], "Өңделді"):], "Өңделді: %d / %d", &n, &total); err != nil {
+			t.Fatalf("progress text %q: %v", c.Params["text"], err)
+		}
+		done = append(done, n)
+	}
+	if len(done) < 2 {
+		t.Fatalf("%d progress edits, want several during 1000 sends", len(done))
+	}
+	for i := 1; i < len(done); i++ {
+		if done[i] <= done[i-1] {
+			t.Fatalf("progress went %v, want it rising", done)
+		}
+	}
+	if done[len(done)-1] >= 1000 {
+		t.Fatalf("progress edits %v, want them before the final report", done)
+	}
+}
+
+func TestBroadcastCancelStopsWithinOneBatch(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	admin := h.cfg.AdminIDs[0]
+	scheduleBroadcast(t, h, 3*broadcastBatchSize)
+	// the admin presses ⛔️ Тоқтату while the first send of the first batch is in flight
+	var once sync.Once
+	fake.OnCall(func(c apiCall) {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			once.Do(func() {
+				h.BroadcastCancelHandler(context.Background(), b, &models.Update{CallbackQuery: &models.CallbackQuery{
+					ID: "cb", From: models.User{ID: admin}, Data: broadcastCancelData,
+				}})
+			})
+		}
+	})
+	h.runDueBroadcasts(context.Background(), b)
+
+	sends, stopped := 0, false
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			sends++
+		}
+		if c.Method == "editMessageText" && strings.Contains(c.Params["text"], "ТОҚТАТЫЛДЫ") {
+			stopped = true
+		}
+	}
+	if sends != broadcastBatchSize {
+		t.Errorf("%d sends, want the first batch of %d and nothing after", sends, broadcastBatchSize)
+	}
+	if !stopped {
+		t.Error("the status message was not edited to say the broadcast stopped")
+	}
+	var status string
+	var next int
+	if err := h.db.QueryRow(`SELECT status, next_index FROM broadcast_runs`).Scan(&status, &next); err != nil {
+		t.Fatal(err)
+	}
+	if status != domain.BroadcastCancelled || next != broadcastBatchSize {
+		t.Errorf("run status = %q at %d, want %q at %d", status, next, domain.BroadcastCancelled, broadcastBatchSize)
+	}
+	if stop, _ := h.redisClient.IsBroadcastCancelled(context.Background(), admin); stop {
+		t.Error("cancel flag left set after the run ended")
+	}
+}
+
+func TestWaitBroadcasts(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	scheduleBroadcast(t, h, 3)
+	// the first send hangs until the test lets it through
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	fake.OnCall(func(c apiCall) {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+		}
+	})
+	finished := make(chan struct{})
+	go func() {
+		h.runDueBroadcasts(context.Background(), b)
+		close(finished)
+	}()
+	<-started
+
+	if h.WaitBroadcasts(20 * time.Millisecond) {
+		t.Fatal("WaitBroadcasts reported done while a send was still in flight")
+	}
+	if h.beginBroadcast() {
+		h.broadcasts.Done()
+		t.Error("a new broadcast was allowed to start after shutdown began")
+	}
+
+	waited := make(chan bool)
+	go func() { waited <- h.WaitBroadcasts(5 * time.Second) }()
+	select {
+	case <-waited:
+		t.Fatal("WaitBroadcasts returned before the broadcast finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if !<-waited {
+		t.Fatal("WaitBroadcasts timed out although the broadcast finished")
+	}
+	<-finished
+}
+
+func TestBroadcastEmptyAudienceSuccessRate(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	run := &domain.BroadcastRun{
+		AdminID:  h.cfg.AdminIDs[0],
+		Audience: audienceAll,
+		Payload:  domain.BroadcastPayload{Type: "text", Caption: "hello"},
+	}
+	if err := h.broadcastRepo.CreateRun(ctx, run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !h.beginBroadcast() {
+		t.Fatal("beginBroadcast refused")
+	}
+	if err := h.runBroadcast(ctx, b, run, nil); err != nil {
+		t.Fatalf("runBroadcast: %v", err)
+	}
+
+	var final string
+	for _, c := range fake.Calls() {
+		if c.Method == "editMessageText" && strings.Contains(c.Params["text"], "АЯҚТАЛДЫ") {
+			final = c.Params["text"]
+		}
+	}
+	if !strings.Contains(final, "Сәттілік: 0.0%") || strings.Contains(final, "NaN") {
+		t.Fatalf("final report = %q, want a 0.0%% success rate", final)
+	}
+}
+
+func TestCancelDuringBroadcastCompose(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	admin := h.cfg.AdminIDs[0]
+	send := func(text string) {
+		h.DefaultHandler(ctx, b, &models.Update{Message: &models.Message{
+			ID: 1, From: &models.User{ID: admin}, Chat: models.Chat{ID: admin}, Text: text,
+		}})
+	}
+
+	// the admin picks an audience, and a ⛔️ from an earlier run is still set
+	if err := h.redisClient.SaveUserState(ctx, admin, &domain.UserState{State: stateBroadcast}); err != nil {
+		t.Fatal(err)
+	}
+	send("📢 Барлығына жіберу")
+	if s, _ := h.redisClient.GetUserState(ctx, admin); s == nil || s.State != stateBroadcast || s.BroadCastType != audienceAll {
+		t.Fatalf("state after picking the audience = %+v", s)
+	}
+	h.redisClient.SetBroadcastCancel(ctx, admin)
+	fake.Calls()
+
+	send("/cancel")
+	if s, _ := h.redisClient.GetUserState(ctx, admin); s == nil || s.State != stateStart || s.BroadCastType != "" {
+		t.Errorf("state after /cancel = %+v, want a fresh %s", s, stateStart)
+	}
+	if stop, _ := h.redisClient.IsBroadcastCancelled(ctx, admin); stop {
+		t.Error("cancel flag left set after /cancel")
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].Params["text"], "Болдырылды") {
+		t.Fatalf("calls after /cancel:\n%s", formatCalls(calls))
+	}
+
+	// the next message is not taken as broadcast content
+	send("hello")
+	for _, c := range fake.Calls() {
+		if strings.Contains(c.Params["reply_markup"], "bsend_") {
+			t.Errorf("message after /cancel was previewed as a broadcast:\n%s", formatCalls([]apiCall{c}))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// Callback data of the buttons under a broadcast preview
+const (
+	broadcastPreviewPrefix = "bsend_"
+	broadcastConfirmData   = broadcastPreviewPrefix + "confirm"
+	broadcastDiscardData   = broadcastPreviewPrefix + "discard"
+	broadcastScheduleData  = broadcastPreviewPrefix + "schedule"
+)
+
+// previewBroadcast sends payload to the admin exactly as recipients will get it and
+// asks for confirmation; the payload waits in the admin's state until then. If the
+// preview can't be sent, the broadcast would fail the same way, so it is not offered.
+func (h *Handler) previewBroadcast(ctx context.Context, b *bot.Bot, adminId int64, state *domain.UserState, payload domain.BroadcastPayload) {
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "👁 Алдын ала қарау: алушылар хабарламаны былай көреді 👇"})
+	payload.Unprotected = !state.Protected
+	if err := h.sendToUser(ctx, b, adminId, payload); err != nil {
+		h.logger.Warn("Broadcast preview failed", zap.String("msg_type", payload.Type), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: adminId,
+			Text:   fmt.Sprintf("⚠️ Алдын ала көрсету мүмкін болмады, хабарлама жіберілмейді:\n%s\n\nБасқа хабарлама жіберіңіз.", err.Error()),
+		})
+		return
+	}
+
+	next := *state
+	next.Pending = &payload
+	if err := h.redisClient.SaveUserState(ctx, adminId, &next); err != nil {
+		h.logger.Error("Failed to save admin state to Redis", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Қате: хабарламаны сақтау мүмкін болмады"})
+		return
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: adminId,
+		Text:   fmt.Sprintf("🎯 Аудитория: %s\n%s\n\nЖіберейік пе?", h.getBroadcastTypeName(state.BroadCastType), protectLabel(state.Protected)),
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					{Text: "✅ Жіберу", CallbackData: broadcastConfirmData},
+					{Text: "✖️ Болдырмау", CallbackData: broadcastDiscardData},
+				},
+				{{Text: "⏰ Уақытын белгілеу", CallbackData: broadcastScheduleData}},
+			},
+		},
+	})
+	if err != nil {
+		h.logger.Error("Failed to send broadcast confirmation", zap.Error(err))
+	}
+}
+
+// BroadcastConfirmHandler handles the buttons under a broadcast preview: send the
+// pending message now or at a set time, or discard it so the admin can compose another one
+func (h *Handler) BroadcastConfirmHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	adminId := cq.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", adminId))
+		return
+	}
+	answer := func(text string) {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: text})
+	}
+
+	state, err := h.redisClient.GetUserState(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to get admin state from Redis", zap.Error(err))
+	}
+	// the buttons go either way: the preview is answered once
+	h.dropCallbackButtons(ctx, b, cq)
+	if state == nil || state.State != stateBroadcast || state.Pending == nil {
+		answer("Хабарлама табылмады, қайта жіберіңіз")
+		return
+	}
+
+	if cq.Data == broadcastScheduleData {
+		answer("")
+		h.askScheduleTime(ctx, b, adminId, state)
+		return
+	}
+
+	payload := *state.Pending
+	state.Pending = nil
+	if err := h.redisClient.SaveUserState(ctx, adminId, state); err != nil {
+		h.logger.Error("Failed to save admin state to Redis", zap.Error(err))
+	}
+
+	if cq.Data != broadcastConfirmData {
+		answer("✖️ Болдырылмады")
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "Басқа хабарлама жіберіңіз немесе 🔙 Артқа басыңыз."})
+		return
+	}
+
+	answer("📤 Жіберілуде...")
+	// the protection toggle may have changed since the preview
+	payload.Unprotected = !state.Protected
+	h.logger.Info("Starting broadcast", zap.String("type", state.BroadCastType), zap.String("msg_type", payload.Type))
+	h.launchBroadcast(ctx, b, adminId, state.BroadCastType, payload)
+}
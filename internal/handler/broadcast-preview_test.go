@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBroadcastPreviewGoesToAdmin(t *testing.T) {
+	h, mem, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	// the second admin composes, so a preview sent to AdminID would show up
+	h.cfg.AdminIDs = []int64{1000, 2000}
+	const admin = 2000
+	if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: 1, UserName: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	compose := func(msg *models.Message) {
+		if err := mem.SaveUserState(ctx, admin, &domain.UserState{State: stateBroadcast, BroadCastType: audienceAll, Protected: true}); err != nil {
+			t.Fatal(err)
+		}
+		msg.From, msg.Chat = &models.User{ID: admin}, models.Chat{ID: admin}
+		h.AdminHandler(ctx, b, &models.Update{Message: msg})
+	}
+
+	compose(&models.Message{ID: 5, Text: "promo"})
+	calls := fake.Calls()
+	var preview, confirm bool
+	for _, c := range calls {
+		if c.Params["chat_id"] != "2000" {
+			t.Errorf("%s went to chat %q before the admin confirmed", c.Method, c.Params["chat_id"])
+		}
+		preview = preview || (c.Method == "sendMessage" && c.Params["text"] == "promo")
+		confirm = confirm || strings.Contains(c.Params["reply_markup"], broadcastConfirmData)
+	}
+	if !preview || !confirm {
+		t.Fatalf("preview sent %v, confirmation offered %v; calls:\n%s", preview, confirm, formatCalls(calls))
+	}
+	state, err := mem.GetUserState(ctx, admin)
+	if err != nil || state.Pending == nil || state.Pending.Caption != "promo" {
+		t.Fatalf("pending payload = %+v, %v", state, err)
+	}
+
+	// a preview Telegram rejects is reported and nothing is offered for sending
+	fake.Fail("sendPhoto", 400, "Bad Request: wrong file identifier/HTTP URL specified")
+	compose(&models.Message{ID: 6, Photo: []models.PhotoSize{{FileID: "bad"}}})
+	calls = fake.Calls()
+	var reported bool
+	for _, c := range calls {
+		if c.Params["chat_id"] != "2000" {
+			t.Errorf("%s went to chat %q", c.Method, c.Params["chat_id"])
+		}
+		if strings.Contains(c.Params["reply_markup"], broadcastConfirmData) {
+			t.Error("confirmation offered after the preview failed")
+		}
+		reported = reported || strings.Contains(c.Params["text"], "wrong file identifier")
+	}
+	if !reported {
+		t.Errorf("preview failure not reported; calls:\n%s", formatCalls(calls))
+	}
+	if state, _ := mem.GetUserState(ctx, admin); state == nil || state.Pending != nil {
+		t.Errorf("state after a failed preview = %+v, want no pending payload", state)
+	}
+}
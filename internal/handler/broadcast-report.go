@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+// Error classes in the broadcast report
+const (
+	failBlocked     = "blocked"
+	failDeactivated = "deactivated"
+	failRateLimited = "rate_limited"
+	failOther       = "other"
+)
+
+// broadcastFailure is one recipient the broadcast could not reach
+type broadcastFailure struct {
+	UserID int64
+	Class  string
+	Err    string
+}
+
+// broadcastErrorClass groups Telegram send errors for the report
+func broadcastErrorClass(err error) string {
+	switch {
+	case bot.IsTooManyRequestsError(err) || errors.Is(err, bot.ErrorTooManyRequests):
+		return failRateLimited
+	case isDeactivated(err):
+		return failDeactivated
+	case isBlockedErr(err):
+		return failBlocked
+	default:
+		return failOther
+	}
+}
+
+var broadcastReportHeaders = []string{"UserID", "UserName", "Status", "Error"}
+
+// sendBroadcastReport writes the failed recipients to an xlsx, sends it to the admin
+// and remembers it for the "📄 Соңғы есеп" button, so the file is kept after sending.
+// Successful sends are only counted.
+func (h *Handler) sendBroadcastReport(ctx context.Context, b *bot.Bot, run *domain.BroadcastRun, failures []broadcastFailure, sent int) {
+	sort.Slice(failures, func(i, j int) bool { return failures[i].UserID < failures[j].UserID })
+
+	ids := make([]int64, len(failures))
+	for i, f := range failures {
+		ids[i] = f.UserID
+	}
+	names, err := h.userRepo.GetJustUserNames(ctx, ids)
+	if err != nil {
+		h.logger.Warn("broadcast report: user names lookup failed", zap.Error(err))
+	}
+
+	if err := os.MkdirAll(h.cfg.ExcelDir, 0755); err != nil {
+		h.logger.Error("Failed to create excel dir", zap.String("dir", h.cfg.ExcelDir), zap.Error(err))
+		return
+	}
+	filePath := filepath.Join(h.cfg.ExcelDir, fmt.Sprintf("broadcast_%d_%s.xlsx", run.ID, time.Now().Format("20060102_150405")))
+	if err := writeBroadcastReport(filePath, failures, names, sent); err != nil {
+		h.logger.Error("Failed to write broadcast report", zap.Int64("run", run.ID), zap.Error(err))
+		os.Remove(filePath)
+		return
+	}
+
+	if err := h.redisClient.SaveBroadcastReport(ctx, run.AdminID, filePath, h.cfg.ExcelRetention); err != nil {
+		h.logger.Warn("Failed to remember broadcast report", zap.Error(err))
+	}
+	h.sendExportFile(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: run.AdminID}}},
+		filePath, fmt.Sprintf("📄 Хабарлама есебі\n✅ Сәтті: %d\n❌ Қате: %d", sent, len(failures)), true)
+}
+
+func writeBroadcastReport(filePath string, failures []broadcastFailure, names map[int64]string, sent int) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Қателер"
+	f.SetSheetName("Sheet1", sheet)
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	sw.SetColWidth(1, 2, 20)
+	sw.SetColWidth(3, 3, 14)
+	sw.SetColWidth(4, 4, 60)
+
+	headers := make([]interface{}, len(broadcastReportHeaders))
+	for i, title := range broadcastReportHeaders {
+		headers[i] = title
+	}
+	if err := sw.SetRow(cellRef(1, 1), headers); err != nil {
+		return err
+	}
+	for i, fl := range failures {
+		if err := sw.SetRow(cellRef(i+2, 1), []interface{}{fl.UserID, names[fl.UserID], fl.Class, fl.Err}); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	// summary sheet: successes by count only, failures by class
+	summary := "Қорытынды"
+	if _, err := f.NewSheet(summary); err != nil {
+		return err
+	}
+	byClass := make(map[string]int)
+	for _, fl := range failures {
+		byClass[fl.Class]++
+	}
+	rows := [][]interface{}{
+		{"sent", sent},
+		{failBlocked, byClass[failBlocked]},
+		{failDeactivated, byClass[failDeactivated]},
+		{failRateLimited, byClass[failRateLimited]},
+		{failOther, byClass[failOther]},
+	}
+	for i, row := range rows {
+		if err := f.SetSheetRow(summary, cellRef(i+1, 1), &row); err != nil {
+			return err
+		}
+	}
+	return f.SaveAs(filePath)
+}
+
+// handleLastReport re-sends the most recent broadcast report
+func (h *Handler) handleLastReport(ctx context.Context, b *bot.Bot, update *models.Update) {
+	adminId := update.Message.From.ID
+	if !h.IsAdmin(adminId) {
+		return
+	}
+
+	path, err := h.redisClient.GetBroadcastReport(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to get broadcast report path", zap.Error(err))
+	}
+	if path == "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "📭 Соңғы хабарлама есебі жоқ"})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "📭 Есеп файлы табылмады (ескі файлдар автоматты түрде өшіріледі)"})
+		return
+	}
+	h.sendExportFile(ctx, b, update, path, "📄 Соңғы хабарлама есебі", true)
+}
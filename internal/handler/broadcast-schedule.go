@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduledButton = "🗓 Жоспарланғандар"
+	// scheduleTimeLayout is how admins type a send time
+	scheduleTimeLayout = "2006-01-02 15:04"
+
+	scheduledCallbackPrefix = "bsched_"
+	scheduledCancelPrefix   = scheduledCallbackPrefix + "del_"
+)
+
+// scheduleLocation is the zone send times are typed and shown in
+func (h *Handler) scheduleLocation() *time.Location {
+	loc, err := time.LoadLocation(h.cfg.ScheduleTimezone)
+	if err != nil {
+		h.logger.Warn("Unknown schedule timezone, using UTC+5", zap.String("tz", h.cfg.ScheduleTimezone), zap.Error(err))
+		return time.FixedZone("UTC+5", 5*60*60)
+	}
+	return loc
+}
+
+// askScheduleTime moves the admin to stateScheduleTime; the pending broadcast stays
+// in the state until the admin types when to send it
+func (h *Handler) askScheduleTime(ctx context.Context, b *bot.Bot, adminId int64, state *domain.UserState) {
+	state.State = stateScheduleTime
+	if err := h.redisClient.SaveUserState(ctx, adminId, state); err != nil {
+		h.logger.Error("Failed to save admin state to Redis", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Қате: қайта көріңіз"})
+		return
+	}
+	example := time.Now().In(h.scheduleLocation()).Add(time.Hour).Format(scheduleTimeLayout)
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: adminId,
+		Text:   fmt.Sprintf("⏰ Жіберу уақытын жазыңыз (%s уақыты):\n\nМысалы: %s", h.cfg.ScheduleTimezone, example),
+		ReplyMarkup: &models.ReplyKeyboardMarkup{
+			Keyboard:       [][]models.KeyboardButton{{{Text: "🔙 Артқа (Back)"}}},
+			ResizeKeyboard: true,
+		},
+	})
+}
+
+// handleScheduleTime queues the pending broadcast for the time the admin typed
+func (h *Handler) handleScheduleTime(ctx context.Context, b *bot.Bot, update *models.Update, state *domain.UserState) {
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
+	}
+	reply := func(text string) {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text})
+	}
+	backToBroadcast := func() {
+		if err := h.redisClient.SaveUserState(ctx, adminId, &domain.UserState{State: stateBroadcast, BroadCastType: state.BroadCastType, Protected: state.Protected}); err != nil {
+			h.logger.Error("Failed to save broadcast state to Redis", zap.Error(err))
+		}
+		h.startBroadcast(ctx, b, update, state.BroadCastType)
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "🔙 Артқа (Back)" || state.Pending == nil {
+		backToBroadcast()
+		return
+	}
+	loc := h.scheduleLocation()
+	runAt, err := time.ParseInLocation(scheduleTimeLayout, text, loc)
+	if err != nil {
+		reply(fmt.Sprintf("⚠️ Уақыт форматы: %s. Қайта жазыңыз:", time.Now().In(loc).Add(time.Hour).Format(scheduleTimeLayout)))
+		return
+	}
+	if !runAt.After(time.Now()) {
+		reply("⚠️ Уақыт өтіп кеткен. Болашақ уақытты жазыңыз:")
+		return
+	}
+
+	payload := *state.Pending
+	payload.Unprotected = !state.Protected
+	sb := &domain.ScheduledBroadcast{AdminID: adminId, Audience: state.BroadCastType, Payload: payload, RunAt: runAt}
+	if err := h.broadcastRepo.CreateScheduled(ctx, sb); err != nil {
+		h.logger.Error("Failed to schedule broadcast", zap.Error(err))
+		reply("❌ Қате: жоспарлау мүмкін болмады")
+		return
+	}
+	h.logger.Info("Broadcast scheduled", zap.Int64("scheduled", sb.ID), zap.Time("run_at", runAt), zap.String("type", sb.Audience), zap.Int64("admin", adminId))
+	reply(fmt.Sprintf("✅ #%d жоспарланды: %s\n🎯 Аудитория: %s", sb.ID, runAt.Format(scheduleTimeLayout), h.getBroadcastTypeName(sb.Audience)))
+	backToBroadcast()
+}
+
+// handleScheduledList shows the pending scheduled broadcasts with cancel buttons
+func (h *Handler) handleScheduledList(ctx context.Context, b *bot.Bot, adminId int64) {
+	list, err := h.broadcastRepo.ListPendingScheduled(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list scheduled broadcasts", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Қате: тізімді алу мүмкін болмады"})
+		return
+	}
+	if len(list) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "🗓 Жоспарланған хабарлама жоқ."})
+		return
+	}
+
+	loc := h.scheduleLocation()
+	var rows [][]models.InlineKeyboardButton
+	for _, sb := range list {
+		rows = append(rows, []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("🗑 #%d %s · %s · %s", sb.ID, sb.RunAt.In(loc).Format(scheduleTimeLayout), sb.Payload.Type, h.getBroadcastTypeName(sb.Audience)),
+			CallbackData: scheduledCancelPrefix + strconv.FormatInt(sb.ID, 10),
+		}})
+	}
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      adminId,
+		Text:        "🗓 ЖОСПАРЛАНҒАНДАР\n\nБолдырмау үшін басыңыз:",
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: rows},
+	}); err != nil {
+		h.logger.Error("Failed to send scheduled list", zap.Error(err))
+	}
+}
+
+// ScheduledBroadcastHandler handles the bsched_ buttons: cancel a scheduled broadcast
+func (h *Handler) ScheduledBroadcastHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	adminId := cq.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", adminId))
+		return
+	}
+	answer := func(text string) {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: text})
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(cq.Data, scheduledCancelPrefix), 10, 64)
+	if !strings.HasPrefix(cq.Data, scheduledCancelPrefix) || err != nil {
+		h.logger.Warn("Bad scheduled broadcast callback", zap.String("data", cq.Data))
+		return
+	}
+	ok, err := h.broadcastRepo.CancelScheduled(ctx, id)
+	switch {
+	case err != nil:
+		h.logger.Error("Failed to cancel scheduled broadcast", zap.Int64("scheduled", id), zap.Error(err))
+		answer("❌ Қате")
+		return
+	case !ok:
+		answer("Бұл хабарлама жіберіліп қойған немесе болдырылған")
+	default:
+		h.logger.Info("Scheduled broadcast cancelled", zap.Int64("scheduled", id), zap.Int64("admin", adminId))
+		answer("🗑 Болдырылды")
+	}
+	h.dropCallbackButtons(ctx, b, cq)
+	h.handleScheduledList(ctx, b, adminId)
+}
+
+// startBroadcastScheduler polls the database for due scheduled broadcasts until ctx
+// is done. Polling the table instead of arming timers is what lets them survive a restart.
+func (h *Handler) startBroadcastScheduler(ctx context.Context, b *bot.Bot) {
+	if n, err := h.broadcastRepo.FailStaleScheduled(ctx); err != nil {
+		h.logger.Error("Failed to clean up scheduled broadcasts", zap.Error(err))
+	} else if n > 0 {
+		h.logger.Warn("Scheduled broadcasts interrupted by restart marked failed", zap.Int64("count", n))
+	}
+
+	ticker := time.NewTicker(h.cfg.SchedulePollInterval)
+	defer ticker.Stop()
+	for {
+		h.runDueBroadcasts(ctx, b)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueBroadcasts claims the due scheduled broadcasts and sends them one after
+// another through the regular fan-out
+func (h *Handler) runDueBroadcasts(ctx context.Context, b *bot.Bot) {
+	due, err := h.broadcastRepo.ClaimDueScheduled(ctx, time.Now())
+	if err != nil {
+		h.logger.Error("Failed to claim scheduled broadcasts", zap.Error(err))
+		return
+	}
+	for _, sb := range due {
+		h.logger.Info("Starting scheduled broadcast", zap.Int64("scheduled", sb.ID), zap.String("type", sb.Audience))
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: sb.AdminID,
+			Text:   fmt.Sprintf("⏰ Жоспарланған #%d хабарлама жіберіле бастады", sb.ID),
+		})
+
+		status, errText := domain.ScheduledSent, ""
+		err := h.launchBroadcast(ctx, b, sb.AdminID, sb.Audience, sb.Payload)
+		switch {
+		case errors.Is(err, errBroadcastCancelled):
+			status, errText = domain.ScheduledCancelled, err.Error()
+			h.logger.Info("Scheduled broadcast cancelled while sending", zap.Int64("scheduled", sb.ID))
+		case err != nil:
+			status, errText = domain.ScheduledFailed, err.Error()
+			h.logger.Error("Scheduled broadcast failed", zap.Int64("scheduled", sb.ID), zap.Error(err))
+		}
+		// recorded even when shutdown interrupted the run
+		if err := h.broadcastRepo.FinishScheduled(context.WithoutCancel(ctx), sb.ID, status, errText); err != nil {
+			h.logger.Error("Failed to record scheduled broadcast result", zap.Int64("scheduled", sb.ID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scheduleBroadcast queues a text broadcast to everyone, due a minute ago, for
+// recipients users in just
+func scheduleBroadcast(t *testing.T, h *Handler, recipients int) int64 {
+	t.Helper()
+	ctx := context.Background()
+	for i := 1; i <= recipients; i++ {
+		if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: int64(i), UserName: "u"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sb := &domain.ScheduledBroadcast{
+		AdminID:  h.cfg.AdminIDs[0],
+		Audience: audienceAll,
+		Payload:  domain.BroadcastPayload{Type: "text", Caption: "hello"},
+		RunAt:    time.Now().Add(-time.Minute),
+	}
+	if err := h.broadcastRepo.CreateScheduled(ctx, sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.ID
+}
+
+func scheduledStatus(t *testing.T, h *Handler, id int64) (status, errText string) {
+	t.Helper()
+	err := h.db.QueryRow(`SELECT status, error FROM scheduled_broadcasts WHERE id = ?`, id).Scan(&status, &errText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, errText
+}
+
+func TestRunDueBroadcastsRecordsOutcome(t *testing.T) {
+	t.Run("sent", func(t *testing.T) {
+		h, _, _, b := newTestHandler(t)
+		id := scheduleBroadcast(t, h, 3)
+		h.runDueBroadcasts(context.Background(), b)
+		if status, _ := scheduledStatus(t, h, id); status != domain.ScheduledSent {
+			t.Fatalf("status = %q, want sent", status)
+		}
+	})
+
+	t.Run("cancelled by the admin", func(t *testing.T) {
+		h, mem, f, b := newTestHandler(t)
+		id := scheduleBroadcast(t, h, 2*broadcastBatchSize)
+		var once sync.Once
+		f.OnCall(func(c apiCall) {
+			if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+				once.Do(func() { mem.SetBroadcastCancel(context.Background(), h.cfg.AdminIDs[0]) })
+			}
+		})
+		h.runDueBroadcasts(context.Background(), b)
+		if status, _ := scheduledStatus(t, h, id); status != domain.ScheduledCancelled {
+			t.Fatalf("status = %q, want cancelled", status)
+		}
+	})
+
+	t.Run("interrupted by shutdown", func(t *testing.T) {
+		h, _, f, b := newTestHandler(t)
+		id := scheduleBroadcast(t, h, 2*broadcastBatchSize)
+		ctx, cancel := context.WithCancel(context.Background())
+		f.OnCall(func(c apiCall) {
+			if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+				cancel()
+			}
+		})
+		h.runDueBroadcasts(ctx, b)
+		status, errText := scheduledStatus(t, h, id)
+		if status != domain.ScheduledFailed || errText != errBroadcastInterrupted.Error() {
+			t.Fatalf("status = %q (%q), want failed (%q)", status, errText, errBroadcastInterrupted)
+		}
+	})
+
+	t.Run("no recipients", func(t *testing.T) {
+		h, _, _, b := newTestHandler(t)
+		id := scheduleBroadcast(t, h, 0)
+		h.runDueBroadcasts(context.Background(), b)
+		if status, _ := scheduledStatus(t, h, id); status != domain.ScheduledFailed {
+			t.Fatalf("status = %q, want failed", status)
+		}
+	})
+}
+
+func TestRunDueBroadcastsSendsOnce(t *testing.T) {
+	h, _, f, b := newTestHandler(t)
+	scheduleBroadcast(t, h, 3)
+
+	// two pollers racing, then a later poll: every recipient gets the message once
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runDueBroadcasts(context.Background(), b)
+		}()
+	}
+	wg.Wait()
+	h.runDueBroadcasts(context.Background(), b)
+
+	got := map[string]int{}
+	for _, c := range f.Calls() {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			got[c.Params["chat_id"]]++
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		if n := got[fmt.Sprint(i)]; n != 1 {
+			t.Errorf("user %d got the broadcast %d times", i, n)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	templatesButton = "📋 Үлгілер"
+	// templateNameMaxRunes keeps names short enough for an inline button
+	templateNameMaxRunes = 40
+
+	// Callback data of the template buttons
+	templateCallbackPrefix = "btpl_"
+	templateSaveData       = templateCallbackPrefix + "save"
+	templateCancelData     = templateCallbackPrefix + "cancel"
+	templateUsePrefix      = templateCallbackPrefix + "use_"
+	templateSendPrefix     = templateCallbackPrefix + "send_"
+	templateDeletePrefix   = templateCallbackPrefix + "del_"
+)
+
+// handleTemplates lists the saved broadcast templates with use / delete buttons
+// and offers to save the admin's last broadcast as a new one
+func (h *Handler) handleTemplates(ctx context.Context, b *bot.Bot, adminId int64) {
+	templates, err := h.broadcastRepo.ListTemplates(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list broadcast templates", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Қате: үлгілерді алу мүмкін болмады"})
+		return
+	}
+
+	text := "📋 ҮЛГІЛЕР\n\nЖіберу үшін үлгіні таңдаңыз:"
+	if len(templates) == 0 {
+		text = "📋 ҮЛГІЛЕР\n\nСақталған үлгі жоқ."
+	}
+	var rows [][]models.InlineKeyboardButton
+	for _, t := range templates {
+		id := strconv.FormatInt(t.ID, 10)
+		rows = append(rows, []models.InlineKeyboardButton{
+			{Text: fmt.Sprintf("▶️ %s (%s)", t.Name, t.Payload.Type), CallbackData: templateUsePrefix + id},
+			{Text: "🗑", CallbackData: templateDeletePrefix + id},
+		})
+	}
+	rows = append(rows, []models.InlineKeyboardButton{
+		{Text: "💾 Соңғы хабарламаны сақтау", CallbackData: templateSaveData},
+	})
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      adminId,
+		Text:        text,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: rows},
+	}); err != nil {
+		h.logger.Error("Failed to send template list", zap.Error(err))
+	}
+}
+
+// BroadcastTemplateHandler handles the btpl_ buttons: save the last broadcast,
+// preview a template, send it, or delete it
+func (h *Handler) BroadcastTemplateHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	adminId := cq.From.ID
+	if !h.IsAdmin(adminId) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", adminId))
+		return
+	}
+	answer := func(text string) {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: text})
+	}
+
+	switch cq.Data {
+	case templateSaveData:
+		h.askTemplateName(ctx, b, adminId)
+		answer("")
+		return
+	case templateCancelData:
+		h.dropCallbackButtons(ctx, b, cq)
+		answer("✖️ Болдырылмады")
+		return
+	}
+
+	var prefix string
+	for _, p := range []string{templateUsePrefix, templateSendPrefix, templateDeletePrefix} {
+		if strings.HasPrefix(cq.Data, p) {
+			prefix = p
+		}
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(cq.Data, prefix), 10, 64)
+	if prefix == "" || err != nil {
+		h.logger.Warn("Bad template callback", zap.String("data", cq.Data))
+		return
+	}
+
+	if prefix == templateDeletePrefix {
+		ok, err := h.broadcastRepo.DeleteTemplate(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to delete broadcast template", zap.Int64("template", id), zap.Error(err))
+			answer("❌ Қате")
+			return
+		}
+		if !ok {
+			answer("Үлгі табылмады")
+			return
+		}
+		answer("🗑 Өшірілді")
+		h.dropCallbackButtons(ctx, b, cq)
+		h.handleTemplates(ctx, b, adminId)
+		return
+	}
+
+	t, err := h.broadcastRepo.GetTemplate(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to load broadcast template", zap.Int64("template", id), zap.Error(err))
+	}
+	if t == nil {
+		answer("Үлгі табылмады")
+		return
+	}
+	state, err := h.redisClient.GetUserState(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to get admin state from Redis", zap.Error(err))
+	}
+	if state == nil || state.State != stateBroadcast || state.BroadCastType == "" {
+		answer("Алдымен аудиторияны таңдаңыз")
+		return
+	}
+
+	if prefix == templateUsePrefix {
+		answer("")
+		h.previewTemplate(ctx, b, adminId, t, state.BroadCastType)
+		return
+	}
+
+	answer("📤 Жіберілуде...")
+	h.dropCallbackButtons(ctx, b, cq)
+	h.logger.Info("Starting broadcast from template", zap.Int64("template", t.ID), zap.String("type", state.BroadCastType))
+	payload := t.Payload
+	payload.Unprotected = !state.Protected
+	h.launchBroadcast(ctx, b, adminId, state.BroadCastType, payload)
+}
+
+// previewTemplate sends the template to the admin before asking for confirmation.
+// The preview doubles as a check that a stored file_id is still sendable: Telegram
+// rejects stale ones, and then the broadcast is not offered at all.
+func (h *Handler) previewTemplate(ctx context.Context, b *bot.Bot, adminId int64, t *domain.BroadcastTemplate, audience string) {
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: fmt.Sprintf("👁 «%s» үлгісі алушыларға былай көрінеді:", t.Name)})
+	if err := h.sendToUser(ctx, b, adminId, t.Payload); err != nil {
+		h.logger.Warn("Broadcast template is not sendable", zap.Int64("template", t.ID), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: adminId,
+			Text:   fmt.Sprintf("⚠️ «%s» үлгісін жіберу мүмкін емес, файл ескірген болуы мүмкін. Үлгіні қайта сақтаңыз.\n%s", t.Name, err.Error()),
+		})
+		return
+	}
+
+	id := strconv.FormatInt(t.ID, 10)
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: adminId,
+		Text:   fmt.Sprintf("🎯 Аудитория: %s\n\nЖіберейік пе?", h.getBroadcastTypeName(audience)),
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					{Text: "✅ Жіберу", CallbackData: templateSendPrefix + id},
+					{Text: "✖️ Болдырмау", CallbackData: templateCancelData},
+				},
+			},
+		},
+	})
+	if err != nil {
+		h.logger.Error("Failed to send template confirmation", zap.Error(err))
+	}
+}
+
+// askTemplateName moves the admin to stateTemplateName; the next text becomes the
+// name of a template holding the admin's last broadcast
+func (h *Handler) askTemplateName(ctx context.Context, b *bot.Bot, adminId int64) {
+	run, err := h.broadcastRepo.GetLastRun(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to load last broadcast", zap.Error(err))
+	}
+	if run == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "📭 Сақтайтын хабарлама жоқ: әлі ешнәрсе жіберілмеген"})
+		return
+	}
+
+	// keep the chosen audience so the admin returns to the same compose step
+	state, err := h.redisClient.GetUserState(ctx, adminId)
+	if err != nil {
+		h.logger.Error("Failed to get admin state from Redis", zap.Error(err))
+	}
+	next := &domain.UserState{State: stateTemplateName}
+	if state != nil {
+		next.BroadCastType, next.Protected = state.BroadCastType, state.Protected
+	}
+	if err := h.redisClient.SaveUserState(ctx, adminId, next); err != nil {
+		h.logger.Error("Failed to save admin state to Redis", zap.Error(err))
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: adminId,
+		Text:   fmt.Sprintf("💾 Соңғы хабарлама (%s) үлгі ретінде сақталады.\n\nҮлгі атын жазыңыз (%d таңбаға дейін):", run.Payload.Type, templateNameMaxRunes),
+		ReplyMarkup: &models.ReplyKeyboardMarkup{
+			Keyboard:       [][]models.KeyboardButton{{{Text: "🔙 Артқа (Back)"}}},
+			ResizeKeyboard: true,
+		},
+	})
+}
+
+// handleTemplateName saves the admin's last broadcast under the name they typed
+func (h *Handler) handleTemplateName(ctx context.Context, b *bot.Bot, update *models.Update, state *domain.UserState) {
+	adminId := update.Message.From.ID
+	if !h.requireAdmin(ctx, b, adminId) {
+		return
+	}
+	reply := func(text string) {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text})
+	}
+	backToBroadcast := func() {
+		if err := h.redisClient.SaveUserState(ctx, adminId, &domain.UserState{State: stateBroadcast, BroadCastType: state.BroadCastType, Protected: state.Protected}); err != nil {
+			h.logger.Error("Failed to save broadcast state to Redis", zap.Error(err))
+		}
+		if state.BroadCastType != "" {
+			h.startBroadcast(ctx, b, update, state.BroadCastType)
+		} else {
+			h.handleBroadcastMenu(ctx, b, update)
+		}
+	}
+
+	name := strings.TrimSpace(update.Message.Text)
+	if name == "🔙 Артқа (Back)" {
+		backToBroadcast()
+		return
+	}
+	if name == "" || utf8.RuneCountInString(name) > templateNameMaxRunes {
+		reply(fmt.Sprintf("⚠️ Атауы 1-%d таңба болуы керек. Қайта жазыңыз:", templateNameMaxRunes))
+		return
+	}
+
+	run, err := h.broadcastRepo.GetLastRun(ctx, adminId)
+	if err != nil || run == nil {
+		h.logger.Error("Failed to load last broadcast", zap.Error(err))
+		reply("❌ Қате: соңғы хабарламаны алу мүмкін болмады")
+		backToBroadcast()
+		return
+	}
+	id, err := h.broadcastRepo.SaveTemplate(ctx, name, run.Payload, adminId)
+	if err != nil {
+		h.logger.Error("Failed to save broadcast template", zap.String("name", name), zap.Error(err))
+		reply("❌ Қате: үлгіні сақтау мүмкін болмады")
+		backToBroadcast()
+		return
+	}
+	h.logger.Info("Broadcast template saved", zap.Int64("template", id), zap.String("name", name), zap.Int64("admin", adminId))
+	reply(fmt.Sprintf("✅ «%s» үлгісі сақталды", name))
+	backToBroadcast()
+}
+
+// dropCallbackButtons removes the inline keyboard a callback came from, so it can't be pressed twice
+func (h *Handler) dropCallbackButtons(ctx context.Context, b *bot.Bot, cq *models.CallbackQuery) {
+	if msg := cq.Message.Message; msg != nil {
+		b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{ChatID: msg.Chat.ID, MessageID: msg.ID})
+	}
+}
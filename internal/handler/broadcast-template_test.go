@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBroadcastTemplateSaveAndSend(t *testing.T) {
+	h, mem, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	admin := h.cfg.AdminIDs[0]
+	press := func(data string) {
+		h.BroadcastTemplateHandler(ctx, b, &models.Update{CallbackQuery: &models.CallbackQuery{ID: "cq", From: models.User{ID: admin}, Data: data}})
+	}
+	composing := func() {
+		if err := mem.SaveUserState(ctx, admin, &domain.UserState{State: stateBroadcast, BroadCastType: audienceAll, Protected: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last broadcast is a text to users 1 and 2
+	scheduleBroadcast(t, h, 2)
+	h.runDueBroadcasts(ctx, b)
+	fake.Calls()
+
+	press(templateSaveData)
+	h.DefaultHandler(ctx, b, &models.Update{Message: &models.Message{ID: 1, From: &models.User{ID: admin}, Chat: models.Chat{ID: admin}, Text: "Күнделікті"}})
+	templates, err := h.broadcastRepo.ListTemplates(ctx)
+	if err != nil || len(templates) != 1 {
+		t.Fatalf("templates = %v, %v", templates, err)
+	}
+	tpl := templates[0]
+	if tpl.Name != "Күнделікті" || tpl.CreatedBy != admin || tpl.Payload.Type != "text" || tpl.Payload.Caption != "hello" {
+		t.Fatalf("saved template %+v", tpl)
+	}
+	fake.Calls()
+
+	// loading the template previews its message to the admin and offers to send it
+	composing()
+	id := strconv.FormatInt(tpl.ID, 10)
+	press(templateUsePrefix + id)
+	var preview, offered bool
+	for _, c := range fake.Calls() {
+		if c.Params["chat_id"] != "" && c.Params["chat_id"] != strconv.FormatInt(admin, 10) {
+			t.Errorf("%s went to chat %s during the preview", c.Method, c.Params["chat_id"])
+		}
+		preview = preview || (c.Method == "sendMessage" && c.Params["text"] == "hello")
+		offered = offered || strings.Contains(c.Params["reply_markup"], templateSendPrefix+id)
+	}
+	if !preview || !offered {
+		t.Fatalf("preview sent %v, send button offered %v", preview, offered)
+	}
+
+	press(templateSendPrefix + id)
+	sent := map[string]bool{}
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" && c.Params["text"] == "hello" {
+			sent[c.Params["chat_id"]] = true
+		}
+	}
+	// the admin is in just too since they wrote the template name to the bot
+	if len(sent) != 3 || !sent["1"] || !sent["2"] || !sent[strconv.FormatInt(admin, 10)] {
+		t.Errorf("template sent to %v, want users 1, 2 and the admin", sent)
+	}
+
+	// a stored file_id Telegram no longer accepts is caught by the preview
+	staleID, err := h.broadcastRepo.SaveTemplate(ctx, "stale", domain.BroadcastPayload{Type: "photo", FileID: "gone"}, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Fail("sendPhoto", 400, "Bad Request: wrong file identifier/HTTP URL specified")
+	composing()
+	press(templateUsePrefix + strconv.FormatInt(staleID, 10))
+	var warned bool
+	for _, c := range fake.Calls() {
+		if strings.Contains(c.Params["reply_markup"], templateSendPrefix) {
+			t.Error("stale template offered for sending")
+		}
+		warned = warned || strings.Contains(c.Params["text"], "wrong file identifier")
+	}
+	if !warned {
+		t.Error("admin not told the template can't be sent")
+	}
+}
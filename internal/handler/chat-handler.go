@@ -7,6 +7,7 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -19,7 +20,6 @@ func (h *Handler) InlineHandler(ctx context.Context, b *bot.Bot, update *models.
 	}
 
 	data := update.CallbackQuery.Data
-	fmt.Println(data)
 	if !strings.HasPrefix(data, "select_") {
 		return
 	}
@@ -31,14 +31,13 @@ func (h *Handler) InlineHandler(ctx context.Context, b *bot.Bot, update *models.
 		return
 	}
 
-	fmt.Println("id: ", selectedId)
-
 	ok, err := h.redisClient.CheckPartnerToEmpty(ctx, selectedId)
 	if err != nil {
 		h.logger.Error("error in check partner", zap.Error(err))
 		return
 	}
-	if ok {
+	// a banned user looks busy rather than revealing the ban
+	if ok || h.isBanned(ctx, selectedId) {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.CallbackQuery.From.ID,
 			Text:   fmt.Sprintf("Қолданушы қазір бос емес, күте тұрыңыз: %d", selectedId),
@@ -46,45 +45,47 @@ func (h *Handler) InlineHandler(ctx context.Context, b *bot.Bot, update *models.
 		return
 	}
 
-	if err := h.redisClient.SetPartner(ctx, update.CallbackQuery.From.ID, selectedId); err != nil {
+	if err := h.connectPartners(ctx, b, update.CallbackQuery.From.ID, selectedId); err != nil {
 		h.logger.Error("error in set partner", zap.Error(err))
-		return
 	}
+}
 
-	if err := h.redisClient.SetPartner(ctx, selectedId, update.CallbackQuery.From.ID); err != nil {
-		h.logger.Error("error in set partner", zap.Error(err))
-		return
+// partnerConnectedText greets both users once they are paired; %d is the other user's ID
+const partnerConnectedText = "Сіз сұхбаттасушыға ID арқылы қосылдыңыз: %d\nБұл чатта(боттың ішінде) барлық типтегі хабарламалар(📷 Фото, 🎥 Видео, 🔊 Аудио, 📍 Геолокация, 📄 Құжат, ❓ Сұрақтар) жіберуге болады! Жай ғана сәлем немесе фото видео жіберсеңіз болады 😉"
+
+// connectPartners stores the pairing in both directions and greets both users
+func (h *Handler) connectPartners(ctx context.Context, b *bot.Bot, userID, partnerID int64) error {
+	if err := h.redisClient.SetPartner(ctx, userID, partnerID, h.cfg.PartnerTTL); err != nil {
+		return err
+	}
+	if err := h.redisClient.SetPartner(ctx, partnerID, userID, h.cfg.PartnerTTL); err != nil {
+		return err
+	}
+	if err := h.redisClient.TouchChat(ctx, userID, partnerID, time.Now()); err != nil {
+		h.logger.Warn("failed to touch chat", zap.Error(err))
 	}
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.CallbackQuery.From.ID,
-		Text:   fmt.Sprintf("Сіз сұхбаттасушыға ID арқылы қосылдыңыз: %d\nБұл чатта(боттың ішінде) барлық типтегі хабарламалар(📷 Фото, 🎥 Видео, 🔊 Аудио, 📍 Геолокация, 📄 Құжат, ❓ Сұрақтар) жіберуге болады! Жай ғана сәлем немесе фото видео жіберсеңіз болады 😉", selectedId),
+		ChatID: userID,
+		Text:   fmt.Sprintf(partnerConnectedText, partnerID),
 	})
 	b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: selectedId,
-		Text:   fmt.Sprintf("Сіз сұхбаттасушыға ID арқылы қосылдыңыз: %d\nБұл чатта(боттың ішінде) барлық типтегі хабарламалар(📷 Фото, 🎥 Видео, 🔊 Аудио, 📍 Геолокация, 📄 Құжат, ❓ Сұрақтар) жіберуге болады! Жай ғана сәлем немесе фото видео жіберсеңіз болады 😉", update.CallbackQuery.From.ID),
+		ChatID: partnerID,
+		Text:   fmt.Sprintf(partnerConnectedText, userID),
 	})
+	return nil
 }
 
 // CallbackHandlerExit обрабатывает выход пользователя из чата.
 func (h *Handler) CallbackHandlerExit(ctx context.Context, b *bot.Bot, update *models.Update) {
 	userID := update.CallbackQuery.From.ID
-	partnerID, err := h.redisClient.GetUserPartner(ctx, userID)
+	partnerID, err := h.redisClient.RemoveUser(ctx, userID)
 	if err != nil {
-		fmt.Println("Ошибка при получении собеседника:", err)
-		return
-	}
-
-	if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-		fmt.Println("Ошибка при удалении пользователя:", err)
+		h.logger.Error("error in remove user", zap.Int64("user_id", userID), zap.Error(err))
 		return
 	}
 
 	if partnerID != 0 {
-		if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-			fmt.Println("Ошибка при удалении собеседника:", err)
-			return
-		}
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: partnerID,
 			Text:   "Сіздің партнер-(-ша) чаттан шықты.",
@@ -98,9 +99,73 @@ func (h *Handler) CallbackHandlerExit(ctx context.Context, b *bot.Bot, update *m
 	})
 }
 
+// nextPartnerData is the callback of the "⏭ Келесі" button
+const nextPartnerData = "next"
+
+// NextCommand handles /next: leave the current chat and look for a new partner in one step
+func (h *Handler) NextCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+	h.nextPartner(ctx, b, update.Message.From.ID)
+}
+
+// CallbackHandlerNext handles the "⏭ Келесі" button
+func (h *Handler) CallbackHandlerNext(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+	h.nextPartner(ctx, b, update.CallbackQuery.From.ID)
+}
+
+// nextPartner ends the current chat on both sides, then pairs the user with someone
+// already waiting in the pool or, if nobody is, adds them to the pool
+func (h *Handler) nextPartner(ctx context.Context, b *bot.Bot, userID int64) {
+	partnerID, err := h.redisClient.RemoveUser(ctx, userID)
+	if err != nil {
+		h.logger.Error("next: remove user", zap.Int64("user_id", userID), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Қате орын алды, кейінірек қайталаңыз."})
+		return
+	}
+	if partnerID != 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: partnerID,
+			Text:   "Сіздің партнер-(-ша) чаттан шықты.",
+		})
+	}
+
+	newPartnerID, err := h.redisClient.FindPartner(ctx, userID)
+	if err != nil {
+		h.logger.Error("next: find partner", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	if newPartnerID != 0 {
+		// the pool can hold users who were paired through the Mini App in the meantime,
+		// or who were banned while waiting
+		busy, err := h.redisClient.CheckPartnerToEmpty(ctx, newPartnerID)
+		if err == nil && !busy && !h.isBanned(ctx, newPartnerID) {
+			err = h.connectPartners(ctx, b, userID, newPartnerID)
+			if err == nil {
+				return
+			}
+			h.logger.Error("next: connect partners", zap.Int64("user_id", userID), zap.Error(err))
+		}
+	}
+
+	if err := h.redisClient.AddUser(ctx, userID); err != nil {
+		h.logger.Error("next: add user to pool", zap.Int64("user_id", userID), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Қате орын алды, кейінірек қайталаңыз."})
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: userID,
+		Text:   "⏳ Жаңа сұхбаттасушы ізделуде. Табылған кезде хабарлаймыз.",
+	})
+}
+
 func (h *Handler) HandleChat(ctx context.Context, b *bot.Bot, update *models.Update) {
 	userID := update.Message.From.ID
-	partnerID, err := h.redisClient.GetUserPartner(ctx, userID)
+	partnerID, err := h.chatPartner(ctx, b, userID)
 	if err != nil {
 		h.logger.Error("error get user partner", zap.Error(err))
 	}
@@ -118,812 +183,81 @@ func (h *Handler) HandleChat(ctx context.Context, b *bot.Bot, update *models.Upd
 	return
 	}
 
-	senderNickname, err := h.userRepo.GetUserNickname(userID)
+	senderNickname, err := h.userRepo.GetUserNickname(ctx, userID)
 	if err != nil && senderNickname == "" {
 		senderNickname = update.Message.From.Username
 	}
 
-	partnerIdentifier := fmt.Sprintf("%d", partnerID)
-	kb := keyboard.NewKeyboard()
-	kb.AddRow(keyboard.NewInlineButton("🔕 Шығу", "exit"))
-
-	switch {
-	case update.Message.Text != "":
-		fmt.Printf("TEXT | User=%s | Text=%q\n", senderNickname, update.Message.Text)
-
-		partnerMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         partnerID,
-			Text:           fmt.Sprintf("от %s: %s", senderNickname, update.Message.Text),
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-		}
-
-		senderMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         update.Message.Chat.ID,
-			Text:           "Егер хабарламаны өшіргіңіз келсе, төмендегі батырманы басыңыз.",
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка отправки текстового сообщения отправителю:", err)
-			return
-		}
-
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.From.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Хабарламыны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-
-		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Text:        "Егер хабарламаны өшіргіңіз келсе, төмендегі батырманы басыңыз.",
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования текстового сообщения:", err)
-		}
-
-		textToChannel := fmt.Sprintf("Сообщение от %s: к %s:\n%s", senderNickname, partnerIdentifier, update.Message.Text)
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           textToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки текстового сообщения:", err)
-		}
-	// 2. Фото.
-	case update.Message.Photo != nil:
-		fmt.Printf("PHOTO | User=%s | FileID=%s | Caption=%q\n", senderNickname, update.Message.Photo[len(update.Message.Photo)-1].FileID, update.Message.Caption)
-		photoID := update.Message.Photo[len(update.Message.Photo)-1].FileID
-
-		var partnerPhotoCaption string
-		if update.Message.Caption == "" {
-			partnerPhotoCaption = fmt.Sprintf("от %s: фото", senderNickname)
-		} else {
-			partnerPhotoCaption = fmt.Sprintf("от %s: %s", senderNickname, update.Message.Caption)
-		}
-
-		partnerMsg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:         partnerID,
-			Photo:          &models.InputFileString{Data: photoID},
-			Caption:        partnerPhotoCaption,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки фото сообщения собеседнику", zap.Error(err))
-			return
-		}
-
-		senderMsg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:         update.Message.Chat.ID,
-			Photo:          &models.InputFileString{Data: photoID},
-			Caption:        "Егер хабарламаны өшіргіңіз келсе, төмендегі батырманы басыңыз.",
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке фото отправителю:", err)
-			return
-		}
-
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Фотоны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-
-		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Caption:     "Егер хабарламаны өшіргіңіз келсе, төмендегі батырманы басыңыз.",
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования фото сообщения:", err)
-		}
-
-		var photoCaptionChannel string
-		if update.Message.Caption == "" {
-			photoCaptionChannel = "фото"
-		} else {
-			photoCaptionChannel = update.Message.Caption
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от %s: к %s:\n%s", senderNickname, partnerIdentifier, photoCaptionChannel)
-		_, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:         h.cfg.ChannelName,
-			Photo:          &models.InputFileString{Data: photoID},
-			Caption:        captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки фото:", err)
-		}
-
-	// 3. Видео.
-	case update.Message.Video != nil:
-		fmt.Printf("VIDEO | User=%s | FileID=%s | Caption=%q\n", senderNickname, update.Message.Video.FileID, update.Message.Caption)
-		var partnerVideoCaption string
-		if update.Message.Caption == "" {
-			partnerVideoCaption = fmt.Sprintf("от %s: видео", senderNickname)
-		} else {
-			partnerVideoCaption = fmt.Sprintf("от %s: %s", senderNickname, update.Message.Caption)
-		}
-		partnerMsg, err := b.SendVideo(ctx, &bot.SendVideoParams{
-			ChatID:         partnerID,
-			Video:          &models.InputFileString{Data: update.Message.Video.FileID},
-			Caption:        partnerVideoCaption,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки видео сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendVideo(ctx, &bot.SendVideoParams{
-			ChatID:         update.Message.Chat.ID,
-			Video:          &models.InputFileString{Data: update.Message.Video.FileID},
-			Caption:        partnerVideoCaption,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке видео отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Видеоны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Caption:     partnerVideoCaption,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования видео сообщения:", err)
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от %s: к %s:\n%s", senderNickname, partnerIdentifier, partnerVideoCaption)
-		_, err = b.SendVideo(ctx, &bot.SendVideoParams{
-			ChatID:         h.cfg.ChannelName,
-			Video:          &models.InputFileString{Data: update.Message.Video.FileID},
-			Caption:        captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки видео:", err)
-		}
-
-	// 4. Голосовое сообщение.
-	case update.Message.Voice != nil:
-		fmt.Printf("VOICE | User=%s | FileID=%s | Caption=%q\n", senderNickname, update.Message.Voice.FileID, update.Message.Caption)
-		var partnerVoiceCaption string
-		if update.Message.Caption == "" {
-			partnerVoiceCaption = fmt.Sprintf("от %s: голосовое сообщение", senderNickname)
-		} else {
-			partnerVoiceCaption = fmt.Sprintf("от %s: %s", senderNickname, update.Message.Caption)
-		}
-		partnerMsg, err := b.SendVoice(ctx, &bot.SendVoiceParams{
-			ChatID:         partnerID,
-			Voice:          &models.InputFileString{Data: update.Message.Voice.FileID},
-			Caption:        partnerVoiceCaption,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки голосового сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendVoice(ctx, &bot.SendVoiceParams{
-			ChatID:         update.Message.Chat.ID,
-			Voice:          &models.InputFileString{Data: update.Message.Voice.FileID},
-			Caption:        partnerVoiceCaption,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке голосового сообщения отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Дыбыстық хабарламаны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Caption:     partnerVoiceCaption,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования голосового сообщения:", err)
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от: %s к %s:\n%s", senderNickname, partnerIdentifier, partnerVoiceCaption)
-		_, err = b.SendVoice(ctx, &bot.SendVoiceParams{
-			ChatID:         h.cfg.ChannelName,
-			Voice:          &models.InputFileString{Data: update.Message.Voice.FileID},
-			Caption:        captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки голосового сообщения:", err)
-		}
-
-	// 5. Видео-сообщение (VideoNote).
-	case update.Message.VideoNote != nil:
-		fmt.Printf("VIDEO_NOTE | User=%s | FileID=%s\n", senderNickname, update.Message.VideoNote.FileID)
-		// Для VideoNote поля Caption и ParseMode отсутствуют – их не указываем.
-		partnerMsg, err := b.SendVideoNote(ctx, &bot.SendVideoNoteParams{
-			ChatID:         partnerID,
-			VideoNote:      &models.InputFileString{Data: update.Message.VideoNote.FileID},
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки видео сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendVideoNote(ctx, &bot.SendVideoNoteParams{
-			ChatID:         update.Message.Chat.ID,
-			VideoNote:      &models.InputFileString{Data: update.Message.VideoNote.FileID},
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке видео-сообщения отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Видео хабарламаны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования видео-сообщения:", err)
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от %s к %s: Видео сообщение", senderNickname, partnerIdentifier)
-		_, err = b.SendVideoNote(ctx, &bot.SendVideoNoteParams{
-			ChatID:         h.cfg.ChannelName,
-			VideoNote:      &models.InputFileString{Data: update.Message.VideoNote.FileID},
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки видео-сообщения:", err)
-		}
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки текста для видео-сообщения:", err)
-		}
-
-	// 6. Документ.
-	case update.Message.Document != nil:
-		fmt.Printf("DOCUMENT | User=%s | FileID=%s | Caption=%q\n", senderNickname, update.Message.Document.FileID, update.Message.Caption)
-		var partnerDocCaption string
-		if update.Message.Caption == "" {
-			partnerDocCaption = fmt.Sprintf("от %s: документ", senderNickname)
-		} else {
-			partnerDocCaption = fmt.Sprintf("от %s: %s", senderNickname, update.Message.Caption)
-		}
-		partnerMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:         partnerID,
-			Document:       &models.InputFileString{Data: update.Message.Document.FileID},
-			Caption:        partnerDocCaption,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки документ сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:         update.Message.Chat.ID,
-			Document:       &models.InputFileString{Data: update.Message.Document.FileID},
-			Caption:        partnerDocCaption,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке документа отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Құжатты жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Caption:     partnerDocCaption,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования документа сообщения:", err)
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от %s: к %s:\n%s", senderNickname, partnerIdentifier, partnerDocCaption)
-		_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:         h.cfg.ChannelName,
-			Document:       &models.InputFileString{Data: update.Message.Document.FileID},
-			Caption:        captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки документа:", err)
-		}
-
-	// 7. Аудио.
-	case update.Message.Audio != nil:
-		fmt.Printf("AUDIO | User=%s | FileID=%s | Caption=%q\n", senderNickname, update.Message.Audio.FileID, update.Message.Caption)
-		var partnerAudioCaption string
-		if update.Message.Caption == "" {
-			partnerAudioCaption = fmt.Sprintf("от %s: аудио", senderNickname)
-		} else {
-			partnerAudioCaption = fmt.Sprintf("от %s: %s", senderNickname, update.Message.Caption)
-		}
-		partnerMsg, err := b.SendAudio(ctx, &bot.SendAudioParams{
-			ChatID:         partnerID,
-			Audio:          &models.InputFileString{Data: update.Message.Audio.FileID},
-			Caption:        partnerAudioCaption,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки аудио сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendAudio(ctx, &bot.SendAudioParams{
-			ChatID:         update.Message.Chat.ID,
-			Audio:          &models.InputFileString{Data: update.Message.Audio.FileID},
-			Caption:        partnerAudioCaption,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке аудио отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Аудионы жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Caption:     partnerAudioCaption,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования аудио сообщения:", err)
-		}
-		captionToChannel := fmt.Sprintf("Сообщение от %s к %s:\n%s", senderNickname, partnerIdentifier, partnerAudioCaption)
-		_, err = b.SendAudio(ctx, &bot.SendAudioParams{
-			ChatID:         h.cfg.ChannelName,
-			Audio:          &models.InputFileString{Data: update.Message.Audio.FileID},
-			Caption:        captionToChannel,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки аудио:", err)
-		}
-
-	// 8. Локация.
-	case update.Message.Location != nil:
-		fmt.Printf("LOCATION | User=%s | Lat=%.5f | Long=%.5f\n", senderNickname, update.Message.Location.Latitude, update.Message.Location.Longitude)
-		partnerMsg, err := b.SendLocation(ctx, &bot.SendLocationParams{
-			ChatID:         partnerID,
-			Latitude:       update.Message.Location.Latitude,
-			Longitude:      update.Message.Location.Longitude,
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки гео сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendLocation(ctx, &bot.SendLocationParams{
-			ChatID:         update.Message.Chat.ID,
-			Latitude:       update.Message.Location.Latitude,
-			Longitude:      update.Message.Location.Longitude,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке локации отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Гео-локацияны жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования локации сообщения:", err)
-		}
-		locationText := fmt.Sprintf("Сообщение от %s: к %s:\nЛокация: %.5f, %.5f", senderNickname, partnerIdentifier, update.Message.Location.Latitude, update.Message.Location.Longitude)
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           locationText,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки локации:", err)
-		}
-
-	// 9. Стикер.
-	case update.Message.Sticker != nil:
-		fmt.Printf("STICKER | User=%s | FileID=%s\n", senderNickname, update.Message.Sticker.FileID)
-		partnerMsg, err := b.SendSticker(ctx, &bot.SendStickerParams{
-			ChatID:         partnerID,
-			Sticker:        &models.InputFileString{Data: update.Message.Sticker.FileID},
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки стикер сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendSticker(ctx, &bot.SendStickerParams{
-			ChatID:         update.Message.Chat.ID,
-			Sticker:        &models.InputFileString{Data: update.Message.Sticker.FileID},
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке стикера отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Стикерді жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования стикера сообщения:", err)
-		}
-		_, err = b.SendSticker(ctx, &bot.SendStickerParams{
-			ChatID:         h.cfg.ChannelName,
-			Sticker:        &models.InputFileString{Data: update.Message.Sticker.FileID},
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки стикера:", err)
-		}
-		stickerInfo := fmt.Sprintf("Сообщение от %s: к %s: Стикер", senderNickname, partnerIdentifier)
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           stickerInfo,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки текста для стикера:", err)
-		}
-
-	// 10. Контакт.
-	case update.Message.Contact != nil:
-		contact := update.Message.Contact
-		contactText := fmt.Sprintf("от %s: контакт\nТел: %s\nИмя: %s %s", senderNickname, contact.PhoneNumber, contact.FirstName, contact.LastName)
-		partnerMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         partnerID,
-			Text:           contactText,
-			ParseMode:      "HTML",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки контакт сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         update.Message.Chat.ID,
-			Text:           contactText,
-			ParseMode:      "HTML",
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке контакта отправителю:", err)
+	m := relayMessage{msg: update.Message, nickname: senderNickname, partner: fmt.Sprintf("%d", partnerID)}
+	for _, spec := range chatRelaySpecs {
+		if spec.detect(m.msg) {
+			h.relayChat(ctx, b, update, partnerID, spec.build(h, ctx, b, m))
 			return
 		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Контактіні жою!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			Text:        contactText,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования контакта сообщения:", err)
-		}
-		channelContactText := fmt.Sprintf("Сообщение от %s к %s:\nКонтакт:\nТел: %s\nИмя: %s %s", senderNickname, partnerIdentifier, contact.PhoneNumber, contact.FirstName, contact.LastName)
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           channelContactText,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки контакта:", err)
-		}
+	}
 
-	// 11. Опрос.
-	case update.Message.Poll != nil:
-		poll := update.Message.Poll
-		var partnerPollQuestion string
-		if poll.Question == "" {
-			partnerPollQuestion = fmt.Sprintf("от %s: опрос", senderNickname)
-		} else {
-			partnerPollQuestion = fmt.Sprintf("от %s: %s", senderNickname, poll.Question)
-		}
-		// Преобразуем poll.Options (тип []models.PollOption) в []models.InputPollOption
-		var inputOptions []models.InputPollOption
-		for _, opt := range poll.Options {
-			inputOptions = append(inputOptions, models.InputPollOption{Text: opt.Text})
-		}
-		partnerMsg, err := b.SendPoll(ctx, &bot.SendPollParams{
-			ChatID:         partnerID,
-			Question:       partnerPollQuestion,
-			Options:        inputOptions,
-			ProtectContent: true,
-		})
-		if err != nil {
-			if err.Error() == "forbidden, Forbidden: bot was blocked by the user" {
-				if err := h.redisClient.RemoveUser(ctx, userID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				if err := h.redisClient.RemoveUser(ctx, partnerID); err != nil {
-					h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
-					return
-				}
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: userID,
-					Text:   "Қолданушы ботты бұғаттады, хабарлама жіберу мүмкін болмады басқа қолдуншылармен сөйлесіңіз!",
-				})
-			}
-			h.logger.Error("Ошибка отправки опрос сообщения собеседнику", zap.Error(err))
-			return
-		}
-		senderMsg, err := b.SendPoll(ctx, &bot.SendPollParams{
-			ChatID:         update.Message.Chat.ID,
-			Question:       poll.Question,
-			Options:        inputOptions,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка при отправке опроса отправителю:", err)
-			return
-		}
-		callbackData := fmt.Sprintf("delete_%d_%d_%d_%d", update.Message.Chat.ID, senderMsg.ID, partnerID, partnerMsg.ID)
-		deleteKb := keyboard.NewKeyboard()
-		deleteKb.AddRow(keyboard.NewInlineButton("⛔️ Хабарламыны жою опрос!", callbackData))
-		deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"))
-		_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
-			ChatID:      update.Message.Chat.ID,
-			MessageID:   senderMsg.ID,
-			ReplyMarkup: deleteKb.Build(),
-		})
-		if err != nil {
-			log.Println("Ошибка редактирования опроса сообщения:", err)
-		}
-		pollText := fmt.Sprintf("Сообщение от %s: к %s: Опрос\nВопрос: %s", senderNickname, partnerIdentifier, poll.Question)
-		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         h.cfg.ChannelName,
-			Text:           pollText,
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка пересылки опроса:", err)
-		}
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(keyboard.NewInlineButton("🔕 Шығу", "exit"))
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:         m.msg.Chat.ID,
+		Text:           "Неизвестный тип сообщения. Попробуйте отправить текст, фото, видео, голосовое сообщение или документ.",
+		ReplyMarkup:    kb.Build(),
+		ProtectContent: true,
+	})
+	if err != nil {
+		log.Println("Ошибка отправки сообщения об неизвестном типе:", err)
+	}
+}
 
-	// 12. Неизвестный тип сообщения.
-	default:
-		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:         update.Message.Chat.ID,
-			Text:           "Неизвестный тип сообщения. Попробуйте отправить текст, фото, видео, голосовое сообщение или документ.",
-			ReplyMarkup:    kb.Build(),
-			ProtectContent: true,
-		})
-		if err != nil {
-			log.Println("Ошибка отправки сообщения об неизвестном типе:", err)
-		}
+// sendChannelNote posts the caption that goes with caption-less media (stickers, video notes) to the channel
+func (h *Handler) sendChannelNote(ctx context.Context, b *bot.Bot, text string) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:         h.cfg.ChannelName,
+		Text:           text,
+		ProtectContent: true,
+	})
+	if err != nil {
+		log.Println("Ошибка пересылки текста в канал:", err)
 	}
 }
 
+// DeleteMessageHandler handles the delete button under a relayed message or album:
+// it removes every stored copy from both chats
 func (h *Handler) DeleteMessageHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	var senderChatID int64
-	var senderMsgID int
-	var partnerChatID int64
-	var partnerMsgID int
+	cq := update.CallbackQuery
+	token := strings.TrimPrefix(cq.Data, relayDeletePrefix)
 
-	_, err := fmt.Sscanf(update.CallbackQuery.Data, "delete_%d_%d_%d_%d", &senderChatID, &senderMsgID, &partnerChatID, &partnerMsgID)
+	relayed, err := h.redisClient.GetRelayedMessage(ctx, token)
 	if err != nil {
-		fmt.Println("Ошибка при извлечении данных из callback:", err)
+		h.logger.Error("Failed to get relayed message", zap.String("token", token), zap.Error(err))
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "❌ Қате: қайта көріңіз"})
 		return
 	}
-
-	okSend, errSender := b.DeleteMessage(ctx, &bot.DeleteMessageParams{
-		ChatID:    senderChatID,
-		MessageID: senderMsgID,
-	})
-	if errSender != nil {
-		fmt.Println("Ошибка при удалении сообщения отправителя:", errSender)
+	// buttons in the old delete_<ids> format land here too
+	if relayed == nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "Бұл батырма ескірген"})
+		return
+	}
+	if cq.From.ID != relayed.SenderID && cq.From.ID != relayed.PartnerID {
+		h.logger.Warn("Delete from outside the chat", zap.Int64("user_id", cq.From.ID), zap.String("token", token))
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID})
+		return
 	}
 
-	okPartner, errPartner := b.DeleteMessage(ctx, &bot.DeleteMessageParams{
-		ChatID:    partnerChatID,
-		MessageID: partnerMsgID,
-	})
-	if errPartner != nil {
-		fmt.Println("Ошибка при удалении сообщения собеседника:", errPartner)
+	ok := true
+	for chatID, ids := range map[int64][]int{relayed.SenderID: relayed.SenderMsgIDs, relayed.PartnerID: relayed.PartnerMsgIDs} {
+		if _, err := b.DeleteMessages(ctx, &bot.DeleteMessagesParams{ChatID: chatID, MessageIDs: ids}); err != nil {
+			h.logger.Warn("Failed to delete relayed message", zap.Int64("chat_id", chatID), zap.Error(err))
+			ok = false
+		}
+	}
+	if err := h.redisClient.DeleteRelayedMessage(ctx, token); err != nil {
+		h.logger.Warn("Failed to delete relay token", zap.String("token", token), zap.Error(err))
 	}
 
-	responseChatId := update.CallbackQuery.From.ID
-	if !okSend || !okPartner {
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: responseChatId,
-			Text:   "Хабарлама өшірілмеді!",
-		})
-		return
+	text := "Хабарлама сәтті өшірілді!"
+	if !ok {
+		text = "Хабарлама өшірілмеді!"
 	}
-	b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: responseChatId,
-		Text:   "Хабарлама сәтті өшірілді!",
-	})
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: text})
 }
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// textsTo maps a chat id to the texts sent to it
+func textsTo(calls []apiCall) map[string][]string {
+	out := map[string][]string{}
+	for _, c := range calls {
+		if c.Method == "sendMessage" {
+			out[c.Params["chat_id"]] = append(out[c.Params["chat_id"]], c.Params["text"])
+		}
+	}
+	return out
+}
+
+func TestNextPartnerRequeues(t *testing.T) {
+	h, mem, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	mem.SetPartner(ctx, 10, 20, time.Hour)
+	mem.SetPartner(ctx, 20, 10, time.Hour)
+
+	// 10 presses "⏭ Келесі" while nobody is waiting
+	h.CallbackHandlerNext(ctx, b, &models.Update{CallbackQuery: &models.CallbackQuery{ID: "cq", From: models.User{ID: 10}, Data: nextPartnerData}})
+	for _, id := range []int64{10, 20} {
+		if p, _ := mem.GetUserPartner(ctx, id); p != 0 {
+			t.Fatalf("partner of %d = %d, want both directions cleared", id, p)
+		}
+	}
+	texts := textsTo(fake.Calls())
+	if len(texts["20"]) != 1 || !strings.Contains(texts["20"][0], "чаттан шықты") {
+		t.Fatalf("partner got %q, want told the chat ended", texts["20"])
+	}
+	if len(texts["10"]) != 1 || !strings.Contains(texts["10"][0], "ізделуде") {
+		t.Fatalf("requester got %q, want told the search started", texts["10"])
+	}
+
+	// 10 waits in the pool, so the next user to ask is paired with them
+	h.NextCommand(ctx, b, &models.Update{Message: &models.Message{From: &models.User{ID: 30}, Chat: models.Chat{ID: 30}, Text: "/next"}})
+	if p, _ := mem.GetUserPartner(ctx, 30); p != 10 {
+		t.Fatalf("partner of 30 = %d, want 10", p)
+	}
+	if p, _ := mem.GetUserPartner(ctx, 10); p != 30 {
+		t.Fatalf("partner of 10 = %d, want 30", p)
+	}
+	texts = textsTo(fake.Calls())
+	if len(texts["10"]) != 1 || len(texts["30"]) != 1 || len(texts["20"]) != 0 {
+		t.Fatalf("messages after pairing = %v, want one greeting each for 10 and 30", texts)
+	}
+	if p, _ := mem.FindPartner(ctx, 40); p != 0 {
+		t.Fatalf("pool still holds %d after pairing", p)
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// chatIdleSweepInterval is how often idle chats are looked for
+const chatIdleSweepInterval = time.Minute
+
+// startChatIdleSweeper ends idle chats until ctx is cancelled
+func (h *Handler) startChatIdleSweeper(ctx context.Context) {
+	ticker := time.NewTicker(chatIdleSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.sweepIdleChats(ctx, h.now())
+		}
+	}
+}
+
+// sweepIdleChats ends every chat with no relayed message for cfg.ChatIdleTimeout
+// before now and tells both users. Pairs that already split up are only dropped
+// from the index.
+func (h *Handler) sweepIdleChats(ctx context.Context, now time.Time) {
+	pairs, err := h.redisClient.IdleChats(ctx, now.Add(-h.cfg.ChatIdleTimeout))
+	if err != nil {
+		h.logger.Error("chat idle sweep: list failed", zap.Error(err))
+		return
+	}
+
+	ended := 0
+	for _, p := range pairs {
+		a, b := p[0], p[1]
+		partnerID, err := h.redisClient.GetUserPartner(ctx, a)
+		if err != nil {
+			h.logger.Warn("chat idle sweep: get partner", zap.Int64("user_id", a), zap.Error(err))
+			continue
+		}
+		if partnerID != b {
+			if err := h.redisClient.ForgetChat(ctx, a, b); err != nil {
+				h.logger.Warn("chat idle sweep: forget pair", zap.Error(err))
+			}
+			continue
+		}
+
+		if _, err := h.redisClient.RemoveUser(ctx, a); err != nil {
+			h.logger.Warn("chat idle sweep: remove users", zap.Int64("user_id", a), zap.Int64("partner_id", b), zap.Error(err))
+			continue
+		}
+		if h.bot != nil {
+			for _, id := range []int64{a, b} {
+				h.bot.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID: id,
+					Text:   "⌛ Чатта ұзақ уақыт хабарлама болмағандықтан, ол аяқталды. Жаңа сұхбаттасушы табу үшін /next басыңыз.",
+				})
+			}
+		}
+		ended++
+	}
+	if ended > 0 {
+		h.logger.Info("chat idle sweep: ended idle chats", zap.Int("chats", ended))
+	}
+}
+
+// chatExpiredText tells a user their chat was closed after its partner mapping expired
+const chatExpiredText = "⌛ Чат белсенділік болмағандықтан жабылды. Жаңа сұхбаттасушы табу үшін /next басыңыз."
+
+// touchChat records a relayed message: it marks the pair active for the idle sweeper
+// and restarts the TTL of both partner mappings
+func (h *Handler) touchChat(ctx context.Context, userID, partnerID int64) {
+	if err := h.redisClient.TouchChat(ctx, userID, partnerID, h.now()); err != nil {
+		h.logger.Warn("failed to touch chat", zap.Error(err))
+	}
+	for _, id := range []int64{userID, partnerID} {
+		if err := h.redisClient.RefreshPartner(ctx, id, h.cfg.PartnerTTL); err != nil {
+			h.logger.Warn("failed to refresh partner ttl", zap.Int64("user_id", id), zap.Error(err))
+		}
+	}
+}
+
+// chatPartner is GetUserPartner that also checks the partner's side of the pair.
+// When that side has expired, the chat is closed for both users and 0 is returned;
+// when the partner has moved on to someone else, only userID's stale mapping is dropped.
+func (h *Handler) chatPartner(ctx context.Context, b *bot.Bot, userID int64) (int64, error) {
+	partnerID, err := h.redisClient.GetUserPartner(ctx, userID)
+	if err != nil || partnerID == 0 {
+		return partnerID, err
+	}
+	back, err := h.redisClient.GetUserPartner(ctx, partnerID)
+	if err != nil || back == userID {
+		// a failed check must not break a working chat
+		return partnerID, nil
+	}
+
+	h.logger.Info("partner mapping expired on one side, closing chat",
+		zap.Int64("user_id", userID), zap.Int64("partner_id", partnerID), zap.Int64("partner_partner", back))
+	// the partner's side is left alone when it points to someone else
+	if _, err := h.redisClient.RemoveUser(ctx, userID); err != nil {
+		h.logger.Warn("remove user with expired partner", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	notify := []int64{userID}
+	if back == 0 {
+		notify = append(notify, partnerID)
+	}
+	for _, id := range notify {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: id, Text: chatExpiredText})
+	}
+	return 0, nil
+}
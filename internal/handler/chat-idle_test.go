@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSweepIdleChats(t *testing.T) {
+	h, _, fake, _ := newTestHandler(t)
+	ctx := context.Background()
+	mr := useMiniredis(t, h)
+	h.cfg.ChatIdleTimeout = 30 * time.Minute
+
+	clock := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return clock }
+	// the test clock and the partner TTLs in miniredis move together
+	advance := func(d time.Duration) {
+		clock = clock.Add(d)
+		mr.FastForward(d)
+	}
+	pair := func(a, c int64) {
+		h.redisClient.SetPartner(ctx, a, c, h.cfg.PartnerTTL)
+		h.redisClient.SetPartner(ctx, c, a, h.cfg.PartnerTTL)
+		h.touchChat(ctx, a, c)
+	}
+	partner := func(id int64) int64 {
+		p, err := h.redisClient.GetUserPartner(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	pair(1, 2)
+	advance(20 * time.Minute)
+	pair(3, 4)
+	advance(10*time.Minute - time.Second)
+
+	h.sweepIdleChats(ctx, h.now())
+	if calls := fake.Calls(); len(calls) != 0 || partner(1) != 2 {
+		t.Fatalf("a second before the cutoff: partner(1) = %d, calls:\n%s", partner(1), formatCalls(calls))
+	}
+
+	advance(time.Second)
+	h.sweepIdleChats(ctx, h.now())
+	notified := map[string]bool{}
+	for _, c := range fake.Calls() {
+		notified[c.Params["chat_id"]] = true
+	}
+	if len(notified) != 2 || !notified["1"] || !notified["2"] {
+		t.Errorf("notified %v, want both users of the idle chat", notified)
+	}
+	if partner(1) != 0 || partner(2) != 0 {
+		t.Errorf("idle chat left mapped: %d, %d", partner(1), partner(2))
+	}
+	if partner(3) != 4 || partner(4) != 3 {
+		t.Errorf("chat active 10 minutes ago was ended")
+	}
+	if n, _ := h.redisClient.CountActiveChats(ctx); n != 1 {
+		t.Errorf("%d chats in the activity index, want 1", n)
+	}
+
+	// a message keeps 3–4 going past its original cutoff
+	advance(15 * time.Minute)
+	h.touchChat(ctx, 3, 4)
+	advance(20 * time.Minute)
+	h.sweepIdleChats(ctx, h.now())
+	if calls := fake.Calls(); len(calls) != 0 || partner(3) != 4 {
+		t.Errorf("chat touched 20 minutes ago: partner(3) = %d, calls:\n%s", partner(3), formatCalls(calls))
+	}
+}
+
+func TestPartnerMappingExpiry(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	mr := useMiniredis(t, h)
+	h.cfg.PartnerTTL = 2 * time.Second
+	partner := func(id int64) int64 {
+		p, err := h.redisClient.GetUserPartner(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	for _, p := range [][2]int64{{1, 2}, {2, 1}, {3, 4}, {4, 3}} {
+		h.redisClient.SetPartner(ctx, p[0], p[1], h.cfg.PartnerTTL)
+	}
+	// 1 wrote a while ago and stretched only their own side
+	h.redisClient.SetPartner(ctx, 1, 2, time.Minute)
+
+	// a relayed message restarts both sides of 3–4
+	mr.FastForward(1500 * time.Millisecond)
+	h.touchChat(ctx, 3, 4)
+	mr.FastForward(time.Second)
+
+	if p, err := h.chatPartner(ctx, b, 3); p != 4 || err != nil {
+		t.Errorf("touched chat: chatPartner(3) = %d, %v", p, err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("live chat notified:\n%s", formatCalls(calls))
+	}
+
+	// 2's side ran out: the chat is closed for both of them
+	if p, err := h.chatPartner(ctx, b, 1); p != 0 || err != nil {
+		t.Errorf("half-expired chat: chatPartner(1) = %d, %v", p, err)
+	}
+	if partner(1) != 0 || partner(2) != 0 {
+		t.Errorf("mappings left: %d, %d", partner(1), partner(2))
+	}
+	notified := map[string]bool{}
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" && c.Params["text"] == chatExpiredText {
+			notified[c.Params["chat_id"]] = true
+		}
+	}
+	if len(notified) != 2 || !notified["1"] || !notified["2"] {
+		t.Errorf("expiry notice went to %v, want users 1 and 2", notified)
+	}
+
+	// with no more messages 3–4 expires on both sides
+	mr.FastForward(h.cfg.PartnerTTL)
+	if partner(3) != 0 || partner(4) != 0 {
+		t.Errorf("idle pair still mapped: %d, %d", partner(3), partner(4))
+	}
+}
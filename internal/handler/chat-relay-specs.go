@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// relayMessage is the chat message a relaySpec builds its chatRelay from
+type relayMessage struct {
+	msg      *models.Message
+	nickname string // sender's nickname shown to the partner
+	partner  string // partner's ID, for the channel mirror
+}
+
+// relaySpec is one message type HandleChat relays: detect recognises it, build
+// describes how it travels. HandleChat uses the first spec in chatRelaySpecs
+// whose detect matches, so the order matters where Telegram sets several fields.
+type relaySpec struct {
+	detect func(msg *models.Message) bool
+	build  func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay
+}
+
+// fileSend sends one file to chatID, a user or the channel. Types without a
+// caption ignore caption.
+type fileSend func(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error)
+
+// captionedFile is the spec of a media type whose every copy carries the
+// partner-facing caption. mirrorFormat gets the sender, the partner and that caption.
+func captionedFile(kind, deleteLabel, placeholder, mirrorFormat, mirrorErr string, fileID func(*models.Message) string, send fileSend) relaySpec {
+	return relaySpec{
+		detect: func(msg *models.Message) bool { return fileID(msg) != "" },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			id := fileID(m.msg)
+			caption := relayCaption(m.nickname, m.msg.Caption, placeholder)
+			file := &models.InputFileString{Data: id}
+			return chatRelay{
+				kind:        kind,
+				deleteLabel: deleteLabel,
+				edit:        editCaption,
+				editValue:   caption,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return send(ctx, b, chatID, file, caption, markup)
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return send(ctx, b, chatID, file, caption, nil)
+				},
+				mirror: func() {
+					channelCaption := fmt.Sprintf(mirrorFormat, m.nickname, m.partner, caption)
+					if _, err := send(ctx, b, h.cfg.ChannelName, file, channelCaption, nil); err != nil {
+						log.Println(mirrorErr, err)
+					}
+				},
+			}
+		},
+	}
+}
+
+// bareFile is the spec of a media type without a caption; the channel gets the
+// file followed by channelNote, formatted with the sender and the partner
+func bareFile(kind, deleteLabel, channelNote, mirrorErr string, fileID func(*models.Message) string, send fileSend) relaySpec {
+	return relaySpec{
+		detect: func(msg *models.Message) bool { return fileID(msg) != "" },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			id := fileID(m.msg)
+			file := &models.InputFileString{Data: id}
+			return chatRelay{
+				kind:        kind,
+				deleteLabel: deleteLabel,
+				edit:        editMarkup,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return send(ctx, b, chatID, file, "", markup)
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return send(ctx, b, chatID, file, "", nil)
+				},
+				mirror: func() {
+					if _, err := send(ctx, b, h.cfg.ChannelName, file, "", nil); err != nil {
+						log.Println(mirrorErr, err)
+					}
+					h.sendChannelNote(ctx, b, fmt.Sprintf(channelNote, m.nickname, m.partner))
+				},
+			}
+		},
+	}
+}
+
+// chatRelaySpecs are the message types relayed between chat partners. Nothing is
+// sent with a parse mode: texts and captions carry raw user input, and a stray "<"
+// would make Telegram reject the whole message.
+var chatRelaySpecs = []relaySpec{
+	{
+		detect: func(msg *models.Message) bool { return msg.Text != "" },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			return chatRelay{
+				kind:        "text",
+				deleteLabel: "⛔️ Хабарламыны жою!",
+				edit:        editText,
+				editValue:   deleteHint,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID:         chatID,
+						Text:           fmt.Sprintf("от %s: %s", m.nickname, m.msg.Text),
+						ReplyMarkup:    markup,
+						ProtectContent: true,
+					})
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID:         chatID,
+						Text:           deleteHint,
+						ProtectContent: true,
+					})
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s: к %s:\n%s", m.nickname, m.partner, m.msg.Text))
+				},
+			}
+		},
+	},
+	{
+		// the sender's copy shows the delete hint instead of the caption
+		detect: func(msg *models.Message) bool { return msg.Photo != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			photoID := m.msg.Photo[len(m.msg.Photo)-1].FileID
+			return chatRelay{
+				kind:        "photo",
+				deleteLabel: "⛔️ Фотоны жою!",
+				edit:        editCaption,
+				editValue:   deleteHint,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return sendPhoto(ctx, b, chatID, &models.InputFileString{Data: photoID}, relayCaption(m.nickname, m.msg.Caption, "фото"), markup)
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return sendPhoto(ctx, b, chatID, &models.InputFileString{Data: photoID}, deleteHint, nil)
+				},
+				mirror: func() {
+					caption := m.msg.Caption
+					if caption == "" {
+						caption = "фото"
+					}
+					channelCaption := fmt.Sprintf("Сообщение от %s: к %s:\n%s", m.nickname, m.partner, caption)
+					if _, err := sendPhoto(ctx, b, h.cfg.ChannelName, &models.InputFileString{Data: photoID}, channelCaption, nil); err != nil {
+						log.Println("Ошибка пересылки фото:", err)
+					}
+				},
+			}
+		},
+	},
+	captionedFile("video", "⛔️ Видеоны жою!", "видео", "Сообщение от %s: к %s:\n%s", "Ошибка пересылки видео:",
+		func(msg *models.Message) string {
+			if msg.Video == nil {
+				return ""
+			}
+			return msg.Video.FileID
+		}, sendVideo),
+	captionedFile("voice", "⛔️ Дыбыстық хабарламаны жою!", "голосовое сообщение", "Сообщение от: %s к %s:\n%s", "Ошибка пересылки голосового сообщения:",
+		func(msg *models.Message) string {
+			if msg.Voice == nil {
+				return ""
+			}
+			return msg.Voice.FileID
+		}, sendVoice),
+	bareFile("video_note", "⛔️ Видео хабарламаны жою!", "Сообщение от %s к %s: Видео сообщение", "Ошибка пересылки видео-сообщения:",
+		func(msg *models.Message) string {
+			if msg.VideoNote == nil {
+				return ""
+			}
+			return msg.VideoNote.FileID
+		}, sendVideoNote),
+	// GIFs also arrive with Document set, so animation has to come first
+	captionedFile("animation", "⛔️ GIF-ті жою!", "GIF", "Сообщение от %s: к %s:\n%s", "Ошибка пересылки GIF:",
+		func(msg *models.Message) string {
+			if msg.Animation == nil {
+				return ""
+			}
+			return msg.Animation.FileID
+		}, sendAnimation),
+	captionedFile("document", "⛔️ Құжатты жою!", "документ", "Сообщение от %s: к %s:\n%s", "Ошибка пересылки документа:",
+		func(msg *models.Message) string {
+			if msg.Document == nil {
+				return ""
+			}
+			return msg.Document.FileID
+		}, sendDocument),
+	captionedFile("audio", "⛔️ Аудионы жою!", "аудио", "Сообщение от %s к %s:\n%s", "Ошибка пересылки аудио:",
+		func(msg *models.Message) string {
+			if msg.Audio == nil {
+				return ""
+			}
+			return msg.Audio.FileID
+		}, sendAudio),
+	{
+		// venues also arrive with Location set
+		detect: func(msg *models.Message) bool { return msg.Venue != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			v := m.msg.Venue
+			params := func(chatID int64, markup models.ReplyMarkup) *bot.SendVenueParams {
+				return &bot.SendVenueParams{
+					ChatID:         chatID,
+					Latitude:       v.Location.Latitude,
+					Longitude:      v.Location.Longitude,
+					Title:          v.Title,
+					Address:        v.Address,
+					ReplyMarkup:    markup,
+					ProtectContent: true,
+				}
+			}
+			return chatRelay{
+				kind:        "venue",
+				deleteLabel: "⛔️ Орынды жою!",
+				edit:        editMarkup,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return b.SendVenue(ctx, params(chatID, markup))
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendVenue(ctx, params(chatID, nil))
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s: к %s:\nМесто: %s, %s (%.5f, %.5f)", m.nickname, m.partner, v.Title, v.Address, v.Location.Latitude, v.Location.Longitude))
+				},
+			}
+		},
+	},
+	{
+		detect: func(msg *models.Message) bool { return msg.Location != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			loc := m.msg.Location
+			return chatRelay{
+				kind:        "location",
+				deleteLabel: "⛔️ Гео-локацияны жою!",
+				edit:        editMarkup,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return b.SendLocation(ctx, &bot.SendLocationParams{ChatID: chatID, Latitude: loc.Latitude, Longitude: loc.Longitude, ReplyMarkup: markup, ProtectContent: true})
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendLocation(ctx, &bot.SendLocationParams{ChatID: chatID, Latitude: loc.Latitude, Longitude: loc.Longitude, ProtectContent: true})
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s: к %s:\nЛокация: %.5f, %.5f", m.nickname, m.partner, loc.Latitude, loc.Longitude))
+				},
+			}
+		},
+	},
+	bareFile("sticker", "⛔️ Стикерді жою!", "Сообщение от %s: к %s: Стикер", "Ошибка пересылки стикера:",
+		func(msg *models.Message) string {
+			if msg.Sticker == nil {
+				return ""
+			}
+			return msg.Sticker.FileID
+		}, sendSticker),
+	{
+		// the partner and the sender's echo each get a fresh roll of the same dice
+		detect: func(msg *models.Message) bool { return msg.Dice != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			dice := m.msg.Dice
+			return chatRelay{
+				kind:        "dice",
+				deleteLabel: "⛔️ Ойын сүйегін жою!",
+				edit:        editMarkup,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return b.SendDice(ctx, &bot.SendDiceParams{ChatID: chatID, Emoji: dice.Emoji, ReplyMarkup: markup, ProtectContent: true})
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendDice(ctx, &bot.SendDiceParams{ChatID: chatID, Emoji: dice.Emoji, ProtectContent: true})
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s: к %s: Кубик %s", m.nickname, m.partner, dice.Emoji))
+				},
+			}
+		},
+	},
+	{
+		detect: func(msg *models.Message) bool { return msg.Contact != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			contact := m.msg.Contact
+			contactText := fmt.Sprintf("от %s: контакт\nТел: %s\nИмя: %s %s", m.nickname, contact.PhoneNumber, contact.FirstName, contact.LastName)
+			return chatRelay{
+				kind:        "contact",
+				deleteLabel: "⛔️ Контактіні жою!",
+				edit:        editText,
+				editValue:   contactText,
+				toPartner: func(chatID int64, markup models.ReplyMarkup) (*models.Message, error) {
+					return b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: contactText, ReplyMarkup: markup, ProtectContent: true})
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: contactText, ProtectContent: true})
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s к %s:\nКонтакт:\nТел: %s\nИмя: %s %s", m.nickname, m.partner, contact.PhoneNumber, contact.FirstName, contact.LastName))
+				},
+			}
+		},
+	},
+	{
+		detect: func(msg *models.Message) bool { return msg.Poll != nil },
+		build: func(h *Handler, ctx context.Context, b *bot.Bot, m relayMessage) chatRelay {
+			poll := m.msg.Poll
+			// Преобразуем poll.Options (тип []models.PollOption) в []models.InputPollOption
+			var inputOptions []models.InputPollOption
+			for _, opt := range poll.Options {
+				inputOptions = append(inputOptions, models.InputPollOption{Text: opt.Text})
+			}
+			return chatRelay{
+				kind:        "poll",
+				deleteLabel: "⛔️ Хабарламыны жою опрос!",
+				edit:        editMarkup,
+				// the partner's poll goes out without the exit keyboard
+				toPartner: func(chatID int64, _ models.ReplyMarkup) (*models.Message, error) {
+					return b.SendPoll(ctx, &bot.SendPollParams{ChatID: chatID, Question: relayCaption(m.nickname, poll.Question, "опрос"), Options: inputOptions, ProtectContent: true})
+				},
+				toSender: func(chatID int64) (*models.Message, error) {
+					return b.SendPoll(ctx, &bot.SendPollParams{ChatID: chatID, Question: poll.Question, Options: inputOptions, ProtectContent: true})
+				},
+				mirror: func() {
+					h.mirrorText(ctx, fmt.Sprintf("Сообщение от %s: к %s: Опрос\nВопрос: %s", m.nickname, m.partner, poll.Question))
+				},
+			}
+		},
+	},
+}
+
+func sendPhoto(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendPhoto(ctx, &bot.SendPhotoParams{ChatID: chatID, Photo: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendVideo(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendVideo(ctx, &bot.SendVideoParams{ChatID: chatID, Video: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendVoice(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendVoice(ctx, &bot.SendVoiceParams{ChatID: chatID, Voice: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendAnimation(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendAnimation(ctx, &bot.SendAnimationParams{ChatID: chatID, Animation: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendDocument(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendDocument(ctx, &bot.SendDocumentParams{ChatID: chatID, Document: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendAudio(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, caption string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendAudio(ctx, &bot.SendAudioParams{ChatID: chatID, Audio: file, Caption: caption, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendVideoNote(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, _ string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendVideoNote(ctx, &bot.SendVideoNoteParams{ChatID: chatID, VideoNote: file, ReplyMarkup: markup, ProtectContent: true})
+}
+
+func sendSticker(ctx context.Context, b *bot.Bot, chatID any, file models.InputFile, _ string, markup models.ReplyMarkup) (*models.Message, error) {
+	return b.SendSticker(ctx, &bot.SendStickerParams{ChatID: chatID, Sticker: file, ReplyMarkup: markup, ProtectContent: true})
+}
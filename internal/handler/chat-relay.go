@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"aika/internal/keyboard"
+	"aika/internal/metrics"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// deleteHint is the sender's copy caption/text that explains the delete button
+const deleteHint = "Егер хабарламаны өшіргіңіз келсе, төмендегі батырманы басыңыз."
+
+const (
+	// relayDeletePrefix starts the callback data of a delete button; the rest is a
+	// token for the stored message ids
+	relayDeletePrefix = "delete_"
+	// relayTokenTTL is how long a delete button keeps working; Telegram doesn't let
+	// bots delete messages older than 48 hours anyway
+	relayTokenTTL = 48 * time.Hour
+)
+
+// chatEdit is how the sender's copy of a relayed message gets its delete keyboard
+type chatEdit int
+
+const (
+	editMarkup  chatEdit = iota // reply markup only, for messages without text or caption
+	editText                    // EditMessageText with editValue
+	editCaption                 // EditMessageCaption with editValue
+)
+
+// chatRelay describes how one message type travels between chat partners.
+// chatRelaySpecs build one per type; relayChat owns the shared
+// send / blocked / delete button / mirror flow.
+type chatRelay struct {
+	kind        string // message type, for logs
+	deleteLabel string
+	edit        chatEdit
+	editValue   string
+	toPartner   func(chatID int64, markup models.ReplyMarkup) (*models.Message, error)
+	toSender    func(chatID int64) (*models.Message, error)
+	// mirror copies the message to the moderation channel; optional
+	mirror func()
+}
+
+// relayChat sends the message to the partner, echoes it back to the sender
+// with a delete button for both copies and mirrors it to the channel.
+func (h *Handler) relayChat(ctx context.Context, b *bot.Bot, update *models.Update, partnerID int64, r chatRelay) {
+	userID := update.Message.From.ID
+	chatID := update.Message.Chat.ID
+
+	// the message itself stays out of the logs, only who sent what kind to whom
+	h.logger.Debug("Relaying chat message", zap.String("kind", r.kind), zap.Int64("user_id", userID), zap.Int64("partner_id", partnerID))
+
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(keyboard.NewInlineButton("🔕 Шығу", "exit"), keyboard.NewInlineButton("⏭ Келесі", nextPartnerData))
+
+	partnerMsg, err := r.toPartner(partnerID, kb.Build())
+	if err != nil {
+		if isUnreachable(err) {
+			h.handleBlocked(ctx, b, userID, partnerID)
+		}
+		h.logger.Error("Ошибка отправки сообщения собеседнику", zap.String("kind", r.kind), zap.Error(err))
+		return
+	}
+	metrics.MessagesRelayed.WithLabelValues(r.kind).Inc()
+	h.touchChat(ctx, userID, partnerID)
+
+	senderMsg, err := r.toSender(chatID)
+	if err != nil {
+		log.Printf("Ошибка при отправке %s отправителю: %v", r.kind, err)
+		return
+	}
+
+	deleteKb := keyboard.NewKeyboard()
+	relayed := &domain.RelayedMessage{SenderID: chatID, SenderMsgIDs: []int{senderMsg.ID}, PartnerID: partnerID, PartnerMsgIDs: []int{partnerMsg.ID}}
+	if token, err := h.saveRelayedMessage(ctx, relayed); err != nil {
+		// the message got through, it just can't be taken back
+		h.logger.Error("Failed to save relayed message", zap.Int64("user_id", userID), zap.Error(err))
+	} else {
+		deleteKb.AddRow(keyboard.NewInlineButton(r.deleteLabel, relayDeletePrefix+token))
+	}
+	deleteKb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"), keyboard.NewInlineButton("⏭ Келесі", nextPartnerData))
+
+	switch r.edit {
+	case editText:
+		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   senderMsg.ID,
+			Text:        r.editValue,
+			ReplyMarkup: deleteKb.Build(),
+		})
+	case editCaption:
+		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+			ChatID:      chatID,
+			MessageID:   senderMsg.ID,
+			Caption:     r.editValue,
+			ReplyMarkup: deleteKb.Build(),
+		})
+	default:
+		_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:      chatID,
+			MessageID:   senderMsg.ID,
+			ReplyMarkup: deleteKb.Build(),
+		})
+	}
+	if err != nil {
+		log.Printf("Ошибка редактирования %s сообщения: %v", r.kind, err)
+	}
+
+	if r.mirror != nil {
+		r.mirror()
+	}
+}
+
+// saveRelayedMessage stores the copies a delete button removes and returns the
+// button's token. Callback data is limited to 64 bytes and can be forged, so the
+// ids themselves never go into it.
+func (h *Handler) saveRelayedMessage(ctx context.Context, m *domain.RelayedMessage) (string, error) {
+	token, err := newRelayToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate relay token: %w", err)
+	}
+	if err := h.redisClient.SaveRelayedMessage(ctx, token, m, relayTokenTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// newRelayToken returns a random 16-char token for a delete button
+func newRelayToken() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// relayCaption is the partner-facing caption: the sender's own caption or a type placeholder
+func relayCaption(nickname, caption, placeholder string) string {
+	if caption == "" {
+		return fmt.Sprintf("от %s: %s", nickname, placeholder)
+	}
+	return fmt.Sprintf("от %s: %s", nickname, caption)
+}
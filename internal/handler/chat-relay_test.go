@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const (
+	relaySender  = 10
+	relayPartner = 20
+)
+
+// relayTokenPattern matches the random part of delete buttons so goldens stay stable
+var relayTokenPattern = regexp.MustCompile(relayDeletePrefix + `[0-9a-f]{16}`)
+
+// newRelayHandler pairs relaySender, nicknamed "Aru", with relayPartner
+func newRelayHandler(t *testing.T) (*Handler, *fakeTelegram, func(*models.Message)) {
+	t.Helper()
+	h, mem, fake, b := newTestHandler(t)
+	ctx := context.Background()
+	if _, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: relaySender, Nickname: "Aru", Sex: "female", Age: 22}); err != nil {
+		t.Fatal(err)
+	}
+	mem.SetPartner(ctx, relaySender, relayPartner, time.Hour)
+	mem.SetPartner(ctx, relayPartner, relaySender, time.Hour)
+	send := func(m *models.Message) {
+		m.From = &models.User{ID: relaySender, Username: "aru_tg"}
+		m.Chat = models.Chat{ID: relaySender}
+		h.HandleChat(ctx, b, &models.Update{Message: m})
+	}
+	return h, fake, send
+}
+
+// formatCalls renders Bot API calls one per line with sorted parameters
+func formatCalls(calls []apiCall) string {
+	var sb strings.Builder
+	for _, c := range calls {
+		keys := make([]string, 0, len(c.Params))
+		for k := range c.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sb.WriteString(c.Method)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, " %s=%q", k, relayTokenPattern.ReplaceAllString(c.Params[k], relayDeletePrefix+"TOKEN"))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "relay", name+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n--- got\n%s--- want\n%s", name, path, got, want)
+	}
+}
+
+func TestRelayGolden(t *testing.T) {
+	photo := []models.PhotoSize{{FileID: "photo-small"}, {FileID: "photo-big"}}
+	tests := map[string]*models.Message{
+		"text":             {Text: "сәлем, how are you?"},
+		"photo":            {Photo: photo, Caption: "look"},
+		"photo_no_caption": {Photo: photo},
+		"video":            {Video: &models.Video{FileID: "video-id"}, Caption: "clip"},
+		"video_no_caption": {Video: &models.Video{FileID: "video-id"}},
+		"voice":            {Voice: &models.Voice{FileID: "voice-id"}},
+		"video_note":       {VideoNote: &models.VideoNote{FileID: "note-id"}},
+		"animation":        {Animation: &models.Animation{FileID: "gif-id"}, Document: &models.Document{FileID: "gif-id"}},
+		"document":         {Document: &models.Document{FileID: "doc-id"}, Caption: "report.pdf"},
+		"audio":            {Audio: &models.Audio{FileID: "audio-id"}},
+		"venue":            {Venue: &models.Venue{Title: "Kok Tobe", Address: "Almaty", Location: models.Location{Latitude: 43.23, Longitude: 76.97}}, Location: &models.Location{Latitude: 43.23, Longitude: 76.97}},
+		"location":         {Location: &models.Location{Latitude: 43.238949, Longitude: 76.889709}},
+		"sticker":          {Sticker: &models.Sticker{FileID: "sticker-id"}},
+		"dice":             {Dice: &models.Dice{Emoji: "🎲", Value: 4}},
+		"contact":          {Contact: &models.Contact{PhoneNumber: "+77012345678", FirstName: "Aru", LastName: "K"}},
+		"poll":             {Poll: &models.Poll{Question: "Tea or coffee?", Options: []models.PollOption{{Text: "tea"}, {Text: "coffee"}}}},
+		"unknown_type":     {Game: &models.Game{Title: "snake"}},
+	}
+	for name, msg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, fake, send := newRelayHandler(t)
+			send(msg)
+			checkGolden(t, name, formatCalls(fake.Calls()))
+		})
+	}
+}
+
+func TestRelayGoldenBlockedPartner(t *testing.T) {
+	h, fake, send := newRelayHandler(t)
+	fake.Fail("sendMessage", 403, "Forbidden: bot was blocked by the user")
+	send(&models.Message{Text: "are you there?"})
+	checkGolden(t, "blocked_partner", formatCalls(fake.Calls()))
+
+	if p, _ := h.redisClient.GetUserPartner(context.Background(), relaySender); p != 0 {
+		t.Fatalf("sender still paired with %d after the partner blocked the bot", p)
+	}
+}
+
+func TestRelayKeepsMarkupCharacters(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *models.Message
+		// method and parameter the partner's copy carries the text in
+		method, param, want string
+	}{
+		{"script text", &models.Message{Text: "<script>alert(1)</script>"}, "sendMessage", "text", "от Aru: <script>alert(1)</script>"},
+		{"comparison text", &models.Message{Text: "5 < 3"}, "sendMessage", "text", "от Aru: 5 < 3"},
+		{"photo caption", &models.Message{Photo: []models.PhotoSize{{FileID: "p"}}, Caption: "5 < 3"}, "sendPhoto", "caption", "от Aru: 5 < 3"},
+		{"video caption", &models.Message{Video: &models.Video{FileID: "v"}, Caption: "<script>"}, "sendVideo", "caption", "от Aru: <script>"},
+		{"contact", &models.Message{Contact: &models.Contact{PhoneNumber: "+7", FirstName: "<b", LastName: "& co"}}, "sendMessage", "text", "от Aru: контакт\nТел: +7\nИмя: <b & co"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, fake, send := newRelayHandler(t)
+			send(tt.msg)
+
+			calls := fake.Calls()
+			if len(calls) == 0 || calls[0].Method != tt.method || calls[0].Params["chat_id"] != "20" {
+				t.Fatalf("first call %v, want %s to the partner", methods(calls), tt.method)
+			}
+			if got := calls[0].Params[tt.param]; got != tt.want {
+				t.Fatalf("partner got %q, want %q", got, tt.want)
+			}
+			// the sender's copy gets its delete button only after a successful relay
+			if len(calls) < 3 || !strings.HasPrefix(calls[2].Method, "editMessage") {
+				t.Fatalf("calls %v, want the sender's copy edited", methods(calls))
+			}
+			if p, _ := h.redisClient.GetUserPartner(context.Background(), relaySender); p != relayPartner {
+				t.Fatalf("sender paired with %d, want the chat kept", p)
+			}
+		})
+	}
+}
+
+// TestFakeTelegramRejectsBadHTML makes sure the fake fails the way Telegram does,
+// so a parse mode creeping back into the relay breaks TestRelayKeepsMarkupCharacters
+func TestFakeTelegramRejectsBadHTML(t *testing.T) {
+	_, b := newFakeTelegram(t)
+	ctx := context.Background()
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: 1, Text: "5 < 3", ParseMode: models.ParseModeHTML}); err == nil {
+		t.Fatal(`"5 < 3" with ParseMode HTML was accepted`)
+	}
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: 1, Text: "<b>bold</b> & <i>fine</i>", ParseMode: models.ParseModeHTML}); err != nil {
+		t.Fatalf("valid HTML rejected: %v", err)
+	}
+}
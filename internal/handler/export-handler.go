@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+// exportJanitorInterval is how often old export files are swept
+const exportJanitorInterval = time.Hour
+
+// Export formats offered in the admin panel
+const (
+	exportXLSX = "xlsx"
+	exportCSV  = "csv"
+)
+
+// exportCallbackPrefix starts the callback data of the format buttons: export_<dataset>_<format>
+const exportCallbackPrefix = "export_"
+
+// askExportFormat offers XLSX / CSV for a dataset before exporting it
+func (h *Handler) askExportFormat(ctx context.Context, b *bot.Bot, update *models.Update, dataset string) {
+	if !h.IsAdmin(update.Message.From.ID) {
+		return
+	}
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.From.ID,
+		Text:   "📁 Файл форматын таңдаңыз:",
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: "📊 XLSX", CallbackData: exportCallbackPrefix + dataset + "_" + exportXLSX},
+				{Text: "📄 CSV", CallbackData: exportCallbackPrefix + dataset + "_" + exportCSV},
+			}},
+		},
+	})
+	if err != nil {
+		h.logger.Error("Failed to send export format choice", zap.Error(err))
+	}
+}
+
+// ExportFormatHandler runs the export picked with the XLSX / CSV buttons
+func (h *Handler) ExportFormatHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	if !h.IsAdmin(cq.From.ID) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", cq.From.ID))
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "⏳ Дайындалуда..."})
+
+	if cq.Message.Message != nil {
+		b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: cq.Message.Message.Chat.ID, MessageID: cq.Message.Message.ID})
+	}
+
+	dataset, format, _ := strings.Cut(strings.TrimPrefix(cq.Data, exportCallbackPrefix), "_")
+	if format != exportXLSX && format != exportCSV {
+		h.logger.Warn("Unknown export format", zap.String("data", cq.Data))
+		return
+	}
+	adminUpdate := &models.Update{Message: &models.Message{From: &models.User{ID: cq.From.ID}}}
+	switch dataset {
+	case "just":
+		h.handleJustUsers(ctx, b, adminUpdate, format)
+	default:
+		h.logger.Warn("Unknown export dataset", zap.String("data", cq.Data))
+	}
+}
+
+// justUsersHeaders is the column order shared by every just-users export format
+var justUsersHeaders = []string{"№", "User ID", "Username", "Тіркелген күні"}
+
+func justUsersRow(n int, e domain.JustEntry) []interface{} {
+	return []interface{}{n, e.UserId, e.UserName, e.DateRegistered}
+}
+
+// cellRef is the A1-style reference of a 1-based row and column; columns go on
+// past Z as AA, AB, ... Out-of-range coordinates give "", which excelize rejects.
+func cellRef(row, col int) string {
+	name, err := excelize.ColumnNumberToName(col)
+	if err != nil || row < 1 {
+		return ""
+	}
+	return name + strconv.Itoa(row)
+}
+
+// exportLockTTL caps how long a crashed export can block the next one of the same kind
+const exportLockTTL = 10 * time.Minute
+
+func exportLockKey(adminID int64, dataset, format string) string {
+	return fmt.Sprintf("export:lock:%d:%s:%s", adminID, dataset, format)
+}
+
+// handleJustUsers starts a background export of the just table as xlsx or csv.
+// The admin gets a progress message right away; the file follows when it is ready.
+func (h *Handler) handleJustUsers(ctx context.Context, b *bot.Bot, update *models.Update, format string) {
+	adminId := update.Message.From.ID
+	if !h.IsAdmin(adminId) {
+		return
+	}
+
+	lockKey := exportLockKey(adminId, "just", format)
+	allowed, _, err := h.redisClient.HitOnce(ctx, lockKey, exportLockTTL)
+	if err != nil {
+		h.logger.Error("export: lock failed", zap.Error(err))
+	} else if !allowed {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "⏳ Бұл экспорт әлі дайындалуда, күте тұрыңыз."})
+		return
+	}
+
+	status, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "⏳ Экспорт дайындалуда…"})
+	if err != nil {
+		h.logger.Error("export: status message failed", zap.Error(err))
+	}
+
+	// the job outlives this update; shutdown waits for it up to the grace period
+	h.goWorker("export-"+format, func(ctx context.Context) {
+		defer h.redisClient.Release(context.WithoutCancel(ctx), lockKey)
+		h.runJustUsersExport(ctx, b, update, format, status)
+	})
+}
+
+func (h *Handler) runJustUsersExport(ctx context.Context, b *bot.Bot, update *models.Update, format string, status *models.Message) {
+	adminId := update.Message.From.ID
+	setStatus := func(text string) {
+		if status == nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text})
+			return
+		}
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{ChatID: adminId, MessageID: status.ID, Text: text})
+	}
+
+	if err := os.MkdirAll(h.cfg.ExcelDir, 0755); err != nil {
+		h.logger.Error("Failed to create excel dir", zap.String("dir", h.cfg.ExcelDir), zap.Error(err))
+		setStatus("❌ Қате: экспорт папкасын жасау мүмкін болмады")
+		return
+	}
+	filePath := filepath.Join(h.cfg.ExcelDir, fmt.Sprintf("just_users_%s.%s", time.Now().Format("20060102_150405"), format))
+
+	var count int
+	var err error
+	switch format {
+	case exportCSV:
+		count, err = h.writeJustUsersCSV(ctx, filePath)
+	default:
+		count, err = h.writeJustUsersXLSX(ctx, filePath)
+	}
+	if err != nil {
+		// a partial file must not be picked up later
+		os.Remove(filePath)
+		if ctx.Err() != nil {
+			h.logger.Info("export: cancelled by shutdown", zap.String("format", format))
+			return
+		}
+		h.logger.Error("Failed to export just entries", zap.String("format", format), zap.Error(err))
+		setStatus("❌ Қате: тіркелгендер тізімін алу мүмкін болмады")
+		return
+	}
+
+	setStatus(fmt.Sprintf("✅ Экспорт дайын: %d жол", count))
+	h.sendExportFile(ctx, b, update, filePath, fmt.Sprintf("👥 Тіркелгендер: %d", count), false)
+}
+
+func (h *Handler) writeJustUsersXLSX(ctx context.Context, filePath string) (int, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Тіркелгендер"
+	f.SetSheetName("Sheet1", sheet)
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"4472C4"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center"},
+	})
+	if err != nil {
+		h.logger.Error("Failed to create header style", zap.Error(err))
+	}
+
+	// StreamWriter flushes rows to a temp file as they come, so memory stays flat on big tables
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return 0, err
+	}
+	sw.SetColWidth(1, 1, 6)
+	sw.SetColWidth(2, len(justUsersHeaders), 22)
+
+	headers := make([]interface{}, 0, len(justUsersHeaders))
+	for _, title := range justUsersHeaders {
+		headers = append(headers, excelize.Cell{StyleID: headerStyle, Value: title})
+	}
+	if err := sw.SetRow(cellRef(1, 1), headers); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = h.userRepo.ForEachJustEntry(ctx, func(e domain.JustEntry) error {
+		count++
+		return sw.SetRow(cellRef(count+1, 1), justUsersRow(count, e))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := sw.Flush(); err != nil {
+		return 0, err
+	}
+	return count, f.SaveAs(filePath)
+}
+
+// writeJustUsersCSV writes the same columns as the xlsx export; csv.Writer quotes
+// nicknames containing commas, quotes or newlines
+func (h *Handler) writeJustUsersCSV(ctx context.Context, filePath string) (count int, err error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return 0, err
+	}
+	// a failed close can lose buffered data, so it fails the export too
+	defer func() {
+		if cerr := file.Close(); err == nil && cerr != nil {
+			count, err = 0, cerr
+		}
+	}()
+
+	// without the BOM Excel reads the file as ANSI and garbles Cyrillic/Kazakh text
+	if _, err := file.WriteString("\uFEFF"); err != nil {
+		return 0, err
+	}
+
+	w := csv.NewWriter(file)
+	if err := w.Write(justUsersHeaders); err != nil {
+		return 0, err
+	}
+
+	err = h.userRepo.ForEachJustEntry(ctx, func(e domain.JustEntry) error {
+		count++
+		row := justUsersRow(count, e)
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = fmt.Sprint(v)
+		}
+		return w.Write(record)
+	})
+	if err != nil {
+		return 0, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// isExpiredExport reports whether a file in the export dir should be removed
+func isExpiredExport(name string, modTime, now time.Time, retention time.Duration) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".xlsx" && ext != ".csv" {
+		return false
+	}
+	return now.Sub(modTime) > retention
+}
+
+// cleanupExports removes export files older than the configured retention
+func (h *Handler) cleanupExports() {
+	dirEntries, err := os.ReadDir(h.cfg.ExcelDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			h.logger.Warn("export janitor: read dir failed", zap.String("dir", h.cfg.ExcelDir), zap.Error(err))
+		}
+		return
+	}
+	now := time.Now()
+	var removed int
+	var reclaimed int64
+	for _, de := range dirEntries {
+		if de.IsDir() {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		if !isExpiredExport(de.Name(), info.ModTime(), now, h.cfg.ExcelRetention) {
+			continue
+		}
+		path := filepath.Join(h.cfg.ExcelDir, de.Name())
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			h.logger.Warn("export janitor: remove failed", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		removed++
+		reclaimed += info.Size()
+		h.logger.Info("export janitor: removed old export", zap.String("file", path), zap.Int64("bytes", info.Size()))
+	}
+	if removed > 0 {
+		h.logger.Info("export janitor: sweep done", zap.Int("files", removed), zap.Int64("reclaimed_bytes", reclaimed))
+	}
+}
+
+// startExportJanitor sweeps the export dir until ctx is cancelled
+func (h *Handler) startExportJanitor(ctx context.Context) {
+	h.cleanupExports()
+	ticker := time.NewTicker(exportJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.cleanupExports()
+		}
+	}
+}
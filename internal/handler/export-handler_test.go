@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCellRef(t *testing.T) {
+	tests := []struct {
+		row, col int
+		want     string
+	}{
+		{1, 1, "A1"},
+		{1, 26, "Z1"},
+		{1, 27, "AA1"},
+		{1, 28, "AB1"},
+		{12, 30, "AD12"},
+		{1, 702, "ZZ1"},
+		{1, 703, "AAA1"},
+		{0, 1, ""},
+		{1, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := cellRef(tt.row, tt.col); got != tt.want {
+			t.Errorf("cellRef(%d, %d) = %q, want %q", tt.row, tt.col, got, tt.want)
+		}
+	}
+}
+
+// TestWideSheetHeaders writes a 30-column header row the way the exports do and
+// reads it back: the columns past Z must land in AA1, AB1, ...
+func TestWideSheetHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wide.xlsx")
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := make([]interface{}, 30)
+	for i := range headers {
+		headers[i] = cellRef(1, i+1)
+	}
+	if err := sw.SetRow(cellRef(1, 1), headers); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	f, err = excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, cell := range []string{"A1", "Z1", "AA1", "AB1", "AD1"} {
+		v, err := f.GetCellValue("Sheet1", cell)
+		if err != nil || v != cell {
+			t.Errorf("%s = %q, %v", cell, v, err)
+		}
+	}
+	if v, _ := f.GetCellValue("Sheet1", "AE1"); v != "" {
+		t.Errorf("AE1 = %q, want empty", v)
+	}
+}
+
+// BenchmarkWriteJustUsersXLSX exports 200k just rows. The streamed export must
+// finish in under 10 seconds and keep the heap under 200MB.
+func BenchmarkWriteJustUsersXLSX(b *testing.B) {
+	const rows = 200_000
+	h, _, _, _ := newTestHandler(b)
+	ctx := context.Background()
+	seedJust(b, h, rows)
+	path := filepath.Join(b.TempDir(), "just.xlsx")
+	runtime.GC()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stop := sampleHeap()
+		start := time.Now()
+		count, err := h.writeJustUsersXLSX(ctx, path)
+		elapsed := time.Since(start)
+		peakMB := float64(stop()) / (1 << 20)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if count != rows {
+			b.Fatalf("exported %d rows, want %d", count, rows)
+		}
+		b.Logf("%d rows in %s, peak heap %.0fMB (targets: 10s, 200MB)", rows, elapsed.Round(time.Millisecond), peakMB)
+		if elapsed > 10*time.Second {
+			b.Errorf("export took %s, want under 10s", elapsed)
+		}
+		if peakMB > 200 {
+			b.Errorf("peak heap %.0fMB, want under 200MB", peakMB)
+		}
+		b.ReportMetric(peakMB, "peak-heap-MB")
+	}
+}
+
+// BenchmarkJustUsersExportMemory compares the old export, which loaded every
+// entry and built the sheet cell by cell, with the streamed one on 50k rows
+func BenchmarkJustUsersExportMemory(b *testing.B) {
+	const rows = 50_000
+	h, _, _, _ := newTestHandler(b)
+	ctx := context.Background()
+	seedJust(b, h, rows)
+	path := filepath.Join(b.TempDir(), "just.xlsx")
+
+	for _, bm := range []struct {
+		name  string
+		write func(context.Context, string) (int, error)
+	}{
+		{"before", h.writeJustUsersXLSXInMemory},
+		{"after", h.writeJustUsersXLSX},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			runtime.GC()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stop := sampleHeap()
+				count, err := bm.write(ctx, path)
+				peakMB := float64(stop()) / (1 << 20)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if count != rows {
+					b.Fatalf("exported %d rows, want %d", count, rows)
+				}
+				b.ReportMetric(peakMB, "peak-heap-MB")
+			}
+		})
+	}
+}
+
+// writeJustUsersXLSXInMemory is the export as it was before streaming: every
+// entry in a slice, then SetCellValue per cell on the in-memory sheet
+func (h *Handler) writeJustUsersXLSXInMemory(ctx context.Context, filePath string) (int, error) {
+	var entries []domain.JustEntry
+	err := h.userRepo.ForEachJustEntry(ctx, func(e domain.JustEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "Тіркелгендер"
+	f.SetSheetName("Sheet1", sheet)
+	for i, title := range justUsersHeaders {
+		f.SetCellValue(sheet, cellRef(1, i+1), title)
+	}
+	for i, e := range entries {
+		for col, v := range justUsersRow(i+1, e) {
+			f.SetCellValue(sheet, cellRef(i+2, col+1), v)
+		}
+	}
+	return len(entries), f.SaveAs(filePath)
+}
+
+// seedJust inserts n just rows in one transaction
+func seedJust(tb testing.TB, h *Handler, n int) {
+	tb.Helper()
+	ctx := context.Background()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO just (id_user, userName, dataRegistred) VALUES (?, ?, ?);`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		if _, err := stmt.ExecContext(ctx, i, fmt.Sprintf("user_%d", i), "2024-01-02 15:04:05"); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// sampleHeap polls the in-use heap until stop is called, which returns the peak
+func sampleHeap() func() uint64 {
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var ms runtime.MemStats
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > peak {
+				peak = ms.HeapInuse
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak
+	}
+}
+
+func TestIsExpiredExport(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	const retention = 24 * time.Hour
+	tests := []struct {
+		name string
+		file string
+		age  time.Duration
+		want bool
+	}{
+		{"fresh xlsx", "just_users.xlsx", time.Hour, false},
+		{"old xlsx", "just_users.xlsx", 25 * time.Hour, true},
+		{"old csv", "just_users.csv", 25 * time.Hour, true},
+		{"extension in upper case", "REPORT.XLSX", 25 * time.Hour, true},
+		{"exactly the retention", "just_users.xlsx", retention, false},
+		{"old file of another kind", "notes.txt", 30 * 24 * time.Hour, false},
+		{"no extension", "xlsx", 30 * 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		if got := isExpiredExport(tt.file, now.Add(-tt.age), now, retention); got != tt.want {
+			t.Errorf("%s: isExpiredExport(%q, %v old) = %v, want %v", tt.name, tt.file, tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestCleanupExports(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.cfg.ExcelDir = t.TempDir()
+	h.cfg.ExcelRetention = time.Hour
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]bool{"old.xlsx": true, "old.csv": true, "old.txt": false, "new.xlsx": false}
+	for name, expired := range files {
+		path := filepath.Join(h.cfg.ExcelDir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if expired || name == "old.txt" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	h.cleanupExports()
+	for name, expired := range files {
+		_, err := os.Stat(filepath.Join(h.cfg.ExcelDir, name))
+		if gone := os.IsNotExist(err); gone != expired {
+			t.Errorf("%s removed = %v, want %v", name, gone, expired)
+		}
+	}
+}
+
+// seedJustRows inserts just rows with increasing created_at, so the export,
+// newest first, lists them in reverse
+func seedJustRows(t *testing.T, h *Handler, rows ...domain.JustEntry) {
+	t.Helper()
+	for i, e := range rows {
+		_, err := h.db.Exec(`INSERT INTO just (id_user, userName, dataRegistred, created_at) VALUES (?, ?, ?, ?);`,
+			e.UserId, e.UserName, e.DateRegistered, fmt.Sprintf("2024-01-01 00:00:%02d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteJustUsersCSVGolden(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	seedJustRows(t, h,
+		domain.JustEntry{UserId: 101, UserName: "aru", DateRegistered: "2024-03-05 14:30:15"},
+		domain.JustEntry{UserId: 102, UserName: "", DateRegistered: "2024-03-06 09:00:00"},
+		domain.JustEntry{UserId: 103, UserName: "nurlan_99", DateRegistered: "2024-03-07 18:45:01"},
+	)
+
+	path := filepath.Join(t.TempDir(), "just.csv")
+	count, err := h.writeJustUsersCSV(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "export", "just_users.csv")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, []byte("\uFEFF")) {
+		t.Errorf("no UTF-8 BOM at the start: % x", got[:min(len(got), 3)])
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("CSV differs from %s:\n--- got\n%s--- want\n%s", golden, got, want)
+	}
+}
+
+// TestWriteJustUsersCSVRoundTrip checks that nicknames with Cyrillic, commas,
+// quotes and newlines come back unchanged through a CSV reader
+func TestWriteJustUsersCSVRoundTrip(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	names := []string{
+		"Әйгерім Қасымқызы",
+		"smith, john",
+		`the "boss"`,
+		"line one\nline two",
+		`"Айдана", "Ерлан"`,
+	}
+	entries := make([]domain.JustEntry, len(names))
+	for i, name := range names {
+		entries[i] = domain.JustEntry{UserId: int64(201 + i), UserName: name, DateRegistered: "2024-03-05 14:30:15"}
+	}
+	seedJustRows(t, h, entries...)
+
+	path := filepath.Join(t.TempDir(), "just.csv")
+	if _, err := h.writeJustUsersCSV(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\uFEFF")))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(names)+1 {
+		t.Fatalf("%d records, want %d", len(records), len(names)+1)
+	}
+	if got := strings.Join(records[0], "|"); got != strings.Join(justUsersHeaders, "|") {
+		t.Errorf("header = %q", got)
+	}
+	// newest first: the last seeded name is on the first data row
+	for i, rec := range records[1:] {
+		want := entries[len(entries)-1-i]
+		if rec[1] != fmt.Sprint(want.UserId) || rec[2] != want.UserName {
+			t.Errorf("row %d = %q, want id %d name %q", i+1, rec, want.UserId, want.UserName)
+		}
+	}
+}
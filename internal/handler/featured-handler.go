@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// featuredPoolFactor: how many candidates to rank per carousel slot
+	featuredPoolFactor = 5
+	// featuredSpareFactor: how many profiles the cache holds per slot, so dropping
+	// the caller and the profiles they blocked doesn't shrink the carousel
+	featuredSpareFactor = 2
+)
+
+type featuredWeights struct {
+	Recent   float64
+	Complete float64
+	Popular  float64
+	Verified float64
+	Boosted  float64
+	Skip     float64
+}
+
+func (h *Handler) featuredWeights() featuredWeights {
+	return featuredWeights{
+		Recent:   h.cfg.FeaturedWeightRecent,
+		Complete: h.cfg.FeaturedWeightComplete,
+		Popular:  h.cfg.FeaturedWeightPopular,
+		Verified: h.cfg.FeaturedWeightVerified,
+		Boosted:  h.cfg.FeaturedWeightBoosted,
+		Skip:     h.cfg.SkipPenalty,
+	}
+}
+
+// FeaturedUsersHandler returns the curated carousel. A caller identified by signed
+// initData doesn't see their own profile or anyone on either side of a block with them.
+func (h *Handler) FeaturedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	list, err := h.loadFeatured(r.Context())
+	if err != nil {
+		logger.Error("featured: load failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	callerTG, _ := h.verifiedTGID(r)
+	hidden, err := h.featuredHidden(r.Context(), callerTG)
+	if err != nil {
+		logger.Warn("featured: block lookup failed", zap.Int64("tg_id", callerTG), zap.Error(err))
+	}
+	out := make([]NearbyUser, 0, h.cfg.FeaturedLimit)
+	for _, u := range list {
+		if callerTG != 0 && u.UserID == callerTG || hidden[u.ID] {
+			continue
+		}
+		out = append(out, u)
+		if len(out) >= h.cfg.FeaturedLimit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// featuredHidden returns the users.id values blocked by or blocking the caller
+func (h *Handler) featuredHidden(ctx context.Context, callerTG int64) (map[string]bool, error) {
+	if callerTG == 0 {
+		return nil, nil
+	}
+	caller, err := h.userRepo.GetUserByTelegramId(ctx, callerTG)
+	if err != nil || caller == nil {
+		return nil, err
+	}
+	return h.blockRepo.BlockedWith(ctx, caller.Id)
+}
+
+// loadFeatured serves the cached ranking, rebuilding it on a cache miss
+func (h *Handler) loadFeatured(ctx context.Context) ([]NearbyUser, error) {
+	data, err := h.redisClient.GetFeaturedProfiles(ctx)
+	if err != nil {
+		h.logger.Warn("featured: cache read failed, rebuilding", zap.Error(err))
+	}
+	if len(data) > 0 {
+		var list []NearbyUser
+		if err := json.Unmarshal(data, &list); err == nil {
+			return list, nil
+		}
+	}
+	return h.refreshFeatured(ctx)
+}
+
+// refreshFeatured ranks candidates and stores the result for one refresh window
+func (h *Handler) refreshFeatured(ctx context.Context) ([]NearbyUser, error) {
+	limit := h.cfg.FeaturedLimit * featuredSpareFactor
+	cands, err := h.userRepo.FindFeaturedCandidates(ctx, limit*featuredPoolFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seed := now.Truncate(h.cfg.FeaturedRefresh).Unix()
+	picked := selectFeatured(cands, h.featuredWeights(), now, seed, limit)
+
+	list := make([]NearbyUser, 0, len(picked))
+	for _, u := range picked {
+		// the cache is shared by every viewer, so it only holds the public view
+		list = append(list, newNearbyUser(&u, nil, false))
+	}
+
+	if data, err := json.Marshal(list); err == nil {
+		if err := h.redisClient.SaveFeaturedProfiles(ctx, data, h.cfg.FeaturedRefresh); err != nil {
+			h.logger.Warn("featured: cache write failed", zap.Error(err))
+		}
+	}
+	return list, nil
+}
+
+// startFeaturedRefresher rebuilds the carousel every refresh window until ctx is done
+func (h *Handler) startFeaturedRefresher(ctx context.Context) {
+	ticker := time.NewTicker(h.cfg.FeaturedRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.refreshFeatured(ctx); err != nil {
+				h.logger.Error("featured: refresh failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// selectFeatured scores candidates and returns the top `limit`.
+// Ties are broken by a hash of seed+id, so the order is stable within a cache window.
+func selectFeatured(cands []domain.FeaturedCandidate, wt featuredWeights, now time.Time, seed int64, limit int) []domain.User {
+	type scored struct {
+		user  domain.User
+		score float64
+		tie   uint64
+	}
+	items := make([]scored, 0, len(cands))
+	for _, c := range cands {
+		items = append(items, scored{
+			user:  c.User,
+			score: featuredScore(c, wt, now),
+			tie:   featuredTie(seed, c.User.Id),
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].score != items[j].score {
+			return items[i].score > items[j].score
+		}
+		return items[i].tie < items[j].tie
+	})
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	out := make([]domain.User, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.user)
+	}
+	return out
+}
+
+func featuredScore(c domain.FeaturedCandidate, wt featuredWeights, now time.Time) float64 {
+	// recency halves roughly every week
+	ageDays := now.Sub(c.User.CreatedAt).Hours() / 24
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	recent := math.Exp(-ageDays / 10)
+
+	var filled float64
+	if strings.TrimSpace(c.User.AvatarPath) != "" {
+		filled++
+	}
+	if strings.TrimSpace(c.User.AboutUser) != "" {
+		filled++
+	}
+	if c.User.Latitude != nil && c.User.Longitude != nil {
+		filled++
+	}
+	complete := filled / 3
+
+	popular := float64(c.Likes) / float64(c.Likes+5)
+	skipped := skipRate(domain.SkipStats{Skips: c.Skips, Likes: c.Likes})
+
+	var verified, boosted float64
+	if c.Verified {
+		verified = 1
+	}
+	if c.Boosted {
+		boosted = 1
+	}
+
+	return wt.Recent*recent + wt.Complete*complete + wt.Popular*popular + wt.Verified*verified + wt.Boosted*boosted - wt.Skip*skipped
+}
+
+func featuredTie(seed int64, id string) uint64 {
+	hs := fnv.New64a()
+	var b [8]byte
+	for i := 0; i < 8; i++ {
+		b[i] = byte(seed >> (8 * i))
+	}
+	hs.Write(b[:])
+	hs.Write([]byte(id))
+	return hs.Sum64()
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// featuredIDs lists the ids of picked users in order
+func featuredIDs(users []domain.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+	return ids
+}
+
+func TestSelectFeaturedWeights(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	lat, lon := 43.2, 76.9
+	plain := func(id string) domain.FeaturedCandidate {
+		return domain.FeaturedCandidate{User: domain.User{Id: id, CreatedAt: now.AddDate(0, 0, -30)}}
+	}
+
+	tests := []struct {
+		name  string
+		wt    featuredWeights
+		cands []domain.FeaturedCandidate
+		want  []string
+	}{
+		{
+			name: "boosted over verified over plain",
+			wt:   featuredWeights{Verified: 1, Boosted: 2},
+			cands: []domain.FeaturedCandidate{
+				plain("plain"),
+				{User: plain("verified").User, Verified: true},
+				{User: plain("boosted").User, Boosted: true},
+			},
+			want: []string{"boosted", "verified", "plain"},
+		},
+		{
+			name: "recent first",
+			wt:   featuredWeights{Recent: 1},
+			cands: []domain.FeaturedCandidate{
+				plain("old"),
+				{User: domain.User{Id: "new", CreatedAt: now.Add(-time.Hour)}},
+			},
+			want: []string{"new", "old"},
+		},
+		{
+			name: "complete profiles first",
+			wt:   featuredWeights{Complete: 1},
+			cands: []domain.FeaturedCandidate{
+				plain("empty"),
+				{User: domain.User{Id: "full", AvatarPath: "a.jpg", AboutUser: "hi", Latitude: &lat, Longitude: &lon}},
+				{User: domain.User{Id: "half", AvatarPath: "a.jpg"}},
+			},
+			want: []string{"full", "half", "empty"},
+		},
+		{
+			name: "liked over skipped",
+			wt:   featuredWeights{Popular: 1, Skip: 1},
+			cands: []domain.FeaturedCandidate{
+				{User: plain("skipped").User, Skips: 50},
+				{User: plain("liked").User, Likes: 20},
+				plain("neither"),
+			},
+			want: []string{"liked", "neither", "skipped"},
+		},
+		{
+			name: "a zero weight turns the signal off",
+			wt:   featuredWeights{Popular: 1, Boosted: 0},
+			cands: []domain.FeaturedCandidate{
+				{User: plain("boosted").User, Boosted: true},
+				{User: plain("liked").User, Likes: 20},
+			},
+			want: []string{"liked", "boosted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := featuredIDs(selectFeatured(tt.cands, tt.wt, now, 1, len(tt.cands)))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFeaturedDeterministic(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	// equal scores everywhere, so only the tie-break orders them
+	cands := make([]domain.FeaturedCandidate, 30)
+	for i := range cands {
+		cands[i] = domain.FeaturedCandidate{User: domain.User{Id: fmt.Sprintf("u%02d", i), CreatedAt: now}}
+	}
+	wt := featuredWeights{Recent: 1}
+
+	first := featuredIDs(selectFeatured(cands, wt, now, 100, 10))
+	if len(first) != 10 {
+		t.Fatalf("picked %d, want the limit of 10", len(first))
+	}
+	reversed := slices.Clone(cands)
+	slices.Reverse(reversed)
+	if again := featuredIDs(selectFeatured(reversed, wt, now, 100, 10)); !slices.Equal(first, again) {
+		t.Fatalf("same window, different order:\n%v\n%v", first, again)
+	}
+	if next := featuredIDs(selectFeatured(cands, wt, now, 200, 10)); slices.Equal(first, next) {
+		t.Fatalf("next window kept the same order %v", first)
+	}
+}
+
+func TestFeaturedExcludesCallerAndBlocked(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.cfg.FeaturedLimit = 10
+	h.cfg.FeaturedRefresh = time.Minute
+	h.cfg.FeaturedWeightBoosted = 2
+	h.cfg.FeaturedWeightVerified = 1
+	ctx := context.Background()
+
+	ids := map[int64]string{}
+	for _, tg := range []int64{42, 43, 44, 45} {
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: fmt.Sprint("u", tg), Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[tg] = id
+	}
+	// 42 blocked 43, and 44 blocked 42
+	if _, err := h.db.Exec(`INSERT INTO blocks (blocker_user_id, blocked_user_id) VALUES (?, ?), (?, ?);`, ids[42], ids[43], ids[44], ids[42]); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.userRepo.BoostUntil(ctx, 45, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.userRepo.SetVerified(ctx, 43, true); err != nil {
+		t.Fatal(err)
+	}
+
+	featured := func(headers map[string]string) []int64 {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/users/featured", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.FeaturedUsersHandler(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var list []NearbyUser
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		var tgs []int64
+		for _, u := range list {
+			tgs = append(tgs, u.UserID)
+		}
+		return tgs
+	}
+
+	if got := featured(map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}); !slices.Equal(got, []int64{45}) {
+		t.Fatalf("signed caller 42 sees %v, want only 45", got)
+	}
+	// a bare X-Telegram-Id proves nothing, so it gets the public carousel
+	got := featured(map[string]string{"X-Telegram-Id": "42"})
+	if len(got) != 4 || got[0] != 45 || got[1] != 43 {
+		t.Fatalf("unsigned caller sees %v, want all four with boosted 45 and verified 43 first", got)
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"aika/config"
+	"aika/internal/repository"
+	"aika/traits/database"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-telegram/bot"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const testBotToken = "1:test"
+
+// signAs makes r come from tgID's Mini App, with initData signed by testBotToken
+func signAs(r *http.Request, tgID int64) *http.Request {
+	r.Header.Set(initDataHeader, signInitData(testBotToken, tgID, time.Now()))
+	return r
+}
+
+// apiCall is one request the bot made to the fake Bot API
+type apiCall struct {
+	Method string
+	Params map[string]string
+}
+
+// fakeTelegram is a Bot API server that records every call and answers with a
+// message, or with the result set for the method
+type fakeTelegram struct {
+	mu      sync.Mutex
+	calls   []apiCall
+	results map[string]string // method -> raw JSON result
+	errors  map[string]string // method -> raw JSON error response
+	// once answers only the next call of a method to a chat ("method chat_id"),
+	// ahead of errors and results
+	once   map[string]string
+	nextID int
+	// onCall, when set, sees every call before it is answered
+	onCall func(apiCall)
+}
+
+func newFakeTelegram(t testing.TB) (*fakeTelegram, *bot.Bot) {
+	t.Helper()
+	f := &fakeTelegram{results: map[string]string{
+		"deleteMessages":      "true",
+		"answerCallbackQuery": "true",
+	}, errors: map[string]string{}, once: map[string]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	b, err := bot.New(testBotToken, bot.WithServerURL(srv.URL), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, b
+}
+
+func (f *fakeTelegram) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(1 << 20)
+	params := map[string]string{}
+	if r.MultipartForm != nil {
+		for k, v := range r.MultipartForm.Value {
+			params[k] = v[0]
+		}
+	}
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	f.mu.Lock()
+	f.calls = append(f.calls, apiCall{Method: method, Params: params})
+	f.nextID++
+	id := f.nextID
+	result, ok := f.results[method]
+	errResp, failed := f.errors[method]
+	if resp, ok := f.once[method+" "+params["chat_id"]]; ok {
+		errResp, failed = resp, true
+		delete(f.once, method+" "+params["chat_id"])
+	}
+	onCall := f.onCall
+	f.mu.Unlock()
+	if onCall != nil {
+		onCall(apiCall{Method: method, Params: params})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case params["parse_mode"] == "HTML" && !validHTML(params["text"]+params["caption"]):
+		fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: unsupported start tag"}`)
+	case failed:
+		fmt.Fprint(w, errResp)
+	case ok:
+		fmt.Fprintf(w, `{"ok":true,"result":%s}`, result)
+	case method == "sendMediaGroup":
+		fmt.Fprintf(w, `{"ok":true,"result":[{"message_id":%d,"chat":{"id":1}},{"message_id":%d,"chat":{"id":1}}]}`, id, id+1000)
+	default:
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"chat":{"id":1}}}`, id)
+	}
+}
+
+// htmlTags are the tags Telegram accepts with ParseMode HTML
+var htmlTags = regexp.MustCompile(`</?(b|strong|i|em|u|ins|s|strike|del|a|code|pre|tg-spoiler|blockquote)(\s[^<>]*)?>`)
+
+// validHTML reports whether Telegram would parse s as HTML: every "<" must open a known tag
+func validHTML(s string) bool {
+	return !strings.Contains(htmlTags.ReplaceAllString(s, ""), "<")
+}
+
+// Calls returns the recorded calls and forgets them
+func (f *fakeTelegram) Calls() []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// OnCall sets the hook run for every call
+func (f *fakeTelegram) OnCall(fn func(apiCall)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onCall = fn
+}
+
+// Fail makes every call to method answer with a Bot API error
+func (f *fakeTelegram) Fail(method string, code int, description string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[method] = fmt.Sprintf(`{"ok":false,"error_code":%d,"description":%q}`, code, description)
+}
+
+// Throttle makes the next call of method to chatID answer 429 with retry_after
+func (f *fakeTelegram) Throttle(method, chatID string, retryAfter int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.once[method+" "+chatID] = fmt.Sprintf(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after %d","parameters":{"retry_after":%d}}`, retryAfter, retryAfter)
+}
+
+// methods lists the method of every call, in order
+func methods(calls []apiCall) []string {
+	out := make([]string, 0, len(calls))
+	for _, c := range calls {
+		out = append(out, c.Method)
+	}
+	return out
+}
+
+// newTestHandler builds a Handler on a fresh SQLite file and an in-memory chat state
+func newTestHandler(t testing.TB) (*Handler, *repository.MemoryStore, *fakeTelegram, *bot.Bot) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	db, err := database.InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), database.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mem := repository.NewMemoryStore()
+	cfg := &config.Config{
+		Token:         testBotToken,
+		ChannelName:   "@channel",
+		AdminID:       1000,
+		AdminIDs:      []int64{1000},
+		PartnerTTL:    time.Hour,
+		OrderPrice:    1500,
+		OrderMaxCount: 5,
+		BroadcastRate: 10000,
+	}
+	f, b := newFakeTelegram(t)
+	h := NewHandler(zap.NewNop(), cfg, ctx, db, mem)
+	h.SetBot(b)
+	return h, mem, f, b
+}
+
+// useMiniredis moves h's chat state from the memory store to a fresh miniredis
+func useMiniredis(t *testing.T, h *Handler) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	h.redisClient = repository.NewRedisClient(client)
+	return mr
+}
@@ -4,21 +4,22 @@ import (
 	"aika/config"
 	"aika/internal/domain"
 	"aika/internal/keyboard"
+	"aika/internal/metrics"
 	"aika/internal/repository"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -34,6 +35,10 @@ const (
 	stateContact    string = "contact"
 	stateAdminPanel string = "admin_panel"
 	stateBroadcast  string = "broadcast"
+
+	stateDeleteConfirm string = "delete_confirm"
+	stateTemplateName  string = "template_name"
+	stateScheduleTime  string = "schedule_time"
 )
 
 // ---------- API: MESSAGE ----------
@@ -53,25 +58,63 @@ type RegisterResponse struct {
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
 	UserId  string `json:"user_id,omitempty"`
+	Updated bool   `json:"updated,omitempty"`
+	// Errors maps a form field to the reason it was rejected
+	Errors map[string]string `json:"errors,omitempty"`
 }
 
 type Handler struct {
-	logger      *zap.Logger
-	cfg         *config.Config
-	bot         *bot.Bot
-	ctx         context.Context
-	userRepo    *repository.UserRepository
-	redisClient *repository.ChatRepository
+	logger        *zap.Logger
+	cfg           *config.Config
+	bot           *bot.Bot
+	ctx           context.Context
+	db            *sql.DB
+	userRepo      *repository.UserRepository
+	likeRepo      *repository.LikeRepository
+	skipRepo      *repository.SkipRepository
+	blockRepo     *repository.BlockRepository
+	broadcastRepo *repository.BroadcastRepository
+	reportRepo    *repository.ReportRepository
+	banRepo       *repository.BanRepository
+	orderRepo     *repository.OrderRepository
+	redisClient   repository.StateStore
+	mirror        *channelMirror
+	workers       *workerGroup
+	albums        *mediaGroupBuffer
+
+	// startedAt is when the process started; botCheck caches the startup getMe result
+	startedAt time.Time
+	botCheck  atomic.Pointer[error]
+	// now is the clock broadcast progress edits are paced by; tests replace it
+	now func() time.Time
+
+	// broadcasts tracks running broadcasts so shutdown can wait for them
+	broadcastMu     sync.Mutex
+	broadcasts      sync.WaitGroup
+	broadcastsClose bool
 }
 
-func NewHandler(logger *zap.Logger, cfg *config.Config, ctx context.Context, db *sql.DB, redisClient *repository.ChatRepository) *Handler {
-	return &Handler{
-		logger:      logger,
-		cfg:         cfg,
-		ctx:         ctx,
-		userRepo:    repository.NewUserRepository(db),
-		redisClient: redisClient,
-	}
+func NewHandler(logger *zap.Logger, cfg *config.Config, ctx context.Context, db *sql.DB, redisClient repository.StateStore) *Handler {
+	h := &Handler{
+		logger:        logger,
+		cfg:           cfg,
+		ctx:           ctx,
+		db:            db,
+		userRepo:      repository.NewUserRepository(db),
+		likeRepo:      repository.NewLikeRepository(db),
+		skipRepo:      repository.NewSkipRepository(db),
+		blockRepo:     repository.NewBlockRepository(db),
+		broadcastRepo: repository.NewBroadcastRepository(db),
+		reportRepo:    repository.NewReportRepository(db),
+		banRepo:       repository.NewBanRepository(db),
+		orderRepo:     repository.NewOrderRepository(db),
+		redisClient:   redisClient,
+		now:           time.Now,
+	}
+	h.workers = newWorkerGroup(ctx)
+	h.albums = newMediaGroupBuffer(redisClient, logger, mediaGroupWindow, mediaGroupMaxWait, h.handleAlbum)
+	h.mirror = newChannelMirror(cfg.MirrorBatch, cfg.MirrorFlushInterval, cfg.MirrorBatchSize, h.sendMirror, logger)
+	return h
 }
 
 
@@ -104,22 +147,22 @@ func (h *Handler) pairStatus(kind string, from, to int64) (LimitStatus, error) {
 
 func (h *Handler) LimitStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 	to := strings.TrimSpace(r.URL.Query().Get("to_user_id"))
 	if to == "" {
-		http.Error(w, "to_user_id required", http.StatusBadRequest)
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "to_user_id required")
 		return
 	}
-	fromTG, err := currentTGID(r)
+	fromTG, err := h.verifiedTGID(r)
 	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
-	toUser, err := h.userRepo.GetUserByID(to)
+	toUser, err := h.userRepo.GetUserByID(r.Context(), to)
 	if err != nil || toUser == nil || toUser.TelegramId == 0 {
-		http.Error(w, "recipient not found", http.StatusBadRequest)
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient not found")
 		return
 	}
 
@@ -165,6 +208,50 @@ func (h *Handler) getOrCreateUserState(ctx context.Context, userID int64) *domai
 	return state
 }
 
+// commandName returns the bot command text starts with, without arguments or the
+// @botname suffix, or "" when text is not a command
+func commandName(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	cmd, _, _ := strings.Cut(strings.Fields(text)[0], "@")
+	return cmd
+}
+
+// resetUserState clears the user, admin and broadcast states of userID, and the
+// broadcast cancel flag of an admin, and starts them over in stateStart. An open
+// chat is left as it is.
+func (h *Handler) resetUserState(ctx context.Context, b *bot.Bot, userID int64, cmd string) {
+	if err := h.redisClient.ClearAllUserStates(ctx, userID); err != nil {
+		h.logger.Error("Failed to clear user states", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	if h.IsAdmin(userID) {
+		if err := h.redisClient.ClearBroadcastCancel(ctx, userID); err != nil {
+			h.logger.Error("Failed to clear broadcast cancel flag", zap.Int64("user_id", userID), zap.Error(err))
+		}
+	}
+	if err := h.redisClient.SaveUserState(ctx, userID, &domain.UserState{State: stateStart}); err != nil {
+		h.logger.Warn("Failed to save start state", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	h.logger.Info("User state reset", zap.Int64("user_id", userID), zap.String("command", cmd))
+
+	if cmd == "/cancel" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      userID,
+			Text:        "✅ Болдырылды. Басынан бастай аласыз.",
+			ReplyMarkup: &models.ReplyKeyboardRemove{RemoveKeyboard: true},
+		})
+		return
+	}
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(keyboard.NewWebAppButton("🚀 AIKA Mini App", h.cfg.MiniAppURL))
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      userID,
+		Text:        "Сәлем! Чатқа қосылу үшін төмендегі 🚀 AIKA Mini App батырмасын басыңыз.",
+		ReplyMarkup: kb.Build(),
+	})
+}
+
 func (h *Handler) SetBot(b *bot.Bot) { h.bot = b }
 
 func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -173,12 +260,15 @@ func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models
 	}
 
 	userId := update.Message.From.ID
+	if err := h.redisClient.SetLastSeen(ctx, userId, time.Now()); err != nil {
+		h.logger.Warn("Failed to set last seen", zap.Error(err))
+	}
 
 	ok, errE := h.userRepo.ExistsJust(ctx, userId)
 	if errE != nil {
 		h.logger.Error("Failed to check user", zap.Error(errE))
 	} else if !ok {
-		timeNow := time.Now().Format("2006-01-02 15:04:05")
+		timeNow := time.Now().Format(repository.RegDateLayout)
 		h.logger.Info("New user", zap.String("user_id", strconv.FormatInt(userId, 10)), zap.String("date", timeNow))
 		if errN := h.userRepo.InsertJust(ctx, domain.JustEntry{
 			UserId:         userId,
@@ -187,6 +277,20 @@ func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models
 		}); errN != nil {
 			h.logger.Error("Failed to insert user", zap.Error(errN))
 		}
+	} else if errT := h.userRepo.TouchJustActivity(ctx, userId); errT != nil {
+		h.logger.Warn("Failed to touch user activity", zap.Error(errT))
+	}
+
+	// album parts are handled together once the whole album has arrived
+	if update.Message.MediaGroupID != "" {
+		h.albums.Add(ctx, b, update.Message)
+		return
+	}
+
+	// /cancel and /start get the user out of whatever flow they are stuck in
+	if cmd := commandName(update.Message.Text); cmd == "/cancel" || cmd == "/start" {
+		h.resetUserState(ctx, b, userId, cmd)
+		return
 	}
 
 	userState := h.getOrCreateUserState(ctx, userId)
@@ -197,6 +301,24 @@ func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models
 		h.AdminHandler(ctx, b, update)
 	case stateBroadcast:
 		h.SendMessage(ctx, b, update)
+	case stateDeleteConfirm:
+		h.handleDeleteConfirm(ctx, b, update)
+		return
+	case stateTemplateName:
+		h.handleTemplateName(ctx, b, update, userState)
+		return
+	case stateScheduleTime:
+		h.handleScheduleTime(ctx, b, update, userState)
+		return
+	case stateCount:
+		h.handleOrderCount(ctx, b, update, userState)
+		return
+	case statePaid:
+		h.handleOrderReceipt(ctx, b, update, userState)
+		return
+	case stateContact:
+		h.handleOrderContact(ctx, b, update, userState)
+		return
 	default:
 	}
 
@@ -210,9 +332,14 @@ func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models
 
 func (h *Handler) StartWebServer(ctx context.Context, b *bot.Bot) {
 	h.SetBot(b)
+	h.checkBotToken(ctx, b)
 
 	mux := http.NewServeMux()
 
+	// Probes
+	mux.HandleFunc("/healthz", h.HealthzHandler)
+	mux.HandleFunc("/readyz", h.ReadyzHandler)
+
 	// HTML pages
 	mux.HandleFunc("/logo", func(w http.ResponseWriter, r *http.Request) {
 		path := "./static/logo.html"
@@ -225,23 +352,51 @@ func (h *Handler) StartWebServer(ctx context.Context, b *bot.Bot) {
 	mux.HandleFunc("/user-detail.html", h.UserDetailPageHandler)
 	mux.HandleFunc("/user-update.html", h.UserUpdatePageHandler)
 
-	// Static for uploads
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
+	// Avatars (served per user, nothing else under uploads/ is exposed)
+	mux.HandleFunc("/avatars/", h.AvatarHandler)
 
 	// API
 	mux.HandleFunc("/api/limit/status", h.LimitStatusHandler)
 
 	mux.HandleFunc("/api/user/check", h.CheckUserHandler)
+	mux.HandleFunc("/api/user", h.DeleteProfileAPIHandler)
 	mux.HandleFunc("/api/user/register", h.HandleRegister)
 	mux.HandleFunc("/api/user/update", h.UpdateUserHandler)
+	mux.HandleFunc("/api/user/preferences", h.PreferencesHandler)
+	mux.HandleFunc("/api/user/me", h.MeHandler)
 	mux.HandleFunc("/api/users/nearby", h.GetNearbyUsersHandler)
-	mux.HandleFunc("/api/users/", h.GetUserByIDHandler) // /api/users/{id}
+	mux.HandleFunc("/api/users/featured", h.FeaturedUsersHandler)
+	mux.HandleFunc("/api/users/", h.GetUserByIDHandler) // GET/DELETE /api/users/{id}
 
 	// Like and message
 	mux.HandleFunc("/api/user/like", h.LikeHandler)
+	mux.HandleFunc("/api/user/likes", h.ReceivedLikesHandler)
+	mux.HandleFunc("/api/user/skip", h.SkipHandler)
+	mux.HandleFunc("/api/user/report", h.ReportHandler)
 	mux.HandleFunc("/api/user/message", h.MessageHandler)
 
-	handler := h.corsMiddleware(mux)
+	// Admin dashboard
+	mux.HandleFunc("/api/admin/stats", h.AdminStatsHandler)
+
+	// these loops end with ctx; registering them lets shutdown wait until they have
+	h.goWorker("featured-refresher", func(context.Context) { h.startFeaturedRefresher(ctx) })
+	h.goWorker("channel-mirror", func(context.Context) { h.mirror.Run(ctx) })
+	h.goWorker("export-janitor", func(context.Context) { h.startExportJanitor(ctx) })
+	h.goWorker("chat-idle-sweeper", func(context.Context) { h.startChatIdleSweeper(ctx) })
+	h.goWorker("broadcast-scheduler", func(context.Context) { h.startBroadcastScheduler(ctx, b) })
+	h.goWorker("gauge-refresher", func(context.Context) { h.startGaugeRefresher(ctx) })
+
+	// the web port is public for the Mini App, so metrics there need a token
+	switch {
+	case h.cfg.MetricsAddr != "":
+		go h.startMetricsServer(ctx)
+	case h.cfg.MetricsToken != "":
+		mux.Handle("/metrics", h.metricsHandler(h.cfg.MetricsToken))
+	default:
+		h.logger.Warn("Metrics disabled: set METRICS_ADDR or METRICS_TOKEN to expose /metrics")
+	}
+
+	handler := h.requestIDMiddleware(h.accessLogMiddleware(metricsMiddleware(mux, h.recoverMiddleware(h.corsMiddleware(h.banMiddleware(mux))))))
 
 	addr := fmt.Sprintf(":%s", h.cfg.Port)
 	h.logger.Info("Web server listening", zap.String("address", addr))
@@ -254,7 +409,9 @@ func (h *Handler) StartWebServer(ctx context.Context, b *bot.Bot) {
 	go func() {
 		<-ctx.Done()
 		h.logger.Info("Shutting down web server...")
-		if err := server.Shutdown(context.Background()); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.cfg.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
 			h.logger.Error("Error shutting down server", zap.Error(err))
 		}
 	}()
@@ -288,13 +445,26 @@ func humanDur(d time.Duration) string {
 }
 
 
+// corsMiddleware echoes the request Origin only when it is in cfg.AllowedOrigins;
+// other origins get no Allow-Origin header, so browsers block the response
 func (h *Handler) corsMiddleware(next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(h.cfg.AllowedOrigins))
+	for _, o := range h.cfg.AllowedOrigins {
+		allowed[strings.TrimRight(o, "/")] = true
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		origin := r.Header.Get("Origin")
+		switch {
+		case h.cfg.CORSAllowAll:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && allowed[origin]:
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Telegram-Id")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Telegram-Id, "+initDataHeader)
 		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -312,28 +482,33 @@ func serveHTML(w http.ResponseWriter, r *http.Request, path string, logger *zap.
 }
 
 func (h *Handler) WelcomePageHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Serving welcome.html")
-	serveHTML(w, r, filepath.Join("static", "welcome.html"), h.logger)
+	logger := requestLogger(r.Context(), h.logger)
+	logger.Info("Serving welcome.html")
+	serveHTML(w, r, filepath.Join("static", "welcome.html"), logger)
 }
 
 func (h *Handler) RegisterPageHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Serving register.html")
-	serveHTML(w, r, filepath.Join("static", "register.html"), h.logger)
+	logger := requestLogger(r.Context(), h.logger)
+	logger.Info("Serving register.html")
+	serveHTML(w, r, filepath.Join("static", "register.html"), logger)
 }
 
 func (h *Handler) ListPageHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Serving list.html")
-	serveHTML(w, r, filepath.Join("static", "list.html"), h.logger)
+	logger := requestLogger(r.Context(), h.logger)
+	logger.Info("Serving list.html")
+	serveHTML(w, r, filepath.Join("static", "list.html"), logger)
 }
 
 func (h *Handler) UserDetailPageHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Serving user-detail.html")
-	serveHTML(w, r, filepath.Join("static", "user-detail.html"), h.logger)
+	logger := requestLogger(r.Context(), h.logger)
+	logger.Info("Serving user-detail.html")
+	serveHTML(w, r, filepath.Join("static", "user-detail.html"), logger)
 }
 
 func (h *Handler) UserUpdatePageHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Serving user-update.html")
-	serveHTML(w, r, filepath.Join("static", "user-update.html"), h.logger)
+	logger := requestLogger(r.Context(), h.logger)
+	logger.Info("Serving user-update.html")
+	serveHTML(w, r, filepath.Join("static", "user-update.html"), logger)
 }
 
 // ---------- API
@@ -358,23 +533,6 @@ const (
 	ctxMsgTextKey  ctxKey = "aika_msg_text"
 )
 
-// ====== Утилита: достать TG ID из контекста/заголовка
-func currentTGID(r *http.Request) (int64, error) {
-	if v := r.Context().Value("tg_id"); v != nil {
-		if id, ok := v.(int64); ok && id > 0 {
-			return id, nil
-		}
-	}
-	if h := r.Header.Get("X-Telegram-Id"); h != "" {
-		var id int64
-		_, err := fmt.Sscanf(h, "%d", &id)
-		if err == nil {
-			return id, nil
-		}
-	}
-	return 0, errors.New("unauthorized: telegram id is missing")
-}
-
 // ====== Вспомогательные билдеры текста
 func sexKZ(sex string) string {
 	switch strings.ToLower(strings.TrimSpace(sex)) {
@@ -416,46 +574,47 @@ type likeAPIResponse struct {
 
 // ======================== LIKE HANDLER (copy-paste) ========================
 func (h *Handler) LikeHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodPost {
-		h.writeJSON(w, http.StatusMethodNotAllowed, likeAPIResponse{OK: false, Message: "method not allowed"})
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req likeAPIRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ToUserID) == "" {
-		h.writeJSON(w, http.StatusBadRequest, likeAPIResponse{OK: false, Message: "invalid body"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid body")
 		return
 	}
 
-	fromTG, err := currentTGID(r)
+	fromTG, err := h.verifiedTGID(r)
 	if err != nil {
-		h.writeJSON(w, http.StatusUnauthorized, likeAPIResponse{OK: false, Message: "unauthorized"})
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
-	fromUser, err := h.userRepo.GetUserByTelegramId(fromTG)
+	fromUser, err := h.userRepo.GetUserByTelegramId(r.Context(), fromTG)
 	if err != nil || fromUser == nil {
-		h.logger.Error("like: sender not found", zap.Int64("fromTG", fromTG), zap.Error(err))
-		h.writeJSON(w, http.StatusBadRequest, likeAPIResponse{OK: false, Message: "sender not found"})
+		logger.Error("like: sender not found", zap.Int64("fromTG", fromTG), zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "sender not found")
 		return
 	}
-	toUser, err := h.userRepo.GetUserByID(req.ToUserID)
+	toUser, err := h.userRepo.GetUserByID(r.Context(), req.ToUserID)
 	if err != nil || toUser == nil {
-		h.logger.Error("like: recipient not found", zap.String("toUserID", req.ToUserID), zap.Error(err))
-		h.writeJSON(w, http.StatusBadRequest, likeAPIResponse{OK: false, Message: "recipient not found"})
+		logger.Error("like: recipient not found", zap.String("toUserID", req.ToUserID), zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient not found")
 		return
 	}
 	if toUser.TelegramId == 0 {
-		h.writeJSON(w, http.StatusBadRequest, likeAPIResponse{OK: false, Message: "recipient has no telegram"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient has no telegram")
 		return
 	}
 	if toUser.TelegramId == fromUser.TelegramId {
-		h.writeJSON(w, http.StatusBadRequest, likeAPIResponse{OK: false, Message: "cannot like yourself"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "cannot like yourself")
 		return
 	}
 	if h.bot == nil {
-		h.logger.Error("like: telegram bot is nil; cannot send")
-		h.writeJSON(w, http.StatusInternalServerError, likeAPIResponse{OK: false, Message: "bot unavailable"})
+		logger.Error("like: telegram bot is nil; cannot send")
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "bot unavailable")
 		return
 	}
 
@@ -463,28 +622,51 @@ func (h *Handler) LikeHandler(w http.ResponseWriter, r *http.Request) {
 	key := rlKey("like", fromUser.TelegramId, toUser.TelegramId)
 	allowed, left, err := h.redisClient.HitOnce(r.Context(), key, pairLimitTTL)
 	if err != nil {
-		h.writeJSON(w, http.StatusInternalServerError, likeAPIResponse{OK: false, Message: "rate limit error"})
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "rate limit error")
 		return
 	}
 	if !allowed {
-		h.writeJSON(w, http.StatusTooManyRequests, likeAPIResponse{
-			OK:      false,
-			Message: fmt.Sprintf("Сіз бұл қолданушыға соңғы 3 сағатта лайк жібердіңіз. Қайта көріңіз %s кейін.", humanDur(left)),
-		})
+		h.writeError(w, http.StatusTooManyRequests, errCodeRateLimited,
+			fmt.Sprintf("Сіз бұл қолданушыға соңғы 3 сағатта лайк жібердіңіз. Қайта көріңіз %s кейін.", humanDur(left)))
+		return
+	}
+
+	if err := h.likeRepo.InsertLike(r.Context(), fromUser.Id, toUser.Id); err != nil {
+		logger.Error("like: save failed", zap.String("from", fromUser.Id), zap.String("to", toUser.Id), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "like save failed")
+		return
+	}
+
+	mutual, err := h.likeRepo.HasLike(r.Context(), toUser.Id, fromUser.Id)
+	if err != nil {
+		logger.Error("like: reverse check failed", zap.Error(err))
+	}
+	if mutual {
+		// Notify both sides once per pair, re-likes stay silent
+		first, _, err := h.redisClient.HitOnce(r.Context(), matchKey(fromUser.TelegramId, toUser.TelegramId), 0)
+		if err != nil {
+			logger.Error("like: match dedup failed", zap.Error(err))
+		}
+		if first {
+			h.goWorker("send-match", func(ctx context.Context) { h.sendMatch(ctx, h.bot, fromUser, toUser) })
+		}
+		metrics.LikesSent.WithLabelValues("match").Inc()
+		h.writeJSON(w, http.StatusOK, likeAPIResponse{OK: true, Message: "match", Delivered: first})
 		return
 	}
 
 	// Send like (async)
-	go func(from *domain.User, to *domain.User) {
-		if ok := h.sendLike(context.Background(), h.bot, from, to); !ok {
-			h.logger.Warn("like: delivery failed",
-				zap.Int64("fromTG", from.TelegramId),
-				zap.Int64("toTG", to.TelegramId),
-				zap.String("toUserDBID", to.Id),
+	h.goWorker("send-like", func(ctx context.Context) {
+		if ok := h.sendLike(ctx, h.bot, fromUser, toUser); !ok {
+			logger.Warn("like: delivery failed",
+				zap.Int64("fromTG", fromUser.TelegramId),
+				zap.Int64("toTG", toUser.TelegramId),
+				zap.String("toUserDBID", toUser.Id),
 			)
 		}
-	}(fromUser, toUser)
+	})
 
+	metrics.LikesSent.WithLabelValues("like").Inc()
 	h.writeJSON(w, http.StatusOK, likeAPIResponse{OK: true, Message: "liked", Delivered: true})
 }
 
@@ -537,7 +719,11 @@ func (h *Handler) sendLike(ctx context.Context, b *bot.Bot, from *domain.User, t
 			if err == nil {
 				return true
 			}
-			fmt.Println(err.Error())
+			if isUnreachable(err) {
+				h.logger.Info("like: recipient blocked the bot", zap.Int64("to", to.TelegramId))
+				h.markUnreachable(ctx, to.TelegramId)
+				return false
+			}
 			h.logger.Error("like: sendPhoto failed", zap.Error(err))
 		}
 	}
@@ -552,58 +738,148 @@ func (h *Handler) sendLike(ctx context.Context, b *bot.Bot, from *domain.User, t
 		ProtectContent: true,
 	})
 	if err != nil {
+		if isUnreachable(err) {
+			h.logger.Info("like: recipient blocked the bot", zap.Int64("to", to.TelegramId))
+			h.markUnreachable(ctx, to.TelegramId)
+			return false
+		}
 		h.logger.Error("like: sendMessage failed", zap.Error(err))
 		return false
 	}
 	return true
 }
 
+// ---------- API: RECEIVED LIKES ----------
+type receivedLikeItem struct {
+	NearbyUser
+	Mutual  bool      `json:"mutual"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// ReceivedLikesHandler returns profiles that liked the authenticated user
+func (h *Handler) ReceivedLikesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+	me, err := h.userRepo.GetUserByTelegramId(r.Context(), tgID)
+	if err != nil {
+		logger.Error("likes: lookup user failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if me == nil {
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "Not found")
+		return
+	}
+
+	likes, err := h.likeRepo.GetReceivedLikes(r.Context(), me.Id)
+	if err != nil {
+		logger.Error("likes: load failed", zap.String("user_id", me.Id), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	out := make([]receivedLikeItem, 0, len(likes))
+	for _, l := range likes {
+		u := l.User
+		out = append(out, receivedLikeItem{
+			NearbyUser: newNearbyUser(&u, nil, l.Mutual),
+			Mutual:     l.Mutual,
+			LikedAt:    l.LikedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// matchKey is the same for (a,b) and (b,a)
+func matchKey(a, b int64) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("match:notified:%d:%d", a, b)
+}
+
+// sendMatch tells both users they liked each other, each with a button to start chatting
+func (h *Handler) sendMatch(ctx context.Context, b *bot.Bot, u1 *domain.User, u2 *domain.User) {
+	if b == nil || u1 == nil || u2 == nil {
+		return
+	}
+	notify := func(to, other *domain.User) {
+		kb := keyboard.NewKeyboard()
+		kb.AddRow(keyboard.NewInlineButton("💬 Сөйлесуді бастау", fmt.Sprintf("select_%d", other.TelegramId)))
+
+		ctxMsg, cancel := context.WithTimeout(ctx, 20*time.Second)
+		defer cancel()
+		_, err := b.SendMessage(ctxMsg, &bot.SendMessageParams{
+			ChatID:         to.TelegramId,
+			Text:           fmt.Sprintf("💞 It's a match!\n\nСіз бен %s бір-біріңізге лайк қойдыңыздар. Сөйлесуді бастаңыз!", sexEmoji(other.Sex)+" "+safeNickKZ(other.Nickname)),
+			ReplyMarkup:    kb.Build(),
+			ProtectContent: true,
+		})
+		if err != nil {
+			h.logger.Error("match: sendMessage failed", zap.Int64("toTG", to.TelegramId), zap.Error(err))
+		}
+	}
+	notify(u1, u2)
+	notify(u2, u1)
+}
+
 // ===================== MESSAGE HANDLER (copy-paste) ========================
 func (h *Handler) MessageHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodPost {
-		h.writeJSON(w, http.StatusMethodNotAllowed, genericAPIResponse{OK: false, Message: "method not allowed"})
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	var req messageAPIRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ToUserID) == "" {
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "invalid body"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid body")
 		return
 	}
 	req.Text = strings.TrimSpace(req.Text)
 	if req.Text == "" {
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "empty message"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "empty message")
 		return
 	}
 
-	fromTG, err := currentTGID(r)
+	fromTG, err := h.verifiedTGID(r)
 	if err != nil {
-		h.writeJSON(w, http.StatusUnauthorized, genericAPIResponse{OK: false, Message: "unauthorized"})
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
-	fromUser, err := h.userRepo.GetUserByTelegramId(fromTG)
+	fromUser, err := h.userRepo.GetUserByTelegramId(r.Context(), fromTG)
 	if err != nil || fromUser == nil {
-		h.logger.Error("sender not found", zap.Error(err))
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "sender not found"})
+		logger.Error("sender not found", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "sender not found")
 		return
 	}
-	toUser, err := h.userRepo.GetUserByID(req.ToUserID)
+	toUser, err := h.userRepo.GetUserByID(r.Context(), req.ToUserID)
 	if err != nil || toUser == nil {
-		h.logger.Error("recipient not found", zap.Error(err))
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "recipient not found"})
+		logger.Error("recipient not found", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient not found")
 		return
 	}
 	if toUser.TelegramId == 0 {
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "recipient has no telegram"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient has no telegram")
 		return
 	}
 	if toUser.TelegramId == fromUser.TelegramId {
-		h.writeJSON(w, http.StatusBadRequest, genericAPIResponse{OK: false, Message: "cannot message yourself"})
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "cannot message yourself")
 		return
 	}
 	if h.bot == nil {
-		h.logger.Error("msg: telegram bot is nil; cannot send")
-		h.writeJSON(w, http.StatusInternalServerError, genericAPIResponse{OK: false, Message: "bot unavailable"})
+		logger.Error("msg: telegram bot is nil; cannot send")
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "bot unavailable")
 		return
 	}
 
@@ -611,25 +887,23 @@ func (h *Handler) MessageHandler(w http.ResponseWriter, r *http.Request) {
 	key := rlKey("msg", fromUser.TelegramId, toUser.TelegramId)
 	allowed, left, err := h.redisClient.HitOnce(r.Context(), key, pairLimitTTL)
 	if err != nil {
-		h.writeJSON(w, http.StatusInternalServerError, genericAPIResponse{OK: false, Message: "rate limit error"})
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "rate limit error")
 		return
 	}
 	if !allowed {
-		h.writeJSON(w, http.StatusTooManyRequests, genericAPIResponse{
-			OK:      false,
-			Message: fmt.Sprintf("Сіз бұл қолданушыға соңғы 3 сағатта хабарлама жібердіңіз. Қайта көріңіз %s кейін.", humanDur(left)),
-		})
+		h.writeError(w, http.StatusTooManyRequests, errCodeRateLimited,
+			fmt.Sprintf("Сіз бұл қолданушыға соңғы 3 сағатта хабарлама жібердіңіз. Қайта көріңіз %s кейін.", humanDur(left)))
 		return
 	}
 
 	// Pass sender and text into context for sendMessage template
-	bg := context.WithValue(context.Background(), ctxMsgFromKey, fromUser)
-	bg = context.WithValue(bg, ctxMsgTextKey, req.Text)
-	ctxSend, cancel := context.WithTimeout(bg, 15*time.Second)
-	go func() {
+	h.goWorker("send-message", func(ctx context.Context) {
+		ctx = context.WithValue(ctx, ctxMsgFromKey, fromUser)
+		ctx = context.WithValue(ctx, ctxMsgTextKey, req.Text)
+		ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 		defer cancel()
-		h.sendMessage(ctxSend, h.bot, fromUser, toUser)
-	}()
+		h.sendMessage(ctx, h.bot, fromUser, toUser)
+	})
 
 	h.writeJSON(w, http.StatusOK, genericAPIResponse{OK: true, Message: "sent"})
 }
@@ -673,6 +947,11 @@ func (h *Handler) sendMessage(ctx context.Context, b *bot.Bot, from *domain.User
 				ReplyMarkup:    kb.Build(),
 				ProtectContent: true,
 			})
+			if isUnreachable(err) {
+				h.logger.Info("msg: recipient blocked the bot", zap.Int64("to", to.TelegramId))
+				h.markUnreachable(ctx, to.TelegramId)
+				return
+			}
 			if err != nil {
 				h.logger.Error("msg: sendPhoto failed", zap.Error(err))
 			} else {
@@ -688,7 +967,10 @@ func (h *Handler) sendMessage(ctx context.Context, b *bot.Bot, from *domain.User
 		Text:           out,
 		ReplyMarkup:    kb.Build(),
 		ProtectContent: true,
-	}); err != nil {
+	}); isUnreachable(err) {
+		h.logger.Info("msg: recipient blocked the bot", zap.Int64("to", to.TelegramId))
+		h.markUnreachable(ctx, to.TelegramId)
+	} else if err != nil {
 		h.logger.Error("msg: send text failed", zap.Error(err))
 	}
 }
@@ -696,25 +978,26 @@ func (h *Handler) sendMessage(ctx context.Context, b *bot.Bot, from *domain.User
 
 
 func (h *Handler) CheckUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 	var req CheckUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request", zap.Error(err))
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		logger.Error("Failed to decode request", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "Invalid request")
 		return
 	}
-	exists, err := h.userRepo.CheckUserExists(req.TelegramId)
+	exists, err := h.userRepo.CheckUserExists(r.Context(), req.TelegramId)
 	if err != nil {
-		h.logger.Error("Failed to check user", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Failed to check user", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	var userId string
 	if exists {
-		user, err := h.userRepo.GetUserByTelegramId(req.TelegramId)
+		user, err := h.userRepo.GetUserByTelegramId(r.Context(), req.TelegramId)
 		if err == nil && user != nil {
 			userId = user.Id
 		}
@@ -724,8 +1007,9 @@ func (h *Handler) CheckUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
@@ -751,53 +1035,122 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		h.writeJSON(w, http.StatusBadRequest, RegisterResponse{Success: false, Error: "Invalid telegram_id"})
 		return
 	}
-	age, err := strconv.Atoi(ageStr)
-	if err != nil || age < 18 {
-		h.writeJSON(w, http.StatusBadRequest, RegisterResponse{Success: false, Error: "Invalid age (must be 18+)"})
+	// registering again overwrites the profile, so only its owner may do it; the
+	// owner is whoever Telegram signed the initData for, not a header the client sets
+	callerID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeJSON(w, http.StatusUnauthorized, RegisterResponse{Success: false, Error: "unauthorized"})
 		return
 	}
-	latitude, err := strconv.ParseFloat(latitudeStr, 64)
-	if err != nil {
-		h.writeJSON(w, http.StatusBadRequest, RegisterResponse{Success: false, Error: "Invalid latitude"})
+	if callerID != telegramID {
+		logger.Warn("register: telegram_id does not match the caller", zap.Int64("tg_id", telegramID), zap.Int64("caller", callerID))
+		h.writeJSON(w, http.StatusForbidden, RegisterResponse{Success: false, Error: "forbidden"})
 		return
 	}
-	longitude, err := strconv.ParseFloat(longitudeStr, 64)
-	if err != nil {
-		h.writeJSON(w, http.StatusBadRequest, RegisterResponse{Success: false, Error: "Invalid longitude"})
+
+	errs := profileErrors{}
+	nickname = validateNickname(nickname, errs)
+	sex = validateSex(sex, errs)
+	age := validateAge(ageStr, errs)
+	aboutUser = validateAbout(aboutUser, errs)
+	latitude := validateLatitude(latitudeStr, errs)
+	longitude := validateLongitude(longitudeStr, errs)
+	if len(errs) > 0 {
+		h.writeJSON(w, http.StatusBadRequest, RegisterResponse{Success: false, Error: "Validation failed", Errors: errs})
 		return
 	}
 
-	avatarPath := ""
+	var avatar savedAvatar
 	if file, header, err := r.FormFile("avatar"); err == nil {
 		defer file.Close()
-		_ = os.MkdirAll("uploads/avatars", 0755)
-		avatarPath = filepath.Join("uploads/avatars", fmt.Sprintf("%d_%d_%s", telegramID, time.Now().Unix(), sanitizeFilename(header.Filename)))
-		if dst, err := os.Create(avatarPath); err == nil {
-			defer dst.Close()
-			_, _ = io.Copy(dst, file)
-		} else {
-			avatarPath = ""
+		saved, err := saveAvatar(file, telegramID, header.Filename)
+		if err != nil {
+			if errors.Is(err, errInvalidImage) {
+				h.writeJSON(w, http.StatusUnprocessableEntity, RegisterResponse{Success: false, Error: "Avatar must be a JPEG, PNG or WebP image"})
+				return
+			}
+			if errors.Is(err, errAvatarTooLarge) {
+				h.writeJSON(w, http.StatusRequestEntityTooLarge, RegisterResponse{Success: false, Error: "Avatar must be at most 8MB"})
+				return
+			}
+			if errors.Is(err, errAvatarTooBig) {
+				h.writeJSON(w, http.StatusRequestEntityTooLarge, RegisterResponse{Success: false, Error: "Avatar must be at most 40 megapixels"})
+				return
+			}
+			logger.Error("register: save avatar failed", zap.Error(err))
+			h.writeJSON(w, http.StatusInternalServerError, RegisterResponse{Success: false, Error: "Failed to save avatar"})
+			return
 		}
+		avatar = *saved
 	}
 
 	user := &domain.User{
-		TelegramId: telegramID,
-		Nickname:   nickname,
-		Sex:        sex,
-		Age:        age,
-		Latitude:   &latitude,
-		Longitude:  &longitude,
-		AboutUser:  aboutUser,
-		AvatarPath: avatarPath,
+		TelegramId:   telegramID,
+		Nickname:     nickname,
+		Sex:          sex,
+		Age:          age,
+		Latitude:     &latitude,
+		Longitude:    &longitude,
+		AboutUser:    aboutUser,
+		AvatarPath:   avatar.Path,
+		AvatarWidth:  avatar.Width,
+		AvatarHeight: avatar.Height,
+	}
+
+	// Registering again updates the existing profile, keeping its id and created_at
+	existing, err := h.userRepo.GetUserByTelegramId(r.Context(), telegramID)
+	if err != nil {
+		h.writeJSON(w, http.StatusInternalServerError, RegisterResponse{Success: false, Error: "Failed to register user"})
+		return
+	}
+	if existing != nil {
+		oldAvatar := existing.AvatarPath
+		existing.Nickname = user.Nickname
+		existing.Sex = user.Sex
+		existing.Age = user.Age
+		existing.Latitude = user.Latitude
+		existing.Longitude = user.Longitude
+		existing.AboutUser = user.AboutUser
+		if avatar.Path != "" {
+			existing.AvatarPath = avatar.Path
+			existing.AvatarWidth = avatar.Width
+			existing.AvatarHeight = avatar.Height
+		}
+		if err := h.userRepo.UpdateUser(r.Context(), existing); err != nil {
+			if avatar.Path != "" && oldAvatar != avatar.Path {
+				removeAvatarFile(avatar.Path, h.logger)
+			}
+			h.writeJSON(w, http.StatusInternalServerError, RegisterResponse{Success: false, Error: "Failed to register user"})
+			return
+		}
+		if avatar.Path != "" && oldAvatar != avatar.Path {
+			removeAvatarFile(oldAvatar, h.logger)
+		}
+		if err := h.userRepo.SetJustActive(r.Context(), telegramID, true); err != nil {
+			logger.Warn("register: activate just failed", zap.Int64("tg_id", telegramID), zap.Error(err))
+		}
+		h.writeJSON(w, http.StatusOK, RegisterResponse{Success: true, Message: "User updated successfully", UserId: existing.Id, Updated: true})
+		return
 	}
 
-	userId, err := h.userRepo.CreateUser(user)
+	userId, err := h.userRepo.CreateUser(r.Context(), user)
+	if errors.Is(err, repository.ErrUserExists) {
+		// a concurrent registration won the race
+		removeAvatarFile(avatar.Path, h.logger)
+		h.writeJSON(w, http.StatusConflict, RegisterResponse{Success: false, Error: "User already registered"})
+		return
+	}
 	if err != nil {
 		h.writeJSON(w, http.StatusInternalServerError, RegisterResponse{Success: false, Error: "Failed to register user"})
 		return
 	}
 
-	go h.sendConfirmationMessageToRegister(r.Context(), h.bot, user)
+	if err := h.userRepo.SetJustActive(r.Context(), telegramID, true); err != nil {
+		logger.Warn("register: activate just failed", zap.Int64("tg_id", telegramID), zap.Error(err))
+	}
+
+	// r.Context() ends with the response, before the confirmation is sent
+	h.goWorker("register-confirmation", func(ctx context.Context) { h.sendConfirmationMessageToRegister(ctx, h.bot, user) })
 
 	h.writeJSON(w, http.StatusOK, RegisterResponse{Success: true, Message: "User registered successfully", UserId: userId})
 }
@@ -906,14 +1259,21 @@ func (h *Handler) sendConfirmationMessageToRegister(ctx context.Context, b *bot.
 
 // ----- Update profile (multipart form)
 type UpdateResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
-	Message string `json:"message,omitempty"`
+	Success bool              `json:"success"`
+	Error   string            `json:"error,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
 }
 
 func (h *Handler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodPost && r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	callerID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeJSON(w, http.StatusUnauthorized, UpdateResponse{Success: false, Error: "unauthorized"})
 		return
 	}
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
@@ -926,7 +1286,7 @@ func (h *Handler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	var target *domain.User
 	if userID != "" {
-		u, err := h.userRepo.GetUserByID(userID)
+		u, err := h.userRepo.GetUserByID(r.Context(), userID)
 		if err != nil {
 			h.writeJSON(w, http.StatusInternalServerError, UpdateResponse{Success: false, Error: "Lookup failed"})
 			return
@@ -942,7 +1302,7 @@ func (h *Handler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 			h.writeJSON(w, http.StatusBadRequest, UpdateResponse{Success: false, Error: "Invalid telegram_id"})
 			return
 		}
-		u, err := h.userRepo.GetUserByTelegramId(tid)
+		u, err := h.userRepo.GetUserByTelegramId(r.Context(), tid)
 		if err != nil {
 			h.writeJSON(w, http.StatusInternalServerError, UpdateResponse{Success: false, Error: "Lookup failed"})
 			return
@@ -956,147 +1316,207 @@ func (h *Handler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		h.writeJSON(w, http.StatusBadRequest, UpdateResponse{Success: false, Error: "Provide user_id or telegram_id"})
 		return
 	}
+	if target.TelegramId != callerID {
+		logger.Warn("update: profile does not belong to the caller", zap.String("user_id", target.Id), zap.Int64("caller", callerID))
+		h.writeJSON(w, http.StatusForbidden, UpdateResponse{Success: false, Error: "forbidden"})
+		return
+	}
 
-	// Optional fields
-	if v := strings.TrimSpace(r.FormValue("nickname")); v != "" {
-		target.Nickname = v
+	// Optional fields; anything provided must pass the same rules as registration
+	errs := profileErrors{}
+	if v := r.FormValue("nickname"); strings.TrimSpace(v) != "" {
+		target.Nickname = validateNickname(v, errs)
 	}
-	if v := strings.TrimSpace(r.FormValue("sex")); v == "male" || v == "female" {
-		target.Sex = v
+	if v := r.FormValue("sex"); strings.TrimSpace(v) != "" {
+		target.Sex = validateSex(v, errs)
 	}
-	if v := strings.TrimSpace(r.FormValue("age")); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 18 {
-			target.Age = n
-		}
+	if v := r.FormValue("age"); strings.TrimSpace(v) != "" {
+		target.Age = validateAge(v, errs)
 	}
-	if v := strings.TrimSpace(r.FormValue("about_user")); v != "" || r.FormValue("about_user") == "" {
-		// allow empty to clear
-		target.AboutUser = v
+	// allow empty to clear
+	target.AboutUser = validateAbout(r.FormValue("about_user"), errs)
+	if v := r.FormValue("latitude"); strings.TrimSpace(v) != "" {
+		f := validateLatitude(v, errs)
+		target.Latitude = &f
 	}
-	if v := strings.TrimSpace(r.FormValue("latitude")); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			target.Latitude = &f
-		}
+	if v := r.FormValue("longitude"); strings.TrimSpace(v) != "" {
+		f := validateLongitude(v, errs)
+		target.Longitude = &f
 	}
-	if v := strings.TrimSpace(r.FormValue("longitude")); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			target.Longitude = &f
+	for field, dst := range map[string]*bool{
+		"hide_age":      &target.HideAge,
+		"hide_about":    &target.HideAbout,
+		"hide_distance": &target.HideDistance,
+	} {
+		if v := strings.TrimSpace(r.FormValue(field)); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs[field] = "must be true or false"
+				continue
+			}
+			*dst = b
 		}
 	}
+	if len(errs) > 0 {
+		h.writeJSON(w, http.StatusBadRequest, UpdateResponse{Success: false, Error: "Validation failed", Errors: errs})
+		return
+	}
 
-	// Avatar
+	// Avatar; the replaced file goes once the new one is saved in the profile
+	oldAvatar := target.AvatarPath
 	if file, header, err := r.FormFile("avatar"); err == nil {
 		defer file.Close()
-		_ = os.MkdirAll("uploads/avatars", 0755)
-		tid := target.TelegramId
-		newPath := filepath.Join("uploads/avatars", fmt.Sprintf("%d_%d_%s", tid, time.Now().Unix(), sanitizeFilename(header.Filename)))
-		if dst, err := os.Create(newPath); err == nil {
-			defer dst.Close()
-			_, _ = io.Copy(dst, file)
-			target.AvatarPath = newPath
+		saved, err := saveAvatar(file, target.TelegramId, header.Filename)
+		if err != nil {
+			if errors.Is(err, errInvalidImage) {
+				h.writeJSON(w, http.StatusUnprocessableEntity, UpdateResponse{Success: false, Error: "Avatar must be a JPEG, PNG or WebP image"})
+				return
+			}
+			if errors.Is(err, errAvatarTooLarge) {
+				h.writeJSON(w, http.StatusRequestEntityTooLarge, UpdateResponse{Success: false, Error: "Avatar must be at most 8MB"})
+				return
+			}
+			if errors.Is(err, errAvatarTooBig) {
+				h.writeJSON(w, http.StatusRequestEntityTooLarge, UpdateResponse{Success: false, Error: "Avatar must be at most 40 megapixels"})
+				return
+			}
+			logger.Error("update: save avatar failed", zap.Error(err))
+			h.writeJSON(w, http.StatusInternalServerError, UpdateResponse{Success: false, Error: "Failed to save avatar"})
+			return
 		}
+		target.AvatarPath = saved.Path
+		target.AvatarWidth = saved.Width
+		target.AvatarHeight = saved.Height
 	}
 
-	if err := h.userRepo.UpdateUser(target); err != nil {
+	if err := h.userRepo.UpdateUser(r.Context(), target); err != nil {
+		if target.AvatarPath != oldAvatar {
+			removeAvatarFile(target.AvatarPath, h.logger)
+		}
 		h.writeJSON(w, http.StatusInternalServerError, UpdateResponse{Success: false, Error: "Update failed"})
 		return
 	}
+	if target.AvatarPath != oldAvatar {
+		removeAvatarFile(oldAvatar, h.logger)
+	}
 	h.writeJSON(w, http.StatusOK, UpdateResponse{Success: true, Message: "Updated"})
 }
 
 // ----- Get by ID
 func (h *Handler) GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method == http.MethodDelete {
+		h.DeleteUserByIDHandler(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 	userID := strings.TrimPrefix(r.URL.Path, "/api/users/")
 	if userID == "" || strings.Contains(userID, "/") {
-		http.Error(w, "Not found", http.StatusNotFound)
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "Not found")
 		return
 	}
-	u, err := h.userRepo.GetUserByID(userID)
+	u, err := h.userRepo.GetUserByID(r.Context(), userID)
 	if err != nil {
-		h.logger.Error("GetUserByID failed", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("GetUserByID failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if u == nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "Not found")
 		return
 	}
 
-	var dist float64
-	if origin := r.URL.Query().Get("origin"); origin != "" && u.Latitude != nil && u.Longitude != nil {
-		pp := strings.Split(origin, ",")
-		if len(pp) == 2 {
-			if olat, err1 := strconv.ParseFloat(strings.TrimSpace(pp[0]), 64); err1 == nil {
-				if olon, err2 := strconv.ParseFloat(strings.TrimSpace(pp[1]), 64); err2 == nil {
-					dist = haversineKm(olat, olon, *u.Latitude, *u.Longitude)
-				}
-			}
+	// distance is only reported when an origin is given and the profile has coordinates;
+	// a present but malformed origin (including an empty one) is rejected
+	var dist *float64
+	if q := r.URL.Query(); q.Has("origin") {
+		olat, olon, ok := parseLatLon(q.Get("origin"))
+		if !ok {
+			h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid origin: want \"lat,lon\"")
+			return
+		}
+		if u.Latitude != nil && u.Longitude != nil {
+			d := haversineKm(olat, olon, *u.Latitude, *u.Longitude)
+			dist = &d
 		}
 	}
 
-	type response struct {
-		ID         string  `json:"id"`
-		UserID     int64   `json:"user_id"`
-		Nickname   string  `json:"nickname"`
-		Sex        string  `json:"sex"`
-		Age        int     `json:"age"`
-		Latitude   float64 `json:"latitude,omitempty"`
-		Longitude  float64 `json:"longitude,omitempty"`
-		AboutUser  string  `json:"about_user,omitempty"`
-		AvatarPath string  `json:"avatar_path,omitempty"`
-		AvatarURL  string  `json:"avatar_url,omitempty"`
-		DistanceKm float64 `json:"distance_km,omitempty"`
+	viewer := h.resolveViewer(r)
+	out := newNearbyUser(u, dist, h.seesHiddenFields(r.Context(), viewer, u))
+	if viewer.tgID != 0 && viewer.tgID == u.TelegramId {
+		out.Visibility = &profileVisibility{HideAge: u.HideAge, HideAbout: u.HideAbout, HideDistance: u.HideDistance}
 	}
+	cards := []NearbyUser{out}
+	h.applyPresence(r.Context(), cards, time.Now())
 
-	var lat, lon float64
-	if u.Latitude != nil {
-		lat = *u.Latitude
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards[0])
+}
+
+// MeHandler returns the caller's own profile in the GetUserByIDHandler shape.
+// 404 means the Telegram user has not registered yet.
+func (h *Handler) MeHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
 	}
-	if u.Longitude != nil {
-		lon = *u.Longitude
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
 	}
-
-	avatarURL := makeAvatarURL(u.AvatarPath)
-	out := response{
-		ID:         u.Id,
-		UserID:     u.TelegramId,
-		Nickname:   u.Nickname,
-		Sex:        u.Sex,
-		Age:        u.Age,
-		Latitude:   lat,
-		Longitude:  lon,
-		AboutUser:  u.AboutUser,
-		AvatarPath: u.AvatarPath,
-		AvatarURL:  avatarURL,
-		DistanceKm: dist,
+	u, err := h.userRepo.GetUserByTelegramId(r.Context(), tgID)
+	if err != nil {
+		logger.Error("me: lookup failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if u == nil {
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "not registered")
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
+	out := newNearbyUser(u, nil, true)
+	out.Visibility = &profileVisibility{HideAge: u.HideAge, HideAbout: u.HideAbout, HideDistance: u.HideDistance}
+	cards := []NearbyUser{out}
+	h.applyPresence(r.Context(), cards, time.Now())
+	h.writeJSON(w, http.StatusOK, cards[0])
 }
 
 // ----- Nearby users (+filters)
 type NearbyUser struct {
-	ID         string  `json:"id"`
-	UserID     int64   `json:"user_id"`
-	Nickname   string  `json:"nickname"`
-	Sex        string  `json:"sex"`
-	Age        int     `json:"age"`
-	Latitude   float64 `json:"latitude"`
-	Longitude  float64 `json:"longitude"`
-	AboutUser  string  `json:"about_user,omitempty"`
-	AvatarPath string  `json:"avatar_path,omitempty"`
-	AvatarURL  string  `json:"avatar_url,omitempty"`
-	DistanceKm float64 `json:"distance_km"`
+	ID             string   `json:"id"`
+	UserID         int64    `json:"user_id"`
+	Nickname       string   `json:"nickname"`
+	Sex            string   `json:"sex"`
+	Age            int      `json:"age,omitempty"`
+	Latitude       *float64 `json:"latitude,omitempty"`
+	Longitude      *float64 `json:"longitude,omitempty"`
+	AboutUser      string   `json:"about_user,omitempty"`
+	AvatarPath     string   `json:"avatar_path,omitempty"`
+	AvatarURL      string   `json:"avatar_url,omitempty"`
+	AvatarThumbURL string   `json:"avatar_thumb_url,omitempty"`
+	AvatarW        int      `json:"avatar_width,omitempty"`
+	AvatarH        int      `json:"avatar_height,omitempty"`
+	// DistanceKm is present only when DistanceAvailable is set; 0 is a real distance
+	DistanceKm        *float64 `json:"distance_km,omitempty"`
+	DistanceAvailable bool     `json:"distance_available"`
+	// Online and LastSeenSeconds come from the user's last interaction with the bot;
+	// LastSeenSeconds is absent when none is recorded
+	Online          bool   `json:"online"`
+	LastSeenSeconds *int64 `json:"last_seen_seconds,omitempty"`
+	// Visibility is only filled in for the profile owner
+	Visibility *profileVisibility `json:"visibility,omitempty"`
 }
 
 func (h *Handler) GetNearbyUsersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1104,28 +1524,48 @@ func (h *Handler) GetNearbyUsersHandler(w http.ResponseWriter, r *http.Request)
 	loc := q.Get("location")
 	var lat, lon float64
 	if loc != "" {
-		parts := strings.Split(loc, ",")
-		if len(parts) == 2 {
-			latParsed, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
-			lonParsed, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
-			if err1 == nil && err2 == nil {
-				lat, lon = latParsed, lonParsed
-			}
+		var ok bool
+		lat, lon, ok = parseLatLon(loc)
+		if !ok {
+			h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid location")
+			return
+		}
+	}
+
+	// filters missing from the query fall back to the caller's saved preferences
+	var prefs domain.UserPreferences
+	if tgID, err := h.verifiedTGID(r); err == nil {
+		if p, err := h.userRepo.GetPreferences(r.Context(), tgID); err != nil {
+			logger.Warn("nearby: load preferences failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		} else if p != nil {
+			prefs = *p
 		}
 	}
 
 	radiusKm := 50.0
-	if v, err := parseFloatParam(q, "radius_km"); err == nil && v != nil && *v > 0 && *v <= 300 {
+	if !q.Has("radius_km") && prefs.RadiusKm != nil {
+		radiusKm = *prefs.RadiusKm
+	}
+	if v, err := parseFloatParam(q, "radius_km"); err == nil && v != nil && *v > 0 && *v <= maxRadiusKm {
 		radiusKm = *v
 	}
 
 	sex := q.Get("sex")
+	if !q.Has("sex") {
+		sex = prefs.Sex
+	}
 	if sex != "" && sex != "male" && sex != "female" {
 		sex = ""
 	}
 
 	ageMinPtr, _ := parseIntParam(q, "age_min")
+	if !q.Has("age_min") {
+		ageMinPtr = prefs.AgeMin
+	}
 	ageMaxPtr, _ := parseIntParam(q, "age_max")
+	if !q.Has("age_max") {
+		ageMaxPtr = prefs.AgeMax
+	}
 
 	search := strings.TrimSpace(q.Get("q"))
 
@@ -1138,47 +1578,45 @@ func (h *Handler) GetNearbyUsersHandler(w http.ResponseWriter, r *http.Request)
 	var users []domain.User
 	var err error
 	if loc == "" {
-		users, err = h.userRepo.FindUsersByFilters(sex, ageMinPtr, ageMaxPtr, search, limit)
+		users, err = h.userRepo.FindUsersByFilters(r.Context(), sex, ageMinPtr, ageMaxPtr, search, limit)
 	} else {
 		latMin, latMax, lonMin, lonMax := bboxFromPoint(lat, lon, radiusKm)
-		users, err = h.userRepo.FindUsersInBBox(latMin, latMax, lonMin, lonMax, sex, ageMinPtr, ageMaxPtr, search, limit*3)
+		// rows come back nearest first, so a small margin over limit covers the
+		// proxy/haversine disagreements at the edge and the skip-rate reranking
+		users, err = h.userRepo.FindUsersInBBox(r.Context(), lat, lon, latMin, latMax, lonMin, lonMax, sex, ageMinPtr, ageMaxPtr, search, limit+limit/2)
 	}
 	if err != nil {
-		h.logger.Error("repo nearby failed", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("repo nearby failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
+	viewer := h.resolveViewer(r)
 	out := make([]NearbyUser, 0, len(users))
-	for _, u := range users {
+	keys := make([]float64, 0, len(users))
+	for i, u := range users {
 		var d float64
+		var dist *float64
 		if loc != "" && u.Latitude != nil && u.Longitude != nil {
 			d = haversineKm(lat, lon, *u.Latitude, *u.Longitude)
 			if d > radiusKm {
 				continue
 			}
+			dist = &d
+		}
+		out = append(out, newNearbyUser(&u, dist, h.seesHiddenFields(r.Context(), viewer, &u)))
+		// rank by distance when a location is given, otherwise keep the repository order
+		if loc != "" {
+			keys = append(keys, d+1)
+		} else {
+			keys = append(keys, float64(i+1))
 		}
-		out = append(out, NearbyUser{
-			ID:         u.Id,
-			UserID:     u.TelegramId,
-			Nickname:   u.Nickname,
-			Sex:        u.Sex,
-			Age:        u.Age,
-			Latitude:   derefOrZero(u.Latitude),
-			Longitude:  derefOrZero(u.Longitude),
-			AboutUser:  u.AboutUser,
-			AvatarPath: u.AvatarPath,
-			AvatarURL:  makeAvatarURL(u.AvatarPath),
-			DistanceKm: d,
-		})
-	}
-
-	if loc != "" {
-		sort.Slice(out, func(i, j int) bool { return out[i].DistanceKm < out[j].DistanceKm })
 	}
+	h.rankNearby(r.Context(), out, keys)
 	if len(out) > limit {
 		out = out[:limit]
 	}
+	h.applyPresence(r.Context(), out, time.Now())
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
@@ -1208,6 +1646,23 @@ func parseIntParam(q url.Values, key string) (*int, error) {
 	return &v, nil
 }
 
+// parseLatLon parses "lat,lon" and checks both values are finite and in geographic range
+func parseLatLon(s string) (lat, lon float64, ok bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
 func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
 	const R = 6371.0
 	toRad := func(d float64) float64 { return d * math.Pi / 180 }
@@ -1223,22 +1678,24 @@ func bboxFromPoint(lat, lon, radiusKm float64) (latMin, latMax, lonMin, lonMax f
 	lonDelta := radiusKm / (111.0 * math.Cos(lat*math.Pi/180))
 	return lat - latDelta, lat + latDelta, lon - lonDelta, lon + lonDelta
 }
-func derefOrZero(p *float64) float64 {
-	if p == nil {
-		return 0
+
+// makeAvatarURL returns the public avatar URL for a user, empty if they have no avatar
+func makeAvatarURL(userID, path string) string {
+	if path == "" || userID == "" {
+		return ""
 	}
-	return *p
+	return "/avatars/" + url.PathEscape(userID)
 }
 
-func makeAvatarURL(path string) string {
-	if path == "" {
+// makeAvatarThumbURL points at the thumbnail when one exists, otherwise at the full avatar
+func makeAvatarThumbURL(userID, path string) string {
+	if path == "" || userID == "" {
 		return ""
 	}
-	// store as /uploads/...
-	if strings.HasPrefix(path, "uploads/") {
-		return "/" + path
+	if _, err := os.Stat(avatarThumbPath(path)); err == nil {
+		return makeAvatarURL(userID, path) + "?size=thumb"
 	}
-	return "/uploads/" + filepath.Base(path)
+	return makeAvatarURL(userID, path)
 }
 
 func (h *Handler) writeJSON(w http.ResponseWriter, code int, v any) {
@@ -1247,6 +1704,31 @@ func (h *Handler) writeJSON(w http.ResponseWriter, code int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// API error codes sent in apiError.Error
+const (
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeBadRequest       = "bad_request"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeNotFound         = "not_found"
+	errCodeInternal         = "internal"
+	errCodeRateLimited      = "rate_limited"
+)
+
+// apiError is the JSON body of every API error response. RequestID echoes the
+// X-Request-Id header so a user can quote it when reporting a failure.
+type apiError struct {
+	OK        bool   `json:"ok"`
+	Error     string `json:"error"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError answers with status code and the apiError envelope, so clients
+// can read errors the same way whichever handler produced them
+func (h *Handler) writeError(w http.ResponseWriter, code int, errCode, msg string) {
+	h.writeJSON(w, code, apiError{OK: false, Error: errCode, Message: msg, RequestID: w.Header().Get(requestIDHeader)})
+}
+
 func sanitizeFilename(s string) string {
 	s = strings.ReplaceAll(s, "\\", "_")
 	s = strings.ReplaceAll(s, "/", "_")
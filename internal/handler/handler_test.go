@@ -0,0 +1,496 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func registerRequest(t *testing.T, telegramID, callerID string) *http.Request {
+	t.Helper()
+	return registerRequestWith(t, telegramID, callerID, nil)
+}
+
+// registerRequestWith builds a valid registration form with the given fields replaced
+func registerRequestWith(t *testing.T, telegramID, callerID string, fields map[string]string) *http.Request {
+	t.Helper()
+	form := map[string]string{
+		"telegram_id": telegramID,
+		"nickname":    "Aru",
+		"sex":         "female",
+		"age":         "22",
+		"latitude":    "43.238",
+		"longitude":   "76.889",
+		"about_user":  "hello",
+	}
+	for k, v := range fields {
+		form[k] = v
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range form {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/user/register", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if callerID != "" {
+		id, err := strconv.ParseInt(callerID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set(initDataHeader, signInitData(testBotToken, id, time.Now()))
+	}
+	return r
+}
+
+func TestHandleRegisterOnlyForTheCaller(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+
+	tests := []struct {
+		name       string
+		telegramID string
+		callerID   string
+		want       int
+	}{
+		{"no caller", "42", "", http.StatusUnauthorized},
+		{"someone else's id", "42", "43", http.StatusForbidden},
+		{"own id", "42", "42", http.StatusOK},
+		{"own id again updates", "42", "42", http.StatusOK},
+		{"overwrite an existing profile", "42", "43", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.HandleRegister(rec, registerRequest(t, tt.telegramID, tt.callerID))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	// the header is set by the client, so it proves nothing on its own
+	r := registerRequest(t, "42", "")
+	r.Header.Set("X-Telegram-Id", "42")
+	rec := httptest.NewRecorder()
+	h.HandleRegister(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("X-Telegram-Id only: status = %d, want 401", rec.Code)
+	}
+
+	u, err := h.userRepo.GetUserByTelegramId(context.Background(), 42)
+	if err != nil || u == nil {
+		t.Fatalf("user 42 not registered: %v", err)
+	}
+	if u.Nickname != "Aru" {
+		t.Errorf("nickname = %q", u.Nickname)
+	}
+}
+
+func TestHandleRegisterReportsUpdate(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	for i, wantUpdated := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		h.HandleRegister(rec, registerRequest(t, "7", "7"))
+		var resp RegisterResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Success || resp.Updated != wantUpdated {
+			t.Errorf("call %d: success=%v updated=%v, want updated=%v", i, resp.Success, resp.Updated, wantUpdated)
+		}
+	}
+}
+
+func TestParseLatLon(t *testing.T) {
+	tests := []struct {
+		in       string
+		lat, lon float64
+		ok       bool
+	}{
+		{"43.238,76.889", 43.238, 76.889, true},
+		{" 43.238 , 76.889 ", 43.238, 76.889, true},
+		{"-90,-180", -90, -180, true},
+		{"90,180", 90, 180, true},
+		{"0,0", 0, 0, true},
+		{"", 0, 0, false},
+		{"43.238", 0, 0, false},
+		{"43.238,", 0, 0, false},
+		{"a,b", 0, 0, false},
+		{"1,2,3", 0, 0, false},
+		{"NaN,10", 0, 0, false},
+		{"90.0001,0", 0, 0, false},
+		{"-90.0001,0", 0, 0, false},
+		{"0,180.5", 0, 0, false},
+		{"0,-181", 0, 0, false},
+	}
+	for _, tt := range tests {
+		lat, lon, ok := parseLatLon(tt.in)
+		if ok != tt.ok || lat != tt.lat || lon != tt.lon {
+			t.Errorf("parseLatLon(%q) = %v, %v, %v; want %v, %v, %v", tt.in, lat, lon, ok, tt.lat, tt.lon, tt.ok)
+		}
+	}
+}
+
+func TestGetUserByIDOrigin(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	lat, lon := 43.238, 76.889
+	id, err := h.userRepo.CreateUser(context.Background(), &domain.User{TelegramId: 5, Nickname: "Aru", Sex: "female", Age: 22, Latitude: &lat, Longitude: &lon})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		status   int
+		distance bool
+	}{
+		{"", http.StatusOK, false},
+		{"?origin=43.238,76.889", http.StatusOK, true},
+		{"?origin=", http.StatusBadRequest, false},
+		{"?origin=abc", http.StatusBadRequest, false},
+		{"?origin=91,0", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.GetUserByIDHandler(w, httptest.NewRequest(http.MethodGet, "/api/users/"+id+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%q: status %d, want %d: %s", tt.query, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var got NearbyUser
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if (got.DistanceKm != nil) != tt.distance {
+			t.Errorf("%q: distance %v, want present=%v", tt.query, got.DistanceKm, tt.distance)
+		} else if tt.distance && *got.DistanceKm != 0 {
+			t.Errorf("%q: distance %v, want 0", tt.query, *got.DistanceKm)
+		}
+	}
+}
+
+func TestGetNearbyUsersRejectsBadLocation(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	for _, loc := range []string{"abc", "43.2", "100,10", "10,200"} {
+		w := httptest.NewRecorder()
+		h.GetNearbyUsersHandler(w, httptest.NewRequest(http.MethodGet, "/api/users/nearby?location="+loc, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("location=%s: status %d, want 400", loc, w.Code)
+		}
+	}
+}
+
+func updateRequest(t *testing.T, fields map[string]string, callerID int64) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/user/update", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if callerID != 0 {
+		r.Header.Set(initDataHeader, signInitData(testBotToken, callerID, time.Now()))
+	}
+	return r
+}
+
+func TestUpdateUserOnlyForTheOwner(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: 42, Nickname: "Aru", Sex: "female", Age: 22})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+		caller int64
+		want   int
+	}{
+		{"unsigned", map[string]string{"user_id": id, "nickname": "Hacked"}, 0, http.StatusUnauthorized},
+		{"someone else by user_id", map[string]string{"user_id": id, "nickname": "Hacked"}, 43, http.StatusForbidden},
+		{"someone else by telegram_id", map[string]string{"telegram_id": "42", "nickname": "Hacked"}, 43, http.StatusForbidden},
+		{"owner", map[string]string{"user_id": id, "nickname": "Aruzhan"}, 42, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.UpdateUserHandler(rec, updateRequest(t, tt.fields, tt.caller))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	u, err := h.userRepo.GetUserByID(ctx, id)
+	if err != nil || u == nil || u.Nickname != "Aruzhan" {
+		t.Fatalf("profile = %+v, %v; want only the owner's update applied", u, err)
+	}
+}
+
+func TestCORSAllowsInitDataHeader(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.cfg.AllowedOrigins = []string{"https://app.example"}
+	r := httptest.NewRequest(http.MethodOptions, "/api/user/register", nil)
+	r.Header.Set("Origin", "https://app.example")
+	rec := httptest.NewRecorder()
+	h.corsMiddleware(http.NotFoundHandler()).ServeHTTP(rec, r)
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, initDataHeader) {
+		t.Fatalf("Access-Control-Allow-Headers = %q, want it to allow %s", got, initDataHeader)
+	}
+}
+
+func TestCORSAllowlist(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	h.cfg.AllowedOrigins = []string{"https://app.example/"}
+	reached := false
+	handler := h.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+
+	tests := []struct {
+		name, method, origin string
+		wantACAO             string
+		wantCode             int
+		wantNext             bool
+	}{
+		{"allowed origin", http.MethodGet, "https://app.example", "https://app.example", http.StatusOK, true},
+		{"disallowed origin", http.MethodGet, "https://evil.example", "", http.StatusOK, true},
+		{"no origin", http.MethodGet, "", "", http.StatusOK, true},
+		{"preflight", http.MethodOptions, "https://app.example", "https://app.example", http.StatusNoContent, false},
+		{"disallowed preflight", http.MethodOptions, "https://evil.example", "", http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		reached = false
+		r := httptest.NewRequest(tt.method, "/api/user/me", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantACAO {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.wantACAO)
+		}
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantCode)
+		}
+		if reached != tt.wantNext {
+			t.Errorf("%s: reached the handler = %v, want %v", tt.name, reached, tt.wantNext)
+		}
+	}
+
+	// dev mode allows any origin
+	h.cfg.CORSAllowAll = true
+	r := httptest.NewRequest(http.MethodGet, "/api/user/me", nil)
+	r.Header.Set("Origin", "http://localhost:5173")
+	rec := httptest.NewRecorder()
+	h.corsMiddleware(http.NotFoundHandler()).ServeHTTP(rec, r)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("CORSAllowAll: Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func likeRequest(fromTG int64, toID string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/like", strings.NewReader(`{"to_user_id":"`+toID+`"}`))
+	return signAs(r, fromTG)
+}
+
+func TestLikeBackSendsMatch(t *testing.T) {
+	h, _, fake, _ := newTestHandler(t)
+	ctx := context.Background()
+	ids := map[int64]string{}
+	for _, tg := range []int64{42, 43} {
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "u" + strconv.FormatInt(tg, 10), Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[tg] = id
+	}
+	like := func(from, to int64) likeAPIResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.LikeHandler(rec, likeRequest(from, ids[to]))
+		var resp likeAPIResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("like %d→%d: status %d, %s", from, to, rec.Code, rec.Body)
+		}
+		return resp
+	}
+
+	// A→B is a plain like, delivered to B only
+	if resp := like(42, 43); resp.Message != "liked" {
+		t.Fatalf("A→B = %+v, want liked", resp)
+	}
+	calls := waitForCalls(t, fake, "sendMessage", 1)
+	if len(calls) != 1 || calls[0].Params["chat_id"] != "43" || !strings.Contains(calls[0].Params["text"], "лайк қойды") {
+		t.Fatalf("after A→B: %s", formatCalls(calls))
+	}
+
+	// B→A makes it mutual, and both get the match message instead of a like
+	if resp := like(43, 42); resp.Message != "match" || !resp.Delivered {
+		t.Fatalf("B→A = %+v, want a delivered match", resp)
+	}
+	calls = waitForCalls(t, fake, "sendMessage", 2)
+	got := map[string]bool{}
+	for _, c := range calls {
+		if strings.Contains(c.Params["text"], "match") {
+			got[c.Params["chat_id"]] = true
+		}
+	}
+	if len(calls) != 2 || !got["42"] || !got["43"] {
+		t.Fatalf("after B→A: %s", formatCalls(calls))
+	}
+}
+
+func TestAPIErrorEnvelope(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	ids := map[int64]string{}
+	for _, tg := range []int64{42, 43} {
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "u", Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[tg] = id
+	}
+	// the pair limits are spent, so the next like and message get a 429
+	if _, _, err := h.redisClient.HitOnce(ctx, rlKey("like", 42, 43), pairLimitTTL); err != nil {
+		t.Fatal(err)
+	}
+	h.redisClient.HitOnce(ctx, rlKey("msg", 42, 43), pairLimitTTL)
+
+	request := func(method, path, body string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+	signed := func(tg int64) map[string]string {
+		return map[string]string{initDataHeader: signInitData(testBotToken, tg, time.Now())}
+	}
+	as42 := signed(42)
+	// a bare ID header names a user but proves nothing
+	spoofed42 := map[string]string{"X-Telegram-Id": "42"}
+	to43 := `{"to_user_id":"` + ids[43] + `","text":"hi"}`
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		r       *http.Request
+		code    int
+		errCode string
+	}{
+		{"like: GET", h.LikeHandler, request(http.MethodGet, "/api/user/like", "", as42), http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{"like: bad body", h.LikeHandler, request(http.MethodPost, "/api/user/like", "{", as42), http.StatusBadRequest, errCodeBadRequest},
+		{"like: anonymous", h.LikeHandler, request(http.MethodPost, "/api/user/like", to43, nil), http.StatusUnauthorized, errCodeUnauthorized},
+		{"like: unsigned", h.LikeHandler, request(http.MethodPost, "/api/user/like", to43, spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"like: unknown recipient", h.LikeHandler, request(http.MethodPost, "/api/user/like", `{"to_user_id":"nope"}`, as42), http.StatusBadRequest, errCodeBadRequest},
+		{"like: yourself", h.LikeHandler, request(http.MethodPost, "/api/user/like", `{"to_user_id":"`+ids[42]+`"}`, as42), http.StatusBadRequest, errCodeBadRequest},
+		{"like: rate limited", h.LikeHandler, request(http.MethodPost, "/api/user/like", to43, as42), http.StatusTooManyRequests, errCodeRateLimited},
+		{"message: GET", h.MessageHandler, request(http.MethodGet, "/api/user/message", "", as42), http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{"message: empty text", h.MessageHandler, request(http.MethodPost, "/api/user/message", `{"to_user_id":"`+ids[43]+`","text":" "}`, as42), http.StatusBadRequest, errCodeBadRequest},
+		{"message: anonymous", h.MessageHandler, request(http.MethodPost, "/api/user/message", to43, nil), http.StatusUnauthorized, errCodeUnauthorized},
+		{"message: unsigned", h.MessageHandler, request(http.MethodPost, "/api/user/message", to43, spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"message: rate limited", h.MessageHandler, request(http.MethodPost, "/api/user/message", to43, as42), http.StatusTooManyRequests, errCodeRateLimited},
+		{"skip: unknown recipient", h.SkipHandler, request(http.MethodPost, "/api/user/skip", `{"to_user_id":"nope"}`, as42), http.StatusBadRequest, errCodeBadRequest},
+		{"skip: unsigned", h.SkipHandler, request(http.MethodPost, "/api/user/skip", to43, spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"report: unsigned", h.ReportHandler, request(http.MethodPost, "/api/user/report", `{"to_user_id":"`+ids[43]+`","reason":"spam"}`, spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"received likes: unsigned", h.ReceivedLikesHandler, request(http.MethodGet, "/api/user/likes", "", spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"limit status: unsigned", h.LimitStatusHandler, request(http.MethodGet, "/api/limit/status?to_user_id="+ids[43], "", spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"delete profile: GET", h.DeleteProfileAPIHandler, request(http.MethodGet, "/api/user", "", signed(42)), http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{"delete profile: unsigned", h.DeleteProfileAPIHandler, request(http.MethodDelete, "/api/user", "", spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+		{"delete profile: no profile", h.DeleteProfileAPIHandler, request(http.MethodDelete, "/api/user", "", signed(99)), http.StatusNotFound, errCodeNotFound},
+		{"delete user: someone else", h.DeleteUserByIDHandler, request(http.MethodDelete, "/api/users/"+ids[43], "", signed(42)), http.StatusForbidden, errCodeForbidden},
+		{"delete user: unknown id", h.DeleteUserByIDHandler, request(http.MethodDelete, "/api/users/nope", "", signed(42)), http.StatusNotFound, errCodeNotFound},
+		{"delete user: unsigned", h.DeleteUserByIDHandler, request(http.MethodDelete, "/api/users/"+ids[42], "", spoofed42), http.StatusUnauthorized, errCodeUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.requestIDMiddleware(tt.handler).ServeHTTP(rec, tt.r)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.code, rec.Body)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type %q", tt.name, ct)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: body %q is not JSON: %v", tt.name, rec.Body, err)
+			continue
+		}
+		want := map[string]any{"ok": false, "error": tt.errCode, "message": body["message"], "request_id": rec.Header().Get(requestIDHeader)}
+		if msg, _ := body["message"].(string); msg == "" || fmt.Sprint(body) != fmt.Sprint(want) {
+			t.Errorf("%s: body %v, want the envelope %v", tt.name, body, want)
+		}
+	}
+}
+
+func TestMeHandler(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	lat, lon := 43.238, 76.889
+	id, err := h.userRepo.CreateUser(context.Background(), &domain.User{
+		TelegramId: 42, Nickname: "Aru", Sex: "female", Age: 22, AboutUser: "hello",
+		Latitude: &lat, Longitude: &lon, HideAge: true, HideDistance: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := func(tgID int64) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+		if tgID != 0 {
+			signAs(r, tgID)
+		}
+		rec := httptest.NewRecorder()
+		h.MeHandler(rec, r)
+		return rec
+	}
+
+	rec := me(42)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("registered: status %d: %s", rec.Code, rec.Body)
+	}
+	var got NearbyUser
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	// the owner sees the fields hidden from others, and the settings that hide them
+	if got.ID != id || got.UserID != 42 || got.Age != 22 || got.AboutUser != "hello" || got.Latitude == nil || *got.Latitude != lat {
+		t.Errorf("registered: profile %+v", got)
+	}
+	if got.Visibility == nil || *got.Visibility != (profileVisibility{HideAge: true, HideDistance: true}) {
+		t.Errorf("registered: visibility %+v", got.Visibility)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		tgID    int64
+		code    int
+		errCode string
+	}{
+		{"unregistered", 43, http.StatusNotFound, errCodeNotFound},
+		{"anonymous", 0, http.StatusUnauthorized, errCodeUnauthorized},
+	} {
+		rec := me(tt.tgID)
+		var body apiError
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != tt.code || body.OK || body.Error != tt.errCode {
+			t.Errorf("%s: %d %+v, want %d %s", tt.name, rec.Code, body, tt.code, tt.errCode)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// readyTimeout bounds each dependency ping in /healthz and /readyz
+const readyTimeout = 2 * time.Second
+
+// SetStartedAt records when the process started; /healthz reports uptime from it
+func (h *Handler) SetStartedAt(t time.Time) { h.startedAt = t }
+
+// errBotNotChecked is the bot check result until checkBotToken has run
+var errBotNotChecked = errors.New("getMe not checked yet")
+
+// checkBotToken calls getMe once and caches the result for /readyz, so probes
+// never spend Telegram API calls
+func (h *Handler) checkBotToken(ctx context.Context, b *bot.Bot) {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	me, err := b.GetMe(ctx)
+	if err == nil && me == nil {
+		err = errors.New("getMe returned no bot")
+	}
+	h.botCheck.Store(&err)
+	if err != nil {
+		h.logger.Error("Bot token check failed", zap.Error(err))
+		return
+	}
+	h.logger.Info("Bot token verified", zap.String("username", me.Username))
+}
+
+// botCheckErr is the cached getMe result
+func (h *Handler) botCheckErr() error {
+	if p := h.botCheck.Load(); p != nil {
+		return *p
+	}
+	return errBotNotChecked
+}
+
+// healthResponse is the /healthz body; each component is "ok" or its error
+type healthResponse struct {
+	DB            string `json:"db"`
+	Redis         string `json:"redis"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// pingDependency runs ping with readyTimeout and returns "ok" or the error text
+func (h *Handler) pingDependency(ctx context.Context, name string, ping func(context.Context) error) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		h.logger.Warn("health: dependency down", zap.String("dependency", name), zap.Error(err))
+		return err.Error(), false
+	}
+	return "ok", true
+}
+
+// pingSQLite runs SELECT 1, which exercises a pooled connection end to end
+func (h *Handler) pingSQLite(ctx context.Context) error {
+	var one int
+	return h.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+type readyResponse struct {
+	OK     bool              `json:"ok"`
+	Failed map[string]string `json:"failed,omitempty"`
+	// Degraded lists dependencies that are down but worked around, like Redis while
+	// the chat state is served from memory
+	Degraded map[string]string `json:"degraded,omitempty"`
+}
+
+// stateDegraded reports whether the chat state has fallen back from Redis to memory
+func (h *Handler) stateDegraded() bool {
+	d, ok := h.redisClient.(interface{ Degraded() bool })
+	return ok && d.Degraded()
+}
+
+// HealthzHandler pings SQLite and Redis and reports the process uptime;
+// it answers 503 when either is down, naming it in its field
+func (h *Handler) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	dbStatus, dbOK := h.pingDependency(r.Context(), "sqlite", h.pingSQLite)
+	redisStatus, redisOK := h.pingDependency(r.Context(), "redis", h.redisClient.Ping)
+	resp := healthResponse{DB: dbStatus, Redis: redisStatus}
+	if !h.startedAt.IsZero() {
+		resp.UptimeSeconds = int64(time.Since(h.startedAt).Seconds())
+	}
+
+	code := http.StatusOK
+	if !dbOK || !redisOK {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, code, resp)
+}
+
+// ReadyzHandler pings SQLite and Redis, checks the cached getMe result and
+// answers 503 naming whichever failed. A Redis outage the chat state has fallen
+// back from is reported under degraded and keeps the instance ready.
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	checks := map[string]func(context.Context) error{
+		"sqlite": h.pingSQLite,
+		"redis":  h.redisClient.Ping,
+		"bot":    func(context.Context) error { return h.botCheckErr() },
+	}
+	resp := readyResponse{OK: true}
+	for name, ping := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		err := ping(ctx)
+		cancel()
+		if err != nil && name == "redis" && h.stateDegraded() {
+			if resp.Degraded == nil {
+				resp.Degraded = make(map[string]string)
+			}
+			resp.Degraded[name] = err.Error()
+			logger.Warn("readyz: dependency down, running degraded", zap.String("dependency", name), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			if resp.Failed == nil {
+				resp.Failed = make(map[string]string)
+			}
+			resp.OK = false
+			resp.Failed[name] = err.Error()
+			logger.Warn("readyz: dependency down", zap.String("dependency", name), zap.Error(err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
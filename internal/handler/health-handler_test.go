@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newHealthHandler returns a handler on SQLite and a miniredis-backed chat state,
+// with the bot token check passed
+func newHealthHandler(t *testing.T) (*Handler, *miniredis.Miniredis) {
+	t.Helper()
+	h, _, _, _ := newTestHandler(t)
+	mr := useMiniredis(t, h)
+	var ok error
+	h.botCheck.Store(&ok)
+	return h, mr
+}
+
+func probe(t *testing.T, handler http.HandlerFunc, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s body %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestHealthProbes(t *testing.T) {
+	tests := []struct {
+		name   string
+		outage func(h *Handler, mr *miniredis.Miniredis)
+		// failed is the /healthz field and /readyz failure that must name the outage
+		failed string
+	}{
+		{name: "all up"},
+		{name: "db closed", outage: func(h *Handler, _ *miniredis.Miniredis) { h.db.Close() }, failed: "sqlite"},
+		{name: "redis stopped", outage: func(_ *Handler, mr *miniredis.Miniredis) { mr.Close() }, failed: "redis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mr := newHealthHandler(t)
+			if tt.outage != nil {
+				tt.outage(h, mr)
+			}
+			want := http.StatusOK
+			if tt.failed != "" {
+				want = http.StatusServiceUnavailable
+			}
+
+			code, body := probe(t, h.HealthzHandler, "/healthz")
+			if code != want {
+				t.Errorf("/healthz = %d, want %d: %v", code, want, body)
+			}
+			for _, dep := range []struct{ name, field string }{{"sqlite", "db"}, {"redis", "redis"}} {
+				if up, wantUp := body[dep.field] == "ok", dep.name != tt.failed; up != wantUp {
+					t.Errorf("/healthz %s = %v", dep.field, body[dep.field])
+				}
+			}
+
+			code, body = probe(t, h.ReadyzHandler, "/readyz")
+			if code != want {
+				t.Errorf("/readyz = %d, want %d: %v", code, want, body)
+			}
+			failed, _ := body["failed"].(map[string]interface{})
+			if _, ok := failed[tt.failed]; tt.failed != "" && !ok {
+				t.Errorf("/readyz failed = %v, want %s in it", failed, tt.failed)
+			}
+			if tt.failed == "" && len(failed) != 0 {
+				t.Errorf("/readyz failed = %v, want none", failed)
+			}
+		})
+	}
+}
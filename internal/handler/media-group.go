@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"aika/internal/keyboard"
+	"aika/internal/metrics"
+	"aika/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// mediaGroupWindow is how long an album waits for its next part; Telegram
+	// delivers the parts of one album within a few hundred milliseconds
+	mediaGroupWindow = time.Second
+	// mediaGroupMaxWait caps the wait from the first part, for albums whose
+	// remaining parts never arrive
+	mediaGroupMaxWait = 5 * time.Second
+	// mediaGroupTTL drops the buffered parts of an album nobody flushed, e.g.
+	// after the instance that buffered it went down
+	mediaGroupTTL = 2 * mediaGroupMaxWait
+	// mediaGroupMaxItems is Telegram's album size limit
+	mediaGroupMaxItems = 10
+)
+
+// mediaGroupBuffer collects the messages of one album, which arrive as separate
+// updates sharing MediaGroupID, and hands them to flush together, in message order.
+// A group is flushed mediaGroupWindow after its latest part, at mediaGroupMaxWait
+// after its first one, or as soon as it is full.
+//
+// The parts themselves are kept in the state store, so an album whose parts reach
+// different instances is still relayed in one piece: only the timers are local, and
+// TakeMediaGroup hands the parts to whichever instance flushes first.
+type mediaGroupBuffer struct {
+	store           repository.StateStore
+	logger          *zap.Logger
+	window, maxWait time.Duration
+	flush           func(ctx context.Context, b *bot.Bot, msgs []*models.Message)
+
+	mu     sync.Mutex
+	groups map[string]*pendingMediaGroup
+}
+
+type pendingMediaGroup struct {
+	ctx   context.Context
+	b     *bot.Bot
+	first time.Time
+	timer *time.Timer
+}
+
+func newMediaGroupBuffer(store repository.StateStore, logger *zap.Logger, window, maxWait time.Duration, flush func(ctx context.Context, b *bot.Bot, msgs []*models.Message)) *mediaGroupBuffer {
+	return &mediaGroupBuffer{store: store, logger: logger, window: window, maxWait: maxWait, flush: flush, groups: make(map[string]*pendingMediaGroup)}
+}
+
+// Add buffers one album part
+func (m *mediaGroupBuffer) Add(ctx context.Context, b *bot.Bot, msg *models.Message) {
+	// group ids are only unique per chat
+	key := fmt.Sprintf("%d:%s", msg.Chat.ID, msg.MediaGroupID)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		m.logger.Error("Failed to marshal album part", zap.Error(err))
+		return
+	}
+	n, err := m.store.AddMediaGroupPart(ctx, key, data, mediaGroupTTL)
+	if err != nil {
+		// relay the part alone rather than lose it
+		m.logger.Error("Failed to buffer album part", zap.Int64("user_id", msg.From.ID), zap.Error(err))
+		m.flush(ctx, b, []*models.Message{msg})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.groups[key]
+	if !ok {
+		g = &pendingMediaGroup{ctx: ctx, b: b, first: time.Now()}
+		m.groups[key] = g
+		g.timer = time.AfterFunc(m.window, func() { m.flushKey(key) })
+	}
+
+	switch {
+	case n >= mediaGroupMaxItems:
+		g.timer.Stop()
+		go m.flushKey(key)
+	default:
+		wait := min(m.window, m.maxWait-time.Since(g.first))
+		g.timer.Reset(max(wait, 0))
+	}
+}
+
+func (m *mediaGroupBuffer) flushKey(key string) {
+	m.mu.Lock()
+	g, ok := m.groups[key]
+	delete(m.groups, key)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	parts, err := m.store.TakeMediaGroup(g.ctx, key)
+	if err != nil {
+		m.logger.Error("Failed to take album parts", zap.String("group", key), zap.Error(err))
+		return
+	}
+	msgs := make([]*models.Message, 0, len(parts))
+	for _, p := range parts {
+		var msg models.Message
+		if err := json.Unmarshal(p, &msg); err != nil {
+			m.logger.Warn("Skipping unreadable album part", zap.String("group", key), zap.Error(err))
+			continue
+		}
+		msgs = append(msgs, &msg)
+	}
+	// empty when another instance has flushed the album already
+	if len(msgs) == 0 {
+		return
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+	m.flush(g.ctx, g.b, msgs)
+}
+
+// handleAlbum routes a complete album: an admin composing a broadcast sends it
+// out, anyone else relays it to their chat partner
+func (h *Handler) handleAlbum(ctx context.Context, b *bot.Bot, msgs []*models.Message) {
+	userID := msgs[0].From.ID
+	state := h.getOrCreateUserState(ctx, userID)
+	if state.State == stateBroadcast && h.IsAdmin(userID) {
+		h.broadcastAlbum(ctx, b, userID, state, msgs)
+		return
+	}
+	h.relayAlbum(ctx, b, msgs)
+}
+
+// albumMedia turns an album part into its broadcast item; ok is false for
+// message types Telegram does not group
+func albumMedia(msg *models.Message) (domain.BroadcastMediaItem, bool) {
+	switch {
+	case msg.Photo != nil:
+		return domain.BroadcastMediaItem{Type: "photo", FileID: msg.Photo[len(msg.Photo)-1].FileID, Caption: msg.Caption}, true
+	case msg.Video != nil:
+		return domain.BroadcastMediaItem{Type: "video", FileID: msg.Video.FileID, Caption: msg.Caption}, true
+	case msg.Document != nil:
+		return domain.BroadcastMediaItem{Type: "document", FileID: msg.Document.FileID, Caption: msg.Caption}, true
+	case msg.Audio != nil:
+		return domain.BroadcastMediaItem{Type: "audio", FileID: msg.Audio.FileID, Caption: msg.Caption}, true
+	default:
+		return domain.BroadcastMediaItem{}, false
+	}
+}
+
+// parseAlbum is parseMessage for an album: a "media_group" payload with one item per part
+func parseAlbum(msgs []*models.Message) domain.BroadcastPayload {
+	p := domain.BroadcastPayload{Type: "media_group"}
+	for _, msg := range msgs {
+		if item, ok := albumMedia(msg); ok {
+			p.Items = append(p.Items, item)
+		}
+	}
+	if len(p.Items) == 0 {
+		return domain.BroadcastPayload{}
+	}
+	return p
+}
+
+// inputMedia builds the SendMediaGroup list of items
+func inputMedia(items []domain.BroadcastMediaItem) []models.InputMedia {
+	media := make([]models.InputMedia, 0, len(items))
+	for _, it := range items {
+		switch it.Type {
+		case "photo":
+			media = append(media, &models.InputMediaPhoto{Media: it.FileID, Caption: it.Caption})
+		case "video":
+			media = append(media, &models.InputMediaVideo{Media: it.FileID, Caption: it.Caption})
+		case "document":
+			media = append(media, &models.InputMediaDocument{Media: it.FileID, Caption: it.Caption})
+		case "audio":
+			media = append(media, &models.InputMediaAudio{Media: it.FileID, Caption: it.Caption})
+		}
+	}
+	return media
+}
+
+// broadcastAlbum is SendMessage for an album an admin sent while composing a broadcast
+func (h *Handler) broadcastAlbum(ctx context.Context, b *bot.Bot, adminId int64, state *domain.UserState, msgs []*models.Message) {
+	payload := parseAlbum(msgs)
+	if payload.Type == "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "⚠️ Альбомда жіберуге болатын фото, видео, файл не аудио жоқ."})
+		return
+	}
+	h.previewBroadcast(ctx, b, adminId, state, payload)
+}
+
+// relayAlbum sends an album to the sender's chat partner in one piece and mirrors it to the channel.
+// Albums can't carry an inline keyboard, so the exit / next buttons follow in a short message,
+// and the sender gets a single delete button for the whole album instead of one per part.
+func (h *Handler) relayAlbum(ctx context.Context, b *bot.Bot, msgs []*models.Message) {
+	userID := msgs[0].From.ID
+	partnerID, err := h.chatPartner(ctx, b, userID)
+	if err != nil {
+		h.logger.Error("error get user partner", zap.Error(err))
+	}
+	if partnerID == 0 {
+		// same reply as a single message without a partner
+		h.HandleChat(ctx, b, &models.Update{Message: msgs[0]})
+		return
+	}
+
+	nickname, err := h.userRepo.GetUserNickname(ctx, userID)
+	if err != nil && nickname == "" {
+		nickname = msgs[0].From.Username
+	}
+	items := parseAlbum(msgs).Items
+	if len(items) == 0 {
+		return
+	}
+	// the first caption is the one Telegram shows under the album
+	items[0].Caption = relayCaption(nickname, items[0].Caption, "альбом")
+
+	sent, err := b.SendMediaGroup(ctx, &bot.SendMediaGroupParams{ChatID: partnerID, Media: inputMedia(items), ProtectContent: true})
+	if err != nil {
+		if isUnreachable(err) {
+			h.handleBlocked(ctx, b, userID, partnerID)
+		}
+		h.logger.Error("Ошибка отправки альбома собеседнику", zap.Int("items", len(items)), zap.Error(err))
+		return
+	}
+	metrics.MessagesRelayed.WithLabelValues("media_group").Inc()
+	h.touchChat(ctx, userID, partnerID)
+
+	relayed := &domain.RelayedMessage{SenderID: userID, PartnerID: partnerID}
+	for _, m := range sent {
+		relayed.PartnerMsgIDs = append(relayed.PartnerMsgIDs, m.ID)
+	}
+	for _, m := range msgs {
+		relayed.SenderMsgIDs = append(relayed.SenderMsgIDs, m.ID)
+	}
+
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(keyboard.NewInlineButton("🔕 Шығу", "exit"), keyboard.NewInlineButton("⏭ Келесі", nextPartnerData))
+	note, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      partnerID,
+		Text:        fmt.Sprintf("📎 %s: альбом (%d)", nickname, len(items)),
+		ReplyMarkup: kb.Build(),
+	})
+	if err == nil {
+		relayed.PartnerMsgIDs = append(relayed.PartnerMsgIDs, note.ID)
+	}
+	h.sendAlbumDeleteButton(ctx, b, msgs[0].Chat.ID, len(items), relayed)
+
+	items[0].Caption = fmt.Sprintf("Сообщение от %s: к %d:\n%s", nickname, partnerID, items[0].Caption)
+	if _, err := b.SendMediaGroup(ctx, &bot.SendMediaGroupParams{ChatID: h.cfg.ChannelName, Media: inputMedia(items), ProtectContent: true}); err != nil {
+		h.logger.Warn("Ошибка пересылки альбома", zap.Error(err))
+	}
+}
+
+// sendAlbumDeleteButton gives the sender one button that deletes the whole album
+// on both sides; the album itself can't carry a keyboard
+func (h *Handler) sendAlbumDeleteButton(ctx context.Context, b *bot.Bot, chatID int64, items int, relayed *domain.RelayedMessage) {
+	token, err := newRelayToken()
+	if err != nil {
+		h.logger.Error("Failed to generate album token", zap.Error(err))
+		return
+	}
+
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(keyboard.NewInlineButton("⛔️ Альбомды жою!", relayDeletePrefix+token))
+	kb.AddRow(keyboard.NewInlineButton("🔕 Чатты аяқтау", "exit"), keyboard.NewInlineButton("⏭ Келесі", nextPartnerData))
+	control, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        fmt.Sprintf("📎 Альбом жіберілді (%d). Өшіргіңіз келсе, төмендегі батырманы басыңыз.", items),
+		ReplyMarkup: kb.Build(),
+	})
+	if err != nil {
+		h.logger.Warn("Failed to send album delete button", zap.Int64("user_id", relayed.SenderID), zap.Error(err))
+		return
+	}
+	relayed.SenderMsgIDs = append(relayed.SenderMsgIDs, control.ID)
+
+	if err := h.redisClient.SaveRelayedMessage(ctx, token, relayed, relayTokenTTL); err != nil {
+		h.logger.Error("Failed to save relayed album", zap.Int64("user_id", relayed.SenderID), zap.Error(err))
+	}
+}
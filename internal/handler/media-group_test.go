@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"aika/internal/repository"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// albumPart is one part of the album "g" sent by relaySender
+func albumPart(id int, video bool) *models.Message {
+	m := &models.Message{
+		ID:           id,
+		From:         &models.User{ID: relaySender, Username: "aru_tg"},
+		Chat:         models.Chat{ID: relaySender},
+		MediaGroupID: "g",
+	}
+	if video {
+		m.Video = &models.Video{FileID: "video"}
+	} else {
+		m.Photo = []models.PhotoSize{{FileID: "photo"}}
+	}
+	return m
+}
+
+// waitForCalls returns the calls of method once there are want of them
+func waitForCalls(t *testing.T, f *fakeTelegram, method string, want int) []apiCall {
+	t.Helper()
+	var got []apiCall
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, c := range f.Calls() {
+			if c.Method == method {
+				got = append(got, c)
+			}
+		}
+		if len(got) >= want {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%d %s calls, want %d", len(got), method, want)
+	return nil
+}
+
+func TestAlbumAcrossInstances(t *testing.T) {
+	h, fake, _ := newRelayHandler(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := repository.NewRedisClient(client)
+
+	// two bot instances sharing Redis, each receiving some parts of the album
+	first := newMediaGroupBuffer(store, zap.NewNop(), 50*time.Millisecond, time.Second, h.handleAlbum)
+	second := newMediaGroupBuffer(store, zap.NewNop(), 50*time.Millisecond, time.Second, h.handleAlbum)
+	first.Add(ctx, h.bot, albumPart(1, false))
+	second.Add(ctx, h.bot, albumPart(2, true))
+	first.Add(ctx, h.bot, albumPart(3, false))
+
+	// one album to the partner and one to the channel
+	calls := waitForCalls(t, fake, "sendMediaGroup", 2)
+	time.Sleep(200 * time.Millisecond)
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMediaGroup" {
+			calls = append(calls, c)
+		}
+	}
+	if len(calls) != 2 {
+		t.Fatalf("%d sendMediaGroup calls, want 2: %v", len(calls), formatCalls(calls))
+	}
+	media := calls[0].Params["media"]
+	if calls[0].Params["chat_id"] != "20" || strings.Count(media, `"type":"photo"`) != 2 || strings.Count(media, `"type":"video"`) != 1 {
+		t.Fatalf("partner album = %s", formatCalls(calls[:1]))
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("keys left in Redis: %v", keys)
+	}
+}
+
+func TestAlbumStoreFailureRelaysPart(t *testing.T) {
+	h, fake, _ := newRelayHandler(t)
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	mr.Close()
+
+	buf := newMediaGroupBuffer(repository.NewRedisClient(client), zap.NewNop(), 50*time.Millisecond, time.Second, h.handleAlbum)
+	buf.Add(ctx, h.bot, albumPart(1, false))
+
+	calls := waitForCalls(t, fake, "sendMediaGroup", 1)
+	if calls[0].Params["chat_id"] != "20" || strings.Count(calls[0].Params["media"], `"type":"photo"`) != 1 {
+		t.Fatalf("partner album = %s", formatCalls(calls[:1]))
+	}
+}
+
+// collectAlbums returns a buffer on an in-memory store and the albums it flushes
+func collectAlbums(window, maxWait time.Duration) (*mediaGroupBuffer, chan []*models.Message) {
+	flushed := make(chan []*models.Message, 16)
+	buf := newMediaGroupBuffer(repository.NewMemoryStore(), zap.NewNop(), window, maxWait, func(_ context.Context, _ *bot.Bot, msgs []*models.Message) {
+		flushed <- msgs
+	})
+	return buf, flushed
+}
+
+func groupPart(chatID int64, group string, id int) *models.Message {
+	return &models.Message{
+		ID:           id,
+		From:         &models.User{ID: chatID},
+		Chat:         models.Chat{ID: chatID},
+		MediaGroupID: group,
+		Photo:        []models.PhotoSize{{FileID: fmt.Sprint("photo", id)}},
+	}
+}
+
+func albumIDs(msgs []*models.Message) []int {
+	ids := make([]int, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func nextAlbum(t *testing.T, flushed chan []*models.Message) []int {
+	t.Helper()
+	select {
+	case msgs := <-flushed:
+		return albumIDs(msgs)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no album flushed")
+		return nil
+	}
+}
+
+func TestMediaGroupBufferGroups(t *testing.T) {
+	buf, flushed := collectAlbums(50*time.Millisecond, time.Second)
+	ctx := context.Background()
+
+	// two albums interleaved, one of them reusing the other's group id in another chat
+	buf.Add(ctx, nil, groupPart(1, "g", 3))
+	buf.Add(ctx, nil, groupPart(2, "g", 10))
+	buf.Add(ctx, nil, groupPart(1, "g", 1))
+	buf.Add(ctx, nil, groupPart(2, "g", 11))
+	buf.Add(ctx, nil, groupPart(1, "g", 2))
+
+	got := map[int][]int{}
+	for range 2 {
+		ids := nextAlbum(t, flushed)
+		got[ids[0]] = ids
+	}
+	if !slices.Equal(got[1], []int{1, 2, 3}) || !slices.Equal(got[10], []int{10, 11}) {
+		t.Fatalf("albums = %v, want [1 2 3] in message order and [10 11]", got)
+	}
+
+	// a full album goes out without waiting for the window
+	full, fullFlushed := collectAlbums(time.Hour, time.Hour)
+	for id := 1; id <= mediaGroupMaxItems; id++ {
+		full.Add(ctx, nil, groupPart(1, "full", id))
+	}
+	if ids := nextAlbum(t, fullFlushed); len(ids) != mediaGroupMaxItems {
+		t.Fatalf("full album has %d parts, want %d", len(ids), mediaGroupMaxItems)
+	}
+}
+
+func TestMediaGroupBufferTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	// a lone part is flushed once the window passes without a second one
+	buf, flushed := collectAlbums(30*time.Millisecond, time.Second)
+	start := time.Now()
+	buf.Add(ctx, nil, groupPart(1, "lone", 1))
+	if ids := nextAlbum(t, flushed); !slices.Equal(ids, []int{1}) {
+		t.Fatalf("album = %v, want [1]", ids)
+	}
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Fatalf("flushed after %v, before the window", waited)
+	}
+
+	// parts that keep trickling in can't hold the album past maxWait
+	buf, flushed = collectAlbums(50*time.Millisecond, 150*time.Millisecond)
+	stop := time.After(400 * time.Millisecond)
+	done := make(chan struct{})
+	t.Cleanup(func() { <-done })
+	go func() {
+		defer close(done)
+		for id := 1; ; id++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			buf.Add(ctx, nil, groupPart(1, "slow", id))
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	start = time.Now()
+	ids := nextAlbum(t, flushed)
+	if waited := time.Since(start); waited > 300*time.Millisecond {
+		t.Fatalf("first flush after %v, want it at maxWait", waited)
+	}
+	if len(ids) < 2 || ids[0] != 1 {
+		t.Fatalf("first album = %v, want the parts received before maxWait", ids)
+	}
+}
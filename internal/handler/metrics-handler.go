@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"aika/internal/metrics"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// metricsMiddleware records the duration of every request under its mux route,
+// so /api/users/{id} lookups share one series instead of one per id
+func metricsMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// BotMetricsMiddleware counts every Telegram update by type before it is handled
+func BotMetricsMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		metrics.Updates.WithLabelValues(updateType(update)).Inc()
+		next(ctx, b, update)
+	}
+}
+
+func updateType(update *models.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	default:
+		return "other"
+	}
+}
+
+// gaugeRefreshInterval is how often the user and chat gauges are recounted
+const gaugeRefreshInterval = time.Minute
+
+// startGaugeRefresher keeps the gauges that come from counting the database and
+// Redis up to date; counting on every scrape would put that load on the scraper's
+// schedule instead of ours
+func (h *Handler) startGaugeRefresher(ctx context.Context) {
+	ticker := time.NewTicker(gaugeRefreshInterval)
+	defer ticker.Stop()
+	for {
+		h.refreshGauges(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) refreshGauges(ctx context.Context) {
+	if n, err := h.redisClient.CountActiveChats(ctx); err != nil {
+		h.logger.Warn("metrics: failed to count active chats", zap.Error(err))
+	} else {
+		metrics.ActiveChats.Set(float64(n))
+	}
+	if total, active, err := h.userRepo.CountJustUsers(ctx); err != nil {
+		h.logger.Warn("metrics: failed to count bot users", zap.Error(err))
+	} else {
+		metrics.BotUsers.WithLabelValues("total").Set(float64(total))
+		metrics.BotUsers.WithLabelValues("active").Set(float64(active))
+	}
+	if n, err := h.userRepo.CountProfiles(ctx); err != nil {
+		h.logger.Warn("metrics: failed to count profiles", zap.Error(err))
+	} else {
+		metrics.RegisteredUsers.Set(float64(n))
+	}
+}
+
+// metricsHandler serves /metrics, requiring "Authorization: Bearer <token>" when token is set
+func (h *Handler) metricsHandler(token string) http.Handler {
+	promHandler := metrics.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+			return
+		}
+		promHandler.ServeHTTP(w, r)
+	})
+}
+
+// startMetricsServer serves /metrics on cfg.MetricsAddr until ctx is cancelled
+func (h *Handler) startMetricsServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", h.metricsHandler(h.cfg.MetricsToken))
+	server := &http.Server{Addr: h.cfg.MetricsAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	h.logger.Info("Metrics server listening", zap.String("address", h.cfg.MetricsAddr))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		h.logger.Error("Metrics server error", zap.Error(err))
+	}
+}
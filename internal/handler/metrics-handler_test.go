@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics GETs /metrics from srv and returns every sample by its series,
+// e.g. `aika_bot_users{status="total"}`
+func scrapeMetrics(t *testing.T, srv *httptest.Server) map[string]float64 {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics: status %d", resp.StatusCode)
+	}
+	samples := make(map[string]float64)
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("/metrics line %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestMetricsScrape(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user/like", h.LikeHandler)
+	mux.Handle("/metrics", h.metricsHandler(""))
+	srv := httptest.NewServer(metricsMiddleware(mux, mux))
+	defer srv.Close()
+
+	ids := map[int64]string{}
+	for _, tg := range []int64{42, 43, 44} {
+		if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: tg, UserName: "u"}); err != nil {
+			t.Fatal(err)
+		}
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "u" + strconv.FormatInt(tg, 10), Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[tg] = id
+	}
+	for _, tg := range []int64{45, 46} {
+		if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: tg, UserName: "u"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.userRepo.SetJustActive(ctx, 46, false)
+	h.redisClient.TouchChat(ctx, 42, 43, time.Now())
+	h.redisClient.TouchChat(ctx, 44, 45, time.Now())
+
+	// counters are process-wide, so they are compared with a scrape taken before the request
+	const (
+		likes    = `aika_likes_sent_total{result="like"}`
+		requests = `aika_http_request_duration_seconds_count{code="200",method="POST",route="/api/user/like"}`
+	)
+	before := scrapeMetrics(t, srv)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/like", strings.NewReader(`{"to_user_id":"`+ids[43]+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signAs(req, 42)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("like: status %d", resp.StatusCode)
+	}
+	h.refreshGauges(ctx)
+
+	after := scrapeMetrics(t, srv)
+	for _, series := range []string{likes, requests} {
+		if d := after[series] - before[series]; d != 1 {
+			t.Errorf("%s went up by %v, want 1", series, d)
+		}
+	}
+	for series, want := range map[string]float64{
+		`aika_chat_active_pairs`:          2,
+		`aika_bot_users{status="total"}`:  5,
+		`aika_bot_users{status="active"}`: 4,
+		`aika_registered_users`:           3,
+	} {
+		if got, ok := after[series]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", series, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// telegramTextLimit is the max length of a single Telegram text message
+const telegramTextLimit = 4096
+
+// channelMirror collects textual mirror entries for the channel and sends them
+// as combined messages, either every interval or once maxEntries are queued.
+// With batching disabled every entry is sent right away.
+type channelMirror struct {
+	mu         sync.Mutex
+	entries    []string
+	batching   bool
+	interval   time.Duration
+	maxEntries int
+	send       func(ctx context.Context, text string) error
+	logger     *zap.Logger
+}
+
+func newChannelMirror(batching bool, interval time.Duration, maxEntries int, send func(ctx context.Context, text string) error, logger *zap.Logger) *channelMirror {
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+	return &channelMirror{
+		batching:   batching,
+		interval:   interval,
+		maxEntries: maxEntries,
+		send:       send,
+		logger:     logger,
+	}
+}
+
+// Add queues a text entry (or sends it immediately when batching is off)
+func (m *channelMirror) Add(ctx context.Context, text string) {
+	if !m.batching {
+		if err := m.send(ctx, text); err != nil {
+			m.logger.Warn("mirror: send failed", zap.Error(err))
+		}
+		return
+	}
+
+	m.mu.Lock()
+	m.entries = append(m.entries, text)
+	full := len(m.entries) >= m.maxEntries
+	m.mu.Unlock()
+
+	if full {
+		m.Flush(ctx)
+	}
+}
+
+// Flush sends everything queued so far
+func (m *channelMirror) Flush(ctx context.Context) {
+	m.mu.Lock()
+	entries := m.entries
+	m.entries = nil
+	m.mu.Unlock()
+
+	for _, msg := range combineMirrorEntries(entries, telegramTextLimit) {
+		if err := m.send(ctx, msg); err != nil {
+			m.logger.Warn("mirror: flush failed", zap.Error(err))
+		}
+	}
+}
+
+// Run flushes periodically until ctx is done
+func (m *channelMirror) Run(ctx context.Context) {
+	if !m.batching || m.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Flush(ctx)
+		}
+	}
+}
+
+// combineMirrorEntries joins entries into as few messages as fit in limit runes.
+// An entry that is longer than limit on its own is sent as is.
+func combineMirrorEntries(entries []string, limit int) []string {
+	const sep = "\n\n"
+	var out []string
+	var cur strings.Builder
+	curLen := 0
+	for _, e := range entries {
+		n := utf8.RuneCountInString(e)
+		if curLen > 0 && curLen+len(sep)+n > limit {
+			out = append(out, cur.String())
+			cur.Reset()
+			curLen = 0
+		}
+		if curLen > 0 {
+			cur.WriteString(sep)
+			curLen += len(sep)
+		}
+		cur.WriteString(e)
+		curLen += n
+	}
+	if curLen > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+// mirrorText sends a textual channel mirror entry through the batcher
+func (h *Handler) mirrorText(ctx context.Context, text string) {
+	h.mirror.Add(ctx, text)
+}
+
+// sendMirror delivers one (possibly combined) mirror message to the channel
+func (h *Handler) sendMirror(ctx context.Context, text string) error {
+	if h.bot == nil {
+		return nil
+	}
+	_, err := h.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:         h.cfg.ChannelName,
+		Text:           text,
+		ProtectContent: true,
+	})
+	return err
+}
+
+// Close flushes pending channel mirror entries; call it once the bot has stopped
+func (h *Handler) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	h.mirror.Flush(ctx)
+}
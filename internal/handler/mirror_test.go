@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestChannelMirrorBatches(t *testing.T) {
+	ctx := context.Background()
+	var sent []string
+	send := func(_ context.Context, text string) error {
+		sent = append(sent, text)
+		return nil
+	}
+	entries := make([]string, 7)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("Сообщение от Aru: к 20:\nmsg %d", i)
+	}
+
+	// unbatched, every entry is its own send
+	direct := newChannelMirror(false, 0, 3, send, zap.NewNop())
+	for _, e := range entries {
+		direct.Add(ctx, e)
+	}
+	if len(sent) != len(entries) {
+		t.Fatalf("unbatched: %d sends, want %d", len(sent), len(entries))
+	}
+
+	// batched, a full batch goes out at once and Flush sends the rest
+	sent = nil
+	batched := newChannelMirror(true, 0, 3, send, zap.NewNop())
+	for _, e := range entries {
+		batched.Add(ctx, e)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("batched: %d sends before Flush, want 2 full batches", len(sent))
+	}
+	batched.Flush(ctx)
+	if len(sent) != 3 {
+		t.Fatalf("batched: %d sends after Flush, want 3", len(sent))
+	}
+	if got := strings.Split(strings.Join(sent, "\n\n"), "\n\n"); !slices.Equal(got, entries) {
+		t.Fatalf("combined sends lost or reordered entries:\n%q", sent)
+	}
+}
+
+func TestCombineMirrorEntriesLimit(t *testing.T) {
+	long := strings.Repeat("ж", 12)
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{"fits in one", []string{"a", "b", "c"}, []string{"a\n\nb\n\nc"}},
+		{"split at the limit", []string{"aaaa", "bbbb", "cccc"}, []string{"aaaa\n\nbbbb", "cccc"}},
+		{"limit counts runes", []string{"жжжж", "жжжж"}, []string{"жжжж\n\nжжжж"}},
+		{"oversized entry alone", []string{"a", long, "b"}, []string{"a", long, "b"}},
+		{"nothing queued", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := combineMirrorEntries(tt.entries, 10); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
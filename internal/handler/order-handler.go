@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const orderCancelText = "❌ Бас тарту"
+
+// orderCancelKeyboard is shown at every step of the /order flow
+var orderCancelKeyboard = &models.ReplyKeyboardMarkup{
+	Keyboard:       [][]models.KeyboardButton{{{Text: orderCancelText}}},
+	ResizeKeyboard: true,
+}
+
+// OrderCommand handles /order: it starts the purchase flow, which goes through
+// stateCount, statePaid and stateContact before the order is stored
+func (h *Handler) OrderCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+	userID := update.Message.From.ID
+	if h.cfg.OrderPrice <= 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "Қазір тапсырыс қабылданбайды."})
+		return
+	}
+
+	if err := h.redisClient.SaveUserState(ctx, userID, &domain.UserState{State: stateCount}); err != nil {
+		h.logger.Error("Failed to save order state", zap.Int64("user_id", userID), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Қате: қайта көріңіз"})
+		return
+	}
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      userID,
+		Text:        fmt.Sprintf("🛒 Қанша дана аласыз? 1-ден %d-ға дейін сан жазыңыз.\n\nБағасы: %d ₸", h.cfg.OrderMaxCount, h.cfg.OrderPrice),
+		ReplyMarkup: orderCancelKeyboard,
+	})
+	if err != nil {
+		h.logger.Error("Failed to send order prompt", zap.Error(err))
+	}
+}
+
+// cancelOrder leaves the /order flow at any step
+func (h *Handler) cancelOrder(ctx context.Context, b *bot.Bot, userID int64) {
+	if err := h.redisClient.DeleteUserState(ctx, userID); err != nil {
+		h.logger.Error("Failed to delete order state", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      userID,
+		Text:        "Тапсырыс тоқтатылды.",
+		ReplyMarkup: &models.ReplyKeyboardRemove{RemoveKeyboard: true},
+	})
+}
+
+// saveOrderState persists the next step of the flow; on failure the user is told to
+// retry and false is returned
+func (h *Handler) saveOrderState(ctx context.Context, b *bot.Bot, userID int64, state *domain.UserState) bool {
+	if err := h.redisClient.SaveUserState(ctx, userID, state); err != nil {
+		h.logger.Error("Failed to save order state", zap.Int64("user_id", userID), zap.String("state", state.State), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Қате: қайта көріңіз"})
+		return false
+	}
+	return true
+}
+
+// handleOrderCount takes the number of items and asks for payment
+func (h *Handler) handleOrderCount(ctx context.Context, b *bot.Bot, update *models.Update, state *domain.UserState) {
+	userID := update.Message.From.ID
+	text := strings.TrimSpace(update.Message.Text)
+	if text == orderCancelText {
+		h.cancelOrder(ctx, b, userID)
+		return
+	}
+	count, err := strconv.Atoi(text)
+	if err != nil || count < 1 || count > h.cfg.OrderMaxCount {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: fmt.Sprintf("⚠️ 1-ден %d-ға дейін сан жазыңыз:", h.cfg.OrderMaxCount)})
+		return
+	}
+
+	state.Count = count
+	state.State = statePaid
+	if !h.saveOrderState(ctx, b, userID, state) {
+		return
+	}
+	text = fmt.Sprintf("💳 Төлейтін сома: %d ₸ (%d × %d ₸)", count*h.cfg.OrderPrice, count, h.cfg.OrderPrice)
+	if h.cfg.OrderPaymentInfo != "" {
+		text += "\n\n" + h.cfg.OrderPaymentInfo
+	}
+	text += "\n\nТөлегеннен кейін чекті фото немесе файл ретінде жіберіңіз."
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: text, ReplyMarkup: orderCancelKeyboard})
+}
+
+// handleOrderReceipt takes the payment receipt and asks for a contact
+func (h *Handler) handleOrderReceipt(ctx context.Context, b *bot.Bot, update *models.Update, state *domain.UserState) {
+	msg := update.Message
+	userID := msg.From.ID
+	if strings.TrimSpace(msg.Text) == orderCancelText {
+		h.cancelOrder(ctx, b, userID)
+		return
+	}
+	switch {
+	case len(msg.Photo) > 0:
+		state.ReceiptType = "photo"
+		state.ReceiptFileID = msg.Photo[len(msg.Photo)-1].FileID
+	case msg.Document != nil:
+		state.ReceiptType = "document"
+		state.ReceiptFileID = msg.Document.FileID
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "⚠️ Төлем чегін фото немесе файл ретінде жіберіңіз:"})
+		return
+	}
+
+	state.IsPaid = true
+	state.State = stateContact
+	if !h.saveOrderState(ctx, b, userID, state) {
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: userID,
+		Text:   "📞 Сізбен байланысу үшін телефон нөміріңізді жіберіңіз:",
+		ReplyMarkup: &models.ReplyKeyboardMarkup{
+			Keyboard: [][]models.KeyboardButton{
+				{{Text: "📱 Нөмірді жіберу", RequestContact: true}},
+				{{Text: orderCancelText}},
+			},
+			ResizeKeyboard: true,
+		},
+	})
+}
+
+// handleOrderContact takes the contact, stores the order and passes the receipt on
+// to the admins for checking
+func (h *Handler) handleOrderContact(ctx context.Context, b *bot.Bot, update *models.Update, state *domain.UserState) {
+	msg := update.Message
+	userID := msg.From.ID
+	text := strings.TrimSpace(msg.Text)
+	if text == orderCancelText {
+		h.cancelOrder(ctx, b, userID)
+		return
+	}
+
+	var contact string
+	switch {
+	// a shared contact must be the user's own, not someone from their address book
+	case msg.Contact != nil && msg.Contact.UserID == userID:
+		contact = msg.Contact.PhoneNumber
+	case msg.Contact == nil && isPhoneNumber(text):
+		contact = text
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "⚠️ «📱 Нөмірді жіберу» батырмасын басыңыз немесе нөміріңізді жазыңыз:"})
+		return
+	}
+	state.Contact = contact
+	if state.Count < 1 || !state.IsPaid || state.ReceiptFileID == "" {
+		// the state was written by something other than this flow
+		h.logger.Warn("Incomplete order state", zap.Int64("user_id", userID), zap.Any("state", state))
+		h.cancelOrder(ctx, b, userID)
+		return
+	}
+
+	order := &domain.Order{
+		UserID:        userID,
+		Count:         state.Count,
+		Amount:        state.Count * h.cfg.OrderPrice,
+		Contact:       contact,
+		ReceiptType:   state.ReceiptType,
+		ReceiptFileID: state.ReceiptFileID,
+	}
+	if err := h.orderRepo.CreateOrder(ctx, order); err != nil {
+		h.logger.Error("Failed to create order", zap.Int64("user_id", userID), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Тапсырысты сақтау мүмкін болмады, қайта жіберіп көріңіз."})
+		return
+	}
+	if err := h.redisClient.DeleteUserState(ctx, userID); err != nil {
+		h.logger.Error("Failed to delete order state", zap.Int64("user_id", userID), zap.Error(err))
+	}
+	h.logger.Info("Order created", zap.Int64("order", order.ID), zap.Int64("user_id", userID), zap.Int("count", order.Count), zap.Int("amount", order.Amount))
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      userID,
+		Text:        fmt.Sprintf("✅ Тапсырыс #%d қабылданды. Төлем тексерілгеннен кейін сізбен байланысамыз.", order.ID),
+		ReplyMarkup: &models.ReplyKeyboardRemove{RemoveKeyboard: true},
+	})
+	h.notifyAdminsOfOrder(ctx, b, order, msg.From.Username)
+}
+
+// notifyAdminsOfOrder sends every admin the receipt with the order details
+func (h *Handler) notifyAdminsOfOrder(ctx context.Context, b *bot.Bot, o *domain.Order, username string) {
+	caption := fmt.Sprintf("🛒 Жаңа тапсырыс #%d\n👤 %d", o.ID, o.UserID)
+	if username != "" {
+		caption += " @" + username
+	}
+	caption += fmt.Sprintf("\n📦 %d дана\n💳 %d ₸\n📞 %s", o.Count, o.Amount, o.Contact)
+
+	payload := domain.BroadcastPayload{Type: o.ReceiptType, FileID: o.ReceiptFileID, Caption: caption, Unprotected: true}
+	for _, adminID := range h.cfg.AdminIDs {
+		if err := h.sendToUser(ctx, b, adminID, payload); err != nil {
+			h.logger.Warn("Failed to notify admin of order", zap.Int64("order", o.ID), zap.Int64("admin", adminID), zap.Error(err))
+		}
+	}
+}
+
+// isPhoneNumber accepts a typed phone number: digits with an optional leading +
+// and the usual separators
+func isPhoneNumber(s string) bool {
+	digits := 0
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 10 && digits <= 15
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const orderUser = 42
+
+func orderMessage(m *models.Message) *models.Update {
+	m.From = &models.User{ID: orderUser, Username: "buyer"}
+	m.Chat = models.Chat{ID: orderUser}
+	return &models.Update{Message: m}
+}
+
+func orderText(text string) *models.Update {
+	return orderMessage(&models.Message{Text: text})
+}
+
+// orderState returns the saved state of the buyer, nil when there is none
+func orderState(t *testing.T, h *Handler) *domain.UserState {
+	t.Helper()
+	s, err := h.redisClient.GetUserState(context.Background(), orderUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func countOrders(t *testing.T, h *Handler) int {
+	t.Helper()
+	var n int
+	if err := h.db.QueryRow(`SELECT COUNT(1) FROM orders`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOrderFlowTransitions(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	ctx := context.Background()
+
+	h.OrderCommand(ctx, b, orderText("/order"))
+	if s := orderState(t, h); s == nil || s.State != stateCount {
+		t.Fatalf("after /order: %+v, want %s", s, stateCount)
+	}
+
+	for _, bad := range []string{"abc", "0", "6"} {
+		h.DefaultHandler(ctx, b, orderText(bad))
+		if s := orderState(t, h); s.State != stateCount || s.Count != 0 {
+			t.Fatalf("count %q: %+v, want to stay in %s", bad, s, stateCount)
+		}
+	}
+	h.DefaultHandler(ctx, b, orderText("3"))
+	if s := orderState(t, h); s.State != statePaid || s.Count != 3 {
+		t.Fatalf("after count: %+v, want %s with 3", s, statePaid)
+	}
+
+	h.DefaultHandler(ctx, b, orderText("paid, trust me"))
+	if s := orderState(t, h); s.State != statePaid || s.IsPaid {
+		t.Fatalf("text instead of a receipt: %+v, want to stay in %s", s, statePaid)
+	}
+	h.DefaultHandler(ctx, b, orderMessage(&models.Message{Photo: []models.PhotoSize{{FileID: "small"}, {FileID: "receipt"}}}))
+	if s := orderState(t, h); s.State != stateContact || !s.IsPaid || s.ReceiptType != "photo" || s.ReceiptFileID != "receipt" {
+		t.Fatalf("after receipt: %+v, want %s with the largest photo", s, stateContact)
+	}
+
+	h.DefaultHandler(ctx, b, orderMessage(&models.Message{Contact: &models.Contact{UserID: 7, PhoneNumber: "+77000000000"}}))
+	if s := orderState(t, h); s.State != stateContact || countOrders(t, h) != 0 {
+		t.Fatalf("someone else's contact: %+v, want to stay in %s", s, stateContact)
+	}
+	fake.Calls()
+	h.DefaultHandler(ctx, b, orderText("+7 (701) 234-56-78"))
+	if s := orderState(t, h); s != nil {
+		t.Fatalf("after contact: %+v, want the state cleared", s)
+	}
+
+	var count, amount int
+	var contact, receipt string
+	err := h.db.QueryRow(`SELECT count, amount, contact, receipt_file_id FROM orders WHERE user_id = ?`, orderUser).Scan(&count, &amount, &contact, &receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || amount != 3*h.cfg.OrderPrice || contact != "+7 (701) 234-56-78" || receipt != "receipt" {
+		t.Fatalf("order = %d × %d ₸ %q %q", count, amount, contact, receipt)
+	}
+	var adminReceipt bool
+	for _, c := range fake.Calls() {
+		if c.Method == "sendPhoto" && c.Params["chat_id"] == "1000" && c.Params["photo"] == "receipt" {
+			adminReceipt = true
+		}
+	}
+	if !adminReceipt {
+		t.Fatal("the admin did not get the receipt")
+	}
+}
+
+func TestOrderFlowCancel(t *testing.T) {
+	for _, state := range []string{stateCount, statePaid, stateContact} {
+		t.Run(state, func(t *testing.T) {
+			h, _, _, b := newTestHandler(t)
+			ctx := context.Background()
+			h.redisClient.SaveUserState(ctx, orderUser, &domain.UserState{State: state, Count: 1})
+
+			h.DefaultHandler(ctx, b, orderText(orderCancelText))
+			if s := orderState(t, h); s != nil {
+				t.Fatalf("state after cancel: %+v", s)
+			}
+		})
+	}
+}
+
+// TestOrderContactNeedsReceipt covers a contact state the flow itself did not write
+func TestOrderContactNeedsReceipt(t *testing.T) {
+	h, _, _, b := newTestHandler(t)
+	ctx := context.Background()
+	h.redisClient.SaveUserState(ctx, orderUser, &domain.UserState{State: stateContact, Count: 2})
+
+	h.DefaultHandler(ctx, b, orderText("+77012345678"))
+	if s := orderState(t, h); s != nil {
+		t.Fatalf("state = %+v, want the order cancelled", s)
+	}
+	if n := countOrders(t, h); n != 0 {
+		t.Fatalf("%d orders stored without a receipt", n)
+	}
+}
+
+func TestIsPhoneNumber(t *testing.T) {
+	for s, want := range map[string]bool{
+		"+77012345678":       true,
+		"8 701 234 56 78":    true,
+		"+7 (701) 234-56-78": true,
+		"123456789":          false,
+		"+1234567890123456":  false,
+		"7701+2345678":       false,
+		"call me":            false,
+	} {
+		if got := isPhoneNumber(s); got != want {
+			t.Errorf("isPhoneNumber(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// preferencesBody is the JSON shape of saved nearby filters; omitted fields are unset
+type preferencesBody struct {
+	Sex      string   `json:"sex"`
+	AgeMin   *int     `json:"age_min,omitempty"`
+	AgeMax   *int     `json:"age_max,omitempty"`
+	RadiusKm *float64 `json:"radius_km,omitempty"`
+}
+
+type preferencesResponse struct {
+	OK          bool             `json:"ok"`
+	Message     string           `json:"message,omitempty"`
+	Errors      profileErrors    `json:"errors,omitempty"`
+	Preferences *preferencesBody `json:"preferences,omitempty"`
+}
+
+// PreferencesHandler serves /api/user/preferences: GET returns the caller's saved
+// nearby filters, POST replaces them. GetNearbyUsersHandler falls back to them.
+func (h *Handler) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeJSON(w, http.StatusUnauthorized, preferencesResponse{OK: false, Message: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := h.userRepo.GetPreferences(r.Context(), tgID)
+		if err != nil {
+			logger.Error("preferences: load failed", zap.Int64("tg_id", tgID), zap.Error(err))
+			h.writeJSON(w, http.StatusInternalServerError, preferencesResponse{OK: false, Message: "load failed"})
+			return
+		}
+		body := &preferencesBody{}
+		if p != nil {
+			body = &preferencesBody{Sex: p.Sex, AgeMin: p.AgeMin, AgeMax: p.AgeMax, RadiusKm: p.RadiusKm}
+		}
+		h.writeJSON(w, http.StatusOK, preferencesResponse{OK: true, Preferences: body})
+
+	case http.MethodPost:
+		var req preferencesBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeJSON(w, http.StatusBadRequest, preferencesResponse{OK: false, Message: "invalid body"})
+			return
+		}
+		req.Sex = strings.ToLower(strings.TrimSpace(req.Sex))
+		if errs := validatePreferences(req); len(errs) > 0 {
+			h.writeJSON(w, http.StatusBadRequest, preferencesResponse{OK: false, Message: "validation failed", Errors: errs})
+			return
+		}
+		p := domain.UserPreferences{UserID: tgID, Sex: req.Sex, AgeMin: req.AgeMin, AgeMax: req.AgeMax, RadiusKm: req.RadiusKm}
+		if err := h.userRepo.SavePreferences(r.Context(), p); err != nil {
+			logger.Error("preferences: save failed", zap.Int64("tg_id", tgID), zap.Error(err))
+			h.writeJSON(w, http.StatusInternalServerError, preferencesResponse{OK: false, Message: "save failed"})
+			return
+		}
+		h.writeJSON(w, http.StatusOK, preferencesResponse{OK: true, Preferences: &req})
+
+	default:
+		h.writeJSON(w, http.StatusMethodNotAllowed, preferencesResponse{OK: false, Message: "method not allowed"})
+	}
+}
+
+func validatePreferences(p preferencesBody) profileErrors {
+	errs := profileErrors{}
+	if p.Sex != "" && p.Sex != "male" && p.Sex != "female" {
+		errs["sex"] = `must be "male", "female" or empty`
+	}
+	if p.AgeMin != nil && (*p.AgeMin < minAge || *p.AgeMin > maxAge) {
+		errs["age_min"] = "must be a number between 18 and 99"
+	}
+	if p.AgeMax != nil && (*p.AgeMax < minAge || *p.AgeMax > maxAge) {
+		errs["age_max"] = "must be a number between 18 and 99"
+	}
+	if p.AgeMin != nil && p.AgeMax != nil && *p.AgeMin > *p.AgeMax {
+		errs["age_max"] = "must not be less than age_min"
+	}
+	if p.RadiusKm != nil && (*p.RadiusKm <= 0 || *p.RadiusKm > maxRadiusKm) {
+		errs["radius_km"] = "must be greater than 0 and at most 300"
+	}
+	return errs
+}
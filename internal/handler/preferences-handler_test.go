@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func preferencesRequest(h *Handler, tgID int64, method, body string) (int, preferencesResponse) {
+	r := httptest.NewRequest(method, "/api/user/preferences", strings.NewReader(body))
+	if tgID != 0 {
+		signAs(r, tgID)
+	}
+	rec := httptest.NewRecorder()
+	h.PreferencesHandler(rec, r)
+	var resp preferencesResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp
+}
+
+func TestPreferencesSave(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+
+	// nothing saved yet: every filter is unset
+	code, resp := preferencesRequest(h, 42, http.MethodGet, "")
+	if code != http.StatusOK || resp.Preferences == nil || *resp.Preferences != (preferencesBody{}) {
+		t.Fatalf("GET before saving = %d %+v", code, resp)
+	}
+
+	code, resp = preferencesRequest(h, 42, http.MethodPost, `{"sex":" Female ","age_min":20,"age_max":30,"radius_km":10}`)
+	if code != http.StatusOK || !resp.OK {
+		t.Fatalf("POST = %d %+v", code, resp)
+	}
+	code, resp = preferencesRequest(h, 42, http.MethodGet, "")
+	p := resp.Preferences
+	if code != http.StatusOK || p == nil || p.Sex != "female" || *p.AgeMin != 20 || *p.AgeMax != 30 || *p.RadiusKm != 10 {
+		t.Fatalf("GET after saving = %d %+v", code, p)
+	}
+
+	// a later save replaces the filters, leaving out the omitted ones
+	preferencesRequest(h, 42, http.MethodPost, `{"sex":"male"}`)
+	if _, resp = preferencesRequest(h, 42, http.MethodGet, ""); resp.Preferences.Sex != "male" || resp.Preferences.AgeMin != nil || resp.Preferences.RadiusKm != nil {
+		t.Errorf("after replacing: %+v", resp.Preferences)
+	}
+
+	tests := []struct {
+		name  string
+		tgID  int64
+		body  string
+		code  int
+		field string
+	}{
+		{"unknown sex", 42, `{"sex":"any"}`, http.StatusBadRequest, "sex"},
+		{"age out of range", 42, `{"age_min":17}`, http.StatusBadRequest, "age_min"},
+		{"min above max", 42, `{"age_min":40,"age_max":30}`, http.StatusBadRequest, "age_max"},
+		{"radius too big", 42, `{"radius_km":301}`, http.StatusBadRequest, "radius_km"},
+		{"not json", 42, `sex=male`, http.StatusBadRequest, ""},
+		{"anonymous", 0, `{"sex":"male"}`, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		code, resp := preferencesRequest(h, tt.tgID, http.MethodPost, tt.body)
+		if code != tt.code || resp.OK {
+			t.Errorf("%s: %d %+v, want %d", tt.name, code, resp, tt.code)
+		}
+		if tt.field != "" && resp.Errors[tt.field] == "" {
+			t.Errorf("%s: errors %v lack %s", tt.name, resp.Errors, tt.field)
+		}
+	}
+	// the rejected saves left the last good one in place
+	if _, resp = preferencesRequest(h, 42, http.MethodGet, ""); resp.Preferences.Sex != "male" {
+		t.Errorf("after rejected saves: %+v", resp.Preferences)
+	}
+}
+
+func TestNearbyUsesSavedPreferences(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	// 1 and 3 are about 5 km north of 43.2,76.9, 2 about 20 km
+	for _, u := range []struct {
+		domain.User
+		lat float64
+	}{
+		{domain.User{TelegramId: 1, Nickname: "a", Sex: "female", Age: 25}, 43.245},
+		{domain.User{TelegramId: 2, Nickname: "b", Sex: "female", Age: 35}, 43.38},
+		{domain.User{TelegramId: 3, Nickname: "c", Sex: "male", Age: 25}, 43.245},
+	} {
+		lat, lon := u.lat, 76.9
+		u.Latitude, u.Longitude = &lat, &lon
+		if _, err := h.userRepo.CreateUser(ctx, &u.User); err != nil {
+			t.Fatal(err)
+		}
+	}
+	preferencesRequest(h, 42, http.MethodPost, `{"sex":"female","age_min":20,"age_max":30}`)
+	preferencesRequest(h, 44, http.MethodPost, `{"radius_km":10}`)
+
+	nearby := func(tgID int64, query string) []int64 {
+		r := signAs(httptest.NewRequest(http.MethodGet, "/api/users/nearby?"+query, nil), tgID)
+		rec := httptest.NewRecorder()
+		h.GetNearbyUsersHandler(rec, r)
+		var users []NearbyUser
+		if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+			t.Fatalf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+		ids := make([]int64, len(users))
+		for i, u := range users {
+			ids[i] = u.UserID
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		tgID  int64
+		query string
+		want  []int64
+	}{
+		{"saved filters", 42, "", []int64{1}},
+		{"sex from the query", 42, "sex=male", []int64{3}},
+		{"age from the query", 42, "age_max=40", []int64{1, 2}},
+		{"empty sex in the query clears the saved one", 42, "sex=", []int64{1, 3}},
+		{"nothing saved: defaults", 43, "", []int64{1, 2, 3}},
+		{"saved radius", 44, "location=43.2,76.9", []int64{1, 3}},
+		{"radius from the query", 44, "location=43.2,76.9&radius_km=50", []int64{1, 2, 3}},
+		{"nothing saved: default radius", 43, "location=43.2,76.9", []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := nearby(tt.tgID, tt.query); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
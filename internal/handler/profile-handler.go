@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	deleteConfirmText = "ИӘ, ЖОЮ"
+	deleteCancelText  = "❌ Жоқ"
+)
+
+var errProfileNotFound = errors.New("profile not found")
+
+// DeleteProfileCommand handles /delete_profile and asks for a second confirmation
+func (h *Handler) DeleteProfileCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil {
+		return
+	}
+	userID := update.Message.From.ID
+
+	user, err := h.userRepo.GetUserByTelegramId(ctx, userID)
+	if err != nil {
+		h.logger.Error("delete profile: lookup failed", zap.Int64("user_id", userID), zap.Error(err))
+		return
+	}
+	if user == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: userID,
+			Text:   "Сізде әлі профиль жоқ.",
+		})
+		return
+	}
+
+	if err := h.redisClient.SaveUserState(ctx, userID, &domain.UserState{State: stateDeleteConfirm}); err != nil {
+		h.logger.Error("Failed to save delete confirm state", zap.Error(err))
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: userID,
+		Text:   "⚠️ Профиліңізді өшіргіңіз келе ме?\n\nПрофиль, фото және лайктар толықтай жойылады. Бұл әрекетті қайтару мүмкін емес.\n\nРастау үшін «" + deleteConfirmText + "» батырмасын басыңыз.",
+		ReplyMarkup: &models.ReplyKeyboardMarkup{
+			Keyboard: [][]models.KeyboardButton{
+				{{Text: deleteConfirmText}, {Text: deleteCancelText}},
+			},
+			ResizeKeyboard:  true,
+			OneTimeKeyboard: true,
+		},
+	})
+	if err != nil {
+		h.logger.Error("Failed to send delete confirmation", zap.Error(err))
+	}
+}
+
+// handleDeleteConfirm finishes the /delete_profile flow
+func (h *Handler) handleDeleteConfirm(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+	if err := h.redisClient.DeleteUserState(ctx, userID); err != nil {
+		h.logger.Error("Failed to delete user state", zap.Error(err))
+	}
+
+	text := "Профильді өшіру тоқтатылды."
+	if strings.TrimSpace(update.Message.Text) == deleteConfirmText {
+		switch err := h.deleteProfile(ctx, b, userID); {
+		case err == nil:
+			text = "✅ Профиліңіз өшірілді. Қайта тіркелу үшін AIKA Mini App-ты ашыңыз."
+		case errors.Is(err, errProfileNotFound):
+			text = "Сізде әлі профиль жоқ."
+		default:
+			h.logger.Error("delete profile failed", zap.Int64("user_id", userID), zap.Error(err))
+			text = "❌ Профильді өшіру мүмкін болмады, кейінірек қайталап көріңіз."
+		}
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      userID,
+		Text:        text,
+		ReplyMarkup: &models.ReplyKeyboardRemove{RemoveKeyboard: true},
+	})
+}
+
+// DeleteProfileAPIHandler handles DELETE /api/user for the user who signed the initData
+func (h *Handler) DeleteProfileAPIHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodDelete {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := h.deleteProfile(r.Context(), h.bot, tgID); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			h.writeError(w, http.StatusNotFound, errCodeNotFound, "user not found")
+			return
+		}
+		logger.Error("delete profile failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "delete failed")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, genericAPIResponse{OK: true, Message: "deleted"})
+}
+
+// DeleteUserByIDHandler handles DELETE /api/users/{id}; users may only delete their own
+// profile, so the caller comes from the signed initData rather than X-Telegram-Id
+func (h *Handler) DeleteUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodDelete {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+	userID := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	if userID == "" || strings.Contains(userID, "/") {
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "user not found")
+		return
+	}
+
+	u, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		logger.Error("delete user: lookup failed", zap.String("user_id", userID), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "delete failed")
+		return
+	}
+	if u == nil {
+		h.writeError(w, http.StatusNotFound, errCodeNotFound, "user not found")
+		return
+	}
+	if u.TelegramId != tgID {
+		logger.Warn("delete user: forbidden", zap.String("user_id", userID), zap.Int64("tg_id", tgID))
+		h.writeError(w, http.StatusForbidden, errCodeForbidden, "forbidden")
+		return
+	}
+
+	if err := h.deleteProfile(r.Context(), h.bot, tgID); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			h.writeError(w, http.StatusNotFound, errCodeNotFound, "user not found")
+			return
+		}
+		logger.Error("delete profile failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "delete failed")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, genericAPIResponse{OK: true, Message: "deleted"})
+}
+
+// deleteProfile removes the profile, its avatar, likes, skips, messages and blocks, ends any active chat
+// and marks the just row inactive (the row itself is kept for statistics).
+func (h *Handler) deleteProfile(ctx context.Context, b *bot.Bot, tgID int64) error {
+	user, err := h.userRepo.GetUserByTelegramId(ctx, tgID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errProfileNotFound
+	}
+
+	if err := h.userRepo.DeleteProfile(ctx, user.Id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// deleted by a concurrent request
+			return errProfileNotFound
+		}
+		return err
+	}
+	// the files and the chat go only once nothing can roll the rows back
+	removeAvatarFile(user.AvatarPath, h.logger)
+
+	if err := h.userRepo.SetJustActive(ctx, tgID, false); err != nil {
+		h.logger.Error("delete profile: deactivate just failed", zap.Int64("tg_id", tgID), zap.Error(err))
+	}
+	h.endChat(ctx, b, tgID)
+	return nil
+}
+
+// endChat drops the user from matchmaking and notifies the partner, if any
+func (h *Handler) endChat(ctx context.Context, b *bot.Bot, userID int64) {
+	partnerID, err := h.redisClient.RemoveUser(ctx, userID)
+	if err != nil {
+		h.logger.Error("Ошибка при удалении пользователя", zap.Error(err))
+	}
+	if partnerID != 0 && b != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: partnerID,
+			Text:   "Сіздің партнер-(-ша) чаттан шықты.",
+		})
+	}
+}
+
+// removeAvatarFile deletes an uploaded avatar, refusing paths outside uploads/avatars
+func removeAvatarFile(path string, logger *zap.Logger) {
+	p := strings.TrimSpace(path)
+	if p == "" {
+		return
+	}
+	clean := filepath.Clean(p)
+	if !strings.HasPrefix(clean, filepath.Join("uploads", "avatars")+string(filepath.Separator)) {
+		logger.Warn("avatar outside uploads dir, not removed", zap.String("path", p))
+		return
+	}
+	for _, f := range []string{clean, avatarThumbPath(clean)} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			logger.Warn("remove avatar failed", zap.String("path", f), zap.Error(err))
+		}
+	}
+}
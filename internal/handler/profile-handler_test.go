@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createProfile registers tgID with an avatar and its thumbnail on disk, relative to
+// the working directory the way saveAvatar stores them
+func createProfile(t *testing.T, h *Handler, tgID int64) (id, avatar string) {
+	t.Helper()
+	avatar = filepath.Join("uploads", "avatars", "avatar-"+time.Now().Format("150405.000000000")+".jpg")
+	for _, p := range []string{avatar, avatarThumbPath(avatar)} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("jpeg"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, err := h.userRepo.CreateUser(context.Background(), &domain.User{TelegramId: tgID, Nickname: "Aru", Sex: "female", Age: 22, AvatarPath: avatar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, avatar
+}
+
+func deleteUserRequest(id string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodDelete, "/api/users/"+id, nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestDeleteUserByID(t *testing.T) {
+	t.Chdir(t.TempDir())
+	h, mem, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	ownID, ownAvatar := createProfile(t, h, 42)
+	otherID, otherAvatar := createProfile(t, h, 43)
+	mem.SetPartner(ctx, 42, 43, time.Hour)
+	mem.SetPartner(ctx, 43, 42, time.Hour)
+
+	tests := []struct {
+		name    string
+		id      string
+		headers map[string]string
+		want    int
+	}{
+		{"unsigned", ownID, nil, http.StatusUnauthorized},
+		{"spoofed X-Telegram-Id", otherID, map[string]string{"X-Telegram-Id": "43"}, http.StatusUnauthorized},
+		{"someone else's profile", otherID, map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusForbidden},
+		{"unknown profile", "missing", map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusNotFound},
+		{"own profile", ownID, map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusOK},
+		{"own profile again", ownID, map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.DeleteUserByIDHandler(rec, deleteUserRequest(tt.id, tt.headers))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if u, err := h.userRepo.GetUserByID(ctx, ownID); err != nil || u != nil {
+		t.Fatalf("own profile = %+v, %v; want deleted", u, err)
+	}
+	for _, p := range []string{ownAvatar, avatarThumbPath(ownAvatar)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still on disk: %v", p, err)
+		}
+	}
+	if p, _ := mem.GetUserPartner(ctx, 42); p != 0 {
+		t.Errorf("partner mapping of 42 = %d, want removed", p)
+	}
+
+	// the forbidden attempts left the other profile and its files alone
+	if u, err := h.userRepo.GetUserByID(ctx, otherID); err != nil || u == nil {
+		t.Fatalf("other profile = %+v, %v; want kept", u, err)
+	}
+	for _, p := range []string{otherAvatar, avatarThumbPath(otherAvatar)} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s: %v, want kept", p, err)
+		}
+	}
+}
+
+func TestDeleteProfileAPI(t *testing.T) {
+	t.Chdir(t.TempDir())
+	h, mem, fake, _ := newTestHandler(t)
+	ctx := context.Background()
+	ownID, avatar := createProfile(t, h, 42)
+	otherID, _ := createProfile(t, h, 43)
+	if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: 42, UserName: "aru", DateRegistered: "2024-01-02 15:04:05"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`INSERT INTO likes (from_user_id, to_user_id) VALUES (?1, ?2), (?2, ?1);`,
+		`INSERT INTO skips (from_user_id, to_user_id) VALUES (?1, ?2);`,
+		`INSERT INTO messages (from_user_id, to_user_id, text) VALUES (?1, ?2, 'hi'), (?2, ?1, 'hey');`,
+		`INSERT INTO blocks (blocker_user_id, blocked_user_id) VALUES (?2, ?1);`,
+	} {
+		if _, err := h.db.Exec(q, ownID, otherID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem.SetPartner(ctx, 42, 43, time.Hour)
+	mem.SetPartner(ctx, 43, 42, time.Hour)
+
+	// X-Telegram-Id alone is not proof of who is calling
+	rec := httptest.NewRecorder()
+	h.DeleteProfileAPIHandler(rec, func() *http.Request {
+		r := httptest.NewRequest(http.MethodDelete, "/api/user", nil)
+		r.Header.Set("X-Telegram-Id", "42")
+		return r
+	}())
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned: status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodDelete, "/api/user", nil)
+	r.Header.Set(initDataHeader, signInitData(testBotToken, 42, time.Now()))
+	h.DeleteProfileAPIHandler(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signed: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	for _, table := range []string{"likes", "skips", "messages", "blocks"} {
+		var n int
+		if err := h.db.QueryRow(`SELECT COUNT(1) FROM ` + table + `;`).Scan(&n); err != nil || n != 0 {
+			t.Errorf("%s rows = %d, %v; want none left", table, n, err)
+		}
+	}
+	var active int
+	if err := h.db.QueryRow(`SELECT is_active FROM just WHERE id_user = 42;`).Scan(&active); err != nil || active != 0 {
+		t.Errorf("just.is_active = %d, %v; want the row kept and inactive", active, err)
+	}
+	if _, err := os.Stat(avatar); !os.IsNotExist(err) {
+		t.Errorf("avatar still on disk: %v", err)
+	}
+	var notified bool
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" && c.Params["chat_id"] == "43" && strings.Contains(c.Params["text"], "чаттан шықты") {
+			notified = true
+		}
+	}
+	if !notified {
+		t.Error("partner was not told the chat ended")
+	}
+}
+
+// avatarUpdateRequest posts a fresh PNG avatar for the signed-in owner of id
+func avatarUpdateRequest(t *testing.T, id string, callerID int64) *http.Request {
+	t.Helper()
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("user_id", id)
+	fw, err := mw.CreateFormFile("avatar", "me.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(img.Bytes())
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/user/update", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return signAs(r, callerID)
+}
+
+func TestUpdateUserReplacesAvatar(t *testing.T) {
+	t.Chdir(t.TempDir())
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	id, old := createProfile(t, h, 42)
+
+	rec := httptest.NewRecorder()
+	h.UpdateUserHandler(rec, avatarUpdateRequest(t, id, 42))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", rec.Code, rec.Body)
+	}
+	u, err := h.userRepo.GetUserByID(ctx, id)
+	if err != nil || u == nil || u.AvatarPath == old {
+		t.Fatalf("profile = %+v, %v; want a new avatar", u, err)
+	}
+	for _, p := range []string{old, avatarThumbPath(old)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still on disk: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(u.AvatarPath); err != nil {
+		t.Fatalf("new avatar: %v", err)
+	}
+
+	// saveAvatar names files by the second, so the stored one moves aside to keep
+	// the next upload from landing on the same path
+	current := filepath.Join(avatarDir, "current.jpg")
+	for _, p := range [][2]string{{u.AvatarPath, current}, {avatarThumbPath(u.AvatarPath), avatarThumbPath(current)}} {
+		if err := os.Rename(p[0], p[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.db.Exec(`UPDATE users SET avatar_path = ? WHERE id = ?;`, current, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed update keeps the stored avatar and drops the one just uploaded
+	if _, err := h.db.Exec(`CREATE TRIGGER fail_update BEFORE UPDATE ON users BEGIN SELECT RAISE(ABORT, 'boom'); END;`); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.UpdateUserHandler(rec, avatarUpdateRequest(t, id, 42))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failed update: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(current); err != nil {
+		t.Errorf("stored avatar: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(avatarDir, "*.jpg"))
+	thumbs, _ := filepath.Glob(avatarThumbPath(filepath.Join(avatarDir, "*.jpg")))
+	if files = append(files, thumbs...); len(files) != 2 {
+		t.Errorf("avatars on disk = %v, want only %s and its thumbnail", files, current)
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// panicNoticeTTL limits admin alerts about crashed updates to one a minute,
+// so a panic hit by every update doesn't flood the admins
+const panicNoticeTTL = time.Minute
+
+// recoverMiddleware turns a panicking HTTP handler into a 500 and logs the stack.
+// http.ErrAbortHandler is re-raised: it is net/http's own way of aborting a response.
+func (h *Handler) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			requestLogger(r.Context(), h.logger).Error("panic in http handler",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Any("panic", v),
+				zap.ByteString("stack", debug.Stack()))
+			// too late for an error body once the handler has started writing
+			if rec.status == 0 {
+				h.writeError(rec, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// RecoverMiddleware keeps a panicking bot handler from taking the process down:
+// it logs the stack and, with cfg.PanicNotifyAdmins, tells the admins which update crashed.
+// Register it first in bot.WithMiddlewares so it wraps every handler.
+func (h *Handler) RecoverMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			h.logger.Error("panic in bot handler",
+				zap.Int64("update_id", update.ID),
+				zap.String("type", updateType(update)),
+				zap.Any("panic", v),
+				zap.ByteString("stack", debug.Stack()))
+			if h.cfg.PanicNotifyAdmins {
+				h.notifyPanic(context.WithoutCancel(ctx), b, update, v)
+			}
+		}()
+		next(ctx, b, update)
+	}
+}
+
+func (h *Handler) notifyPanic(ctx context.Context, b *bot.Bot, update *models.Update, v any) {
+	allowed, _, err := h.redisClient.HitOnce(ctx, "rl:panic_notice", panicNoticeTTL)
+	if err != nil || !allowed {
+		return
+	}
+	text := fmt.Sprintf("💥 Update %d (%s) өңдеу кезінде қате (panic): %v", update.ID, updateType(update), v)
+	for _, adminID := range h.cfg.AdminIDs {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminID, Text: text}); err != nil {
+			h.logger.Warn("Failed to notify admin about panic", zap.Int64("admin", adminID), zap.Error(err))
+		}
+	}
+}
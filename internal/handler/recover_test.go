@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestRecoverMiddlewareKeepsServing(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/late-panic", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom after the header")
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "fine") })
+	srv := httptest.NewServer(h.recoverMiddleware(mux))
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(srv.URL + "/panic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body apiError
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError || body.OK || body.Error != errCodeInternal {
+			t.Fatalf("panic: %d %+v, want a 500 JSON error", resp.StatusCode, body)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/late-panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("late panic: status %d, want the handler's own 202", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("server down after panics: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "fine" {
+		t.Fatalf("ok: %d %q", resp.StatusCode, b)
+	}
+}
+
+func TestRecoverMiddlewareReraisesAbort(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.recoverMiddleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Fatal("ErrAbortHandler was swallowed")
+}
+
+func TestBotRecoverMiddleware(t *testing.T) {
+	h, _, fake, b := newTestHandler(t)
+	h.cfg.PanicNotifyAdmins = true
+	ctx := context.Background()
+
+	calls := 0
+	handler := h.RecoverMiddleware(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+		panic("boom")
+	})
+	for id := int64(1); id <= 2; id++ {
+		handler(ctx, b, &models.Update{ID: id, Message: &models.Message{Chat: models.Chat{ID: 5}, From: &models.User{ID: 5}}})
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls)
+	}
+
+	// admins hear about the first crash only; the second is inside panicNoticeTTL
+	var notices []apiCall
+	for _, c := range fake.Calls() {
+		if c.Method == "sendMessage" {
+			notices = append(notices, c)
+		}
+	}
+	if len(notices) != 1 || notices[0].Params["chat_id"] != "1000" {
+		t.Fatalf("admin notices = %+v, want one to 1000", notices)
+	}
+}
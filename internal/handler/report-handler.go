@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"aika/internal/keyboard"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	reportReasonMaxRunes  = 300
+	reportContextMaxRunes = 1000
+	// reportsPerHour caps how many reports one user can file in an hour
+	reportsPerHour = 5
+	// reportPairTTL is how long a user must wait before reporting the same profile again
+	reportPairTTL = 24 * time.Hour
+	// reportListLimit is how many pending reports the admin "🚩 Шағымдар" button shows
+	reportListLimit = 10
+)
+
+// Callback data of the admin buttons under a report: report_ban_<id> / report_dismiss_<id>
+const (
+	reportCallbackPrefix = "report_"
+	reportBanPrefix      = reportCallbackPrefix + "ban_"
+	reportDismissPrefix  = reportCallbackPrefix + "dismiss_"
+)
+
+type reportAPIRequest struct {
+	ToUserID string `json:"to_user_id"` // DB user ID of the reported profile
+	Reason   string `json:"reason"`
+	// Context is optional, e.g. the text of the message being reported
+	Context string `json:"context"`
+}
+
+// ReportHandler files a report about a profile or message (POST /api/user/report)
+// and sends it to the admins
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req reportAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ToUserID) == "" {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid body")
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > reportReasonMaxRunes {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("reason must be 1-%d characters", reportReasonMaxRunes))
+		return
+	}
+	reportContext := strings.TrimSpace(req.Context)
+	if utf8.RuneCountInString(reportContext) > reportContextMaxRunes {
+		reportContext = string([]rune(reportContext)[:reportContextMaxRunes]) + "…"
+	}
+
+	fromTG, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+	toUser, err := h.userRepo.GetUserByID(r.Context(), req.ToUserID)
+	if err != nil || toUser == nil {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient not found")
+		return
+	}
+	if toUser.TelegramId == fromTG {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "cannot report yourself")
+		return
+	}
+
+	// one report per profile a day, and a few per hour overall
+	allowed, left, err := h.redisClient.HitOnce(r.Context(), rlKey("report", fromTG, toUser.TelegramId), reportPairTTL)
+	if err != nil {
+		logger.Error("report: rate limit failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "rate limit error")
+		return
+	}
+	if !allowed {
+		h.writeError(w, http.StatusTooManyRequests, errCodeRateLimited,
+			fmt.Sprintf("Сіз бұл қолданушыға шағым жібердіңіз. Қайта көріңіз %s кейін.", humanDur(left)))
+		return
+	}
+	n, left, err := h.redisClient.HitCount(r.Context(), fmt.Sprintf("rl:report:%d", fromTG), time.Hour)
+	if err != nil {
+		logger.Error("report: rate limit failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "rate limit error")
+		return
+	}
+	if n > reportsPerHour {
+		h.writeError(w, http.StatusTooManyRequests, errCodeRateLimited,
+			fmt.Sprintf("Шағым тым көп. Қайта көріңіз %s кейін.", humanDur(left)))
+		return
+	}
+
+	rep := domain.Report{
+		ReporterTgID:   fromTG,
+		ReportedUserID: toUser.Id,
+		ReportedTgID:   toUser.TelegramId,
+		Reason:         reason,
+		Context:        reportContext,
+		Status:         domain.ReportPending,
+		CreatedAt:      time.Now(),
+	}
+	rep.ID, err = h.reportRepo.InsertReport(r.Context(), rep)
+	if err != nil {
+		logger.Error("report: save failed", zap.Int64("from", fromTG), zap.String("to", toUser.Id), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "report save failed")
+		return
+	}
+	logger.Info("report filed", zap.Int64("report", rep.ID), zap.Int64("from", fromTG), zap.Int64("to", toUser.TelegramId))
+
+	h.goWorker("notify-report", func(ctx context.Context) { h.notifyReport(ctx, h.bot, rep, toUser.Nickname) })
+
+	h.writeJSON(w, http.StatusOK, genericAPIResponse{OK: true, Message: "reported"})
+}
+
+// reportCard is the admin-facing text of a report
+func reportCard(rep domain.Report, nickname string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🚩 Шағым #%d\n\n", rep.ID)
+	fmt.Fprintf(&sb, "Кімге: %s (tg %d)\n", safeNickKZ(nickname), rep.ReportedTgID)
+	fmt.Fprintf(&sb, "Кімнен: tg %d\n", rep.ReporterTgID)
+	fmt.Fprintf(&sb, "Себебі: %s\n", rep.Reason)
+	if rep.Context != "" {
+		fmt.Fprintf(&sb, "Контекст: %s\n", rep.Context)
+	}
+	fmt.Fprintf(&sb, "Уақыты: %s", rep.CreatedAt.Format("2006-01-02 15:04"))
+	return sb.String()
+}
+
+func reportKeyboard(id int64) models.ReplyMarkup {
+	kb := keyboard.NewKeyboard()
+	kb.AddRow(
+		keyboard.NewInlineButton("🚫 Бан", reportBanPrefix+strconv.FormatInt(id, 10)),
+		keyboard.NewInlineButton("✅ Жабу", reportDismissPrefix+strconv.FormatInt(id, 10)),
+	)
+	return kb.Build()
+}
+
+// sendReportCard shows one report to an admin with the ban / dismiss buttons
+func (h *Handler) sendReportCard(ctx context.Context, b *bot.Bot, adminID int64, rep domain.Report, nickname string) error {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      adminID,
+		Text:        reportCard(rep, nickname),
+		ReplyMarkup: reportKeyboard(rep.ID),
+	})
+	return err
+}
+
+// notifyReport sends a new report to every admin
+func (h *Handler) notifyReport(ctx context.Context, b *bot.Bot, rep domain.Report, nickname string) {
+	if b == nil {
+		h.logger.Error("report: telegram bot is nil; admins not notified", zap.Int64("report", rep.ID))
+		return
+	}
+	for _, adminID := range h.cfg.AdminIDs {
+		if err := h.sendReportCard(ctx, b, adminID, rep, nickname); err != nil {
+			h.logger.Warn("report: notify admin failed", zap.Int64("admin", adminID), zap.Int64("report", rep.ID), zap.Error(err))
+		}
+	}
+}
+
+// handleReports lists the oldest pending reports for the admin review flow
+func (h *Handler) handleReports(ctx context.Context, b *bot.Bot, update *models.Update) {
+	adminId := update.Message.From.ID
+	if !h.IsAdmin(adminId) {
+		return
+	}
+
+	reports, err := h.reportRepo.GetPendingReports(ctx, reportListLimit)
+	if err != nil {
+		h.logger.Error("Failed to get pending reports", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Қате: шағымдарды алу мүмкін болмады"})
+		return
+	}
+	if len(reports) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "📭 Қаралмаған шағым жоқ"})
+		return
+	}
+	for _, rep := range reports {
+		nickname, err := h.userRepo.GetUserNickname(ctx, rep.ReportedTgID)
+		if err != nil {
+			nickname = "" // profile already deleted
+		}
+		if err := h.sendReportCard(ctx, b, adminId, rep, nickname); err != nil {
+			h.logger.Warn("Failed to send report card", zap.Int64("report", rep.ID), zap.Error(err))
+		}
+	}
+}
+
+// ReportActionHandler resolves a report from its ban / dismiss buttons.
+// Ban blocks the reported user bot-wide and ends their current chat.
+func (h *Handler) ReportActionHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	cq := update.CallbackQuery
+	if cq == nil {
+		return
+	}
+	if !h.IsAdmin(cq.From.ID) {
+		h.logger.Warn("SomeOne is trying to get admin root", zap.Int64("user_id", cq.From.ID))
+		return
+	}
+
+	status, raw := domain.ReportDismissed, strings.TrimPrefix(cq.Data, reportDismissPrefix)
+	if strings.HasPrefix(cq.Data, reportBanPrefix) {
+		status, raw = domain.ReportBanned, strings.TrimPrefix(cq.Data, reportBanPrefix)
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		h.logger.Warn("Bad report callback", zap.String("data", cq.Data))
+		return
+	}
+
+	rep, err := h.reportRepo.GetReport(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to load report", zap.Int64("report", id), zap.Error(err))
+	}
+	if rep == nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "Шағым табылмады"})
+		return
+	}
+	ok, err := h.reportRepo.ResolveReport(ctx, id, status, cq.From.ID)
+	if err != nil {
+		h.logger.Error("Failed to resolve report", zap.Int64("report", id), zap.Error(err))
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "❌ Қате"})
+		return
+	}
+	if !ok {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: "Бұл шағым бұрын қаралған"})
+		return
+	}
+
+	result := "✅ Жабылды"
+	if status == domain.ReportBanned {
+		result = "🚫 Бұғатталды"
+		if err := h.banUser(ctx, b, rep.ReportedTgID, fmt.Sprintf("report #%d: %s", id, rep.Reason)); err != nil {
+			h.logger.Error("report: ban failed", zap.Int64("report", id), zap.Int64("tg_id", rep.ReportedTgID), zap.Error(err))
+			result = "⚠️ Бан сәтсіз: бұғаттау мүмкін болмады"
+		}
+	}
+	h.logger.Info("report resolved", zap.Int64("report", id), zap.String("status", status), zap.Int64("admin", cq.From.ID))
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: cq.ID, Text: result})
+
+	if msg := cq.Message.Message; msg != nil {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    msg.Chat.ID,
+			MessageID: msg.ID,
+			Text:      fmt.Sprintf("%s\n\n%s (admin %d)", msg.Text, result, cq.From.ID),
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reportRequest(fromTG int64, toID, reason string) *http.Request {
+	body, _ := json.Marshal(reportAPIRequest{ToUserID: toID, Reason: reason, Context: "rude message"})
+	r := httptest.NewRequest(http.MethodPost, "/api/user/report", strings.NewReader(string(body)))
+	return signAs(r, fromTG)
+}
+
+func TestReportLimitsAndAdminNotification(t *testing.T) {
+	h, _, fake, _ := newTestHandler(t)
+	ctx := context.Background()
+	h.cfg.AdminIDs = []int64{1000, 2000}
+	ids := map[int64]string{}
+	for tg := int64(42); tg <= 49; tg++ {
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "u" + strconv.FormatInt(tg, 10), Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[tg] = id
+	}
+	report := func(to int64, reason string) (int, apiError) {
+		rec := httptest.NewRecorder()
+		h.ReportHandler(rec, reportRequest(42, ids[to], reason))
+		var body apiError
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	tests := []struct {
+		name    string
+		to      int64
+		reason  string
+		code    int
+		errCode string
+	}{
+		{"first report", 43, "spam", http.StatusOK, ""},
+		{"same profile within 24h", 43, "spam again", http.StatusTooManyRequests, errCodeRateLimited},
+		{"yourself", 42, "spam", http.StatusBadRequest, errCodeBadRequest},
+		{"empty reason", 44, " ", http.StatusBadRequest, errCodeBadRequest},
+		{"second report this hour", 44, "spam", http.StatusOK, ""},
+		{"third report this hour", 45, "spam", http.StatusOK, ""},
+		{"fourth report this hour", 46, "spam", http.StatusOK, ""},
+		{"fifth report this hour", 47, "spam", http.StatusOK, ""},
+		{"sixth report this hour", 48, "spam", http.StatusTooManyRequests, errCodeRateLimited},
+	}
+	for _, tt := range tests {
+		code, body := report(tt.to, tt.reason)
+		if code != tt.code || (tt.errCode != "" && body.Error != tt.errCode) {
+			t.Errorf("%s: %d %+v, want %d %s", tt.name, code, body, tt.code, tt.errCode)
+		}
+	}
+
+	pending, err := h.reportRepo.GetPendingReports(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 5 {
+		t.Fatalf("%d reports stored, want 5", len(pending))
+	}
+	first := pending[0]
+	if first.ReporterTgID != 42 || first.ReportedTgID != 43 || first.ReportedUserID != ids[43] || first.Reason != "spam" || first.Context != "rude message" || first.Status != domain.ReportPending {
+		t.Errorf("stored report %+v", first)
+	}
+
+	// every admin gets a card with the ban / dismiss buttons for each stored report
+	if left := h.workers.Wait(5 * time.Second); len(left) > 0 {
+		t.Fatalf("notifications still running: %v", left)
+	}
+	cards := map[string]int{}
+	for _, c := range fake.Calls() {
+		if c.Method != "sendMessage" {
+			continue
+		}
+		var id int64
+		if _, err := fmt.Sscanf(c.Params["text"], "🚩 Шағым #%d", &id); err != nil {
+			t.Errorf("unexpected message to %s: %q", c.Params["chat_id"], c.Params["text"])
+			continue
+		}
+		if !strings.Contains(c.Params["reply_markup"], reportBanPrefix+strconv.FormatInt(id, 10)) {
+			t.Errorf("report #%d card to %s has no ban button", id, c.Params["chat_id"])
+		}
+		if id == first.ID && !strings.Contains(c.Params["text"], "Контекст: rude message") {
+			t.Errorf("report #%d card lacks the context: %q", id, c.Params["text"])
+		}
+		cards[c.Params["chat_id"]]++
+	}
+	if cards["1000"] != 5 || cards["2000"] != 5 || len(cards) != 2 {
+		t.Errorf("report cards per chat = %v, want 5 for each admin", cards)
+	}
+}
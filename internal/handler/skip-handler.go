@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// skipPrior smooths the skip rate so a couple of skips on a new profile barely move it
+const skipPrior = 5
+
+// skipRate is the share of reactions to a profile that were skips, in [0,1)
+func skipRate(st domain.SkipStats) float64 {
+	return float64(st.Skips) / float64(st.Skips+st.Likes+skipPrior)
+}
+
+// SkipHandler records that the caller passed on a profile (POST /api/user/skip)
+func (h *Handler) SkipHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req likeAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ToUserID) == "" {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "invalid body")
+		return
+	}
+
+	fromTG, err := h.verifiedTGID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+	fromUser, err := h.userRepo.GetUserByTelegramId(r.Context(), fromTG)
+	if err != nil || fromUser == nil {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "sender not found")
+		return
+	}
+	toUser, err := h.userRepo.GetUserByID(r.Context(), req.ToUserID)
+	if err != nil || toUser == nil {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "recipient not found")
+		return
+	}
+	if toUser.Id == fromUser.Id {
+		h.writeError(w, http.StatusBadRequest, errCodeBadRequest, "cannot skip yourself")
+		return
+	}
+
+	if err := h.skipRepo.InsertSkip(r.Context(), fromUser.Id, toUser.Id); err != nil {
+		logger.Error("skip: save failed", zap.String("from", fromUser.Id), zap.String("to", toUser.Id), zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "skip save failed")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, genericAPIResponse{OK: true})
+}
+
+// rankNearby orders out by keys (lower first) after inflating each key by the
+// profile's skip rate. keys are kept apart from out because hidden distances are zeroed there.
+func (h *Handler) rankNearby(ctx context.Context, out []NearbyUser, keys []float64) {
+	if h.cfg.SkipPenalty > 0 && len(out) > 0 {
+		ids := make([]string, 0, len(out))
+		for _, u := range out {
+			ids = append(ids, u.ID)
+		}
+		stats, err := h.skipRepo.GetSkipCounts(ctx, ids)
+		if err != nil {
+			h.logger.Warn("nearby: skip stats failed", zap.Error(err))
+		}
+		for i, u := range out {
+			if st, ok := stats[u.ID]; ok {
+				keys[i] *= 1 + h.cfg.SkipPenalty*skipRate(st)
+			}
+		}
+	}
+
+	idx := make([]int, len(out))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return keys[idx[a]] < keys[idx[b]] })
+	sorted := make([]NearbyUser, len(out))
+	for i, j := range idx {
+		sorted[i] = out[j]
+	}
+	copy(out, sorted)
+}
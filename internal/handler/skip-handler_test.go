@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHighSkipRateRanksLower(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	lon := 76.0
+	profile := func(tg int64, lat float64) string {
+		t.Helper()
+		id, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: fmt.Sprint("u", tg), Sex: "female", Age: 22, Latitude: &lat, Longitude: &lon})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// the skipped profile is the closer one, about 1 km away against 1.5 km
+	skipped := profile(1, 43.009)
+	other := profile(2, 43.0135)
+
+	for tg := int64(100); tg < 110; tg++ {
+		if _, err := h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "skipper", Sex: "male", Age: 25}); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/user/skip", strings.NewReader(`{"to_user_id":"`+skipped+`"}`))
+		signAs(r, tg)
+		rec := httptest.NewRecorder()
+		h.SkipHandler(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("skip: status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	nearby := func() []string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.GetNearbyUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/api/users/nearby?location=43.0,76.0&radius_km=10", nil))
+		var list []NearbyUser
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("nearby: %v: %s", err, rec.Body)
+		}
+		var ids []string
+		for _, u := range list {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+
+	h.cfg.SkipPenalty = 0
+	if got := nearby(); len(got) != 2 || got[0] != skipped {
+		t.Fatalf("without the penalty: order = %v, want the closer %s first", got, skipped)
+	}
+	h.cfg.SkipPenalty = 1
+	if got := nearby(); len(got) != 2 || got[0] != other || got[1] != skipped {
+		t.Fatalf("with the penalty: order = %v, want the often skipped %s last", got, skipped)
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// statsTrendDays is the length of the registration trend in the statistics message
+const statsTrendDays = 7
+
+// handleStatistics sends aggregate counters and a 7-day registration trend to the admin
+func (h *Handler) handleStatistics(ctx context.Context, b *bot.Bot, update *models.Update) {
+	adminId := update.Message.From.ID
+	if !h.IsAdmin(adminId) {
+		return
+	}
+
+	sendErr := func(err error) {
+		h.logger.Error("Failed to build statistics", zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: "❌ Статистиканы алу мүмкін болмады"})
+	}
+
+	total, active, err := h.userRepo.CountJustUsers(ctx)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	profiles, err := h.userRepo.CountProfiles(ctx)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	likes, matches, err := h.likeRepo.CountLikes(ctx)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+
+	now := time.Now()
+	days := registrationTrendDays(now, statsTrendDays)
+	byDay, err := h.userRepo.CountRegistrationsByDay(ctx, days[0])
+	if err != nil {
+		sendErr(err)
+		return
+	}
+
+	var trend strings.Builder
+	weekTotal := 0
+	for _, d := range days {
+		key := d.Format("2006-01-02")
+		weekTotal += byDay[key]
+		fmt.Fprintf(&trend, "• %s: %d\n", d.Format("02.01"), byDay[key])
+	}
+
+	text := fmt.Sprintf(`📈 СТАТИСТИКА
+
+👥 Бот қолданушылары: %d
+✅ Белсенді: %d
+💘 Профильдер: %d
+❤️ Лайктар: %d
+💞 Матчтар: %d
+
+🆕 Бүгін тіркелгендер: %d
+📅 Соңғы %d күн: %d
+%s
+⏰ Уақыт: %s`,
+		total, active, profiles, likes, matches,
+		byDay[now.Format("2006-01-02")],
+		statsTrendDays, weekTotal, trend.String(),
+		now.Format("2006-01-02 15:04:05"))
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: adminId, Text: text}); err != nil {
+		h.logger.Error("Failed to send statistics", zap.Error(err))
+	}
+}
+
+// registrationTrendDays returns the local midnights of the last n days, oldest first, ending today
+func registrationTrendDays(now time.Time, n int) []time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := make([]time.Time, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		days = append(days, today.AddDate(0, 0, -i))
+	}
+	return days
+}
+
+// AdminStatsResponse is the JSON of GET /api/admin/stats
+type AdminStatsResponse struct {
+	Users              int       `json:"users"`
+	ActiveUsers        int       `json:"active_users"`
+	Profiles           int       `json:"profiles"`
+	Likes              int       `json:"likes"`
+	Matches            int       `json:"matches"`
+	RegistrationsToday int       `json:"registrations_today"`
+	ActiveChats        int64     `json:"active_chats"`
+	WaitingUsers       int64     `json:"waiting_users"`
+	Orders             int       `json:"orders"`
+	OrdersAmount       int       `json:"orders_amount"`
+	GeneratedAt        time.Time `json:"generated_at"`
+}
+
+// AdminStatsHandler serves GET /api/admin/stats: the /admin statistics as JSON, for
+// a web dashboard. Only admins get it, identified by the signed Mini App initData
+// in the X-Telegram-Init-Data header.
+func (h *Handler) AdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context(), h.logger)
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		logger.Warn("admin stats: unauthorized", zap.Error(err))
+		h.writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+		return
+	}
+	if !h.IsAdmin(tgID) {
+		logger.Warn("admin stats: not an admin", zap.Int64("tg_id", tgID))
+		h.writeError(w, http.StatusForbidden, errCodeForbidden, "forbidden")
+		return
+	}
+
+	stats, err := h.adminStats(r.Context(), time.Now())
+	if err != nil {
+		logger.Error("admin stats: count failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handler) adminStats(ctx context.Context, now time.Time) (*AdminStatsResponse, error) {
+	s := &AdminStatsResponse{GeneratedAt: now}
+	var err error
+	if s.Users, s.ActiveUsers, err = h.userRepo.CountJustUsers(ctx); err != nil {
+		return nil, err
+	}
+	if s.Profiles, err = h.userRepo.CountProfiles(ctx); err != nil {
+		return nil, err
+	}
+	if s.Likes, s.Matches, err = h.likeRepo.CountLikes(ctx); err != nil {
+		return nil, err
+	}
+	if s.RegistrationsToday, err = h.userRepo.CountRegistrationsOn(ctx, now); err != nil {
+		return nil, err
+	}
+	if s.ActiveChats, err = h.redisClient.CountActiveChats(ctx); err != nil {
+		return nil, err
+	}
+	if s.WaitingUsers, err = h.redisClient.CountWaitingUsers(ctx); err != nil {
+		return nil, err
+	}
+	if s.Orders, s.OrdersAmount, err = h.orderRepo.CountOrders(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
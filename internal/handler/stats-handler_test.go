@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAdminStatsAuth(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	admin := h.cfg.AdminIDs[0]
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"nothing", nil, http.StatusUnauthorized},
+		{"spoofed id header", map[string]string{"X-Telegram-Id": "1000"}, http.StatusUnauthorized},
+		{"forged init data", map[string]string{initDataHeader: signInitData("2:other", admin, time.Now())}, http.StatusUnauthorized},
+		{"not an admin", map[string]string{initDataHeader: signInitData(testBotToken, 42, time.Now())}, http.StatusForbidden},
+		{"admin", map[string]string{initDataHeader: signInitData(testBotToken, admin, time.Now())}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.AdminStatsHandler(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/stats", nil)
+	rec := httptest.NewRecorder()
+	h.AdminStatsHandler(rec, r)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d", rec.Code)
+	}
+}
+
+func TestAdminStatsJSON(t *testing.T) {
+	h, mem, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	for _, id := range []int64{1, 2, 3} {
+		if err := h.userRepo.InsertJust(ctx, domain.JustEntry{UserId: id, UserName: "u"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem.TouchChat(ctx, 1, 2, time.Now())
+	mem.AddUser(ctx, 3)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil)
+	r.Header.Set(initDataHeader, signInitData(testBotToken, h.cfg.AdminIDs[0], time.Now()))
+	rec := httptest.NewRecorder()
+	h.AdminStatsHandler(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	want := []string{"active_chats", "active_users", "generated_at", "likes", "matches", "orders", "orders_amount", "profiles", "registrations_today", "users", "waiting_users"}
+	if len(keys) != len(want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("keys = %v, want %v", keys, want)
+		}
+	}
+
+	var stats AdminStatsResponse
+	json.Unmarshal(rec.Body.Bytes(), &stats)
+	if stats.Users != 3 || stats.ActiveChats != 1 || stats.WaitingUsers != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRegistrationTrendDays(t *testing.T) {
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.Local) }
+	tests := []struct {
+		name        string
+		now         time.Time
+		n           int
+		first, last time.Time
+	}{
+		{"week across a leap day", at(2024, 3, 2, 15), 7, at(2024, 2, 25, 0), at(2024, 3, 2, 0)},
+		{"week across new year", at(2025, 1, 3, 0), 7, at(2024, 12, 28, 0), at(2025, 1, 3, 0)},
+		{"just before midnight", time.Date(2024, 3, 2, 23, 59, 59, 0, time.Local), 7, at(2024, 2, 25, 0), at(2024, 3, 2, 0)},
+		{"today only", at(2024, 3, 2, 15), 1, at(2024, 3, 2, 0), at(2024, 3, 2, 0)},
+	}
+	for _, tt := range tests {
+		days := registrationTrendDays(tt.now, tt.n)
+		if len(days) != tt.n {
+			t.Fatalf("%s: %d days, want %d", tt.name, len(days), tt.n)
+		}
+		if !days[0].Equal(tt.first) || !days[len(days)-1].Equal(tt.last) {
+			t.Errorf("%s: days %s..%s, want %s..%s", tt.name, days[0], days[len(days)-1], tt.first, tt.last)
+		}
+		for i := 1; i < len(days); i++ {
+			if y, m, d := days[i-1].AddDate(0, 0, 1).Date(); !days[i].Equal(time.Date(y, m, d, 0, 0, 0, 0, time.Local)) {
+				t.Errorf("%s: day %d is %s after %s", tt.name, i, days[i], days[i-1])
+			}
+		}
+	}
+	if days := registrationTrendDays(at(2024, 3, 2, 15), 0); len(days) != 0 {
+		t.Errorf("n = 0: %v, want no days", days)
+	}
+}
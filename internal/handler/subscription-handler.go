@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// UnsubscribeCommand handles /unsubscribe: the user stops getting admin broadcasts.
+// Chat, likes and match notifications are not affected.
+func (h *Handler) UnsubscribeCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.setBroadcastOptOut(ctx, b, update, true)
+}
+
+// SubscribeCommand handles /subscribe and turns admin broadcasts back on
+func (h *Handler) SubscribeCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.setBroadcastOptOut(ctx, b, update, false)
+}
+
+func (h *Handler) setBroadcastOptOut(ctx context.Context, b *bot.Bot, update *models.Update, optOut bool) {
+	if update.Message == nil {
+		return
+	}
+	userID := update.Message.From.ID
+
+	found, err := h.userRepo.SetBroadcastOptOut(ctx, userID, optOut)
+	if err != nil {
+		h.logger.Error("broadcast opt-out: update failed", zap.Int64("user_id", userID), zap.Bool("opt_out", optOut), zap.Error(err))
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: "❌ Қате орын алды, кейінірек қайталаңыз."})
+		return
+	}
+
+	text := "🔔 Жаңалықтар мен хабарламалар қайта қосылды. Өшіру үшін /unsubscribe жіберіңіз."
+	switch {
+	case !found:
+		text = "Алдымен /start басып тіркеліңіз."
+	case optOut:
+		text = "🔕 Сіз жаңалықтар таратылымынан бас тарттыңыз. Чат пен лайк хабарламалары келе береді.\n\nҚайта қосу үшін /subscribe жіберіңіз."
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: userID, Text: text})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signInitData builds initData for userID the way Telegram signs it
+func signInitData(token string, userID int64, authDate time.Time) string {
+	values := url.Values{
+		"auth_date": {fmt.Sprint(authDate.Unix())},
+		"query_id":  {"AAH"},
+		"user":      {fmt.Sprintf(`{"id":%d,"first_name":"Aru"}`, userID)},
+	}
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		pairs = append(pairs, k+"="+v[0])
+	}
+	sort.Strings(pairs)
+	values.Set("hash", initDataHash(strings.Join(pairs, "\n"), token))
+	return values.Encode()
+}
+
+func TestVerifyInitData(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	valid := signInitData(testBotToken, 42, now.Add(-time.Minute))
+
+	tests := []struct {
+		name     string
+		initData string
+		token    string
+		wantID   int64
+	}{
+		{"valid", valid, testBotToken, 42},
+		{"other bot's token", valid, "2:other", 0},
+		{"user swapped", strings.Replace(valid, "42", "1000", 1), testBotToken, 0},
+		{"no hash", "auth_date=1&user=%7B%22id%22%3A42%7D", testBotToken, 0},
+		{"expired", signInitData(testBotToken, 42, now.Add(-initDataMaxAge-time.Minute)), testBotToken, 0},
+		{"garbage", "%zz", testBotToken, 0},
+		{"empty token", valid, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := verifyInitData(tt.initData, tt.token, now)
+			if tt.wantID == 0 {
+				if !errors.Is(err, errInitDataInvalid) {
+					t.Fatalf("err = %v, want errInitDataInvalid", err)
+				}
+				return
+			}
+			if err != nil || id != tt.wantID {
+				t.Fatalf("got (%d, %v), want %d", id, err, tt.wantID)
+			}
+		})
+	}
+}
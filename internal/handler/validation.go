@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	nicknameMinRunes = 1
+	nicknameMaxRunes = 32
+	aboutMaxRunes    = 500
+	minAge           = 18
+	maxAge           = 99
+	maxRadiusKm      = 300
+)
+
+// profileErrors collects field-level validation messages keyed by form field name.
+type profileErrors map[string]string
+
+// validateNickname trims the nickname and rejects control characters in it:
+// unlike the about text a nickname is shown inline, where a newline or escape
+// sequence would break the card
+func validateNickname(raw string, errs profileErrors) string {
+	v := strings.TrimSpace(raw)
+	if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+		errs["nickname"] = "must not contain control characters"
+		return v
+	}
+	if n := utf8.RuneCountInString(v); n < nicknameMinRunes || n > nicknameMaxRunes {
+		errs["nickname"] = "must be " + strconv.Itoa(nicknameMinRunes) + "-" + strconv.Itoa(nicknameMaxRunes) + " characters"
+	}
+	return v
+}
+
+func validateSex(raw string, errs profileErrors) string {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	if v != "male" && v != "female" {
+		errs["sex"] = `must be "male" or "female"`
+	}
+	return v
+}
+
+func validateAge(raw string, errs profileErrors) int {
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || n < minAge || n > maxAge {
+		errs["age"] = "must be a number between " + strconv.Itoa(minAge) + " and " + strconv.Itoa(maxAge)
+	}
+	return n
+}
+
+// validateAbout keeps newlines and tabs in the free-text field but drops other control characters.
+func validateAbout(raw string, errs profileErrors) string {
+	v := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, raw))
+	if utf8.RuneCountInString(v) > aboutMaxRunes {
+		errs["about_user"] = "must be at most " + strconv.Itoa(aboutMaxRunes) + " characters"
+	}
+	return v
+}
+
+func validateCoord(field, raw string, limit float64, errs profileErrors) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	// ParseFloat accepts "NaN" and "Inf", which slip through the range comparison
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < -limit || f > limit {
+		errs[field] = "must be a number between " + strconv.FormatFloat(-limit, 'f', -1, 64) + " and " + strconv.FormatFloat(limit, 'f', -1, 64)
+	}
+	return f
+}
+
+func validateLatitude(raw string, errs profileErrors) float64 {
+	return validateCoord("latitude", raw, 90, errs)
+}
+
+func validateLongitude(raw string, errs profileErrors) float64 {
+	return validateCoord("longitude", raw, 180, errs)
+}
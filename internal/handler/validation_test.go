@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProfileValidationBoundaries(t *testing.T) {
+	validators := map[string]func(string, profileErrors){
+		"nickname":   func(v string, e profileErrors) { validateNickname(v, e) },
+		"sex":        func(v string, e profileErrors) { validateSex(v, e) },
+		"age":        func(v string, e profileErrors) { validateAge(v, e) },
+		"about_user": func(v string, e profileErrors) { validateAbout(v, e) },
+		"latitude":   func(v string, e profileErrors) { validateLatitude(v, e) },
+		"longitude":  func(v string, e profileErrors) { validateLongitude(v, e) },
+	}
+
+	tests := []struct {
+		field, value string
+		valid        bool
+	}{
+		{"nickname", "", false},
+		{"nickname", "   ", false},
+		{"nickname", "A", true},
+		{"nickname", strings.Repeat("a", nicknameMaxRunes), true},
+		{"nickname", strings.Repeat("a", nicknameMaxRunes+1), false},
+		{"nickname", strings.Repeat("ә", nicknameMaxRunes), true},
+		{"nickname", strings.Repeat("ә", nicknameMaxRunes+1), false},
+		{"nickname", "  " + strings.Repeat("a", nicknameMaxRunes) + "  ", true},
+		{"nickname", "Aru\nKhan", false},
+		{"nickname", "Aru\x1b[31m", false},
+		{"sex", "male", true},
+		{"sex", "Female", true},
+		{"sex", "other", false},
+		{"sex", "", false},
+		{"age", strconv.Itoa(minAge - 1), false},
+		{"age", strconv.Itoa(minAge), true},
+		{"age", strconv.Itoa(maxAge), true},
+		{"age", strconv.Itoa(maxAge + 1), false},
+		{"age", "twenty", false},
+		{"about_user", "", true},
+		{"about_user", strings.Repeat("ә", aboutMaxRunes), true},
+		{"about_user", strings.Repeat("ә", aboutMaxRunes+1), false},
+		{"about_user", strings.Repeat("a", aboutMaxRunes) + "\x00\x07", true},
+		{"latitude", "-90", true},
+		{"latitude", "90", true},
+		{"latitude", "90.000001", false},
+		{"latitude", "-90.000001", false},
+		{"latitude", "NaN", false},
+		{"latitude", "", false},
+		{"longitude", "-180", true},
+		{"longitude", "180", true},
+		{"longitude", "180.000001", false},
+		{"longitude", "-180.000001", false},
+		{"longitude", "Inf", false},
+	}
+	for _, tt := range tests {
+		errs := profileErrors{}
+		validators[tt.field](tt.value, errs)
+		if _, failed := errs[tt.field]; failed == tt.valid {
+			t.Errorf("%s %q: errors %v, want valid=%v", tt.field, tt.value, errs, tt.valid)
+		}
+		if len(errs) > 1 {
+			t.Errorf("%s %q: unrelated errors %v", tt.field, tt.value, errs)
+		}
+	}
+}
+
+func TestValidateAboutDropsControlCharacters(t *testing.T) {
+	got := validateAbout(" line one\nline\ttwo\x00\x1b ", profileErrors{})
+	if got != "line one\nline\ttwo" {
+		t.Fatalf("validateAbout = %q", got)
+	}
+}
+
+func TestHandleRegisterFieldErrors(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+
+	r := registerRequestWith(t, "42", "42", map[string]string{
+		"nickname":  strings.Repeat("a", nicknameMaxRunes+1),
+		"sex":       "other",
+		"latitude":  "91",
+		"longitude": "76.889",
+	})
+	w := httptest.NewRecorder()
+	h.HandleRegister(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+	var resp RegisterResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"nickname", "sex", "latitude"} {
+		if resp.Errors[field] == "" {
+			t.Errorf("no error for %s in %v", field, resp.Errors)
+		}
+	}
+	if len(resp.Errors) != 3 {
+		t.Errorf("errors = %v, want exactly nickname, sex and latitude", resp.Errors)
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// profileVisibility is returned to the owner so the update form can show current settings
+type profileVisibility struct {
+	HideAge      bool `json:"hide_age"`
+	HideAbout    bool `json:"hide_about"`
+	HideDistance bool `json:"hide_distance"`
+}
+
+// profileViewer identifies who is looking at a profile; zero values mean anonymous
+type profileViewer struct {
+	tgID   int64
+	userID string
+}
+
+// newNearbyUser is the single place profile cards are shaped for the API.
+// When full is false the fields the owner chose to hide are left out; hiding
+// distance also drops the coordinates, since they'd give the distance away.
+func newNearbyUser(u *domain.User, distKm *float64, full bool) NearbyUser {
+	out := NearbyUser{
+		ID:                u.Id,
+		UserID:            u.TelegramId,
+		Nickname:          u.Nickname,
+		Sex:               u.Sex,
+		Age:               u.Age,
+		Latitude:          u.Latitude,
+		Longitude:         u.Longitude,
+		AboutUser:         u.AboutUser,
+		AvatarPath:        u.AvatarPath,
+		AvatarURL:         makeAvatarURL(u.Id, u.AvatarPath),
+		AvatarThumbURL:    makeAvatarThumbURL(u.Id, u.AvatarPath),
+		AvatarW:           u.AvatarWidth,
+		AvatarH:           u.AvatarHeight,
+		DistanceKm:        distKm,
+		DistanceAvailable: distKm != nil,
+	}
+	if full {
+		return out
+	}
+	if u.HideAge {
+		out.Age = 0
+	}
+	if u.HideAbout {
+		out.AboutUser = ""
+	}
+	if u.HideDistance {
+		out.Latitude, out.Longitude = nil, nil
+		out.DistanceKm, out.DistanceAvailable = nil, false
+	}
+	return out
+}
+
+// resolveViewer looks up the caller's profile id once per request
+func (h *Handler) resolveViewer(r *http.Request) profileViewer {
+	tgID, err := h.verifiedTGID(r)
+	if err != nil {
+		return profileViewer{}
+	}
+	v := profileViewer{tgID: tgID}
+	me, err := h.userRepo.GetUserByTelegramId(r.Context(), tgID)
+	if err != nil {
+		h.logger.Warn("visibility: viewer lookup failed", zap.Int64("tg_id", tgID), zap.Error(err))
+		return v
+	}
+	if me != nil {
+		v.userID = me.Id
+	}
+	return v
+}
+
+// seesHiddenFields reports whether the viewer is the owner or a mutual match of u
+func (h *Handler) seesHiddenFields(ctx context.Context, v profileViewer, u *domain.User) bool {
+	if !u.HidesAny() {
+		return true
+	}
+	if v.tgID != 0 && v.tgID == u.TelegramId {
+		return true
+	}
+	if v.userID == "" {
+		return false
+	}
+	liked, err := h.likeRepo.HasLike(ctx, v.userID, u.Id)
+	if err != nil || !liked {
+		return false
+	}
+	likedBack, err := h.likeRepo.HasLike(ctx, u.Id, v.userID)
+	return err == nil && likedBack
+}
+
+// applyPresence fills Online and LastSeenSeconds from the users' last_seen keys.
+// Presence is best effort: on a Redis error the cards go out without it.
+func (h *Handler) applyPresence(ctx context.Context, cards []NearbyUser, now time.Time) {
+	ids := make([]int64, len(cards))
+	for i, c := range cards {
+		ids[i] = c.UserID
+	}
+	seen, err := h.redisClient.GetLastSeenMany(ctx, ids)
+	if err != nil {
+		h.logger.Warn("presence lookup failed", zap.Error(err))
+		return
+	}
+	for i := range cards {
+		at, ok := seen[cards[i].UserID]
+		if !ok {
+			continue
+		}
+		ago := max(int64(now.Sub(at).Seconds()), 0)
+		cards[i].LastSeenSeconds = &ago
+		cards[i].Online = now.Sub(at) <= h.cfg.OnlineWindow
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHiddenFieldsOnlyForOwnerAndMatches(t *testing.T) {
+	h, _, _, _ := newTestHandler(t)
+	ctx := context.Background()
+	lat, lon := 43.238, 76.889
+	owner, err := h.userRepo.CreateUser(ctx, &domain.User{
+		TelegramId: 42, Nickname: "Aru", Sex: "female", Age: 22, AboutUser: "hello",
+		Latitude: &lat, Longitude: &lon, HideAge: true, HideAbout: true, HideDistance: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int64]string{}
+	for _, tg := range []int64{43, 44} {
+		if ids[tg], err = h.userRepo.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: "u", Sex: "male", Age: 25}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 44 and the owner liked each other; 43 only liked the owner
+	for _, l := range [][2]string{{ids[44], owner}, {owner, ids[44]}, {ids[43], owner}} {
+		if err := h.likeRepo.InsertLike(ctx, l[0], l[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		viewer     int64
+		full       bool
+		visibility bool
+		// unsigned sends the viewer as a bare X-Telegram-Id instead of initData
+		unsigned bool
+	}{
+		{"anonymous", 0, false, false, false},
+		{"one-sided like", 43, false, false, false},
+		{"mutual match", 44, true, false, false},
+		{"owner", 42, true, true, false},
+		{"owner's id, unsigned", 42, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/users/"+owner+"?origin=43.2,76.9", nil)
+			switch {
+			case tt.unsigned:
+				r.Header.Set("X-Telegram-Id", fmt.Sprint(tt.viewer))
+			case tt.viewer != 0:
+				signAs(r, tt.viewer)
+			}
+			rec := httptest.NewRecorder()
+			h.GetUserByIDHandler(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []string{"age", "about_user", "latitude", "longitude", "distance_km"} {
+				if _, ok := got[field]; ok != tt.full {
+					t.Errorf("%s present = %v, want %v", field, ok, tt.full)
+				}
+			}
+			if got["distance_available"] != tt.full {
+				t.Errorf("distance_available = %v, want %v", got["distance_available"], tt.full)
+			}
+			if _, ok := got["visibility"]; ok != tt.visibility {
+				t.Errorf("visibility settings present = %v, want %v", ok, tt.visibility)
+			}
+		})
+	}
+}
+
+func TestPresenceWindow(t *testing.T) {
+	h, _ := newHealthHandler(t)
+	ctx := context.Background()
+	h.cfg.OnlineWindow = 5 * time.Minute
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	h.redisClient.SetLastSeen(ctx, 1, now.Add(-h.cfg.OnlineWindow+time.Second))
+	h.redisClient.SetLastSeen(ctx, 2, now.Add(-h.cfg.OnlineWindow))
+	h.redisClient.SetLastSeen(ctx, 3, now.Add(-h.cfg.OnlineWindow-time.Second))
+
+	cards := []NearbyUser{{UserID: 1}, {UserID: 2}, {UserID: 3}, {UserID: 4}}
+	h.applyPresence(ctx, cards, now)
+
+	tests := []struct {
+		name   string
+		online bool
+		ago    int64
+	}{
+		{"a second inside the window", true, 299},
+		{"at the window edge", true, 300},
+		{"a second outside the window", false, 301},
+	}
+	for i, tt := range tests {
+		c := cards[i]
+		if c.Online != tt.online || c.LastSeenSeconds == nil || *c.LastSeenSeconds != tt.ago {
+			t.Errorf("%s: online %v, last seen %v; want %v, %d", tt.name, c.Online, c.LastSeenSeconds, tt.online, tt.ago)
+		}
+	}
+	if cards[3].Online || cards[3].LastSeenSeconds != nil {
+		t.Errorf("never seen: %+v", cards[3])
+	}
+}
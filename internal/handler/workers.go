@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// workerGroup tracks the goroutines a handler starts outside an update or request,
+// so shutdown can wait for them instead of cutting them off.
+//
+// Workers get ctx, which is detached from the app context: a SIGTERM does not abort a
+// half-sent like or a running export. ctx is cancelled only when Wait gives up, so
+// stragglers still stop once the grace period is over.
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closed  bool
+	nextID  int
+	running map[int]string
+}
+
+func newWorkerGroup(appCtx context.Context) *workerGroup {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(appCtx))
+	return &workerGroup{ctx: ctx, cancel: cancel, running: make(map[int]string)}
+}
+
+// Go runs fn as a named worker. It reports false, without running fn, once Wait has started.
+func (g *workerGroup) Go(name string, fn func(ctx context.Context)) bool {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return false
+	}
+	id := g.nextID
+	g.nextID++
+	g.running[id] = name
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, id)
+			g.mu.Unlock()
+			g.wg.Done()
+		}()
+		fn(g.ctx)
+	}()
+	return true
+}
+
+// Wait refuses new workers and waits up to timeout for the running ones. Whatever is
+// still running then has its context cancelled, and its names are returned.
+func (g *workerGroup) Wait(timeout time.Duration) []string {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		g.cancel()
+		return nil
+	case <-time.After(timeout):
+	}
+
+	g.mu.Lock()
+	left := make([]string, 0, len(g.running))
+	for _, name := range g.running {
+		left = append(left, name)
+	}
+	g.mu.Unlock()
+	sort.Strings(left)
+	g.cancel()
+	return left
+}
+
+// goWorker runs fn in the background as a tracked worker; after shutdown has
+// started it is dropped and logged
+func (h *Handler) goWorker(name string, fn func(ctx context.Context)) {
+	if !h.workers.Go(name, fn) {
+		h.logger.Warn("Shutting down, background job not started", zap.String("worker", name))
+	}
+}
+
+// Shutdown waits up to grace for running broadcasts and background workers, logs
+// the ones that did not finish, and flushes the channel mirror
+func (h *Handler) Shutdown(grace time.Duration) {
+	deadline := time.Now().Add(grace)
+	if !h.WaitBroadcasts(grace) {
+		h.logger.Warn("Shutdown timeout reached with broadcasts still running", zap.Duration("timeout", grace))
+	}
+	if left := h.workers.Wait(time.Until(deadline)); len(left) > 0 {
+		h.logger.Warn("Shutdown timeout reached with workers still running",
+			zap.Duration("timeout", grace), zap.Strings("workers", left))
+	}
+	h.Close()
+}
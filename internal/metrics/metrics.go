@@ -0,0 +1,135 @@
+// Package metrics holds the Prometheus collectors of the bot and the web server.
+// Everything is registered on Registry, which /metrics serves.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+const namespace = "aika"
+
+// Registry is what /metrics exposes; it also carries the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Updates counts Telegram updates handled, by update type
+	Updates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "bot_updates_total",
+		Help: "Telegram updates processed, by type.",
+	}, []string{"type"})
+
+	// MessagesRelayed counts anonymous chat messages delivered to a partner, by message kind
+	MessagesRelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "chat_messages_relayed_total",
+		Help: "Chat messages relayed to a partner, by message kind.",
+	}, []string{"kind"})
+
+	// LikesSent counts accepted likes; result is "like" or "match"
+	LikesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "likes_sent_total",
+		Help: "Likes accepted by the API, by result.",
+	}, []string{"result"})
+
+	// BroadcastSends counts broadcast deliveries; result is "sent" or a failure class
+	BroadcastSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "broadcast_sends_total",
+		Help: "Broadcast messages sent, by result.",
+	}, []string{"result"})
+
+	// ActiveChats is the number of partner pairs that have relayed a message and not ended the chat
+	ActiveChats = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "chat_active_pairs",
+		Help: "Anonymous chat pairs currently talking.",
+	})
+
+	// BotUsers is the number of bot users; status is "total" or "active"
+	BotUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "bot_users",
+		Help: "Users who started the bot, by status.",
+	}, []string{"status"})
+
+	// RegisteredUsers is the number of dating profiles
+	RegisteredUsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "registered_users",
+		Help: "Users with a dating profile.",
+	})
+
+	// HTTPDuration is the latency of web requests by mux route
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "http_request_duration_seconds",
+		Help:    "HTTP request duration, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	// SQLiteDuration is the latency of SQLite statements; op is "exec" or "query"
+	SQLiteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "sqlite_query_duration_seconds",
+		Help:    "SQLite statement duration, by operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"op"})
+
+	// RedisErrors counts failed Redis commands; a missing key (redis.Nil) is not an error
+	RedisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "redis_errors_total",
+		Help: "Redis commands that failed, by command.",
+	}, []string{"command"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Updates, MessagesRelayed, LikesSent, BroadcastSends,
+		ActiveChats, BotUsers, RegisteredUsers,
+		HTTPDuration, SQLiteDuration, RedisErrors,
+	)
+}
+
+// Handler serves Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveSQLite records one SQLite statement that started at start
+func ObserveSQLite(op string, start time.Time) {
+	SQLiteDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// RedisHook counts failed commands; add it with redis.Client.AddHook
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		countRedisError(cmd.Name(), err)
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			countRedisError(cmd.Name(), cmd.Err())
+		}
+		return err
+	}
+}
+
+func countRedisError(command string, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		RedisErrors.WithLabelValues(command).Inc()
+	}
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// BanRepository keeps the bot-wide ban list; it is the source of truth behind
+// the Redis ban cache
+type BanRepository struct {
+	db *sql.DB
+}
+
+func NewBanRepository(db *sql.DB) *BanRepository {
+	return &BanRepository{db: db}
+}
+
+// BanUser bans a Telegram user; banning again only replaces the reason
+func (r *BanRepository) BanUser(ctx context.Context, id int64, reason string) error {
+	const q = `
+		INSERT INTO banned_users (telegram_id, reason) VALUES (?, ?)
+		ON CONFLICT(telegram_id) DO UPDATE SET reason = excluded.reason;`
+	if _, err := r.db.ExecContext(ctx, q, id, reason); err != nil {
+		return fmt.Errorf("BanUser exec: %w", err)
+	}
+	return nil
+}
+
+// UnbanUser lifts a ban; it reports false when the user was not banned
+func (r *BanRepository) UnbanUser(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM banned_users WHERE telegram_id = ?;`, id)
+	if err != nil {
+		return false, fmt.Errorf("UnbanUser exec: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// IsBanned reports whether the Telegram user is banned
+func (r *BanRepository) IsBanned(ctx context.Context, id int64) (bool, error) {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM banned_users WHERE telegram_id = ?);`, id).Scan(&exists); err != nil {
+		return false, fmt.Errorf("IsBanned query: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// BlockRepository reads the blocks table: pairs of users.id values where the blocker
+// no longer wants to see the blocked profile
+type BlockRepository struct {
+	db *sql.DB
+}
+
+func NewBlockRepository(db *sql.DB) *BlockRepository {
+	return &BlockRepository{db: db}
+}
+
+// BlockedWith returns the users.id values hidden from userID: those it blocked and
+// those that blocked it
+func (r *BlockRepository) BlockedWith(ctx context.Context, userID string) (map[string]bool, error) {
+	const q = `
+		SELECT blocked_user_id FROM blocks WHERE blocker_user_id = ?
+		UNION
+		SELECT blocker_user_id FROM blocks WHERE blocked_user_id = ?;`
+	rows, err := r.db.QueryContext(ctx, q, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("BlockedWith query: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("BlockedWith scan: %w", err)
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
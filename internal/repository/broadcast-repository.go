@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// BroadcastRepository persists broadcast runs and the recipient list snapshotted when each run starts
+type BroadcastRepository struct {
+	db *sql.DB
+}
+
+func NewBroadcastRepository(db *sql.DB) *BroadcastRepository {
+	return &BroadcastRepository{db: db}
+}
+
+// CreateRun stores the run together with its recipients in the order they will be sent to.
+// run.ID is filled in on success.
+func (r *BroadcastRepository) CreateRun(ctx context.Context, run *domain.BroadcastRun, userIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateRun begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	payload, err := json.Marshal(run.Payload)
+	if err != nil {
+		return fmt.Errorf("CreateRun marshal payload: %w", err)
+	}
+	p := run.Payload
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO broadcast_runs (admin_id, audience, msg_type, file_id, caption, payload, total, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		run.AdminID, run.Audience, p.Type, p.FileID, p.Caption, string(payload), len(userIDs), domain.BroadcastRunning)
+	if err != nil {
+		return fmt.Errorf("CreateRun insert run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("CreateRun last id: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO broadcast_recipients (run_id, position, user_id) VALUES (?, ?, ?);`)
+	if err != nil {
+		return fmt.Errorf("CreateRun prepare: %w", err)
+	}
+	defer stmt.Close()
+	for i, uid := range userIDs {
+		if _, err := stmt.ExecContext(ctx, id, i, uid); err != nil {
+			return fmt.Errorf("CreateRun insert recipient: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("CreateRun commit: %w", err)
+	}
+	run.ID = id
+	run.Total = len(userIDs)
+	run.Status = domain.BroadcastRunning
+	return nil
+}
+
+// SaveProgress flushes the checkpoint of a running broadcast
+func (r *BroadcastRepository) SaveProgress(ctx context.Context, id int64, nextIndex, sent, failed int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE broadcast_runs
+		SET next_index = ?, sent = ?, failed = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?;`, nextIndex, sent, failed, id)
+	if err != nil {
+		return fmt.Errorf("SaveProgress exec: %w", err)
+	}
+	return nil
+}
+
+// FinishRun records the final counters and status; the recipient snapshot is no longer needed
+func (r *BroadcastRepository) FinishRun(ctx context.Context, id int64, status string, nextIndex, sent, failed int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("FinishRun begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE broadcast_runs
+		SET status = ?, next_index = ?, sent = ?, failed = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?;`, status, nextIndex, sent, failed, id); err != nil {
+		return fmt.Errorf("FinishRun update: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM broadcast_recipients WHERE run_id = ?;`, id); err != nil {
+		return fmt.Errorf("FinishRun delete recipients: %w", err)
+	}
+	return tx.Commit()
+}
+
+const broadcastRunColumns = `id, admin_id, audience, msg_type, file_id, caption, payload, total, next_index, sent, failed, status, created_at`
+
+func scanBroadcastRun(s interface{ Scan(...any) error }) (*domain.BroadcastRun, error) {
+	var run domain.BroadcastRun
+	var payload string
+	var createdAt sql.NullTime
+	p := &run.Payload
+	if err := s.Scan(&run.ID, &run.AdminID, &run.Audience, &p.Type, &p.FileID, &p.Caption, &payload,
+		&run.Total, &run.NextIndex, &run.Sent, &run.Failed, &run.Status, &createdAt); err != nil {
+		return nil, err
+	}
+	// runs created before the payload column only have the plain columns
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), p); err != nil {
+			return nil, fmt.Errorf("decode payload of run %d: %w", run.ID, err)
+		}
+	}
+	if createdAt.Valid {
+		run.CreatedAt = createdAt.Time
+	}
+	return &run, nil
+}
+
+// GetRun returns nil, nil when the run does not exist
+func (r *BroadcastRepository) GetRun(ctx context.Context, id int64) (*domain.BroadcastRun, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+broadcastRunColumns+` FROM broadcast_runs WHERE id = ?;`, id)
+	run, err := scanBroadcastRun(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetRun scan: %w", err)
+	}
+	return run, nil
+}
+
+// GetRunningRuns lists runs still marked running. Only one process sends broadcasts,
+// so at startup these are the ones that were interrupted.
+func (r *BroadcastRepository) GetRunningRuns(ctx context.Context) ([]*domain.BroadcastRun, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+broadcastRunColumns+` FROM broadcast_runs WHERE status = ? ORDER BY id;`, domain.BroadcastRunning)
+	if err != nil {
+		return nil, fmt.Errorf("GetRunningRuns query: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*domain.BroadcastRun
+	for rows.Next() {
+		run, err := scanBroadcastRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetRunningRuns scan: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetRunRecipients returns the snapshotted recipient list in send order
+func (r *BroadcastRepository) GetRunRecipients(ctx context.Context, id int64) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id FROM broadcast_recipients WHERE run_id = ? ORDER BY position;`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetRunRecipients query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("GetRunRecipients scan: %w", err)
+		}
+		ids = append(ids, uid)
+	}
+	return ids, rows.Err()
+}
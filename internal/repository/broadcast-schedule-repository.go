@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const scheduledBroadcastColumns = `id, admin_id, audience, msg_type, file_id, caption, payload, run_at, status, error`
+
+func scanScheduledBroadcast(s interface{ Scan(...any) error }) (*domain.ScheduledBroadcast, error) {
+	var sb domain.ScheduledBroadcast
+	var payload string
+	var runAt int64
+	p := &sb.Payload
+	if err := s.Scan(&sb.ID, &sb.AdminID, &sb.Audience, &p.Type, &p.FileID, &p.Caption, &payload, &runAt, &sb.Status, &sb.Error); err != nil {
+		return nil, err
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), p); err != nil {
+			return nil, fmt.Errorf("decode payload of scheduled broadcast %d: %w", sb.ID, err)
+		}
+	}
+	sb.RunAt = time.Unix(runAt, 0)
+	return &sb, nil
+}
+
+// CreateScheduled queues sb as pending and sets its ID
+func (r *BroadcastRepository) CreateScheduled(ctx context.Context, sb *domain.ScheduledBroadcast) error {
+	if sb.Payload.Type == "" || sb.Audience == "" {
+		return errors.New("CreateScheduled: empty message type or audience")
+	}
+	payload, err := json.Marshal(sb.Payload)
+	if err != nil {
+		return fmt.Errorf("CreateScheduled marshal payload: %w", err)
+	}
+	const q = `
+		INSERT INTO scheduled_broadcasts (admin_id, msg_type, file_id, caption, payload, audience, run_at, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := r.db.ExecContext(ctx, q, sb.AdminID, sb.Payload.Type, sb.Payload.FileID, sb.Payload.Caption,
+		string(payload), sb.Audience, sb.RunAt.Unix(), domain.ScheduledPending)
+	if err != nil {
+		return fmt.Errorf("CreateScheduled exec: %w", err)
+	}
+	sb.ID, _ = res.LastInsertId()
+	sb.Status = domain.ScheduledPending
+	return nil
+}
+
+// ListPendingScheduled returns the broadcasts still waiting for their time, soonest first
+func (r *BroadcastRepository) ListPendingScheduled(ctx context.Context) ([]*domain.ScheduledBroadcast, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+scheduledBroadcastColumns+` FROM scheduled_broadcasts WHERE status = ? ORDER BY run_at, id;`, domain.ScheduledPending)
+	if err != nil {
+		return nil, fmt.Errorf("ListPendingScheduled query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*domain.ScheduledBroadcast
+	for rows.Next() {
+		sb, err := scanScheduledBroadcast(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListPendingScheduled scan: %w", err)
+		}
+		res = append(res, sb)
+	}
+	return res, rows.Err()
+}
+
+// CancelScheduled cancels a pending broadcast; it reports false when there was
+// none or it has already started
+func (r *BroadcastRepository) CancelScheduled(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE scheduled_broadcasts SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?;`, domain.ScheduledCancelled, id, domain.ScheduledPending)
+	if err != nil {
+		return false, fmt.Errorf("CancelScheduled exec: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ClaimDueScheduled moves the pending broadcasts due at now to running and returns
+// them. The single UPDATE is what makes execution idempotent: a broadcast is
+// returned by exactly one claim, however many pollers run.
+func (r *BroadcastRepository) ClaimDueScheduled(ctx context.Context, now time.Time) ([]*domain.ScheduledBroadcast, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE scheduled_broadcasts SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND run_at <= ?
+		RETURNING `+scheduledBroadcastColumns+`;`, domain.ScheduledRunning, domain.ScheduledPending, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("ClaimDueScheduled query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*domain.ScheduledBroadcast
+	for rows.Next() {
+		sb, err := scanScheduledBroadcast(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ClaimDueScheduled scan: %w", err)
+		}
+		res = append(res, sb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING gives no order guarantee
+	sort.Slice(res, func(i, j int) bool { return res[i].RunAt.Before(res[j].RunAt) })
+	return res, nil
+}
+
+// FinishScheduled records how a claimed broadcast ended: ScheduledSent,
+// ScheduledCancelled or ScheduledFailed
+func (r *BroadcastRepository) FinishScheduled(ctx context.Context, id int64, status, errText string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE scheduled_broadcasts SET status = ?, error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?;`, status, errText, id)
+	if err != nil {
+		return fmt.Errorf("FinishScheduled exec: %w", err)
+	}
+	return nil
+}
+
+// FailStaleScheduled marks broadcasts left running by a previous process as failed.
+// They are not retried: the fan-out may already have started, and an interrupted
+// run is offered for resuming through broadcast_runs instead.
+func (r *BroadcastRepository) FailStaleScheduled(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE scheduled_broadcasts SET status = ?, error = 'interrupted by restart', updated_at = CURRENT_TIMESTAMP
+		WHERE status = ?;`, domain.ScheduledFailed, domain.ScheduledRunning)
+	if err != nil {
+		return 0, fmt.Errorf("FailStaleScheduled exec: %w", err)
+	}
+	return res.RowsAffected()
+}
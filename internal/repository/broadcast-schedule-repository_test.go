@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClaimDueScheduled(t *testing.T) {
+	r := NewBroadcastRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+
+	ids := map[string]int64{}
+	for name, runAt := range map[string]time.Time{
+		"past":   now.Add(-time.Hour),
+		"now":    now,
+		"future": now.Add(time.Second),
+	} {
+		sb := &domain.ScheduledBroadcast{AdminID: 1, Audience: "all", Payload: domain.BroadcastPayload{Type: "text", Caption: name}, RunAt: runAt}
+		if err := r.CreateScheduled(ctx, sb); err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = sb.ID
+	}
+	cancelled := &domain.ScheduledBroadcast{AdminID: 1, Audience: "all", Payload: domain.BroadcastPayload{Type: "text"}, RunAt: now.Add(-time.Hour)}
+	r.CreateScheduled(ctx, cancelled)
+	if ok, err := r.CancelScheduled(ctx, cancelled.ID); !ok || err != nil {
+		t.Fatalf("cancel: %v %v", ok, err)
+	}
+
+	due, err := r.ClaimDueScheduled(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].ID != ids["past"] || due[1].ID != ids["now"] {
+		t.Fatalf("claimed %v, want past then now", scheduledIDs(due))
+	}
+	if due[0].Status != domain.ScheduledRunning || due[0].Payload.Caption != "past" {
+		t.Errorf("claimed row = %+v", due[0])
+	}
+
+	// claimed rows are not handed out again
+	if again, _ := r.ClaimDueScheduled(ctx, now); len(again) != 0 {
+		t.Fatalf("second claim got %v", scheduledIDs(again))
+	}
+	if later, _ := r.ClaimDueScheduled(ctx, now.Add(time.Second)); len(later) != 1 || later[0].ID != ids["future"] {
+		t.Fatalf("later claim got %v", scheduledIDs(later))
+	}
+
+	// a restart fails what was left running
+	if n, err := r.FailStaleScheduled(ctx); err != nil || n != 3 {
+		t.Fatalf("FailStaleScheduled = %d, %v", n, err)
+	}
+	if pending, _ := r.ListPendingScheduled(ctx); len(pending) != 0 {
+		t.Errorf("still pending: %v", scheduledIDs(pending))
+	}
+}
+
+func TestClaimDueScheduledConcurrent(t *testing.T) {
+	r := NewBroadcastRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	const n = 20
+	for range n {
+		r.CreateScheduled(ctx, &domain.ScheduledBroadcast{AdminID: 1, Audience: "all", Payload: domain.BroadcastPayload{Type: "text"}, RunAt: now})
+	}
+
+	var mu sync.Mutex
+	seen := map[int64]int{}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			due, err := r.ClaimDueScheduled(ctx, now)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, sb := range due {
+				seen[sb.ID]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != n {
+		t.Fatalf("claimed %d broadcasts, want %d", len(seen), n)
+	}
+	for id, c := range seen {
+		if c != 1 {
+			t.Errorf("broadcast %d claimed %d times", id, c)
+		}
+	}
+}
+
+func scheduledIDs(sbs []*domain.ScheduledBroadcast) []int64 {
+	ids := make([]int64, 0, len(sbs))
+	for _, sb := range sbs {
+		ids = append(ids, sb.ID)
+	}
+	return ids
+}
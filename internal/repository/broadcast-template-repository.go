@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Templates keep msg_type, file_id and caption in plain columns like broadcast_runs;
+// payload holds the full message so location and contact templates round-trip.
+const broadcastTemplateColumns = `id, name, msg_type, file_id, caption, payload, created_by`
+
+func scanBroadcastTemplate(s interface{ Scan(...any) error }) (*domain.BroadcastTemplate, error) {
+	var t domain.BroadcastTemplate
+	var payload string
+	p := &t.Payload
+	if err := s.Scan(&t.ID, &t.Name, &p.Type, &p.FileID, &p.Caption, &payload, &t.CreatedBy); err != nil {
+		return nil, err
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), p); err != nil {
+			return nil, fmt.Errorf("decode payload of template %d: %w", t.ID, err)
+		}
+	}
+	return &t, nil
+}
+
+// SaveTemplate stores p under name, replacing a template with the same name, and returns its id
+func (r *BroadcastRepository) SaveTemplate(ctx context.Context, name string, p domain.BroadcastPayload, adminID int64) (int64, error) {
+	if name == "" || p.Type == "" {
+		return 0, errors.New("SaveTemplate: empty name or message type")
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return 0, fmt.Errorf("SaveTemplate marshal payload: %w", err)
+	}
+	const q = `
+		INSERT INTO broadcast_templates (name, msg_type, file_id, caption, payload, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			msg_type = excluded.msg_type, file_id = excluded.file_id, caption = excluded.caption,
+			payload = excluded.payload, created_by = excluded.created_by, updated_at = CURRENT_TIMESTAMP
+		RETURNING id;`
+	var id int64
+	if err := r.db.QueryRowContext(ctx, q, name, p.Type, p.FileID, p.Caption, string(payload), adminID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("SaveTemplate exec: %w", err)
+	}
+	return id, nil
+}
+
+// GetTemplate returns nil, nil when the template does not exist
+func (r *BroadcastRepository) GetTemplate(ctx context.Context, id int64) (*domain.BroadcastTemplate, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+broadcastTemplateColumns+` FROM broadcast_templates WHERE id = ?;`, id)
+	t, err := scanBroadcastTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetTemplate scan: %w", err)
+	}
+	return t, nil
+}
+
+// ListTemplates returns every template ordered by name
+func (r *BroadcastRepository) ListTemplates(ctx context.Context) ([]*domain.BroadcastTemplate, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+broadcastTemplateColumns+` FROM broadcast_templates ORDER BY name;`)
+	if err != nil {
+		return nil, fmt.Errorf("ListTemplates query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*domain.BroadcastTemplate
+	for rows.Next() {
+		t, err := scanBroadcastTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListTemplates scan: %w", err)
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// DeleteTemplate removes a template; it reports false when there was none
+func (r *BroadcastRepository) DeleteTemplate(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM broadcast_templates WHERE id = ?;`, id)
+	if err != nil {
+		return false, fmt.Errorf("DeleteTemplate exec: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetLastRun returns the admin's most recent broadcast, nil when there is none
+func (r *BroadcastRepository) GetLastRun(ctx context.Context, adminID int64) (*domain.BroadcastRun, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+broadcastRunColumns+` FROM broadcast_runs WHERE admin_id = ? ORDER BY id DESC LIMIT 1;`, adminID)
+	run, err := scanBroadcastRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetLastRun scan: %w", err)
+	}
+	return run, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBroadcastTemplates(t *testing.T) {
+	r := NewBroadcastRepository(newTestDB(t))
+	ctx := context.Background()
+	payloads := map[string]domain.BroadcastPayload{
+		"promo":  {Type: "photo", FileID: "AgACphoto", Caption: "Жаңа мүмкіндік!"},
+		"venue":  {Type: "venue", Latitude: 43.238, Longitude: 76.889, Title: "Cafe", Address: "Abay 1"},
+		"album":  {Type: "media_group", Items: []domain.BroadcastMediaItem{{Type: "photo", FileID: "a", Caption: "first"}, {Type: "video", FileID: "b"}}},
+		"dice":   {Type: "dice", Emoji: "🎯", Unprotected: true},
+		"notice": {Type: "text", Caption: "hello"},
+	}
+	ids := map[string]int64{}
+	for name, p := range payloads {
+		id, err := r.SaveTemplate(ctx, name, p, 1000)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ids[name] = id
+	}
+
+	for name, want := range payloads {
+		got, err := r.GetTemplate(ctx, ids[name])
+		if err != nil || got == nil {
+			t.Fatalf("%s: GetTemplate = %v, %v", name, got, err)
+		}
+		if got.Name != name || got.CreatedBy != 1000 || !reflect.DeepEqual(got.Payload, want) {
+			t.Errorf("%s: loaded %+v, want payload %+v", name, got, want)
+		}
+	}
+
+	// saving under an existing name replaces that template in place
+	replaced := domain.BroadcastPayload{Type: "video", FileID: "BAACvideo", Caption: "v2"}
+	id, err := r.SaveTemplate(ctx, "promo", replaced, 2000)
+	if err != nil || id != ids["promo"] {
+		t.Fatalf("re-save: id %d, %v; want %d", id, err, ids["promo"])
+	}
+	if got, _ := r.GetTemplate(ctx, id); got == nil || got.CreatedBy != 2000 || !reflect.DeepEqual(got.Payload, replaced) {
+		t.Errorf("after re-save: %+v", got)
+	}
+
+	list, err := r.ListTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tpl := range list {
+		names = append(names, tpl.Name)
+	}
+	if want := []string{"album", "dice", "notice", "promo", "venue"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListTemplates = %v, want %v", names, want)
+	}
+
+	if ok, err := r.DeleteTemplate(ctx, ids["dice"]); !ok || err != nil {
+		t.Fatalf("DeleteTemplate = %v, %v", ok, err)
+	}
+	if ok, _ := r.DeleteTemplate(ctx, ids["dice"]); ok {
+		t.Error("second DeleteTemplate reported a deletion")
+	}
+	if got, err := r.GetTemplate(ctx, ids["dice"]); got != nil || err != nil {
+		t.Errorf("deleted template: %+v, %v", got, err)
+	}
+	if _, err := r.SaveTemplate(ctx, "", payloads["notice"], 1000); err == nil {
+		t.Error("SaveTemplate accepted an empty name")
+	}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"aika/traits/database"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := database.InitDatabase(context.Background(), filepath.Join(t.TempDir(), "test.db"), database.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
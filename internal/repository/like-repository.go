@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type LikeRepository struct {
+	db *sql.DB
+}
+
+func NewLikeRepository(db *sql.DB) *LikeRepository {
+	return &LikeRepository{db: db}
+}
+
+// InsertLike saves a like from one user to another (users.id values).
+// Repeated likes for the same pair are ignored by the unique constraint.
+func (r *LikeRepository) InsertLike(ctx context.Context, from, to string) error {
+	if from == "" || to == "" {
+		return errors.New("InsertLike: empty user id")
+	}
+	const q = `INSERT OR IGNORE INTO likes (from_user_id, to_user_id) VALUES (?, ?);`
+	if _, err := r.db.ExecContext(ctx, q, from, to); err != nil {
+		return fmt.Errorf("InsertLike exec: %w", err)
+	}
+	return nil
+}
+
+// GetReceivedLikes returns profiles that liked userID, newest first.
+// Mutual is set when userID liked them back.
+func (r *LikeRepository) GetReceivedLikes(ctx context.Context, userID string) ([]domain.ReceivedLike, error) {
+	const q = `
+		SELECT u.id, u.user_id, u.nickname, u.sex, u.age, u.latitude, u.longitude,
+		       COALESCE(u.about_user, ''), COALESCE(u.avatar_path, ''), u.avatar_width, u.avatar_height, u.hide_age, u.hide_about, u.hide_distance, u.created_at, u.updated_at,
+		       l.created_at,
+		       EXISTS(SELECT 1 FROM likes b WHERE b.from_user_id = l.to_user_id AND b.to_user_id = l.from_user_id)
+		FROM likes l
+		JOIN users u ON u.id = l.from_user_id
+		WHERE l.to_user_id = ?
+		ORDER BY l.created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetReceivedLikes query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []domain.ReceivedLike
+	for rows.Next() {
+		var l domain.ReceivedLike
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&l.User.Id, &l.User.TelegramId, &l.User.Nickname, &l.User.Sex, &l.User.Age, &lat, &lon,
+			&l.User.AboutUser, &l.User.AvatarPath, &l.User.AvatarWidth, &l.User.AvatarHeight, &l.User.HideAge, &l.User.HideAbout, &l.User.HideDistance, &l.User.CreatedAt, &l.User.UpdatedAt, &l.LikedAt, &l.Mutual); err != nil {
+			return nil, fmt.Errorf("GetReceivedLikes scan: %w", err)
+		}
+		if lat.Valid {
+			l.User.Latitude = &lat.Float64
+		}
+		if lon.Valid {
+			l.User.Longitude = &lon.Float64
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+// HasLike reports whether `from` has liked `to`
+func (r *LikeRepository) HasLike(ctx context.Context, from, to string) (bool, error) {
+	const q = `SELECT EXISTS(SELECT 1 FROM likes WHERE from_user_id = ? AND to_user_id = ?);`
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, q, from, to).Scan(&exists); err != nil {
+		return false, fmt.Errorf("HasLike query: %w", err)
+	}
+	return exists, nil
+}
+
+// CountLikes returns the total number of likes and of mutual pairs
+func (r *LikeRepository) CountLikes(ctx context.Context) (likes, matches int, err error) {
+	const q = `
+		SELECT COUNT(1),
+		       (SELECT COUNT(1) FROM likes a JOIN likes b
+		          ON a.from_user_id = b.to_user_id AND a.to_user_id = b.from_user_id
+		        WHERE a.from_user_id < a.to_user_id)
+		FROM likes;`
+	err = r.db.QueryRowContext(ctx, q).Scan(&likes, &matches)
+	return likes, matches, err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"testing"
+)
+
+// createTestUser registers a profile and returns its users.id
+func createTestUser(t *testing.T, r *UserRepository, tgID int64, nickname string) string {
+	t.Helper()
+	id, err := r.CreateUser(context.Background(), &domain.User{TelegramId: tgID, Nickname: nickname, Sex: "female", Age: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestInsertLikeIsIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	users, likes := NewUserRepository(db), NewLikeRepository(db)
+	ctx := context.Background()
+	alice := createTestUser(t, users, 1, "alice")
+	bob := createTestUser(t, users, 2, "bob")
+
+	for i := 0; i < 3; i++ {
+		if err := likes.InsertLike(ctx, alice, bob); err != nil {
+			t.Fatalf("like #%d: %v", i+1, err)
+		}
+	}
+	total, matches, err := likes.CountLikes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || matches != 0 {
+		t.Fatalf("likes=%d matches=%d, want 1 and 0", total, matches)
+	}
+	got, err := likes.GetReceivedLikes(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].User.Id != alice || got[0].Mutual {
+		t.Fatalf("bob received %+v, want one one-way like from alice", got)
+	}
+	if err := likes.InsertLike(ctx, "", bob); err == nil {
+		t.Fatal("empty from id accepted")
+	}
+}
+
+func TestReceivedLikesMutual(t *testing.T) {
+	db := newTestDB(t)
+	users, likes := NewUserRepository(db), NewLikeRepository(db)
+	ctx := context.Background()
+	alice := createTestUser(t, users, 1, "alice")
+	bob := createTestUser(t, users, 2, "bob")
+	carol := createTestUser(t, users, 3, "carol")
+
+	for _, l := range [][2]string{{alice, bob}, {bob, alice}, {carol, bob}} {
+		if err := likes.InsertLike(ctx, l[0], l[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := likes.GetReceivedLikes(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutual := map[string]bool{}
+	for _, l := range got {
+		mutual[l.User.Nickname] = l.Mutual
+	}
+	if len(got) != 2 || !mutual["alice"] || mutual["carol"] {
+		t.Fatalf("bob received %v, want alice mutual and carol one-way", mutual)
+	}
+
+	got, err = likes.GetReceivedLikes(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Mutual {
+		t.Fatalf("alice received %+v, want bob mutual", got)
+	}
+
+	if _, matches, _ := likes.CountLikes(ctx); matches != 1 {
+		t.Fatalf("matches = %d, want 1", matches)
+	}
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{{alice, bob, true}, {bob, carol, false}} {
+		if ok, err := likes.HasLike(ctx, tc.from, tc.to); err != nil || ok != tc.want {
+			t.Errorf("HasLike(%s, %s) = %v, %v", tc.from, tc.to, ok, err)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryEvictInterval is how often a write also sweeps out expired keys
+const memoryEvictInterval = time.Minute
+
+type memoryValue struct {
+	value any
+	// expires is zero for keys without a TTL
+	expires time.Time
+}
+
+// MemoryStore is the StateStore kept in process memory, with the same keys and TTLs
+// as the Redis one. Expired keys are dropped on read and swept out periodically.
+// It records which user states and partner mappings changed, so FailoverStore can
+// copy them to Redis once it is back.
+type MemoryStore struct {
+	mu        sync.Mutex
+	values    map[string]memoryValue
+	waiting   map[int64]struct{}
+	chats     map[[2]int64]time.Time
+	lastEvict time.Time
+
+	// changes since the last drain; a nil state is a deletion
+	changedStates   map[int64]*domain.UserState
+	changedPartners map[int64]int64
+	// unpaired maps the users whose pairing ended since the last drain to the
+	// partner they were paired with
+	unpaired map[int64]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{}
+	m.reset()
+	return m
+}
+
+func (m *MemoryStore) reset() {
+	m.values = make(map[string]memoryValue)
+	m.waiting = make(map[int64]struct{})
+	m.chats = make(map[[2]int64]time.Time)
+	m.changedStates = make(map[int64]*domain.UserState)
+	m.changedPartners = make(map[int64]int64)
+	m.unpaired = make(map[int64]int64)
+}
+
+// memoryChanges is what changed in a MemoryStore while it stood in for Redis
+type memoryChanges struct {
+	states   map[int64]*domain.UserState
+	partners map[int64]int64
+	// partnerTTLs is what is left of the TTL of each mapping in partners
+	partnerTTLs map[int64]time.Duration
+	// unpaired maps each user whose pairing ended to their former partner
+	unpaired map[int64]int64
+	waiting  []int64
+	chats    map[[2]int64]time.Time
+}
+
+// drain returns the changes since the last drain and empties the store
+func (m *MemoryStore) drain() memoryChanges {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := memoryChanges{states: m.changedStates, partners: m.changedPartners, unpaired: m.unpaired, chats: m.chats}
+	c.partnerTTLs = make(map[int64]time.Duration, len(c.partners))
+	for userID, partnerID := range c.partners {
+		if _, ok := m.get(partnerKey(userID)); !ok {
+			// expired while Redis was away
+			delete(c.partners, userID)
+			c.unpaired[userID] = partnerID
+			continue
+		}
+		c.partnerTTLs[userID] = m.ttlLocked(partnerKey(userID))
+	}
+	for id := range m.waiting {
+		c.waiting = append(c.waiting, id)
+	}
+	m.reset()
+	return c
+}
+
+// get returns the live value of key; the caller holds mu
+func (m *MemoryStore) get(key string) (any, bool) {
+	v, ok := m.values[key]
+	if !ok {
+		return nil, false
+	}
+	if !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		delete(m.values, key)
+		return nil, false
+	}
+	return v.value, true
+}
+
+// set stores key with ttl, 0 meaning no expiry; the caller holds mu
+func (m *MemoryStore) set(key string, value any, ttl time.Duration) {
+	v := memoryValue{value: value}
+	if ttl > 0 {
+		v.expires = time.Now().Add(ttl)
+	}
+	m.values[key] = v
+	if time.Since(m.lastEvict) > memoryEvictInterval {
+		m.evictExpiredLocked()
+	}
+}
+
+func (m *MemoryStore) evictExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictExpiredLocked()
+}
+
+func (m *MemoryStore) evictExpiredLocked() {
+	now := time.Now()
+	for key, v := range m.values {
+		if !v.expires.IsZero() && !now.Before(v.expires) {
+			delete(m.values, key)
+		}
+	}
+	m.lastEvict = now
+}
+
+func (m *MemoryStore) ttlLocked(key string) time.Duration {
+	if _, ok := m.get(key); !ok {
+		return 0
+	}
+	if exp := m.values[key].expires; !exp.IsZero() {
+		return time.Until(exp)
+	}
+	return 0
+}
+
+func (m *MemoryStore) HitOnce(ctx context.Context, key string, ttl time.Duration) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, m.ttlLocked(key), nil
+	}
+	m.set(key, "1", ttl)
+	return true, 0, nil
+}
+
+func (m *MemoryStore) HitCount(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.get(key)
+	if !ok {
+		m.set(key, int64(1), ttl)
+		return 1, ttl, nil
+	}
+	count := v.(int64) + 1
+	entry := m.values[key]
+	entry.value = count
+	m.values[key] = entry
+	return count, m.ttlLocked(key), nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ttlLocked(key), nil
+}
+
+// getState returns a copy, as the Redis store hands out a fresh decode every time
+func (m *MemoryStore) getState(key string) *domain.UserState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.get(key)
+	if !ok {
+		return nil
+	}
+	state := *v.(*domain.UserState)
+	return &state
+}
+
+func (m *MemoryStore) SaveUserState(ctx context.Context, userID int64, state *domain.UserState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *state
+	m.set(fmt.Sprintf("user_state:%d", userID), &copied, 24*time.Hour)
+	m.changedStates[userID] = &copied
+	return nil
+}
+
+func (m *MemoryStore) GetUserState(ctx context.Context, userID int64) (*domain.UserState, error) {
+	return m.getState(fmt.Sprintf("user_state:%d", userID)), nil
+}
+
+func (m *MemoryStore) DeleteUserState(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, fmt.Sprintf("user_state:%d", userID))
+	m.changedStates[userID] = nil
+	return nil
+}
+
+func (m *MemoryStore) SaveAdminState(ctx context.Context, adminID int64, state *domain.UserState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *state
+	m.set(fmt.Sprintf("admin_state:%d", adminID), &copied, 24*time.Hour)
+	return nil
+}
+
+func (m *MemoryStore) GetAdminState(ctx context.Context, adminID int64) (*domain.UserState, error) {
+	return m.getState(fmt.Sprintf("admin_state:%d", adminID)), nil
+}
+
+func (m *MemoryStore) DeleteAdminState(ctx context.Context, adminID int64) error {
+	return m.Release(ctx, fmt.Sprintf("admin_state:%d", adminID))
+}
+
+func (m *MemoryStore) SaveBroadcastState(ctx context.Context, adminID int64, broadcastType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(fmt.Sprintf("broadcast_state:%d", adminID), broadcastType, time.Hour)
+	return nil
+}
+
+func (m *MemoryStore) GetBroadcastState(ctx context.Context, adminID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(fmt.Sprintf("broadcast_state:%d", adminID))
+	s, _ := v.(string)
+	return s, nil
+}
+
+func (m *MemoryStore) DeleteBroadcastState(ctx context.Context, adminID int64) error {
+	return m.Release(ctx, fmt.Sprintf("broadcast_state:%d", adminID))
+}
+
+func (m *MemoryStore) ClearAllUserStates(ctx context.Context, userID int64) error {
+	m.DeleteUserState(ctx, userID)
+	m.DeleteAdminState(ctx, userID)
+	return m.DeleteBroadcastState(ctx, userID)
+}
+
+func (m *MemoryStore) SetBroadcastCancel(ctx context.Context, adminID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(broadcastCancelKey(adminID), "1", time.Hour)
+	return nil
+}
+
+func (m *MemoryStore) IsBroadcastCancelled(ctx context.Context, adminID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.get(broadcastCancelKey(adminID))
+	return ok, nil
+}
+
+func (m *MemoryStore) ClearBroadcastCancel(ctx context.Context, adminID int64) error {
+	return m.Release(ctx, broadcastCancelKey(adminID))
+}
+
+func (m *MemoryStore) SaveBroadcastCheckpoint(ctx context.Context, runID int64, nextIndex, sent, failed int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(broadcastCheckpointKey(runID), [3]int{nextIndex, sent, failed}, 7*24*time.Hour)
+	return nil
+}
+
+func (m *MemoryStore) GetBroadcastCheckpoint(ctx context.Context, runID int64) (nextIndex, sent, failed int, ok bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.get(broadcastCheckpointKey(runID))
+	if !ok {
+		return 0, 0, 0, false, nil
+	}
+	cp := v.([3]int)
+	return cp[0], cp[1], cp[2], true, nil
+}
+
+func (m *MemoryStore) DeleteBroadcastCheckpoint(ctx context.Context, runID int64) error {
+	return m.Release(ctx, broadcastCheckpointKey(runID))
+}
+
+func (m *MemoryStore) SaveBroadcastReport(ctx context.Context, adminID int64, path string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(broadcastReportKey(adminID), path, ttl)
+	return nil
+}
+
+func (m *MemoryStore) GetBroadcastReport(ctx context.Context, adminID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(broadcastReportKey(adminID))
+	path, _ := v.(string)
+	return path, nil
+}
+
+func (m *MemoryStore) SaveRelayedMessage(ctx context.Context, token string, msg *domain.RelayedMessage, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *msg
+	m.set(relayedMessageKey(token), &copied, ttl)
+	return nil
+}
+
+func (m *MemoryStore) GetRelayedMessage(ctx context.Context, token string) (*domain.RelayedMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(relayedMessageKey(token))
+	msg, _ := v.(*domain.RelayedMessage)
+	return msg, nil
+}
+
+func (m *MemoryStore) DeleteRelayedMessage(ctx context.Context, token string) error {
+	return m.Release(ctx, relayedMessageKey(token))
+}
+
+func (m *MemoryStore) AddMediaGroupPart(ctx context.Context, group string, part []byte, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(mediaGroupKey(group))
+	parts, _ := v.([][]byte)
+	parts = append(parts, append([]byte(nil), part...))
+	m.set(mediaGroupKey(group), parts, ttl)
+	return int64(len(parts)), nil
+}
+
+func (m *MemoryStore) TakeMediaGroup(ctx context.Context, group string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(mediaGroupKey(group))
+	delete(m.values, mediaGroupKey(group))
+	parts, _ := v.([][]byte)
+	return parts, nil
+}
+
+func (m *MemoryStore) SaveFeaturedProfiles(ctx context.Context, payload []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(featuredKey, payload, ttl)
+	return nil
+}
+
+func (m *MemoryStore) GetFeaturedProfiles(ctx context.Context) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(featuredKey)
+	payload, _ := v.([]byte)
+	return payload, nil
+}
+
+func (m *MemoryStore) SetBanCache(ctx context.Context, userID int64, banned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(banKey(userID), banned, banCacheTTL)
+	return nil
+}
+
+func (m *MemoryStore) GetBanCache(ctx context.Context, userID int64) (bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.get(banKey(userID))
+	if !ok {
+		return false, false, nil
+	}
+	return v.(bool), true, nil
+}
+
+func (m *MemoryStore) SetLastSeen(ctx context.Context, userID int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(lastSeenKey(userID), time.Unix(at.Unix(), 0), lastSeenTTL)
+	return nil
+}
+
+func (m *MemoryStore) GetLastSeen(ctx context.Context, userID int64) (time.Time, bool, error) {
+	seen, _ := m.GetLastSeenMany(ctx, []int64{userID})
+	at, ok := seen[userID]
+	return at, ok, nil
+}
+
+func (m *MemoryStore) GetLastSeenMany(ctx context.Context, userIDs []int64) (map[int64]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[int64]time.Time, len(userIDs))
+	for _, id := range userIDs {
+		if v, ok := m.get(lastSeenKey(id)); ok {
+			seen[id] = v.(time.Time)
+		}
+	}
+	return seen, nil
+}
+
+func (m *MemoryStore) AddUser(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waiting[userID] = struct{}{}
+	return nil
+}
+
+func (m *MemoryStore) FindPartner(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.waiting {
+		if id != userID {
+			delete(m.waiting, id)
+			return id, nil
+		}
+	}
+	return 0, nil
+}
+
+func partnerKey(userID int64) string {
+	return fmt.Sprintf("chat:partner:%d", userID)
+}
+
+func (m *MemoryStore) SetPartner(ctx context.Context, userID, partnerID int64, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(partnerKey(userID), partnerID, ttl)
+	m.changedPartners[userID] = partnerID
+	delete(m.unpaired, userID)
+	return nil
+}
+
+func (m *MemoryStore) RefreshPartner(ctx context.Context, userID int64, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.get(partnerKey(userID)); ok {
+		m.set(partnerKey(userID), v, ttl)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetUserPartner(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(partnerKey(userID))
+	partnerID, _ := v.(int64)
+	return partnerID, nil
+}
+
+func (m *MemoryStore) CheckPartnerToEmpty(ctx context.Context, userID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.get(partnerKey(userID))
+	return ok, nil
+}
+
+func (m *MemoryStore) RemoveUser(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.get(partnerKey(userID))
+	partnerID, _ := v.(int64)
+	delete(m.waiting, userID)
+	delete(m.values, partnerKey(userID))
+	if partnerID == 0 {
+		return 0, nil
+	}
+	m.unpair(userID, partnerID)
+	delete(m.chats, memoryChatPair(userID, partnerID))
+	v, _ = m.get(partnerKey(partnerID))
+	switch back, _ := v.(int64); back {
+	case userID:
+		delete(m.waiting, partnerID)
+		delete(m.values, partnerKey(partnerID))
+		m.unpair(partnerID, userID)
+	case 0:
+	default:
+		return 0, nil
+	}
+	return partnerID, nil
+}
+
+// unpair records that userID's pairing with partnerID ended; the caller holds mu
+func (m *MemoryStore) unpair(userID, partnerID int64) {
+	delete(m.changedPartners, userID)
+	m.unpaired[userID] = partnerID
+}
+
+func (m *MemoryStore) GetUsers(ctx context.Context) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var userIDs []int64
+	for id := range m.waiting {
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, nil
+}
+
+func (m *MemoryStore) CountWaitingUsers(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.waiting)), nil
+}
+
+// memoryChatPair orders a pair like chatPairMember does
+func memoryChatPair(a, b int64) [2]int64 {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int64{a, b}
+}
+
+func (m *MemoryStore) TouchChat(ctx context.Context, a, b int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chats[memoryChatPair(a, b)] = at
+	return nil
+}
+
+// CountActiveChats returns how many pairs are in the activity index
+func (m *MemoryStore) CountActiveChats(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.chats)), nil
+}
+
+func (m *MemoryStore) IdleChats(ctx context.Context, cutoff time.Time) ([][2]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pairs [][2]int64
+	for pair, at := range m.chats {
+		if !at.After(cutoff) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+func (m *MemoryStore) ForgetChat(ctx context.Context, a, b int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chats, memoryChatPair(a, b))
+	return nil
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
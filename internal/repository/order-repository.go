@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// OrderRepository stores the orders placed through the /order flow
+type OrderRepository struct {
+	db *sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+// CreateOrder stores o as a new order and sets its ID
+func (r *OrderRepository) CreateOrder(ctx context.Context, o *domain.Order) error {
+	const q = `
+		INSERT INTO orders (user_id, count, amount, contact, receipt_type, receipt_file_id, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	res, err := r.db.ExecContext(ctx, q, o.UserID, o.Count, o.Amount, o.Contact, o.ReceiptType, o.ReceiptFileID, domain.OrderNew)
+	if err != nil {
+		return fmt.Errorf("CreateOrder exec: %w", err)
+	}
+	o.ID, _ = res.LastInsertId()
+	o.Status = domain.OrderNew
+	return nil
+}
+
+// CountOrders returns the number of orders and the sum of their amounts
+func (r *OrderRepository) CountOrders(ctx context.Context) (count, amount int, err error) {
+	const q = `SELECT COUNT(1), COALESCE(SUM(amount), 0) FROM orders;`
+	err = r.db.QueryRowContext(ctx, q).Scan(&count, &amount)
+	return count, amount, err
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -41,6 +42,31 @@ func (r *ChatRepository) HitOnce(ctx context.Context, key string, ttl time.Durat
 	return false, ttlLeft, nil
 }
 
+// HitCount counts a hit in a fixed window of length ttl that starts with the first hit.
+// It returns the count including this hit and how long the window still runs.
+func (r *ChatRepository) HitCount(ctx context.Context, key string, ttl time.Duration) (count int64, ttlLeft time.Duration, err error) {
+	count, err = r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	if count == 1 {
+		if err := r.client.Expire(ctx, key, ttl).Err(); err != nil {
+			return 0, 0, err
+		}
+		return count, ttl, nil
+	}
+	ttlLeft, err = r.TTL(ctx, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, ttlLeft, nil
+}
+
+// Release deletes a key taken with HitOnce before its TTL runs out.
+func (r *ChatRepository) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
 // TTL returns remaining TTL (0 if none/expired).
 func (r *ChatRepository) TTL(ctx context.Context, key string) (time.Duration, error) {
 	d, err := r.client.TTL(ctx, key).Result()
@@ -191,6 +217,219 @@ func (r *ChatRepository) DeleteBroadcastState(ctx context.Context, adminID int64
 	return nil
 }
 
+// Broadcast cancellation flag, checked by the sender between batches
+func broadcastCancelKey(adminID int64) string {
+	return fmt.Sprintf("broadcast:cancel:%d", adminID)
+}
+
+func (r *ChatRepository) SetBroadcastCancel(ctx context.Context, adminID int64) error {
+	if err := r.client.Set(ctx, broadcastCancelKey(adminID), 1, time.Hour).Err(); err != nil {
+		return fmt.Errorf("failed to set broadcast cancel flag: %w", err)
+	}
+	return nil
+}
+
+func (r *ChatRepository) IsBroadcastCancelled(ctx context.Context, adminID int64) (bool, error) {
+	n, err := r.client.Exists(ctx, broadcastCancelKey(adminID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read broadcast cancel flag: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *ChatRepository) ClearBroadcastCancel(ctx context.Context, adminID int64) error {
+	if err := r.client.Del(ctx, broadcastCancelKey(adminID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear broadcast cancel flag: %w", err)
+	}
+	return nil
+}
+
+// Broadcast checkpoints: the latest progress of a run, written more often than SQLite
+func broadcastCheckpointKey(runID int64) string {
+	return fmt.Sprintf("broadcast:checkpoint:%d", runID)
+}
+
+func (r *ChatRepository) SaveBroadcastCheckpoint(ctx context.Context, runID int64, nextIndex, sent, failed int) error {
+	key := broadcastCheckpointKey(runID)
+	if err := r.client.HSet(ctx, key, "next_index", nextIndex, "sent", sent, "failed", failed).Err(); err != nil {
+		return fmt.Errorf("failed to save broadcast checkpoint: %w", err)
+	}
+	r.client.Expire(ctx, key, 7*24*time.Hour)
+	return nil
+}
+
+// GetBroadcastCheckpoint returns ok=false when no checkpoint was written for the run
+func (r *ChatRepository) GetBroadcastCheckpoint(ctx context.Context, runID int64) (nextIndex, sent, failed int, ok bool, err error) {
+	vals, err := r.client.HGetAll(ctx, broadcastCheckpointKey(runID)).Result()
+	if err != nil {
+		return 0, 0, 0, false, fmt.Errorf("failed to get broadcast checkpoint: %w", err)
+	}
+	if len(vals) == 0 {
+		return 0, 0, 0, false, nil
+	}
+	nextIndex, _ = strconv.Atoi(vals["next_index"])
+	sent, _ = strconv.Atoi(vals["sent"])
+	failed, _ = strconv.Atoi(vals["failed"])
+	return nextIndex, sent, failed, true, nil
+}
+
+func (r *ChatRepository) DeleteBroadcastCheckpoint(ctx context.Context, runID int64) error {
+	if err := r.client.Del(ctx, broadcastCheckpointKey(runID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete broadcast checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Last broadcast report: path of the xlsx so the admin can ask for it again
+func broadcastReportKey(adminID int64) string {
+	return fmt.Sprintf("broadcast:report:%d", adminID)
+}
+
+func (r *ChatRepository) SaveBroadcastReport(ctx context.Context, adminID int64, path string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, broadcastReportKey(adminID), path, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save broadcast report path: %w", err)
+	}
+	return nil
+}
+
+// GetBroadcastReport returns "" when there is no report
+func (r *ChatRepository) GetBroadcastReport(ctx context.Context, adminID int64) (string, error) {
+	path, err := r.client.Get(ctx, broadcastReportKey(adminID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get broadcast report path: %w", err)
+	}
+	return path, nil
+}
+
+// Relayed chat messages, looked up by the token in their delete button
+func relayedMessageKey(token string) string {
+	return "chat:relayed:" + token
+}
+
+func (r *ChatRepository) SaveRelayedMessage(ctx context.Context, token string, m *domain.RelayedMessage, ttl time.Duration) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal relayed message: %w", err)
+	}
+	if err := r.client.Set(ctx, relayedMessageKey(token), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save relayed message: %w", err)
+	}
+	return nil
+}
+
+// GetRelayedMessage returns nil when the token is unknown or expired
+func (r *ChatRepository) GetRelayedMessage(ctx context.Context, token string) (*domain.RelayedMessage, error) {
+	data, err := r.client.Get(ctx, relayedMessageKey(token)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relayed message: %w", err)
+	}
+	var m domain.RelayedMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal relayed message: %w", err)
+	}
+	return &m, nil
+}
+
+func (r *ChatRepository) DeleteRelayedMessage(ctx context.Context, token string) error {
+	if err := r.client.Del(ctx, relayedMessageKey(token)).Err(); err != nil {
+		return fmt.Errorf("failed to delete relayed message: %w", err)
+	}
+	return nil
+}
+
+// Album parts waiting to be relayed together, a list of JSON messages per media group
+func mediaGroupKey(group string) string {
+	return "chat:album:" + group
+}
+
+// AddMediaGroupPart appends one album part and returns how many parts the group
+// holds; the group expires ttl after its latest part
+func (r *ChatRepository) AddMediaGroupPart(ctx context.Context, group string, part []byte, ttl time.Duration) (int64, error) {
+	key := mediaGroupKey(group)
+	pipe := r.client.TxPipeline()
+	n := pipe.RPush(ctx, key, part)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to add media group part: %w", err)
+	}
+	return n.Val(), nil
+}
+
+// TakeMediaGroup returns the parts of a group in arrival order and removes them in
+// the same transaction, so with several instances only one of them gets the album
+func (r *ChatRepository) TakeMediaGroup(ctx context.Context, group string) ([][]byte, error) {
+	key := mediaGroupKey(group)
+	pipe := r.client.TxPipeline()
+	parts := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to take media group: %w", err)
+	}
+	out := make([][]byte, 0, len(parts.Val()))
+	for _, p := range parts.Val() {
+		out = append(out, []byte(p))
+	}
+	return out, nil
+}
+
+// Featured profiles cache
+const featuredKey = "featured:profiles"
+
+func (r *ChatRepository) SaveFeaturedProfiles(ctx context.Context, payload []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, featuredKey, payload, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save featured profiles to redis: %w", err)
+	}
+	return nil
+}
+
+func (r *ChatRepository) GetFeaturedProfiles(ctx context.Context) ([]byte, error) {
+	data, err := r.client.Get(ctx, featuredKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil // Key doesn't exist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get featured profiles from redis: %w", err)
+	}
+	return data, nil
+}
+
+// banCacheTTL bounds how long a cached ban status can lag behind banned_users
+const banCacheTTL = 10 * time.Minute
+
+func banKey(userID int64) string {
+	return fmt.Sprintf("ban:%d", userID)
+}
+
+// SetBanCache caches whether the user is banned
+func (r *ChatRepository) SetBanCache(ctx context.Context, userID int64, banned bool) error {
+	v := "0"
+	if banned {
+		v = "1"
+	}
+	if err := r.client.Set(ctx, banKey(userID), v, banCacheTTL).Err(); err != nil {
+		return fmt.Errorf("failed to cache ban status: %w", err)
+	}
+	return nil
+}
+
+// GetBanCache returns the cached ban status; ok is false when nothing is cached
+func (r *ChatRepository) GetBanCache(ctx context.Context, userID int64) (banned, ok bool, err error) {
+	v, err := r.client.Get(ctx, banKey(userID)).Result()
+	if err == redis.Nil {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get ban status: %w", err)
+	}
+	return v == "1", true, nil
+}
+
 // Helper method to clear all states for a user (useful for cleanup)
 func (r *ChatRepository) ClearAllUserStates(ctx context.Context, userID int64) error {
 	keys := []string{
@@ -207,53 +446,129 @@ func (r *ChatRepository) ClearAllUserStates(ctx context.Context, userID int64) e
 	return nil
 }
 
-// Health check method
-func (r *ChatRepository) Ping(ctx context.Context) error {
-	return r.client.Ping(ctx).Err()
+// lastSeenTTL keeps last_seen keys around long enough to show "seen N days ago"
+const lastSeenTTL = 30 * 24 * time.Hour
+
+func lastSeenKey(userID int64) string {
+	return fmt.Sprintf("last_seen:%d", userID)
 }
 
-func (r *ChatRepository) AddUser(ctx context.Context, userID int64) error {
-	key := "chat:users"
-	isMember, err := r.client.SIsMember(ctx, key, userID).Result()
+// SetLastSeen stores the time of the user's latest interaction with the bot
+func (r *ChatRepository) SetLastSeen(ctx context.Context, userID int64, at time.Time) error {
+	if err := r.client.Set(ctx, lastSeenKey(userID), at.Unix(), lastSeenTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set last seen: %w", err)
+	}
+	return nil
+}
+
+// GetLastSeen returns the user's latest interaction; ok is false when none is recorded
+func (r *ChatRepository) GetLastSeen(ctx context.Context, userID int64) (at time.Time, ok bool, err error) {
+	seen, err := r.GetLastSeenMany(ctx, []int64{userID})
 	if err != nil {
-		return fmt.Errorf("failed to check user membership: %w", err)
+		return time.Time{}, false, err
 	}
+	at, ok = seen[userID]
+	return at, ok, nil
+}
 
-	if !isMember {
-		if err := r.client.SAdd(ctx, key, userID).Err(); err != nil {
-			return fmt.Errorf("failed to add user to set: %w", err)
+// GetLastSeenMany looks up several users in one MGET; users never seen are left out
+func (r *ChatRepository) GetLastSeenMany(ctx context.Context, userIDs []int64) (map[int64]time.Time, error) {
+	seen := make(map[int64]time.Time, len(userIDs))
+	if len(userIDs) == 0 {
+		return seen, nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = lastSeenKey(id)
+	}
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last seen: %w", err)
+	}
+	for i, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if ts, err := strconv.ParseInt(str, 10, 64); err == nil {
+			seen[userIDs[i]] = time.Unix(ts, 0)
 		}
 	}
+	return seen, nil
+}
+
+// Health check method
+func (r *ChatRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
 
+// waitingUsersKey is the set of users waiting for a chat partner
+const waitingUsersKey = "chat:users"
+
+const (
+	// waitingScanBatch is the SSCAN COUNT hint used to walk the waiting set
+	waitingScanBatch = 100
+	// findPartnerAttempts bounds the retries when other users grab the same candidate
+	findPartnerAttempts = 5
+)
+
+func (r *ChatRepository) AddUser(ctx context.Context, userID int64) error {
+	// SADD is a no-op for members already in the set
+	if err := r.client.SAdd(ctx, waitingUsersKey, userID).Err(); err != nil {
+		return fmt.Errorf("failed to add user to set: %w", err)
+	}
 	return nil
 }
 
+// FindPartner takes a random waiting user other than userID out of the waiting set.
+// Two random members are drawn so the caller's own ID can be skipped, and the SREM
+// result decides who gets a candidate two callers drew at the same time.
 func (r *ChatRepository) FindPartner(ctx context.Context, userID int64) (int64, error) {
-	key := "chat:users"
-	users, err := r.client.SMembers(ctx, key).Result()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get users from set: %w", err)
-	}
-	for _, user := range users {
-		partnerID := user
-		if partnerID != fmt.Sprintf("%d", userID) {
-			if err := r.client.SRem(ctx, key, partnerID).Err(); err != nil {
-				return 0, fmt.Errorf("failed to remove partner from set: %w", err)
+	self := strconv.FormatInt(userID, 10)
+	for range findPartnerAttempts {
+		users, err := r.client.SRandMemberN(ctx, waitingUsersKey, 2).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get users from set: %w", err)
+		}
+		candidate := ""
+		for _, user := range users {
+			if user != self {
+				candidate = user
+				break
 			}
-			return parseInt64(partnerID), nil
+		}
+		if candidate == "" {
+			return 0, nil
+		}
+		removed, err := r.client.SRem(ctx, waitingUsersKey, candidate).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove partner from set: %w", err)
+		}
+		if removed == 1 {
+			return parseInt64(candidate), nil
 		}
 	}
 	return 0, nil
 }
 
-func (r *ChatRepository) SetPartner(ctx context.Context, userID, partnerID int64) error {
+// SetPartner maps userID to partnerID for ttl (0 keeps it until removed), so pairs
+// whose users silently disappear don't stay busy forever
+func (r *ChatRepository) SetPartner(ctx context.Context, userID, partnerID int64, ttl time.Duration) error {
 	key := fmt.Sprintf("chat:partner:%d", userID)
-	if err := r.client.Set(ctx, key, partnerID, 0).Err(); err != nil {
+	if err := r.client.Set(ctx, key, partnerID, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to set partner: %w", err)
 	}
 	return nil
 }
 
+// RefreshPartner restarts the TTL of userID's partner mapping; a missing mapping is left alone
+func (r *ChatRepository) RefreshPartner(ctx context.Context, userID int64, ttl time.Duration) error {
+	if err := r.client.Expire(ctx, fmt.Sprintf("chat:partner:%d", userID), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to refresh partner: %w", err)
+	}
+	return nil
+}
+
 func (r *ChatRepository) GetUserPartner(ctx context.Context, userID int64) (int64, error) {
 	key := fmt.Sprintf("chat:partner:%d", userID)
 	partnerID, err := r.client.Get(ctx, key).Result()
@@ -265,34 +580,122 @@ func (r *ChatRepository) GetUserPartner(ctx context.Context, userID int64) (int6
 	return parseInt64(partnerID), nil
 }
 
-func (r *ChatRepository) RemoveUser(ctx context.Context, userID int64) error {
-	// Remove user from set
-	keyUsers := "chat:users"
-	if err := r.client.SRem(ctx, keyUsers, userID).Err(); err != nil {
-		return fmt.Errorf("failed to remove user from set: %w", err)
+// RemoveUser takes userID out of matchmaking and ends their chat on both sides: the
+// waiting-set memberships and partner mappings of the user and the partner are
+// removed together. It returns the partner the chat was with, so the caller can tell
+// them; the partner's mapping is left alone, and 0 returned, when it already points
+// to someone else.
+func (r *ChatRepository) RemoveUser(ctx context.Context, userID int64) (int64, error) {
+	partnerID, err := r.GetUserPartner(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var back int64
+	if partnerID != 0 {
+		if back, err = r.GetUserPartner(ctx, partnerID); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, waitingUsersKey, userID)
+		pipe.Del(ctx, fmt.Sprintf("chat:partner:%d", userID))
+		if partnerID != 0 {
+			pipe.ZRem(ctx, chatActiveKey, chatPairMember(userID, partnerID))
+		}
+		if partnerID != 0 && back == userID {
+			pipe.SRem(ctx, waitingUsersKey, partnerID)
+			pipe.Del(ctx, fmt.Sprintf("chat:partner:%d", partnerID))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove user: %w", err)
+	}
+	if back != 0 && back != userID {
+		return 0, nil
+	}
+	return partnerID, nil
+}
+
+// GetUsers lists the waiting users, walking the set with SSCAN so a large set
+// doesn't block Redis the way SMEMBERS would
+func (r *ChatRepository) GetUsers(ctx context.Context) ([]int64, error) {
+	var userIDs []int64
+	iter := r.client.SScan(ctx, waitingUsersKey, 0, "", waitingScanBatch).Iterator()
+	for iter.Next(ctx) {
+		userIDs = append(userIDs, parseInt64(iter.Val()))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get users from set: %w", err)
+	}
+	return userIDs, nil
+}
+
+// CountWaitingUsers returns how many users wait for a partner
+func (r *ChatRepository) CountWaitingUsers(ctx context.Context) (int64, error) {
+	n, err := r.client.SCard(ctx, waitingUsersKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count waiting users: %w", err)
 	}
+	return n, nil
+}
 
-	// Remove partner mapping
-	keyPartner := fmt.Sprintf("chat:partner:%d", userID)
-	if err := r.client.Del(ctx, keyPartner).Err(); err != nil {
-		return fmt.Errorf("failed to delete partner mapping: %w", err)
+// chatActiveKey is a sorted set of partner pairs scored by the unix time of their last relayed message
+const chatActiveKey = "chat:active"
+
+// chatPairMember names a pair the same way whichever side is passed first
+func chatPairMember(a, b int64) string {
+	if a > b {
+		a, b = b, a
 	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
 
+// TouchChat records activity of the a–b chat for the idle sweeper
+func (r *ChatRepository) TouchChat(ctx context.Context, a, b int64, at time.Time) error {
+	err := r.client.ZAdd(ctx, chatActiveKey, redis.Z{Score: float64(at.Unix()), Member: chatPairMember(a, b)}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to touch chat: %w", err)
+	}
 	return nil
 }
 
-func (r *ChatRepository) GetUsers(ctx context.Context) ([]int64, error) {
-	key := "chat:users"
-	users, err := r.client.SMembers(ctx, key).Result()
+// CountActiveChats returns how many pairs are in the activity index
+func (r *ChatRepository) CountActiveChats(ctx context.Context) (int64, error) {
+	n, err := r.client.ZCard(ctx, chatActiveKey).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users from set: %w", err)
+		return 0, fmt.Errorf("failed to count active chats: %w", err)
 	}
+	return n, nil
+}
 
-	var userIDs []int64
-	for _, user := range users {
-		userIDs = append(userIDs, parseInt64(user))
+// IdleChats returns the pairs whose last activity is at or before cutoff
+func (r *ChatRepository) IdleChats(ctx context.Context, cutoff time.Time) ([][2]int64, error) {
+	members, err := r.client.ZRangeByScore(ctx, chatActiveKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idle chats: %w", err)
 	}
-	return userIDs, nil
+	pairs := make([][2]int64, 0, len(members))
+	for _, m := range members {
+		var a, b int64
+		if _, err := fmt.Sscanf(m, "%d:%d", &a, &b); err != nil {
+			continue
+		}
+		pairs = append(pairs, [2]int64{a, b})
+	}
+	return pairs, nil
+}
+
+// ForgetChat drops the a–b chat from the activity index
+func (r *ChatRepository) ForgetChat(ctx context.Context, a, b int64) error {
+	if err := r.client.ZRem(ctx, chatActiveKey, chatPairMember(a, b)).Err(); err != nil {
+		return fmt.Errorf("failed to forget chat: %w", err)
+	}
+	return nil
 }
 
 func (r *ChatRepository) CheckPartnerToEmpty(ctx context.Context, userID int64) (bool, error) {
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seedWaiting puts users 1..n into the waiting set
+func seedWaiting(tb testing.TB, r *ChatRepository, n int) {
+	tb.Helper()
+	ctx := context.Background()
+	members := make([]any, 0, 1000)
+	for i := 1; i <= n; i++ {
+		members = append(members, i)
+		if len(members) == cap(members) || i == n {
+			if err := r.client.SAdd(ctx, waitingUsersKey, members...).Err(); err != nil {
+				tb.Fatal(err)
+			}
+			members = members[:0]
+		}
+	}
+}
+
+func BenchmarkWaitingUsers50k(b *testing.B) {
+	const members = 50_000
+	ctx := context.Background()
+	_, r := newTestRedis(b)
+	seedWaiting(b, r, members)
+
+	b.Run("CountWaitingUsers", func(b *testing.B) {
+		for range b.N {
+			if n, err := r.CountWaitingUsers(ctx); err != nil || n != members {
+				b.Fatalf("CountWaitingUsers = %d, %v", n, err)
+			}
+		}
+	})
+	// miniredis sorts the whole set for every SSCAN page, so this one is far slower
+	// than against a real Redis; it still shows the page count and allocations
+	b.Run("GetUsers", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if ids, err := r.GetUsers(ctx); err != nil || len(ids) != members {
+				b.Fatalf("GetUsers = %d ids, %v", len(ids), err)
+			}
+		}
+	})
+	b.Run("FindPartner", func(b *testing.B) {
+		for range b.N {
+			partner, err := r.FindPartner(ctx, 1)
+			if err != nil || partner == 0 {
+				b.Fatalf("FindPartner = %d, %v", partner, err)
+			}
+			// keep the set at 50k for the next draw
+			if err := r.AddUser(ctx, partner); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestIdleChats(t *testing.T) {
+	ctx := context.Background()
+	_, r := newTestRedis(t)
+	t0 := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	r.TouchChat(ctx, 2, 1, t0)
+	r.TouchChat(ctx, 3, 4, t0.Add(10*time.Minute))
+	r.TouchChat(ctx, 5, 6, t0.Add(20*time.Minute))
+	// a later message from the other side moves the same pair forward
+	r.TouchChat(ctx, 6, 5, t0.Add(40*time.Minute))
+
+	tests := []struct {
+		cutoff time.Time
+		want   string
+	}{
+		{t0.Add(-time.Second), "[]"},
+		{t0, "[[1 2]]"},
+		{t0.Add(10*time.Minute - time.Second), "[[1 2]]"},
+		{t0.Add(10 * time.Minute), "[[1 2] [3 4]]"},
+		{t0.Add(30 * time.Minute), "[[1 2] [3 4]]"},
+		{t0.Add(40 * time.Minute), "[[1 2] [3 4] [5 6]]"},
+	}
+	for _, tt := range tests {
+		pairs, err := r.IdleChats(ctx, tt.cutoff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(pairs); got != tt.want {
+			t.Errorf("IdleChats(t0 + %s) = %s, want %s", tt.cutoff.Sub(t0), got, tt.want)
+		}
+	}
+
+	r.ForgetChat(ctx, 1, 2)
+	if pairs, _ := r.IdleChats(ctx, t0.Add(time.Hour)); fmt.Sprint(pairs) != "[[3 4] [5 6]]" {
+		t.Errorf("after ForgetChat(1, 2): %v", pairs)
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newTestRedis(t)
+	at := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	if err := r.SetLastSeen(ctx, 1, at); err != nil {
+		t.Fatal(err)
+	}
+	r.SetLastSeen(ctx, 2, at.Add(-time.Hour))
+
+	seen, err := r.GetLastSeenMany(ctx, []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || !seen[1].Equal(at) || !seen[2].Equal(at.Add(-time.Hour)) {
+		t.Fatalf("GetLastSeenMany = %v", seen)
+	}
+	if _, ok, _ := r.GetLastSeen(ctx, 3); ok {
+		t.Error("user 3 was never seen")
+	}
+
+	// a newer interaction replaces the old one and restarts the TTL
+	mr.FastForward(lastSeenTTL - time.Second)
+	r.SetLastSeen(ctx, 1, at.Add(time.Minute))
+	if got, ok, _ := r.GetLastSeen(ctx, 2); !ok || !got.Equal(at.Add(-time.Hour)) {
+		t.Errorf("a second inside the TTL: user 2 = %v, %v", got, ok)
+	}
+	mr.FastForward(time.Second)
+	if _, ok, _ := r.GetLastSeen(ctx, 2); ok {
+		t.Error("user 2 still seen once the TTL ran out")
+	}
+	if got, ok, _ := r.GetLastSeen(ctx, 1); !ok || !got.Equal(at.Add(time.Minute)) {
+		t.Errorf("user 1 = %v, %v, want the refreshed time", got, ok)
+	}
+}
+
+func TestPartnerTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newTestRedis(t)
+	const ttl = 2 * time.Second
+	r.SetPartner(ctx, 1, 2, ttl)
+	r.SetPartner(ctx, 2, 1, ttl)
+	r.SetPartner(ctx, 3, 4, 0)
+
+	mr.FastForward(1500 * time.Millisecond)
+	if err := r.RefreshPartner(ctx, 1, ttl); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Second)
+	if p, _ := r.GetUserPartner(ctx, 1); p != 2 {
+		t.Errorf("refreshed mapping: partner(1) = %d, want 2", p)
+	}
+	if p, _ := r.GetUserPartner(ctx, 2); p != 0 {
+		t.Errorf("expired mapping: partner(2) = %d, want 0", p)
+	}
+	if busy, _ := r.CheckPartnerToEmpty(ctx, 2); busy {
+		t.Error("user 2 still reported busy after the TTL")
+	}
+
+	// refreshing a mapping that is gone does not bring it back
+	r.RefreshPartner(ctx, 2, ttl)
+	if p, _ := r.GetUserPartner(ctx, 2); p != 0 {
+		t.Errorf("after refreshing a missing mapping: partner(2) = %d", p)
+	}
+
+	mr.FastForward(ttl)
+	if p, _ := r.GetUserPartner(ctx, 1); p != 0 {
+		t.Errorf("partner(1) = %d once its refreshed TTL ran out", p)
+	}
+	if p, _ := r.GetUserPartner(ctx, 3); p != 4 {
+		t.Errorf("mapping without a TTL expired: partner(3) = %d", p)
+	}
+}
+
+func TestRemoveUserClearsBothSides(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newTestRedis(t)
+	r.AddUser(ctx, 1)
+	r.AddUser(ctx, 2)
+	r.SetPartner(ctx, 1, 2, time.Hour)
+	r.SetPartner(ctx, 2, 1, time.Hour)
+	r.TouchChat(ctx, 1, 2, time.Now())
+	// 3 is paired with 4, who has moved on to 5: removing 3 must not touch 4
+	r.SetPartner(ctx, 3, 4, time.Hour)
+	r.SetPartner(ctx, 4, 5, time.Hour)
+
+	if p, err := r.RemoveUser(ctx, 1); err != nil || p != 2 {
+		t.Fatalf("RemoveUser(1) = %d, %v; want 2", p, err)
+	}
+	for _, key := range []string{"chat:partner:1", "chat:partner:2"} {
+		if mr.Exists(key) {
+			t.Errorf("%s left behind", key)
+		}
+	}
+	if waiting, _ := r.GetUsers(ctx); len(waiting) != 0 {
+		t.Errorf("waiting after RemoveUser(1) = %v", waiting)
+	}
+	if pairs, _ := r.IdleChats(ctx, time.Now().Add(time.Hour)); len(pairs) != 0 {
+		t.Errorf("chat activity after RemoveUser(1) = %v", pairs)
+	}
+
+	if p, err := r.RemoveUser(ctx, 3); err != nil || p != 0 {
+		t.Fatalf("RemoveUser(3) = %d, %v; want 0, 4 has another partner", p, err)
+	}
+	if mr.Exists("chat:partner:3") {
+		t.Error("chat:partner:3 left behind")
+	}
+	if p, _ := r.GetUserPartner(ctx, 4); p != 5 {
+		t.Errorf("partner(4) = %d after removing 3, want 5", p)
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegDateLayout is the canonical format of just.dataRegistred
+const RegDateLayout = "2006-01-02 15:04:05"
+
+// regDateLayouts are the textual forms found in just.dataRegistred and in imported
+// spreadsheets, canonical first. Slashed dates are US month/day/year, as Excel
+// writes them; the single-digit layouts also accept two digits.
+var regDateLayouts = []string{
+	RegDateLayout,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	"02.01.06",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	"1/2/06 15:04",
+	"1/2/06",
+}
+
+// excelEpoch is day 0 of Excel's 1900 date system (with its leap-year bug folded in).
+// It is in UTC so adding days never crosses a DST change; the wall clock is moved to
+// time.Local afterwards.
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// ParseRegDate parses a registration date in any of the formats that ended up in
+// just.dataRegistred, including Excel serial numbers from imported spreadsheets.
+func ParseRegDate(raw string) (time.Time, bool) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range regDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	// Excel serial: whole days since the epoch plus a fraction of a day
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 && f < 2958466 {
+		t := excelEpoch.Add(time.Duration(f * float64(24*time.Hour))).Round(time.Second)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), true
+	}
+	return time.Time{}, false
+}
+
+// NormalizeRegDate rewrites a registration date in any ParseRegDate form as RegDateLayout,
+// so dates from the bot and from imports compare and filter the same way
+func NormalizeRegDate(raw string) (string, bool) {
+	t, ok := ParseRegDate(raw)
+	if !ok {
+		return "", false
+	}
+	// RFC3339 input keeps its own offset; stored dates are local time like the bot's
+	return t.In(time.Local).Format(RegDateLayout), true
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeRegDate(t *testing.T) {
+	utcNoon := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC).In(time.Local).Format(RegDateLayout)
+
+	tests := []struct {
+		name, raw, want string
+		ok              bool
+	}{
+		{"canonical", "2024-03-05 14:30:15", "2024-03-05 14:30:15", true},
+		{"padded", "  2024-03-05 14:30:15 ", "2024-03-05 14:30:15", true},
+		{"rfc3339", "2024-03-05T12:00:00Z", utcNoon, true},
+		{"iso without zone", "2024-03-05T14:30:15", "2024-03-05 14:30:15", true},
+		{"iso minutes", "2024-03-05 14:30", "2024-03-05 14:30:00", true},
+		{"iso date", "2024-03-05", "2024-03-05 00:00:00", true},
+		{"slashed iso", "2024/03/05 14:30:15", "2024-03-05 14:30:15", true},
+		{"slashed iso date", "2024/03/05", "2024-03-05 00:00:00", true},
+		{"dotted with seconds", "05.03.2024 14:30:15", "2024-03-05 14:30:15", true},
+		{"dotted with minutes", "05.03.2024 14:30", "2024-03-05 14:30:00", true},
+		{"dotted date", "05.03.2024", "2024-03-05 00:00:00", true},
+		{"dotted short year", "05.03.24", "2024-03-05 00:00:00", true},
+		{"us with seconds", "3/5/2024 14:30:15", "2024-03-05 14:30:15", true},
+		{"us two digits", "03/05/2024", "2024-03-05 00:00:00", true},
+		{"us short year", "3/5/24 14:30", "2024-03-05 14:30:00", true},
+		{"excel serial", "45356", "2024-03-05 00:00:00", true},
+		{"excel serial with time", "45356.5", "2024-03-05 12:00:00", true},
+		{"excel serial rounding", "45356.604340277", "2024-03-05 14:30:15", true},
+		{"empty", "", "", false},
+		{"blank", "   ", "", false},
+		{"text", "yesterday", "", false},
+		{"day out of range", "32.01.2024", "", false},
+		{"zero serial", "0", "", false},
+		{"negative serial", "-5", "", false},
+		{"serial past 9999", "2958466", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizeRegDate(tt.raw)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("NormalizeRegDate(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
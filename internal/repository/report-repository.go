@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ReportRepository stores abuse reports for admin review
+type ReportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// InsertReport saves a pending report and returns its id
+func (r *ReportRepository) InsertReport(ctx context.Context, rep domain.Report) (int64, error) {
+	if rep.ReportedUserID == "" || rep.ReporterTgID == 0 {
+		return 0, errors.New("InsertReport: empty reporter or reported user")
+	}
+	const q = `
+		INSERT INTO reports (reporter_tg_id, reported_user_id, reported_tg_id, reason, context)
+		VALUES (?, ?, ?, ?, ?);`
+	res, err := r.db.ExecContext(ctx, q, rep.ReporterTgID, rep.ReportedUserID, rep.ReportedTgID, rep.Reason, rep.Context)
+	if err != nil {
+		return 0, fmt.Errorf("InsertReport exec: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+const reportColumns = `id, reporter_tg_id, reported_user_id, reported_tg_id, reason, context, status, created_at`
+
+func scanReport(row interface{ Scan(...any) error }) (domain.Report, error) {
+	var rep domain.Report
+	err := row.Scan(&rep.ID, &rep.ReporterTgID, &rep.ReportedUserID, &rep.ReportedTgID, &rep.Reason, &rep.Context, &rep.Status, &rep.CreatedAt)
+	return rep, err
+}
+
+// GetPendingReports returns the oldest unresolved reports first
+func (r *ReportRepository) GetPendingReports(ctx context.Context, limit int) ([]domain.Report, error) {
+	q := `SELECT ` + reportColumns + ` FROM reports WHERE status = ? ORDER BY created_at, id LIMIT ?;`
+	rows, err := r.db.QueryContext(ctx, q, domain.ReportPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetPendingReports query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []domain.Report
+	for rows.Next() {
+		rep, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rep)
+	}
+	return res, rows.Err()
+}
+
+// GetReport returns the report with id, nil when there is none
+func (r *ReportRepository) GetReport(ctx context.Context, id int64) (*domain.Report, error) {
+	q := `SELECT ` + reportColumns + ` FROM reports WHERE id = ?;`
+	rep, err := scanReport(r.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetReport: %w", err)
+	}
+	return &rep, nil
+}
+
+// ResolveReport moves a pending report to status. It reports false when the
+// report was already resolved, so two admins pressing a button act only once.
+func (r *ReportRepository) ResolveReport(ctx context.Context, id int64, status string, adminID int64) (bool, error) {
+	const q = `
+		UPDATE reports SET status = ?, resolved_by = ?, resolved_at = datetime('now')
+		WHERE id = ? AND status = ?;`
+	res, err := r.db.ExecContext(ctx, q, status, adminID, id, domain.ReportPending)
+	if err != nil {
+		return false, fmt.Errorf("ResolveReport exec: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
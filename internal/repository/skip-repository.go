@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SkipRepository records "pass" actions; the data is only used for ranking and never shown to users
+type SkipRepository struct {
+	db *sql.DB
+}
+
+func NewSkipRepository(db *sql.DB) *SkipRepository {
+	return &SkipRepository{db: db}
+}
+
+// InsertSkip saves that one user passed on another (users.id values).
+// Skipping the same profile again only refreshes the timestamp, so the table stays one row per pair.
+func (r *SkipRepository) InsertSkip(ctx context.Context, from, to string) error {
+	if from == "" || to == "" {
+		return errors.New("InsertSkip: empty user id")
+	}
+	const q = `
+		INSERT INTO skips (from_user_id, to_user_id) VALUES (?, ?)
+		ON CONFLICT(from_user_id, to_user_id) DO UPDATE SET created_at = CURRENT_TIMESTAMP;`
+	if _, err := r.db.ExecContext(ctx, q, from, to); err != nil {
+		return fmt.Errorf("InsertSkip exec: %w", err)
+	}
+	return nil
+}
+
+// GetSkipCounts returns, per profile, how many users skipped it and how many liked it.
+// Profiles without any skips are left out of the map.
+func (r *SkipRepository) GetSkipCounts(ctx context.Context, userIDs []string) (map[string]domain.SkipStats, error) {
+	res := make(map[string]domain.SkipStats)
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	args := make([]any, 0, len(userIDs))
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	q := `
+		SELECT s.to_user_id, COUNT(1),
+		       (SELECT COUNT(1) FROM likes l WHERE l.to_user_id = s.to_user_id)
+		FROM skips s
+		WHERE s.to_user_id IN (?` + strings.Repeat(",?", len(userIDs)-1) + `)
+		GROUP BY s.to_user_id;`
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetSkipCounts query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var skips, likes int
+		if err := rows.Scan(&id, &skips, &likes); err != nil {
+			return nil, fmt.Errorf("GetSkipCounts scan: %w", err)
+		}
+		res[id] = domain.SkipStats{Skips: skips, Likes: likes}
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,458 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// StateStore is the short-lived chat state: user states, the waiting set, partner
+// mappings, rate-limit keys and small caches. ChatRepository keeps it in Redis,
+// MemoryStore in process, and FailoverStore switches between the two.
+type StateStore interface {
+	HitOnce(ctx context.Context, key string, ttl time.Duration) (allowed bool, ttlLeft time.Duration, err error)
+	HitCount(ctx context.Context, key string, ttl time.Duration) (count int64, ttlLeft time.Duration, err error)
+	Release(ctx context.Context, key string) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+
+	SaveUserState(ctx context.Context, userID int64, state *domain.UserState) error
+	GetUserState(ctx context.Context, userID int64) (*domain.UserState, error)
+	DeleteUserState(ctx context.Context, userID int64) error
+	SaveAdminState(ctx context.Context, adminID int64, state *domain.UserState) error
+	GetAdminState(ctx context.Context, adminID int64) (*domain.UserState, error)
+	DeleteAdminState(ctx context.Context, adminID int64) error
+	SaveBroadcastState(ctx context.Context, adminID int64, broadcastType string) error
+	GetBroadcastState(ctx context.Context, adminID int64) (string, error)
+	DeleteBroadcastState(ctx context.Context, adminID int64) error
+	ClearAllUserStates(ctx context.Context, userID int64) error
+
+	SetBroadcastCancel(ctx context.Context, adminID int64) error
+	IsBroadcastCancelled(ctx context.Context, adminID int64) (bool, error)
+	ClearBroadcastCancel(ctx context.Context, adminID int64) error
+	SaveBroadcastCheckpoint(ctx context.Context, runID int64, nextIndex, sent, failed int) error
+	GetBroadcastCheckpoint(ctx context.Context, runID int64) (nextIndex, sent, failed int, ok bool, err error)
+	DeleteBroadcastCheckpoint(ctx context.Context, runID int64) error
+	SaveBroadcastReport(ctx context.Context, adminID int64, path string, ttl time.Duration) error
+	GetBroadcastReport(ctx context.Context, adminID int64) (string, error)
+
+	SaveRelayedMessage(ctx context.Context, token string, m *domain.RelayedMessage, ttl time.Duration) error
+	GetRelayedMessage(ctx context.Context, token string) (*domain.RelayedMessage, error)
+	DeleteRelayedMessage(ctx context.Context, token string) error
+	AddMediaGroupPart(ctx context.Context, group string, part []byte, ttl time.Duration) (int64, error)
+	TakeMediaGroup(ctx context.Context, group string) ([][]byte, error)
+
+	SaveFeaturedProfiles(ctx context.Context, payload []byte, ttl time.Duration) error
+	GetFeaturedProfiles(ctx context.Context) ([]byte, error)
+	SetBanCache(ctx context.Context, userID int64, banned bool) error
+	GetBanCache(ctx context.Context, userID int64) (banned, ok bool, err error)
+	SetLastSeen(ctx context.Context, userID int64, at time.Time) error
+	GetLastSeen(ctx context.Context, userID int64) (at time.Time, ok bool, err error)
+	GetLastSeenMany(ctx context.Context, userIDs []int64) (map[int64]time.Time, error)
+
+	AddUser(ctx context.Context, userID int64) error
+	FindPartner(ctx context.Context, userID int64) (int64, error)
+	SetPartner(ctx context.Context, userID, partnerID int64, ttl time.Duration) error
+	RefreshPartner(ctx context.Context, userID int64, ttl time.Duration) error
+	GetUserPartner(ctx context.Context, userID int64) (int64, error)
+	CheckPartnerToEmpty(ctx context.Context, userID int64) (bool, error)
+	RemoveUser(ctx context.Context, userID int64) (partnerID int64, err error)
+	GetUsers(ctx context.Context) ([]int64, error)
+	CountWaitingUsers(ctx context.Context) (int64, error)
+	TouchChat(ctx context.Context, a, b int64, at time.Time) error
+	IdleChats(ctx context.Context, cutoff time.Time) ([][2]int64, error)
+	CountActiveChats(ctx context.Context) (int64, error)
+	ForgetChat(ctx context.Context, a, b int64) error
+
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ StateStore = (*ChatRepository)(nil)
+	_ StateStore = (*MemoryStore)(nil)
+	_ StateStore = (*FailoverStore)(nil)
+)
+
+// FailoverStore serves the state from primary (Redis) and moves to an in-memory
+// store after threshold consecutive connection errors, so a Redis outage degrades
+// the chat instead of breaking it. Monitor pings primary while degraded and, once it
+// answers, copies back what changed in memory and switches back.
+//
+// The trade-off is consistency: memory starts empty, so chats and states from before
+// the outage are invisible until Redis returns, and only user states, partner
+// mappings, the waiting set and chat activity are synced back. Rate-limit keys,
+// caches, delete-button tokens, buffered album parts and broadcast checkpoints
+// written while degraded are dropped. Writes that reach Redis while the sync runs
+// can be overwritten by the older memory copy. With several bot instances each one
+// degrades to its own memory.
+type FailoverStore struct {
+	primary   StateStore
+	memory    *MemoryStore
+	threshold int64
+	logger    *zap.Logger
+
+	failures atomic.Int64
+	degraded atomic.Bool
+	// syncMu keeps the switch back from racing a second outage
+	syncMu sync.Mutex
+}
+
+func NewFailoverStore(primary StateStore, memory *MemoryStore, threshold int, logger *zap.Logger) *FailoverStore {
+	return &FailoverStore{primary: primary, memory: memory, threshold: int64(max(threshold, 1)), logger: logger}
+}
+
+// Degraded reports whether the state is currently served from memory
+func (f *FailoverStore) Degraded() bool {
+	return f.degraded.Load()
+}
+
+// MarkDegraded switches to memory without waiting for the failure threshold, e.g.
+// when Redis was unreachable at startup
+func (f *FailoverStore) MarkDegraded(reason error) {
+	if f.degraded.CompareAndSwap(false, true) {
+		f.logger.Error("Serving chat state from memory", zap.Error(reason))
+	}
+}
+
+// Monitor checks on primary every interval while degraded, and switches back once it
+// answers. It returns when ctx is done.
+func (f *FailoverStore) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		f.memory.evictExpired()
+		if !f.degraded.Load() {
+			continue
+		}
+		if err := f.primary.Ping(ctx); err != nil {
+			f.logger.Debug("Redis still unavailable", zap.Error(err))
+			continue
+		}
+		f.recover(ctx)
+	}
+}
+
+// recover syncs the memory changes back to primary and switches to it
+func (f *FailoverStore) recover(ctx context.Context) {
+	f.syncMu.Lock()
+	defer f.syncMu.Unlock()
+	if !f.degraded.Load() {
+		return
+	}
+	// new writes go to primary from here on; the sync below only fills in the outage
+	f.failures.Store(0)
+	f.degraded.Store(false)
+
+	changes := f.memory.drain()
+	var failed int
+	for userID, state := range changes.states {
+		var err error
+		if state == nil {
+			err = f.primary.DeleteUserState(ctx, userID)
+		} else {
+			err = f.primary.SaveUserState(ctx, userID, state)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	for userID, partnerID := range changes.partners {
+		if err := f.primary.SetPartner(ctx, userID, partnerID, changes.partnerTTLs[userID]); err != nil {
+			failed++
+		}
+	}
+	for userID, partnerID := range changes.unpaired {
+		// only a mapping still pointing at the old partner is stale; anything else
+		// was paired on primary after the switch back and stays
+		current, err := f.primary.GetUserPartner(ctx, userID)
+		if err == nil && current == partnerID {
+			_, err = f.primary.RemoveUser(ctx, userID)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	for _, userID := range changes.waiting {
+		if err := f.primary.AddUser(ctx, userID); err != nil {
+			failed++
+		}
+	}
+	for pair, at := range changes.chats {
+		if err := f.primary.TouchChat(ctx, pair[0], pair[1], at); err != nil {
+			failed++
+		}
+	}
+	f.logger.Info("Redis is back, chat state switched back from memory",
+		zap.Int("states", len(changes.states)),
+		zap.Int("partners", len(changes.partners)),
+		zap.Int("unpaired", len(changes.unpaired)),
+		zap.Int("waiting", len(changes.waiting)),
+		zap.Int("chats", len(changes.chats)),
+		zap.Int("failed", failed))
+}
+
+// isConnError tells a Redis outage apart from errors of a single call
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
+
+// observe counts err towards the failover threshold and reports whether the store
+// has switched to memory
+func (f *FailoverStore) observe(err error) bool {
+	if err == nil || !isConnError(err) {
+		f.failures.Store(0)
+		return false
+	}
+	if f.failures.Add(1) < f.threshold {
+		return false
+	}
+	if f.degraded.CompareAndSwap(false, true) {
+		f.logger.Error("Redis is unavailable, serving chat state from memory", zap.Int64("failures", f.threshold), zap.Error(err))
+	}
+	return true
+}
+
+// run calls op on the active store; a call that trips the failover is repeated on memory
+func run(f *FailoverStore, op func(s StateStore) error) error {
+	if f.degraded.Load() {
+		return op(f.memory)
+	}
+	err := op(f.primary)
+	if f.observe(err) {
+		return op(f.memory)
+	}
+	return err
+}
+
+func run1[T any](f *FailoverStore, op func(s StateStore) (T, error)) (T, error) {
+	var v T
+	err := run(f, func(s StateStore) (err error) {
+		v, err = op(s)
+		return err
+	})
+	return v, err
+}
+
+func run2[T, U any](f *FailoverStore, op func(s StateStore) (T, U, error)) (T, U, error) {
+	var v T
+	var u U
+	err := run(f, func(s StateStore) (err error) {
+		v, u, err = op(s)
+		return err
+	})
+	return v, u, err
+}
+
+func (f *FailoverStore) HitOnce(ctx context.Context, key string, ttl time.Duration) (bool, time.Duration, error) {
+	return run2(f, func(s StateStore) (bool, time.Duration, error) { return s.HitOnce(ctx, key, ttl) })
+}
+
+func (f *FailoverStore) HitCount(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return run2(f, func(s StateStore) (int64, time.Duration, error) { return s.HitCount(ctx, key, ttl) })
+}
+
+func (f *FailoverStore) Release(ctx context.Context, key string) error {
+	return run(f, func(s StateStore) error { return s.Release(ctx, key) })
+}
+
+func (f *FailoverStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return run1(f, func(s StateStore) (time.Duration, error) { return s.TTL(ctx, key) })
+}
+
+func (f *FailoverStore) SaveUserState(ctx context.Context, userID int64, state *domain.UserState) error {
+	return run(f, func(s StateStore) error { return s.SaveUserState(ctx, userID, state) })
+}
+
+func (f *FailoverStore) GetUserState(ctx context.Context, userID int64) (*domain.UserState, error) {
+	return run1(f, func(s StateStore) (*domain.UserState, error) { return s.GetUserState(ctx, userID) })
+}
+
+func (f *FailoverStore) DeleteUserState(ctx context.Context, userID int64) error {
+	return run(f, func(s StateStore) error { return s.DeleteUserState(ctx, userID) })
+}
+
+func (f *FailoverStore) SaveAdminState(ctx context.Context, adminID int64, state *domain.UserState) error {
+	return run(f, func(s StateStore) error { return s.SaveAdminState(ctx, adminID, state) })
+}
+
+func (f *FailoverStore) GetAdminState(ctx context.Context, adminID int64) (*domain.UserState, error) {
+	return run1(f, func(s StateStore) (*domain.UserState, error) { return s.GetAdminState(ctx, adminID) })
+}
+
+func (f *FailoverStore) DeleteAdminState(ctx context.Context, adminID int64) error {
+	return run(f, func(s StateStore) error { return s.DeleteAdminState(ctx, adminID) })
+}
+
+func (f *FailoverStore) SaveBroadcastState(ctx context.Context, adminID int64, broadcastType string) error {
+	return run(f, func(s StateStore) error { return s.SaveBroadcastState(ctx, adminID, broadcastType) })
+}
+
+func (f *FailoverStore) GetBroadcastState(ctx context.Context, adminID int64) (string, error) {
+	return run1(f, func(s StateStore) (string, error) { return s.GetBroadcastState(ctx, adminID) })
+}
+
+func (f *FailoverStore) DeleteBroadcastState(ctx context.Context, adminID int64) error {
+	return run(f, func(s StateStore) error { return s.DeleteBroadcastState(ctx, adminID) })
+}
+
+func (f *FailoverStore) ClearAllUserStates(ctx context.Context, userID int64) error {
+	return run(f, func(s StateStore) error { return s.ClearAllUserStates(ctx, userID) })
+}
+
+func (f *FailoverStore) SetBroadcastCancel(ctx context.Context, adminID int64) error {
+	return run(f, func(s StateStore) error { return s.SetBroadcastCancel(ctx, adminID) })
+}
+
+func (f *FailoverStore) IsBroadcastCancelled(ctx context.Context, adminID int64) (bool, error) {
+	return run1(f, func(s StateStore) (bool, error) { return s.IsBroadcastCancelled(ctx, adminID) })
+}
+
+func (f *FailoverStore) ClearBroadcastCancel(ctx context.Context, adminID int64) error {
+	return run(f, func(s StateStore) error { return s.ClearBroadcastCancel(ctx, adminID) })
+}
+
+func (f *FailoverStore) SaveBroadcastCheckpoint(ctx context.Context, runID int64, nextIndex, sent, failed int) error {
+	return run(f, func(s StateStore) error { return s.SaveBroadcastCheckpoint(ctx, runID, nextIndex, sent, failed) })
+}
+
+func (f *FailoverStore) GetBroadcastCheckpoint(ctx context.Context, runID int64) (nextIndex, sent, failed int, ok bool, err error) {
+	err = run(f, func(s StateStore) (err error) {
+		nextIndex, sent, failed, ok, err = s.GetBroadcastCheckpoint(ctx, runID)
+		return err
+	})
+	return nextIndex, sent, failed, ok, err
+}
+
+func (f *FailoverStore) DeleteBroadcastCheckpoint(ctx context.Context, runID int64) error {
+	return run(f, func(s StateStore) error { return s.DeleteBroadcastCheckpoint(ctx, runID) })
+}
+
+func (f *FailoverStore) SaveBroadcastReport(ctx context.Context, adminID int64, path string, ttl time.Duration) error {
+	return run(f, func(s StateStore) error { return s.SaveBroadcastReport(ctx, adminID, path, ttl) })
+}
+
+func (f *FailoverStore) GetBroadcastReport(ctx context.Context, adminID int64) (string, error) {
+	return run1(f, func(s StateStore) (string, error) { return s.GetBroadcastReport(ctx, adminID) })
+}
+
+func (f *FailoverStore) SaveRelayedMessage(ctx context.Context, token string, m *domain.RelayedMessage, ttl time.Duration) error {
+	return run(f, func(s StateStore) error { return s.SaveRelayedMessage(ctx, token, m, ttl) })
+}
+
+func (f *FailoverStore) GetRelayedMessage(ctx context.Context, token string) (*domain.RelayedMessage, error) {
+	return run1(f, func(s StateStore) (*domain.RelayedMessage, error) { return s.GetRelayedMessage(ctx, token) })
+}
+
+func (f *FailoverStore) DeleteRelayedMessage(ctx context.Context, token string) error {
+	return run(f, func(s StateStore) error { return s.DeleteRelayedMessage(ctx, token) })
+}
+
+func (f *FailoverStore) AddMediaGroupPart(ctx context.Context, group string, part []byte, ttl time.Duration) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.AddMediaGroupPart(ctx, group, part, ttl) })
+}
+
+func (f *FailoverStore) TakeMediaGroup(ctx context.Context, group string) ([][]byte, error) {
+	return run1(f, func(s StateStore) ([][]byte, error) { return s.TakeMediaGroup(ctx, group) })
+}
+
+func (f *FailoverStore) SaveFeaturedProfiles(ctx context.Context, payload []byte, ttl time.Duration) error {
+	return run(f, func(s StateStore) error { return s.SaveFeaturedProfiles(ctx, payload, ttl) })
+}
+
+func (f *FailoverStore) GetFeaturedProfiles(ctx context.Context) ([]byte, error) {
+	return run1(f, func(s StateStore) ([]byte, error) { return s.GetFeaturedProfiles(ctx) })
+}
+
+func (f *FailoverStore) SetBanCache(ctx context.Context, userID int64, banned bool) error {
+	return run(f, func(s StateStore) error { return s.SetBanCache(ctx, userID, banned) })
+}
+
+func (f *FailoverStore) GetBanCache(ctx context.Context, userID int64) (bool, bool, error) {
+	return run2(f, func(s StateStore) (bool, bool, error) { return s.GetBanCache(ctx, userID) })
+}
+
+func (f *FailoverStore) SetLastSeen(ctx context.Context, userID int64, at time.Time) error {
+	return run(f, func(s StateStore) error { return s.SetLastSeen(ctx, userID, at) })
+}
+
+func (f *FailoverStore) GetLastSeen(ctx context.Context, userID int64) (time.Time, bool, error) {
+	return run2(f, func(s StateStore) (time.Time, bool, error) { return s.GetLastSeen(ctx, userID) })
+}
+
+func (f *FailoverStore) GetLastSeenMany(ctx context.Context, userIDs []int64) (map[int64]time.Time, error) {
+	return run1(f, func(s StateStore) (map[int64]time.Time, error) { return s.GetLastSeenMany(ctx, userIDs) })
+}
+
+func (f *FailoverStore) AddUser(ctx context.Context, userID int64) error {
+	return run(f, func(s StateStore) error { return s.AddUser(ctx, userID) })
+}
+
+func (f *FailoverStore) FindPartner(ctx context.Context, userID int64) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.FindPartner(ctx, userID) })
+}
+
+func (f *FailoverStore) SetPartner(ctx context.Context, userID, partnerID int64, ttl time.Duration) error {
+	return run(f, func(s StateStore) error { return s.SetPartner(ctx, userID, partnerID, ttl) })
+}
+
+func (f *FailoverStore) RefreshPartner(ctx context.Context, userID int64, ttl time.Duration) error {
+	return run(f, func(s StateStore) error { return s.RefreshPartner(ctx, userID, ttl) })
+}
+
+func (f *FailoverStore) GetUserPartner(ctx context.Context, userID int64) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.GetUserPartner(ctx, userID) })
+}
+
+func (f *FailoverStore) CheckPartnerToEmpty(ctx context.Context, userID int64) (bool, error) {
+	return run1(f, func(s StateStore) (bool, error) { return s.CheckPartnerToEmpty(ctx, userID) })
+}
+
+func (f *FailoverStore) RemoveUser(ctx context.Context, userID int64) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.RemoveUser(ctx, userID) })
+}
+
+func (f *FailoverStore) GetUsers(ctx context.Context) ([]int64, error) {
+	return run1(f, func(s StateStore) ([]int64, error) { return s.GetUsers(ctx) })
+}
+
+func (f *FailoverStore) CountWaitingUsers(ctx context.Context) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.CountWaitingUsers(ctx) })
+}
+
+func (f *FailoverStore) TouchChat(ctx context.Context, a, b int64, at time.Time) error {
+	return run(f, func(s StateStore) error { return s.TouchChat(ctx, a, b, at) })
+}
+
+func (f *FailoverStore) CountActiveChats(ctx context.Context) (int64, error) {
+	return run1(f, func(s StateStore) (int64, error) { return s.CountActiveChats(ctx) })
+}
+
+func (f *FailoverStore) IdleChats(ctx context.Context, cutoff time.Time) ([][2]int64, error) {
+	return run1(f, func(s StateStore) ([][2]int64, error) { return s.IdleChats(ctx, cutoff) })
+}
+
+func (f *FailoverStore) ForgetChat(ctx context.Context, a, b int64) error {
+	return run(f, func(s StateStore) error { return s.ForgetChat(ctx, a, b) })
+}
+
+// Ping always checks Redis itself, so health checks report the outage while the
+// chat keeps working from memory
+func (f *FailoverStore) Ping(ctx context.Context) error {
+	return f.primary.Ping(ctx)
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func newTestRedis(t testing.TB) (*miniredis.Miniredis, *ChatRepository) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialTimeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewRedisClient(client)
+}
+
+func TestFailoverStoreWithStoppedRedis(t *testing.T) {
+	ctx := context.Background()
+	mr, primary := newTestRedis(t)
+	store := NewFailoverStore(primary, NewMemoryStore(), 2, zap.NewNop())
+
+	if err := store.SaveUserState(ctx, 1, &domain.UserState{State: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	if store.Degraded() {
+		t.Fatal("degraded while Redis is up")
+	}
+
+	mr.Close()
+	// the first failure is below the threshold and surfaces; the second switches to memory
+	if err := store.SaveUserState(ctx, 2, &domain.UserState{State: "during"}); err == nil {
+		t.Fatal("first call after the outage succeeded")
+	}
+	if store.Degraded() {
+		t.Fatal("degraded after one failure, threshold is 2")
+	}
+	if err := store.SaveUserState(ctx, 2, &domain.UserState{State: "during"}); err != nil {
+		t.Fatalf("call that trips the failover: %v", err)
+	}
+	if !store.Degraded() {
+		t.Fatal("not degraded after two failures")
+	}
+
+	// pairing keeps working from memory
+	if err := store.AddUser(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPartner(ctx, 4, 5, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := store.GetUserPartner(ctx, 4); err != nil || p != 5 {
+		t.Fatalf("partner of 4 = %d, %v; want 5", p, err)
+	}
+	if s, err := store.GetUserState(ctx, 2); err != nil || s == nil || s.State != "during" {
+		t.Fatalf("state of 2 = %+v, %v", s, err)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	monitorCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go store.Monitor(monitorCtx, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Degraded() {
+		if time.Now().After(deadline) {
+			t.Fatal("still degraded after Redis came back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the outage's changes were copied to Redis, the earlier state is still there
+	if s, err := primary.GetUserState(ctx, 2); err != nil || s == nil || s.State != "during" {
+		t.Fatalf("Redis state of 2 = %+v, %v; want the one saved during the outage", s, err)
+	}
+	if s, err := primary.GetUserState(ctx, 1); err != nil || s == nil || s.State != "before" {
+		t.Fatalf("Redis state of 1 = %+v, %v", s, err)
+	}
+	if p, err := primary.GetUserPartner(ctx, 4); err != nil || p != 5 {
+		t.Fatalf("Redis partner of 4 = %d, %v; want 5", p, err)
+	}
+	waiting, err := primary.GetUsers(ctx)
+	if err != nil || len(waiting) != 1 || waiting[0] != 3 {
+		t.Fatalf("Redis waiting = %v, %v; want [3]", waiting, err)
+	}
+}
+
+func TestFailoverStoreIgnoresCallErrors(t *testing.T) {
+	ctx := context.Background()
+	mr, primary := newTestRedis(t)
+	store := NewFailoverStore(primary, NewMemoryStore(), 1, zap.NewNop())
+
+	// a value of the wrong type fails the call but says nothing about the connection
+	mr.Set("user_state:7", "not json")
+	if _, err := store.GetUserState(ctx, 7); err == nil {
+		t.Fatal("decoding garbage succeeded")
+	}
+	if store.Degraded() {
+		t.Fatal("a per-call error switched the store to memory")
+	}
+}
+
+func TestMediaGroupParts(t *testing.T) {
+	ctx := context.Background()
+	mr, redisStore := newTestRedis(t)
+	stores := map[string]StateStore{"redis": redisStore, "memory": NewMemoryStore()}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for i, part := range []string{"a", "b", "c"} {
+				n, err := store.AddMediaGroupPart(ctx, "1:g", []byte(part), time.Minute)
+				if err != nil || n != int64(i+1) {
+					t.Fatalf("add %s = %d, %v; want %d", part, n, err, i+1)
+				}
+			}
+			parts, err := store.TakeMediaGroup(ctx, "1:g")
+			if err != nil || len(parts) != 3 || string(parts[0]) != "a" || string(parts[2]) != "c" {
+				t.Fatalf("take = %q, %v; want [a b c]", parts, err)
+			}
+			// the album is handed out once
+			if parts, err := store.TakeMediaGroup(ctx, "1:g"); err != nil || len(parts) != 0 {
+				t.Fatalf("second take = %q, %v; want nothing", parts, err)
+			}
+		})
+	}
+
+	// parts of an album nobody flushed expire
+	if _, err := redisStore.AddMediaGroupPart(ctx, "1:lost", []byte("a"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	if parts, err := redisStore.TakeMediaGroup(ctx, "1:lost"); err != nil || len(parts) != 0 {
+		t.Fatalf("take after expiry = %q, %v; want nothing", parts, err)
+	}
+}
+
+func TestFailoverStoreSyncsOnlyOutageUnpairs(t *testing.T) {
+	ctx := context.Background()
+	mr, primary := newTestRedis(t)
+	store := NewFailoverStore(primary, NewMemoryStore(), 1, zap.NewNop())
+
+	// 9 and 10 were chatting before the outage
+	primary.SetPartner(ctx, 9, 10, time.Hour)
+	primary.SetPartner(ctx, 10, 9, time.Hour)
+
+	mr.Close()
+	store.MarkDegraded(nil)
+	// 1 and 2 pair and part while degraded, 3 only leaves the queue, and 9 and 10
+	// meet again and part
+	store.SetPartner(ctx, 1, 2, time.Hour)
+	store.SetPartner(ctx, 2, 1, time.Hour)
+	store.RemoveUser(ctx, 1)
+	store.AddUser(ctx, 3)
+	store.RemoveUser(ctx, 3)
+	store.SetPartner(ctx, 9, 10, time.Hour)
+	store.SetPartner(ctx, 10, 9, time.Hour)
+	store.RemoveUser(ctx, 9)
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	// pairings made on Redis before the sync reaches them
+	primary.SetPartner(ctx, 1, 5, time.Hour)
+	primary.SetPartner(ctx, 3, 6, time.Hour)
+	store.recover(ctx)
+	if store.Degraded() {
+		t.Fatal("still degraded after recover")
+	}
+
+	for _, tt := range []struct{ user, want int64 }{
+		{1, 5},
+		{2, 0},
+		{3, 6},
+		{9, 0},
+		{10, 0},
+	} {
+		if p, err := primary.GetUserPartner(ctx, tt.user); err != nil || p != tt.want {
+			t.Errorf("Redis partner of %d = %d, %v; want %d", tt.user, p, err, tt.want)
+		}
+	}
+}
@@ -2,14 +2,21 @@ package repository
 
 import (
 	"aika/internal/domain"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
-    "context"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrUserExists is returned by CreateUser when the telegram user already has a profile
+var ErrUserExists = errors.New("user already exists")
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -37,7 +44,142 @@ func (r *UserRepository) GetAllJustUserIDs(ctx context.Context) ([]int64, error)
 	return userIDs, nil
 }
 
-func (r *UserRepository) UpdateUser(user *domain.User) error {
+// GetBroadcastAudience returns the just users who receive marketing broadcasts,
+// i.e. everyone except those who sent /unsubscribe or can't be reached
+func (r *UserRepository) GetBroadcastAudience(ctx context.Context) ([]int64, error) {
+	const q = `SELECT id_user FROM just WHERE broadcast_opt_out = 0 AND is_unreachable = 0 ORDER BY created_at DESC;`
+	return r.queryUserIDs(ctx, "GetBroadcastAudience", q)
+}
+
+// GetRegisteredAudience returns Telegram IDs of users who filled in a Mini App profile
+func (r *UserRepository) GetRegisteredAudience(ctx context.Context) ([]int64, error) {
+	const q = `
+		SELECT u.user_id
+		FROM users u
+		LEFT JOIN just j ON j.id_user = u.user_id
+		WHERE COALESCE(j.broadcast_opt_out, 0) = 0 AND COALESCE(j.is_unreachable, 0) = 0
+		ORDER BY u.created_at DESC;`
+	return r.queryUserIDs(ctx, "GetRegisteredAudience", q)
+}
+
+// GetActiveAudience returns just users who wrote to the bot within the last `days` days
+func (r *UserRepository) GetActiveAudience(ctx context.Context, days int) ([]int64, error) {
+	const q = `
+		SELECT id_user FROM just
+		WHERE broadcast_opt_out = 0 AND is_unreachable = 0 AND last_active_at >= datetime('now', ?)
+		ORDER BY last_active_at DESC;`
+	return r.queryUserIDs(ctx, "GetActiveAudience", q, fmt.Sprintf("-%d days", days))
+}
+
+// GetLikersAudience returns Telegram IDs of users who sent at least one like
+func (r *UserRepository) GetLikersAudience(ctx context.Context) ([]int64, error) {
+	const q = `
+		SELECT u.user_id
+		FROM users u
+		LEFT JOIN just j ON j.id_user = u.user_id
+		WHERE COALESCE(j.broadcast_opt_out, 0) = 0 AND COALESCE(j.is_unreachable, 0) = 0
+		  AND EXISTS (SELECT 1 FROM likes l WHERE l.from_user_id = u.id)
+		ORDER BY u.created_at DESC;`
+	return r.queryUserIDs(ctx, "GetLikersAudience", q)
+}
+
+func (r *UserRepository) queryUserIDs(ctx context.Context, op, q string, args ...any) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("%s scan: %w", op, err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// GetJustUserNames maps id_user to userName for the given IDs; unknown IDs are left out
+func (r *UserRepository) GetJustUserNames(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	names := make(map[int64]string, len(userIDs))
+	// stay well under SQLite's bound-parameter limit
+	const chunk = 500
+	for start := 0; start < len(userIDs); start += chunk {
+		ids := userIDs[start:min(start+chunk, len(userIDs))]
+		args := make([]any, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		q := `SELECT id_user, userName FROM just WHERE id_user IN (?` + strings.Repeat(",?", len(ids)-1) + `);`
+		rows, err := r.db.QueryContext(ctx, q, args...)
+		if err != nil {
+			return nil, fmt.Errorf("GetJustUserNames query: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("GetJustUserNames scan: %w", err)
+			}
+			names[id] = name
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("GetJustUserNames rows: %w", err)
+		}
+	}
+	return names, nil
+}
+
+// TouchJustActivity records that the user just interacted with the bot, which also
+// makes them reachable again
+func (r *UserRepository) TouchJustActivity(ctx context.Context, userID int64) error {
+	const q = `UPDATE just SET last_active_at = datetime('now'), is_unreachable = 0 WHERE id_user = ?;`
+	if _, err := r.db.ExecContext(ctx, q, userID); err != nil {
+		return fmt.Errorf("TouchJustActivity exec: %w", err)
+	}
+	return nil
+}
+
+// SetBroadcastOptOut toggles marketing broadcasts for a just user.
+// It returns false when the user is not in the just table.
+func (r *UserRepository) SetBroadcastOptOut(ctx context.Context, userID int64, optOut bool) (bool, error) {
+	const q = `UPDATE just SET broadcast_opt_out = ?, updated_at = datetime('now') WHERE id_user = ?;`
+	res, err := r.db.ExecContext(ctx, q, optOut, userID)
+	if err != nil {
+		return false, fmt.Errorf("SetBroadcastOptOut exec: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("SetBroadcastOptOut rows: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SetUnreachable flags a just user the bot can't send to: they blocked it, deleted
+// their account or their chat is gone
+func (r *UserRepository) SetUnreachable(ctx context.Context, userID int64, unreachable bool) error {
+	const q = `UPDATE just SET is_unreachable = ?, updated_at = datetime('now') WHERE id_user = ?;`
+	if _, err := r.db.ExecContext(ctx, q, unreachable, userID); err != nil {
+		return fmt.Errorf("SetUnreachable exec: %w", err)
+	}
+	return nil
+}
+
+// CountBroadcastOptOut returns how many just users turned broadcasts off
+func (r *UserRepository) CountBroadcastOptOut(ctx context.Context) (int, error) {
+	var n int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM just WHERE broadcast_opt_out = 1;`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("CountBroadcastOptOut: %w", err)
+	}
+	return n, nil
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user *domain.User) error {
 	if user == nil || user.Id == "" {
 		return errors.New("UpdateUser: empty user or user.Id")
 	}
@@ -51,6 +193,11 @@ func (r *UserRepository) UpdateUser(user *domain.User) error {
 			longitude   = ?,
 			about_user  = ?,
 			avatar_path = ?,
+			avatar_width  = ?,
+			avatar_height = ?,
+			hide_age      = ?,
+			hide_about    = ?,
+			hide_distance = ?,
 			updated_at  = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
@@ -62,7 +209,8 @@ func (r *UserRepository) UpdateUser(user *domain.User) error {
 		return *p
 	}
 
-	res, err := r.db.Exec(
+	res, err := r.db.ExecContext(
+		ctx,
 		q,
 		user.Nickname,
 		user.Sex,
@@ -71,6 +219,11 @@ func (r *UserRepository) UpdateUser(user *domain.User) error {
 		nullableFloat64(user.Longitude),
 		user.AboutUser,
 		user.AvatarPath,
+		user.AvatarWidth,
+		user.AvatarHeight,
+		user.HideAge,
+		user.HideAbout,
+		user.HideDistance,
 		user.Id,
 	)
 	if err != nil {
@@ -84,6 +237,85 @@ func (r *UserRepository) UpdateUser(user *domain.User) error {
 	return nil
 }
 
+// ForEachJustEntry streams the just table, newest first, calling fn per row so
+// exports never hold the whole table in memory. An error from fn stops the scan.
+func (r *UserRepository) ForEachJustEntry(ctx context.Context, fn func(domain.JustEntry) error) error {
+	const q = `SELECT id, id_user, userName, dataRegistred FROM just ORDER BY created_at DESC;`
+	rows, err := r.db.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.JustEntry
+		if err := rows.Scan(&e.Id, &e.UserId, &e.UserName, &e.DateRegistered); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountJustUsers returns the number of bot users and how many of them are still active
+func (r *UserRepository) CountJustUsers(ctx context.Context) (total, active int, err error) {
+	const q = `SELECT COUNT(1), COALESCE(SUM(is_active), 0) FROM just;`
+	err = r.db.QueryRowContext(ctx, q).Scan(&total, &active)
+	return total, active, err
+}
+
+// CountProfiles returns the number of registered dating profiles
+func (r *UserRepository) CountProfiles(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM users;`).Scan(&n)
+	return n, err
+}
+
+// CountRegistrationsByDay buckets just registrations from since onwards by local
+// calendar day ("2006-01-02"). dataRegistred holds mixed formats, so it is parsed
+// in Go with ParseRegDate, falling back to created_at when it can't be read.
+func (r *UserRepository) CountRegistrationsByDay(ctx context.Context, since time.Time) (map[string]int, error) {
+	const q = `SELECT dataRegistred, created_at FROM just;`
+	rows, err := r.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]int)
+	for rows.Next() {
+		var raw string
+		var created sql.NullTime
+		if err := rows.Scan(&raw, &created); err != nil {
+			return nil, err
+		}
+		t, ok := ParseRegDate(raw)
+		if !ok {
+			if !created.Valid {
+				continue
+			}
+			t = created.Time.Local()
+		}
+		if t.Before(since) {
+			continue
+		}
+		res[t.Format("2006-01-02")]++
+	}
+	return res, rows.Err()
+}
+
+// CountRegistrationsOn returns how many users registered on the given local day
+func (r *UserRepository) CountRegistrationsOn(ctx context.Context, day time.Time) (int, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	byDay, err := r.CountRegistrationsByDay(ctx, start)
+	if err != nil {
+		return 0, err
+	}
+	return byDay[start.Format("2006-01-02")], nil
+}
+
 // ExistsJust проверяет, есть ли запись в just по id_user
 func (r *UserRepository) ExistsJust(ctx context.Context, userId int64) (bool, error) {
 	const q = `SELECT COUNT(1) FROM just WHERE id_user=?;`
@@ -94,28 +326,39 @@ func (r *UserRepository) ExistsJust(ctx context.Context, userId int64) (bool, er
 	return cnt > 0, nil
 }
 
-// InsertJust вставляет запись в таблицу just с учетом новых полей (SQLite version)
+// InsertJust вставляет запись в таблицу just с учетом новых полей (SQLite version).
+// An upsert rather than OR REPLACE, so flags like broadcast_opt_out survive a repeat /start.
 func (r *UserRepository) InsertJust(ctx context.Context, e domain.JustEntry) error {
 	const q = `
-		INSERT OR REPLACE INTO just (id_user, userName, dataRegistred, updated_at)
-		VALUES (?, ?, ?, datetime('now'));
+		INSERT INTO just (id_user, userName, dataRegistred, updated_at, last_active_at)
+		VALUES (?, ?, ?, datetime('now'), datetime('now'))
+		ON CONFLICT(id_user) DO UPDATE SET
+			userName = excluded.userName,
+			dataRegistred = excluded.dataRegistred,
+			updated_at = excluded.updated_at,
+			last_active_at = excluded.last_active_at;
 	`
-	_, err := r.db.ExecContext(ctx, q, e.UserId, e.UserName, e.DateRegistered)
+	// dataRegistred is always stored as RegDateLayout; an unreadable date means "now"
+	dataReg, ok := NormalizeRegDate(e.DateRegistered)
+	if !ok {
+		dataReg = time.Now().Format(RegDateLayout)
+	}
+	_, err := r.db.ExecContext(ctx, q, e.UserId, e.UserName, dataReg)
 	return err
 }
 
 // в repository.UserRepository
-func (r *UserRepository) GetUserByID(id string) (*domain.User, error) {
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
 	const q = `
-		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, created_at, updated_at
+		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, avatar_width, avatar_height, hide_age, hide_about, hide_distance, created_at, updated_at
 		FROM users
 		WHERE id = ?
 		LIMIT 1`
-	row := r.db.QueryRow(q, id)
+	row := r.db.QueryRowContext(ctx, q, id)
 
 	var u domain.User
 	var lat, lon sql.NullFloat64
-	if err := row.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.CreatedAt, &u.UpdatedAt); err != nil {
+	if err := row.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.AvatarWidth, &u.AvatarHeight, &u.HideAge, &u.HideAbout, &u.HideDistance, &u.CreatedAt, &u.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -131,9 +374,9 @@ func (r *UserRepository) GetUserByID(id string) (*domain.User, error) {
 }
 
 // Простой поиск без координат (для случая, когда location не пришёл)
-func (r *UserRepository) FindUsersByFilters(sex string, ageMin, ageMax *int, q string, limit int) ([]domain.User, error) {
+func (r *UserRepository) FindUsersByFilters(ctx context.Context, sex string, ageMin, ageMax *int, q string, limit int) ([]domain.User, error) {
 	query := `
-		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, created_at, updated_at
+		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, avatar_width, avatar_height, hide_age, hide_about, hide_distance, created_at, updated_at
 		FROM users
 		WHERE 1=1
 	`
@@ -160,7 +403,7 @@ func (r *UserRepository) FindUsersByFilters(sex string, ageMin, ageMax *int, q s
 	query += " ORDER BY created_at DESC LIMIT ?"
 	args = append(args, limit)
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -170,7 +413,7 @@ func (r *UserRepository) FindUsersByFilters(sex string, ageMin, ageMax *int, q s
 	for rows.Next() {
 		var u domain.User
 		var lat, lon sql.NullFloat64
-		if err := rows.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.AvatarWidth, &u.AvatarHeight, &u.HideAge, &u.HideAbout, &u.HideDistance, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if lat.Valid {
@@ -185,20 +428,30 @@ func (r *UserRepository) FindUsersByFilters(sex string, ageMin, ageMax *int, q s
 }
 
 // GetUserNickname возвращает user_nickname для данного user_id.
-func (r *UserRepository) GetUserNickname(userID int64) (string, error) {
+func (r *UserRepository) GetUserNickname(ctx context.Context, userID int64) (string, error) {
 	query := `SELECT nickname FROM users WHERE user_id = ?`
 	var nickname string
-	if err := r.db.QueryRow(query, userID).Scan(&nickname); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&nickname); err != nil {
 		// Если записи не найдено, можно вернуть пустую строку или ошибку
 		return "", fmt.Errorf("GetUserNickname қатесі: %w", err)
 	}
 	return nickname, nil
 }
 
-// Кандидаты по bbox + фильтры
-func (r *UserRepository) FindUsersInBBox(latMin, latMax, lonMin, lonMax float64, sex string, ageMin, ageMax *int, q string, limit int) ([]domain.User, error) {
+// FindUsersInBBox returns users inside the bbox, nearest to (lat, lon) first.
+//
+// The bbox keeps the lookup on idx_users_lat_lon; the rows inside it are ranked
+// by an equirectangular distance proxy, dlat² + (dlon·cos lat)², with cos taken
+// once at the centre, so the database hands back rows that are already close to
+// the final order and limit can be near the number of cards shown. The proxy
+// treats a degree of longitude as equally long across the whole box: at 50°N and
+// a 300 km radius it is off by up to ~6% at the box's north/south edges (about
+// 1% for radii up to 50 km). It only orders rows; callers correct it with the
+// exact haversine distance, so the error can at worst swap near-equal
+// neighbours around the limit, never let in a profile outside the radius.
+func (r *UserRepository) FindUsersInBBox(ctx context.Context, lat, lon, latMin, latMax, lonMin, lonMax float64, sex string, ageMin, ageMax *int, q string, limit int) ([]domain.User, error) {
 	query := `
-		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, created_at, updated_at
+		SELECT id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, avatar_width, avatar_height, hide_age, hide_about, hide_distance, created_at, updated_at
 		FROM users
 		WHERE latitude IS NOT NULL AND longitude IS NOT NULL
 		  AND latitude BETWEEN ? AND ?
@@ -224,11 +477,14 @@ func (r *UserRepository) FindUsersInBBox(latMin, latMax, lonMin, lonMax float64,
 		args = append(args, pat, pat)
 	}
 
-	// Берём побольше — финальный радиус отфильтруем в Go
-	query += " ORDER BY updated_at DESC LIMIT ?"
-	args = append(args, limit)
+	// ближайшие первыми; точный радиус (haversine) отфильтруем в Go
+	query += `
+		ORDER BY (latitude - ?) * (latitude - ?) + (longitude - ?) * (longitude - ?) * ?, updated_at DESC
+		LIMIT ?`
+	cosLat := math.Cos(lat * math.Pi / 180)
+	args = append(args, lat, lat, lon, lon, cosLat*cosLat, limit)
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -238,7 +494,7 @@ func (r *UserRepository) FindUsersInBBox(latMin, latMax, lonMin, lonMax float64,
 	for rows.Next() {
 		var u domain.User
 		var lat, lon sql.NullFloat64
-		if err := rows.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.Id, &u.TelegramId, &u.Nickname, &u.Sex, &u.Age, &lat, &lon, &u.AboutUser, &u.AvatarPath, &u.AvatarWidth, &u.AvatarHeight, &u.HideAge, &u.HideAbout, &u.HideDistance, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if lat.Valid {
@@ -252,34 +508,40 @@ func (r *UserRepository) FindUsersInBBox(latMin, latMax, lonMin, lonMax float64,
 	return res, rows.Err()
 }
 
-func (r *UserRepository) CheckUserExists(telegramId int64) (bool, error) {
+func (r *UserRepository) CheckUserExists(ctx context.Context, telegramId int64) (bool, error) {
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)`
-	err := r.db.QueryRow(query, telegramId).Scan(&exists)
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE user_id = ?)`
+	err := r.db.QueryRowContext(ctx, query, telegramId).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check user existence: %w", err)
 	}
 	return exists, nil
 }
 
-func (r *UserRepository) GetUserByTelegramId(telegramId int64) (*domain.User, error) {
+func (r *UserRepository) GetUserByTelegramId(ctx context.Context, telegramId int64) (*domain.User, error) {
 	user := &domain.User{}
+	var lat, lon sql.NullFloat64
 	query := `
 		SELECT id, user_id, nickname, sex, age, latitude, longitude, 
-		       about_user, COALESCE(avatar_path, ''), created_at
+		       COALESCE(about_user, ''), COALESCE(avatar_path, ''), avatar_width, avatar_height, hide_age, hide_about, hide_distance, created_at
 		FROM users 
-		WHERE user_id = $1
+		WHERE user_id = ?
 	`
-	err := r.db.QueryRow(query, telegramId).Scan(
+	err := r.db.QueryRowContext(ctx, query, telegramId).Scan(
 		&user.Id,
 		&user.TelegramId,
 		&user.Nickname,
 		&user.Sex,
 		&user.Age,
-		&user.Latitude,
-		&user.Longitude,
+		&lat,
+		&lon,
 		&user.AboutUser,
 		&user.AvatarPath,
+		&user.AvatarWidth,
+		&user.AvatarHeight,
+		&user.HideAge,
+		&user.HideAbout,
+		&user.HideDistance,
 		&user.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -288,19 +550,25 @@ func (r *UserRepository) GetUserByTelegramId(telegramId int64) (*domain.User, er
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	if lat.Valid {
+		user.Latitude = &lat.Float64
+	}
+	if lon.Valid {
+		user.Longitude = &lon.Float64
+	}
 	return user, nil
 }
 
-func (r *UserRepository) CreateUser(user *domain.User) (string, error) {
+func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User) (string, error) {
 	userId := uuid.New().String()
 
 	query := `
-		INSERT INTO users (id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
+		INSERT INTO users (id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path, avatar_width, avatar_height, hide_age, hide_about, hide_distance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	err := r.db.QueryRow(
+	res, err := r.db.ExecContext(
+		ctx,
 		query,
 		userId,
 		user.TelegramId,
@@ -311,25 +579,36 @@ func (r *UserRepository) CreateUser(user *domain.User) (string, error) {
 		user.Longitude,
 		user.AboutUser,
 		user.AvatarPath,
-	).Scan(&userId)
-
+		user.AvatarWidth,
+		user.AvatarHeight,
+		user.HideAge,
+		user.HideAbout,
+		user.HideDistance,
+	)
 	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return "", ErrUserExists
+		}
 		return "", fmt.Errorf("failed to create user: %w", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return "", fmt.Errorf("failed to create user: no rows inserted")
+	}
 
 	return userId, nil
 }
 
-func (r *UserRepository) GetNearbyUsers(location string, limit int) ([]*domain.User, error) {
+func (r *UserRepository) GetNearbyUsers(ctx context.Context, location string, limit int) ([]*domain.User, error) {
 	query := `
 		SELECT id, user_id, nickname, sex, age, latitude, longitude, 
-		       about_user, COALESCE(avatar_path, ''), created_at
+		       COALESCE(about_user, ''), COALESCE(avatar_path, ''), created_at
 		FROM users
 		ORDER BY created_at DESC
-		LIMIT $1
+		LIMIT ?
 	`
 
-	rows, err := r.db.Query(query, limit)
+	rows, err := r.db.QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get nearby users: %w", err)
 	}
@@ -338,14 +617,15 @@ func (r *UserRepository) GetNearbyUsers(location string, limit int) ([]*domain.U
 	var users []*domain.User
 	for rows.Next() {
 		user := &domain.User{}
+		var lat, lon sql.NullFloat64
 		err := rows.Scan(
 			&user.Id,
 			&user.TelegramId,
 			&user.Nickname,
 			&user.Sex,
 			&user.Age,
-			&user.Latitude,
-			&user.Longitude,
+			&lat,
+			&lon,
 			&user.AboutUser,
 			&user.AvatarPath,
 			&user.CreatedAt,
@@ -353,8 +633,166 @@ func (r *UserRepository) GetNearbyUsers(location string, limit int) ([]*domain.U
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
+		if lat.Valid {
+			user.Latitude = &lat.Float64
+		}
+		if lon.Valid {
+			user.Longitude = &lon.Float64
+		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
+}
+
+// profileDependents are the statements that remove what other tables hold about a profile id
+var profileDependents = []string{
+	`DELETE FROM likes WHERE from_user_id = ? OR to_user_id = ?;`,
+	`DELETE FROM skips WHERE from_user_id = ? OR to_user_id = ?;`,
+	`DELETE FROM messages WHERE from_user_id = ? OR to_user_id = ?;`,
+	`DELETE FROM blocks WHERE blocker_user_id = ? OR blocked_user_id = ?;`,
+}
+
+// DeleteProfile removes the users row together with the likes, skips, messages and
+// blocks sent or received by it, all in one transaction; returns sql.ErrNoRows if
+// there is no such profile
+func (r *UserRepository) DeleteProfile(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("DeleteProfile begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range profileDependents {
+		if _, err := tx.ExecContext(ctx, q, id, id); err != nil {
+			return fmt.Errorf("DeleteProfile exec: %w", err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("DeleteProfile exec: %w", err)
+	}
+	if ra, _ := res.RowsAffected(); ra == 0 {
+		return sql.ErrNoRows
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("DeleteProfile commit: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes the users row; returns sql.ErrNoRows if nothing was deleted
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	const q = `DELETE FROM users WHERE id = ?;`
+	res, err := r.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return fmt.Errorf("DeleteUser exec: %w", err)
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetJustActive marks the just row of a telegram user active/inactive
+func (r *UserRepository) SetJustActive(ctx context.Context, userId int64, active bool) error {
+	const q = `UPDATE just SET is_active = ?, updated_at = datetime('now') WHERE id_user = ?;`
+	_, err := r.db.ExecContext(ctx, q, active, userId)
+	return err
+}
+
+// FindFeaturedCandidates returns the boosted profiles and then the most recently created
+// ones, with their received-like and skip counts
+func (r *UserRepository) FindFeaturedCandidates(ctx context.Context, limit int) ([]domain.FeaturedCandidate, error) {
+	const q = `
+		SELECT u.id, u.user_id, u.nickname, u.sex, u.age, u.latitude, u.longitude,
+		       COALESCE(u.about_user, ''), COALESCE(u.avatar_path, ''), u.avatar_width, u.avatar_height, u.hide_age, u.hide_about, u.hide_distance, u.created_at, u.updated_at,
+		       (SELECT COUNT(1) FROM likes l WHERE l.to_user_id = u.id),
+		       (SELECT COUNT(1) FROM skips s WHERE s.to_user_id = u.id),
+		       u.verified, COALESCE(u.boosted_until > CURRENT_TIMESTAMP, 0) AS boosted
+		FROM users u
+		ORDER BY boosted DESC, u.created_at DESC
+		LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, fmt.Errorf("FindFeaturedCandidates query: %w", err)
+	}
+	defer rows.Close()
+
+	var res []domain.FeaturedCandidate
+	for rows.Next() {
+		var c domain.FeaturedCandidate
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&c.User.Id, &c.User.TelegramId, &c.User.Nickname, &c.User.Sex, &c.User.Age, &lat, &lon,
+			&c.User.AboutUser, &c.User.AvatarPath, &c.User.AvatarWidth, &c.User.AvatarHeight, &c.User.HideAge, &c.User.HideAbout, &c.User.HideDistance, &c.User.CreatedAt, &c.User.UpdatedAt, &c.Likes, &c.Skips, &c.Verified, &c.Boosted); err != nil {
+			return nil, fmt.Errorf("FindFeaturedCandidates scan: %w", err)
+		}
+		if lat.Valid {
+			c.User.Latitude = &lat.Float64
+		}
+		if lon.Valid {
+			c.User.Longitude = &lon.Float64
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+// SetVerified marks the profile of a telegram user verified or not
+func (r *UserRepository) SetVerified(ctx context.Context, tgID int64, verified bool) error {
+	const q = `UPDATE users SET verified = ? WHERE user_id = ?;`
+	_, err := r.db.ExecContext(ctx, q, verified, tgID)
+	return err
+}
+
+// BoostUntil lifts the profile of a telegram user in the featured carousel until the given time
+func (r *UserRepository) BoostUntil(ctx context.Context, tgID int64, until time.Time) error {
+	const q = `UPDATE users SET boosted_until = ? WHERE user_id = ?;`
+	_, err := r.db.ExecContext(ctx, q, until.UTC().Format("2006-01-02 15:04:05"), tgID)
+	return err
+}
+
+// GetPreferences returns the saved nearby filters of a Telegram user, nil when none are saved
+func (r *UserRepository) GetPreferences(ctx context.Context, tgID int64) (*domain.UserPreferences, error) {
+	const q = `SELECT pref_sex, age_min, age_max, radius_km FROM user_preferences WHERE user_id = ?;`
+	var ageMin, ageMax sql.NullInt64
+	var radius sql.NullFloat64
+	p := domain.UserPreferences{UserID: tgID}
+	err := r.db.QueryRowContext(ctx, q, tgID).Scan(&p.Sex, &ageMin, &ageMax, &radius)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetPreferences scan: %w", err)
+	}
+	if ageMin.Valid {
+		v := int(ageMin.Int64)
+		p.AgeMin = &v
+	}
+	if ageMax.Valid {
+		v := int(ageMax.Int64)
+		p.AgeMax = &v
+	}
+	if radius.Valid {
+		p.RadiusKm = &radius.Float64
+	}
+	return &p, nil
+}
+
+// SavePreferences replaces the saved nearby filters of p.UserID
+func (r *UserRepository) SavePreferences(ctx context.Context, p domain.UserPreferences) error {
+	const q = `
+		INSERT INTO user_preferences (user_id, pref_sex, age_min, age_max, radius_km, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			pref_sex = excluded.pref_sex,
+			age_min = excluded.age_min,
+			age_max = excluded.age_max,
+			radius_km = excluded.radius_km,
+			updated_at = CURRENT_TIMESTAMP;`
+	if _, err := r.db.ExecContext(ctx, q, p.UserID, p.Sex, p.AgeMin, p.AgeMax, p.RadiusKm); err != nil {
+		return fmt.Errorf("SavePreferences exec: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,592 @@
+package repository
+
+import (
+	"aika/internal/domain"
+	"aika/traits/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestJustConcurrentWrites runs bot-style /start traffic from 50 goroutines
+// against a database opened with the production pragmas
+func TestJustConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), database.Options{
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+		ForeignKeys: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r := NewUserRepository(db)
+
+	const workers, perWorker = 50, 20
+	errs := make(chan error, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := int64(w*perWorker + i + 1)
+				if err := r.InsertJust(ctx, domain.JustEntry{UserId: id, UserName: fmt.Sprintf("user_%d", id)}); err != nil {
+					errs <- fmt.Errorf("InsertJust(%d): %w", id, err)
+					continue
+				}
+				if ok, err := r.ExistsJust(ctx, id); err != nil || !ok {
+					errs <- fmt.Errorf("ExistsJust(%d) = %v, %v", id, ok, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	total, _, err := r.CountJustUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != workers*perWorker {
+		t.Fatalf("just has %d rows, want %d", total, workers*perWorker)
+	}
+}
+
+func TestUserRepositoryHonoursCancellation(t *testing.T) {
+	r := NewUserRepository(newTestDB(t))
+
+	// a query still running when the deadline passes is interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := r.queryUserIDs(ctx, "endless", `
+		WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n)
+		SELECT x FROM n WHERE x < 0;`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("query ran for %v after its deadline", elapsed)
+	}
+
+	// and one whose caller already gave up never starts
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	u := &domain.User{Id: "x", TelegramId: 1, Nickname: "Aru", Sex: "female", Age: 20}
+	calls := map[string]func() error{
+		"CreateUser":          func() error { _, err := r.CreateUser(cancelled, u); return err },
+		"UpdateUser":          func() error { return r.UpdateUser(cancelled, u) },
+		"GetUserByID":         func() error { _, err := r.GetUserByID(cancelled, "x"); return err },
+		"GetUserByTelegramId": func() error { _, err := r.GetUserByTelegramId(cancelled, 1); return err },
+		"GetUserNickname":     func() error { _, err := r.GetUserNickname(cancelled, 1); return err },
+		"FindUsersByFilters":  func() error { _, err := r.FindUsersByFilters(cancelled, "", nil, nil, "", 10); return err },
+		"InsertJust":          func() error { return r.InsertJust(cancelled, domain.JustEntry{UserId: 1, UserName: "aru"}) },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", name, err)
+		}
+	}
+}
+
+// TestUserRepositoryMethods runs every profile query against SQLite, so a placeholder
+// or scan mismatch fails here rather than in production
+func TestUserRepositoryMethods(t *testing.T) {
+	ctx := context.Background()
+	r := NewUserRepository(newTestDB(t))
+	lat, lon := 43.238, 76.889
+
+	located, err := r.CreateUser(ctx, &domain.User{TelegramId: 1, Nickname: "Aru", Sex: "female", Age: 22, AboutUser: "loves tea", Latitude: &lat, Longitude: &lon})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no coordinates: latitude and longitude stay NULL
+	unlocated, err := r.CreateUser(ctx, &domain.User{TelegramId: 2, Nickname: "Dana", Sex: "male", Age: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := r.GetUserByID(ctx, located)
+	if err != nil || u == nil || u.TelegramId != 1 || u.Latitude == nil || *u.Latitude != lat {
+		t.Fatalf("GetUserByID = %+v, %v", u, err)
+	}
+	if u, err := r.GetUserByID(ctx, "missing"); err != nil || u != nil {
+		t.Fatalf("GetUserByID(missing) = %+v, %v; want nil, nil", u, err)
+	}
+	u, err = r.GetUserByTelegramId(ctx, 2)
+	if err != nil || u == nil || u.Id != unlocated || u.Latitude != nil || u.Longitude != nil {
+		t.Fatalf("GetUserByTelegramId with NULL coordinates = %+v, %v", u, err)
+	}
+	if ok, err := r.CheckUserExists(ctx, 1); err != nil || !ok {
+		t.Fatalf("CheckUserExists(1) = %v, %v", ok, err)
+	}
+	if ok, err := r.CheckUserExists(ctx, 3); err != nil || ok {
+		t.Fatalf("CheckUserExists(3) = %v, %v", ok, err)
+	}
+
+	u.Nickname, u.Age, u.Latitude, u.Longitude = "Dana K", 31, &lat, &lon
+	if err := r.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if nick, err := r.GetUserNickname(ctx, 2); err != nil || nick != "Dana K" {
+		t.Fatalf("GetUserNickname = %q, %v", nick, err)
+	}
+	if err := r.UpdateUser(ctx, &domain.User{Id: "missing", Nickname: "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("UpdateUser(missing) = %v, want sql.ErrNoRows", err)
+	}
+
+	ageMin := 25
+	found, err := r.FindUsersByFilters(ctx, "male", &ageMin, nil, "", 10)
+	if err != nil || len(found) != 1 || found[0].Id != unlocated {
+		t.Fatalf("FindUsersByFilters(male, 25+) = %+v, %v", found, err)
+	}
+	if found, err := r.FindUsersByFilters(ctx, "", nil, nil, "TEA", 10); err != nil || len(found) != 1 || found[0].Id != located {
+		t.Fatalf("FindUsersByFilters(q=TEA) = %+v, %v", found, err)
+	}
+	inBox, err := r.FindUsersInBBox(ctx, lat, lon, lat-1, lat+1, lon-1, lon+1, "female", nil, nil, "", 10)
+	if err != nil || len(inBox) != 1 || inBox[0].Id != located {
+		t.Fatalf("FindUsersInBBox = %+v, %v", inBox, err)
+	}
+	if all, err := r.GetNearbyUsers(ctx, "", 10); err != nil || len(all) != 2 {
+		t.Fatalf("GetNearbyUsers = %d users, %v", len(all), err)
+	}
+
+	if err := r.DeleteUser(ctx, located); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteUser(ctx, located); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("second DeleteUser = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	r := NewUserRepository(db)
+	ids := make([]string, 3)
+	for i := range ids {
+		id, err := r.CreateUser(ctx, &domain.User{TelegramId: int64(i + 1), Nickname: "u", Sex: "female", Age: 22})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	a, b, c := ids[0], ids[1], ids[2]
+	seed := []string{
+		`INSERT INTO likes (from_user_id, to_user_id) VALUES ('` + a + `', '` + b + `'), ('` + b + `', '` + a + `'), ('` + c + `', '` + b + `');`,
+		`INSERT INTO skips (from_user_id, to_user_id) VALUES ('` + a + `', '` + c + `'), ('` + c + `', '` + a + `');`,
+		`INSERT INTO messages (from_user_id, to_user_id, text) VALUES ('` + b + `', '` + a + `', 'hi'), ('` + c + `', '` + b + `', 'hey');`,
+		`INSERT INTO blocks (blocker_user_id, blocked_user_id) VALUES ('` + a + `', '` + c + `');`,
+	}
+	for _, q := range seed {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := func() string {
+		t.Helper()
+		var out []string
+		for _, q := range []string{
+			`SELECT COUNT(1) FROM users;`,
+			`SELECT COUNT(1) FROM likes;`,
+			`SELECT COUNT(1) FROM skips;`,
+			`SELECT COUNT(1) FROM messages;`,
+			`SELECT COUNT(1) FROM blocks;`,
+		} {
+			var n int
+			if err := db.QueryRow(q).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, fmt.Sprint(n))
+		}
+		return strings.Join(out, " ")
+	}
+
+	// a failure on the last statement leaves everything as it was
+	if _, err := db.Exec(`CREATE TRIGGER fail_delete BEFORE DELETE ON users BEGIN SELECT RAISE(ABORT, 'boom'); END;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteProfile(ctx, a); err == nil {
+		t.Fatal("DeleteProfile succeeded with the users delete failing")
+	}
+	if got := counts(); got != "3 3 2 2 1" {
+		t.Fatalf("users likes skips messages blocks = %s after a failed delete, want 3 3 2 2 1", got)
+	}
+	db.Exec(`DROP TRIGGER fail_delete;`)
+
+	if err := r.DeleteProfile(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	// only c's like and message to b are left
+	if got := counts(); got != "2 1 0 1 0" {
+		t.Errorf("users likes skips messages blocks = %s, want 2 1 0 1 0", got)
+	}
+	if err := r.DeleteProfile(ctx, a); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second DeleteProfile = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCreateUserDuplicateTelegramID(t *testing.T) {
+	ctx := context.Background()
+	r := NewUserRepository(newTestDB(t))
+	id, err := r.CreateUser(ctx, &domain.User{TelegramId: 7, Nickname: "Aru", Sex: "female", Age: 22})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("id %q is not a UUID: %v", id, err)
+	}
+
+	again, err := r.CreateUser(ctx, &domain.User{TelegramId: 7, Nickname: "Other", Sex: "male", Age: 30})
+	if !errors.Is(err, ErrUserExists) || again != "" {
+		t.Fatalf("second CreateUser = %q, %v; want ErrUserExists", again, err)
+	}
+	u, err := r.GetUserByTelegramId(ctx, 7)
+	if err != nil || u == nil || u.Id != id || u.Nickname != "Aru" {
+		t.Fatalf("profile after the conflict = %+v, %v; want the first one untouched", u, err)
+	}
+}
+
+func TestCountRegistrationsByDay(t *testing.T) {
+	ctx := context.Background()
+	day := func(d, h, m, s int) time.Time { return time.Date(2024, 3, d, h, m, s, 0, time.Local) }
+
+	empty := NewUserRepository(newTestDB(t))
+	if got, err := empty.CountRegistrationsByDay(ctx, day(1, 0, 0, 0)); err != nil || len(got) != 0 {
+		t.Fatalf("empty table: %v, %v; want no buckets", got, err)
+	}
+	if n, err := empty.CountRegistrationsOn(ctx, day(1, 12, 0, 0)); err != nil || n != 0 {
+		t.Fatalf("empty table: CountRegistrationsOn = %d, %v", n, err)
+	}
+
+	db := newTestDB(t)
+	repo := NewUserRepository(db)
+	// dataRegistred in the mixed formats found in just; an unreadable one falls
+	// back to created_at
+	rows := []struct{ date, created string }{
+		{"2024-02-29 23:59:59", "2024-02-29 23:59:59"},
+		{"2024-03-01 00:00:00", "2024-03-01 00:00:00"},
+		{"01.03.2024", "2024-03-01 00:00:00"},
+		{"2024-03-01 23:59:59", "2024-03-01 23:59:59"},
+		{"2024-03-02 00:00:00", "2024-03-02 00:00:00"},
+		{"45353.5", "2024-03-02 12:00:00"},
+		{"someday", day(3, 10, 0, 0).UTC().Format("2006-01-02 15:04:05")},
+	}
+	for i, r := range rows {
+		if _, err := db.Exec(`INSERT INTO just (id_user, userName, dataRegistred, created_at) VALUES (?, 'u', ?, ?);`, i+1, r.date, r.created); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  map[string]int
+	}{
+		{"from midnight", day(1, 0, 0, 0), map[string]int{"2024-03-01": 3, "2024-03-02": 2, "2024-03-03": 1}},
+		{"a second after midnight", day(1, 0, 0, 1), map[string]int{"2024-03-01": 1, "2024-03-02": 2, "2024-03-03": 1}},
+		{"next day", day(2, 0, 0, 0), map[string]int{"2024-03-02": 2, "2024-03-03": 1}},
+		{"week before", day(1, 0, 0, 0).AddDate(0, 0, -6), map[string]int{"2024-02-29": 1, "2024-03-01": 3, "2024-03-02": 2, "2024-03-03": 1}},
+		{"after the last registration", day(4, 0, 0, 0), map[string]int{}},
+	}
+	for _, tt := range tests {
+		got, err := repo.CountRegistrationsByDay(ctx, tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: buckets = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for d, want := range map[int]int{1: 3, 2: 2, 3: 1, 4: 0} {
+		if n, err := repo.CountRegistrationsOn(ctx, day(d, 18, 0, 0)); err != nil || n != want {
+			t.Errorf("CountRegistrationsOn(03-%02d) = %d, %v; want %d", d, n, err, want)
+		}
+	}
+}
+
+// seedJustUsers inserts just users in order, each created a minute after the previous one
+func seedJustUsers(t *testing.T, db *sql.DB, ids ...int64) {
+	t.Helper()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range ids {
+		_, err := db.Exec(`INSERT INTO just (id_user, userName, dataRegistred, created_at) VALUES (?, 'u', '2024-03-01 00:00:00', ?);`,
+			id, start.Add(time.Duration(i)*time.Minute).Format("2006-01-02 15:04:05"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetBroadcastAudience(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	r := NewUserRepository(db)
+
+	if ids, err := r.GetBroadcastAudience(ctx); err != nil || len(ids) != 0 {
+		t.Fatalf("empty just: %v, %v", ids, err)
+	}
+
+	seedJustUsers(t, db, 1, 2, 3, 4, 5)
+	if ok, err := r.SetBroadcastOptOut(ctx, 2, true); err != nil || !ok {
+		t.Fatalf("SetBroadcastOptOut(2) = %v, %v", ok, err)
+	}
+	if ok, err := r.SetBroadcastOptOut(ctx, 99, true); err != nil || ok {
+		t.Fatalf("SetBroadcastOptOut(unknown) = %v, %v; want false", ok, err)
+	}
+	if err := r.SetUnreachable(ctx, 4, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// newest first, without the opted-out and the unreachable user
+	ids, err := r.GetBroadcastAudience(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[5 3 1]" {
+		t.Fatalf("audience = %v, want [5 3 1]", ids)
+	}
+	if n, err := r.CountBroadcastOptOut(ctx); err != nil || n != 1 {
+		t.Fatalf("CountBroadcastOptOut = %d, %v", n, err)
+	}
+
+	// /subscribe and a message to the bot bring both back
+	r.SetBroadcastOptOut(ctx, 2, false)
+	if err := r.TouchJustActivity(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := r.GetBroadcastAudience(ctx); fmt.Sprint(ids) != "[5 4 3 2 1]" {
+		t.Fatalf("audience = %v, want everyone back", ids)
+	}
+}
+
+func TestBroadcastAudiences(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	r := NewUserRepository(db)
+	likes := NewLikeRepository(db)
+
+	// 10-13 have profiles, 13 never wrote to the bot; 20 and 21 only have a just row
+	profiles := map[int64]string{}
+	for _, tg := range []int64{10, 11, 12, 13} {
+		id, err := r.CreateUser(ctx, &domain.User{TelegramId: tg, Nickname: fmt.Sprint("u", tg), Sex: "female", Age: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		profiles[tg] = id
+	}
+	for _, tg := range []int64{10, 11, 12, 20, 21} {
+		if err := r.InsertJust(ctx, domain.JustEntry{UserId: tg, UserName: "u"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE just SET last_active_at = datetime('now', '-40 days') WHERE id_user = 11;`); err != nil {
+		t.Fatal(err)
+	}
+	r.SetBroadcastOptOut(ctx, 12, true)
+	r.SetUnreachable(ctx, 21, true)
+	for _, l := range [][2]int64{{10, 11}, {13, 10}, {12, 10}, {11, 10}} {
+		if err := likes.InsertLike(ctx, profiles[l[0]], profiles[l[1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 11 liked too, then blocked the bot
+	r.SetUnreachable(ctx, 11, true)
+
+	tests := []struct {
+		name string
+		load func() ([]int64, error)
+		want []int64
+	}{
+		{"registered", func() ([]int64, error) { return r.GetRegisteredAudience(ctx) }, []int64{10, 13}},
+		{"active in 30 days", func() ([]int64, error) { return r.GetActiveAudience(ctx, 30) }, []int64{10, 20}},
+		{"active in 60 days", func() ([]int64, error) { return r.GetActiveAudience(ctx, 60) }, []int64{10, 20}},
+		{"likers", func() ([]int64, error) { return r.GetLikersAudience(ctx) }, []int64{10, 13}},
+	}
+	for _, tt := range tests {
+		got, err := tt.load()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// once 11 is reachable again it counts in every audience it qualifies for
+	r.SetUnreachable(ctx, 11, false)
+	for _, tt := range []struct {
+		name string
+		load func() ([]int64, error)
+		want []int64
+	}{
+		{"registered", func() ([]int64, error) { return r.GetRegisteredAudience(ctx) }, []int64{10, 11, 13}},
+		{"active in 30 days", func() ([]int64, error) { return r.GetActiveAudience(ctx, 30) }, []int64{10, 20}},
+		{"active in 60 days", func() ([]int64, error) { return r.GetActiveAudience(ctx, 60) }, []int64{10, 11, 20}},
+		{"likers", func() ([]int64, error) { return r.GetLikersAudience(ctx) }, []int64{10, 11, 13}},
+	} {
+		got, _ := tt.load()
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("after 11 is reachable: %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// nearbyPoint is a seeded user location for the nearby benchmark
+type nearbyPoint struct {
+	tgID     int64
+	lat, lon float64
+}
+
+// seedNearbyUsers inserts n users, two thirds clustered around Almaty and the rest
+// spread over Kazakhstan, and returns their locations
+func seedNearbyUsers(tb testing.TB, db *sql.DB, n int) []nearbyPoint {
+	tb.Helper()
+	rnd := rand.New(rand.NewPCG(1, 2))
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO users (id, user_id, nickname, sex, age, latitude, longitude, about_user, avatar_path) VALUES (?, ?, 'u', ?, ?, ?, ?, '', '');`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	points := make([]nearbyPoint, n)
+	for i := range points {
+		p := nearbyPoint{tgID: int64(i + 1)}
+		if i%3 == 2 {
+			p.lat, p.lon = 41+rnd.Float64()*14, 50+rnd.Float64()*37
+		} else {
+			p.lat, p.lon = 43.24+rnd.NormFloat64()*0.3, 76.89+rnd.NormFloat64()*0.4
+		}
+		sex := []string{"male", "female"}[i%2]
+		if _, err := stmt.Exec(uuid.NewString(), p.tgID, sex, 18+i%40, p.lat, p.lon); err != nil {
+			tb.Fatal(err)
+		}
+		points[i] = p
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+	return points
+}
+
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const r = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * r * math.Asin(math.Sqrt(a))
+}
+
+// findUsersInBBoxByRecency is the query FindUsersInBBox ran before the distance
+// ranking: the bbox ordered by updated_at, with limit*3 rows for the Go filter
+func findUsersInBBoxByRecency(ctx context.Context, db *sql.DB, latMin, latMax, lonMin, lonMax float64, limit int) ([]domain.User, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, latitude, longitude FROM users
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL
+		  AND latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+		ORDER BY updated_at DESC LIMIT ?`, latMin, latMax, lonMin, lonMax, limit*3)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []domain.User
+	for rows.Next() {
+		var u domain.User
+		var lat, lon float64
+		if err := rows.Scan(&u.TelegramId, &lat, &lon); err != nil {
+			return nil, err
+		}
+		u.Latitude, u.Longitude = &lat, &lon
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
+
+// BenchmarkFindUsersInBBox100k compares the distance-ranked query with the old
+// recency-ordered one on 100k users around central Almaty. missed-of-50 counts the
+// true 50 nearest users within the radius that the final haversine pass can't
+// return because the query never fetched them.
+func BenchmarkFindUsersInBBox100k(b *testing.B) {
+	ctx := context.Background()
+	db := newTestDB(b)
+	r := NewUserRepository(db)
+	points := seedNearbyUsers(b, db, 100_000)
+	const lat, lon, limit = 43.238, 76.889, 50
+
+	for _, radius := range []float64{5, 50, 300} {
+		dLat := radius / 111.32
+		dLon := radius / (111.32 * math.Cos(lat*math.Pi/180))
+		latMin, latMax, lonMin, lonMax := lat-dLat, lat+dLat, lon-dLon, lon+dLon
+
+		// the true answer: the limit nearest users inside the radius
+		var inRadius []nearbyPoint
+		for _, p := range points {
+			if haversine(lat, lon, p.lat, p.lon) <= radius {
+				inRadius = append(inRadius, p)
+			}
+		}
+		sort.Slice(inRadius, func(i, j int) bool {
+			return haversine(lat, lon, inRadius[i].lat, inRadius[i].lon) < haversine(lat, lon, inRadius[j].lat, inRadius[j].lon)
+		})
+		nearest := map[int64]bool{}
+		for _, p := range inRadius[:min(limit, len(inRadius))] {
+			nearest[p.tgID] = true
+		}
+		missed := func(users []domain.User) int {
+			n := len(nearest)
+			for _, u := range users {
+				if nearest[u.TelegramId] {
+					n--
+				}
+			}
+			return n
+		}
+
+		queries := []struct {
+			name string
+			run  func() ([]domain.User, error)
+		}{
+			{"recency", func() ([]domain.User, error) {
+				return findUsersInBBoxByRecency(ctx, db, latMin, latMax, lonMin, lonMax, limit)
+			}},
+			{"distance", func() ([]domain.User, error) {
+				return r.FindUsersInBBox(ctx, lat, lon, latMin, latMax, lonMin, lonMax, "", nil, nil, "", limit+limit/2)
+			}},
+		}
+		for _, q := range queries {
+			b.Run(fmt.Sprintf("%s/%gkm", q.name, radius), func(b *testing.B) {
+				var users []domain.User
+				var err error
+				for range b.N {
+					if users, err = q.run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(users)), "rows")
+				b.ReportMetric(float64(missed(users)), "missed-of-50")
+			})
+		}
+	}
+}
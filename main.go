@@ -1,18 +1,81 @@
 package main
 
 import (
+	"aika/internal/repository"
+	"aika/traits/database"
+	"context"
 	"database/sql"
+	"encoding/csv"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/xuri/excelize/v2"
 )
 
 func main() {
 	dbPath := flag.String("db", "./aika.db", "path to SQLite DB")
+	excelPath := flag.String("excel", "./document/just_users.xlsx", "path to the just users spreadsheet (.xlsx or .csv)")
+	format := flag.String("format", formatAuto, "input format: auto (by extension), xlsx or csv")
+	dryRun := flag.Bool("dry-run", false, "parse and validate the spreadsheet, then roll back instead of committing")
+	verbose := flag.Bool("verbose", false, "log every skipped row with the reason")
+	sheet := flag.String("sheet", "", "xlsx sheet to import (default: the first sheet)")
+	batchSize := flag.Int("batch", 5000, "rows per transaction")
+	var rejects string
+	flag.StringVar(&rejects, "rejects", "", "write a CSV report of rejected rows and unparseable dates to this path (none by default)")
+	flag.StringVar(&rejects, "report", "", "alias for -rejects")
+	progress := flag.Bool("progress", false, fmt.Sprintf("log running counts every %d rows", progressEvery))
+	mode := flag.String("mode", modeInsert, "how rows already in just are handled: insert (leave them), upsert (refresh userName) or replace (refresh userName and dataRegistred)")
+	skipIDs := idSet{}
+	flag.Var(skipIDs, "skip-id", "id_user to leave out of the import (repeatable)")
+	flag.Var(skipIDs, "skip-ids", "comma-separated id_user values to leave out of the import")
+	skipFile := flag.String("skip-file", "", "file of id_user values to leave out of the import, one per line (# starts a comment)")
+	export := flag.Bool("export", false, "write the just table to an xlsx instead of importing")
+	exportDir := flag.String("export-dir", "./document", "directory for the -export file")
+	since := flag.String("since", "", "with -export: only rows registered on or after this date (YYYY-MM-DD)")
+	until := flag.String("until", "", "with -export: only rows registered on or before this date (YYYY-MM-DD)")
 
 	flag.Parse()
 
+	if *batchSize < 1 {
+		log.Fatalf("-batch must be at least 1")
+	}
+	switch *mode {
+	case modeInsert, modeUpsert, modeReplace:
+	default:
+		log.Fatalf("unknown -mode %q (want %s, %s or %s)", *mode, modeInsert, modeUpsert, modeReplace)
+	}
+
+	if *skipFile != "" {
+		if err := skipIDs.load(*skipFile); err != nil {
+			log.Fatalf("-skip-file: %v", err)
+		}
+	}
+	if len(skipIDs) == 0 {
+		if env := os.Getenv("MIGRATE_SKIP_IDS"); env != "" {
+			if err := skipIDs.Set(env); err != nil {
+				log.Fatalf("MIGRATE_SKIP_IDS: %v", err)
+			}
+		}
+	}
+	if len(skipIDs) > 0 {
+		log.Printf("Skip list: %d user ids", len(skipIDs))
+	}
+
+	// sqlite creates a missing file on open, which a dry run must not do
+	if *dryRun && !*export {
+		if _, err := os.Stat(*dbPath); err != nil {
+			log.Fatalf("dry run: %v", err)
+		}
+	}
 	db, err := sql.Open("sqlite3", *dbPath)
 	if err != nil {
 		log.Fatalf("open db: %v", err)
@@ -25,7 +88,563 @@ func main() {
 
 	//db.Exec(`DROP table users`)
 
+	ctx := context.Background()
+	if *dryRun && !*export {
+		// a dry run writes nothing, schema migrations included
+		if err := checkJustSchema(ctx, db); err != nil {
+			log.Fatalf("dry run: %v", err)
+		}
+	} else if err := database.Migrate(ctx, db); err != nil {
+		log.Fatalf("migrate schema: %v", err)
+	}
+
+	if *export {
+		sinceT, err := parseDateFlag("since", *since, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		untilT, err := parseDateFlag("until", *until, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path, n, err := exportJustToXLSX(ctx, db, exportOptions{Dir: *exportDir, Since: sinceT, Until: untilT, Progress: *progress})
+		if err != nil {
+			log.Fatalf("export just: %v", err)
+		}
+		log.Printf("Exported %d rows to %s", n, path)
+		return
+	}
+
+	opts := migrateOptions{DryRun: *dryRun, Verbose: *verbose, SkipIDs: skipIDs, Sheet: *sheet, Format: *format, Progress: *progress,
+		BatchSize: *batchSize, RejectsPath: rejects, Mode: *mode}
+	if err := migrateExcelToJust(ctx, db, *excelPath, opts); err != nil {
+		if errors.Is(err, errInvalidRows) {
+			log.Printf("dry run: %v", err)
+			os.Exit(2)
+		}
+		log.Fatalf("migrate excel: %v", err)
+	}
 
 	log.Println("Migration finished.")
 }
 
+// errInvalidRows fails a dry run whose spreadsheet has rows that would not import cleanly,
+// so the tool can gate an import pipeline
+var errInvalidRows = errors.New("spreadsheet has invalid rows")
+
+// rejectSampleSize is how many rejected rows a dry run prints when -verbose is off
+const rejectSampleSize = 10
+
+// progressEvery is how many spreadsheet rows pass between -progress log lines
+const progressEvery = 10000
+
+// Import modes for users that are already in just (-mode)
+const (
+	// modeInsert leaves existing rows as they are
+	modeInsert = "insert"
+	// modeUpsert refreshes userName; dataRegistred keeps the original registration date
+	modeUpsert = "upsert"
+	// modeReplace overwrites both userName and dataRegistred with the spreadsheet values
+	modeReplace = "replace"
+)
+
+type migrateOptions struct {
+	// DryRun runs every insert inside a transaction that is rolled back at the end
+	DryRun  bool
+	Verbose bool
+	// SkipIDs are id_user values that are never imported
+	SkipIDs idSet
+	// Sheet names the sheet to read; empty means the first one
+	Sheet string
+	// Format is formatAuto, formatXLSX or formatCSV
+	Format string
+	// Progress logs running counts every progressEvery rows
+	Progress bool
+	// BatchSize is how many rows go into one transaction
+	BatchSize int
+	// RejectsPath is where rejected rows are written as CSV; empty writes no report
+	RejectsPath string
+	// Mode is modeInsert, modeUpsert or modeReplace
+	Mode string
+}
+
+// justColumns are the columns of just the import reads and writes
+var justColumns = []string{"id_user", "userName", "dataRegistred", "updated_at"}
+
+// checkJustSchema makes sure db already has a just table the import can write to,
+// for a dry run that must not migrate the schema itself
+func checkJustSchema(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info('just');`)
+	if err != nil {
+		return fmt.Errorf("read just columns: %w", err)
+	}
+	defer rows.Close()
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("read just columns: %w", err)
+		}
+		have[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read just columns: %w", err)
+	}
+	if len(have) == 0 {
+		return errors.New("table just does not exist; run the import without -dry-run or start the bot once to create the schema")
+	}
+	var missing []string
+	for _, c := range justColumns {
+		if !have[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("just has no %s column; run the import without -dry-run or start the bot once to migrate the schema", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// idSet collects user IDs from a repeatable flag; each value may also be a comma-separated list
+type idSet map[int64]struct{}
+
+func (s idSet) String() string {
+	ids := make([]string, 0, len(s))
+	for id := range s {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func (s idSet) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad user id %q", part)
+		}
+		s[id] = struct{}{}
+	}
+	return nil
+}
+
+// load adds the IDs listed in a file, one per line; blank lines and # comments are ignored
+func (s idSet) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if err := s.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// Reasons a spreadsheet row is not imported
+const (
+	rejectEmptyID = "empty user id"
+	rejectBadID   = "unparseable user id"
+	rejectSkipID  = "skip id"
+	rejectInsert  = "insert failed"
+	// warnBadDate rows are imported with the current time; they are reported but not skipped
+	warnBadDate = "unparseable date"
+)
+
+// rejectedRow is a spreadsheet row that was not imported
+type rejectedRow struct {
+	row    int
+	kind   string
+	reason string
+	values []string
+}
+
+// migrateExcelToJust copies rows of the just users spreadsheet (xlsx or csv) into
+// the just table. Columns are found by header name, falling back to our export
+// layout (ID | User ID | Username | Date Registered).
+// Users already in just are updated according to opts.Mode; rows that would not
+// change anything are counted as unchanged and never written.
+func migrateExcelToJust(ctx context.Context, db *sql.DB, path string, opts migrateOptions) error {
+	rows, err := openRowSource(path, opts.Format, opts.Sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var counts justCounts
+	var badDates int
+	var rejected, badDateRows []rejectedRow
+	rejectedBy := make(map[string]int)
+	reject := func(row int, kind, reason string, values []string) {
+		rejected = append(rejected, rejectedRow{row: row, kind: kind, reason: reason, values: values})
+		rejectedBy[kind]++
+		if opts.Verbose {
+			log.Printf("row %d: skipped: %s", row, reason)
+		}
+	}
+
+	// a dry run keeps one transaction for the whole file and rolls it back;
+	// otherwise every batch is committed on its own so the write lock is held briefly
+	var tx *sql.Tx
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	batch := make([]justRow, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if tx == nil {
+			var err error
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return fmt.Errorf("begin tx: %w", err)
+			}
+		}
+		c, failed, err := writeJustBatch(ctx, tx, batch, opts.Mode)
+		if err != nil {
+			return err
+		}
+		for _, f := range failed {
+			reject(f.row.n, rejectInsert, fmt.Sprintf("write user %d: %v", f.row.userID, f.err), f.row.values)
+		}
+		counts.add(c)
+		batch = batch[:0]
+		if opts.DryRun {
+			return nil
+		}
+		err = tx.Commit()
+		tx = nil
+		if err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		return nil
+	}
+
+	var header []string
+	cols := defaultColumns
+	now := time.Now().Format(repository.RegDateLayout)
+	for i := 0; rows.Next(); i++ {
+		if opts.Progress && i > 0 && i%progressEvery == 0 {
+			log.Printf("… %d rows read: %s, %d skipped", i, counts, len(rejected))
+		}
+		row, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("read row %d: %w", i+1, err)
+		}
+		if i == 0 {
+			header = row
+			cols = matchHeader(row)
+			continue
+		}
+		rawID := cell(row, cols.id)
+		if rawID == "" {
+			reject(i+1, rejectEmptyID, rejectEmptyID, row)
+			continue
+		}
+		userID, err := strconv.ParseInt(rawID, 10, 64)
+		if err != nil || userID <= 0 {
+			reject(i+1, rejectBadID, fmt.Sprintf("unparseable user id %q", rawID), row)
+			continue
+		}
+		if _, ok := opts.SkipIDs[userID]; ok {
+			reject(i+1, rejectSkipID, fmt.Sprintf("user %d is in the skip list", userID), row)
+			continue
+		}
+		userName, rawDate := cell(row, cols.name), cell(row, cols.date)
+
+		dataReg := now
+		if rawDate != "" {
+			if d, ok := repository.NormalizeRegDate(rawDate); ok {
+				dataReg = d
+			} else {
+				log.Printf("row %d: unparseable date %q, using now", i+1, rawDate)
+				badDates++
+				badDateRows = append(badDateRows, rejectedRow{row: i + 1, kind: warnBadDate,
+					reason: fmt.Sprintf("unparseable date %q, imported with the current time", rawDate), values: row})
+			}
+		}
+
+		batch = append(batch, justRow{n: i + 1, userID: userID, userName: userName, dataReg: dataReg, values: row})
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read rows: %w", err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, kind := range []string{rejectEmptyID, rejectBadID, rejectSkipID, rejectInsert} {
+		if n := rejectedBy[kind]; n > 0 {
+			log.Printf("Skipped (%s): %d", kind, n)
+		}
+	}
+	if report := append(slices.Clone(rejected), badDateRows...); opts.RejectsPath != "" && len(report) > 0 {
+		slices.SortStableFunc(report, func(a, b rejectedRow) int { return a.row - b.row })
+		if err := writeRejects(opts.RejectsPath, header, report); err != nil {
+			return fmt.Errorf("write rejects: %w", err)
+		}
+		log.Printf("Report of rejected rows and bad dates written to %s", opts.RejectsPath)
+	}
+
+	if opts.DryRun {
+		log.Printf("Excel migration (%s, dry run, rolled back): would have %s, skipped %d by the skip list and %d invalid, %d unparseable dates",
+			opts.Mode, counts, rejectedBy[rejectSkipID], len(rejected)-rejectedBy[rejectSkipID], badDates)
+		if !opts.Verbose {
+			for _, r := range rejected[:min(len(rejected), rejectSampleSize)] {
+				log.Printf("  row %d: %s", r.row, r.reason)
+			}
+		}
+		// skip-list rows are left out on purpose, everything else needs a look before the real import
+		if invalid := len(rejected) - rejectedBy[rejectSkipID] + badDates; invalid > 0 {
+			return fmt.Errorf("%w: %d", errInvalidRows, invalid)
+		}
+		return nil
+	}
+
+	log.Printf("Excel migration (%s): %s, skipped %d by the skip list and %d invalid, %d unparseable dates",
+		opts.Mode, counts, rejectedBy[rejectSkipID], len(rejected)-rejectedBy[rejectSkipID], badDates)
+	return nil
+}
+
+// justRow is a validated spreadsheet row waiting to be inserted
+type justRow struct {
+	n        int // 1-based spreadsheet row
+	userID   int64
+	userName string
+	dataReg  string
+	values   []string
+}
+
+// failedRow is a row the database refused during the row-by-row fallback
+type failedRow struct {
+	row justRow
+	err error
+}
+
+// justCounts tallies what happened to the rows that reached the database
+type justCounts struct {
+	inserted, updated, unchanged int
+}
+
+func (c *justCounts) add(o justCounts) {
+	c.inserted += o.inserted
+	c.updated += o.updated
+	c.unchanged += o.unchanged
+}
+
+func (c justCounts) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d unchanged", c.inserted, c.updated, c.unchanged)
+}
+
+// Outcomes of comparing a spreadsheet row with the just table
+const (
+	rowNew = iota
+	rowChanged
+	rowSame
+)
+
+// maxInParams keeps IN lists and multi-row statements under SQLite's 999 bound-parameter limit
+const maxInParams = 900
+
+// insertChunkRows is how many rows go into one multi-row statement
+const insertChunkRows = maxInParams / 3
+
+// writeJustBatch compares the batch with the just table, then inserts the new
+// rows and, unless mode is modeInsert, updates the changed ones. If a statement
+// fails the batch is rolled back to a savepoint and retried row by row, so one
+// bad row only costs itself.
+func writeJustBatch(ctx context.Context, tx *sql.Tx, batch []justRow, mode string) (justCounts, []failedRow, error) {
+	kinds, err := classifyJustRows(ctx, tx, batch, mode)
+	if err != nil {
+		return justCounts{}, nil, fmt.Errorf("compare with just: %w", err)
+	}
+	var counts justCounts
+	var writes []justRow
+	var writeKinds []int
+	for i, r := range batch {
+		if kinds[i] == rowSame {
+			counts.unchanged++
+			continue
+		}
+		writes = append(writes, r)
+		writeKinds = append(writeKinds, kinds[i])
+	}
+	count := func(kind int) {
+		if kind == rowNew {
+			counts.inserted++
+		} else {
+			counts.updated++
+		}
+	}
+	if len(writes) == 0 {
+		return counts, nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT just_batch"); err != nil {
+		return justCounts{}, nil, fmt.Errorf("savepoint: %w", err)
+	}
+	err = writeJustChunks(ctx, tx, writes, mode)
+	if err == nil {
+		if _, err := tx.ExecContext(ctx, "RELEASE just_batch"); err != nil {
+			return justCounts{}, nil, fmt.Errorf("release savepoint: %w", err)
+		}
+		for _, k := range writeKinds {
+			count(k)
+		}
+		return counts, nil, nil
+	}
+	log.Printf("batch at row %d failed (%v), retrying row by row", batch[0].n, err)
+	if _, err := tx.ExecContext(ctx, "ROLLBACK TO just_batch"); err != nil {
+		return justCounts{}, nil, fmt.Errorf("rollback to savepoint: %w", err)
+	}
+
+	var failed []failedRow
+	for i, r := range writes {
+		if err := writeJustChunks(ctx, tx, []justRow{r}, mode); err != nil {
+			failed = append(failed, failedRow{row: r, err: err})
+			continue
+		}
+		count(writeKinds[i])
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE just_batch"); err != nil {
+		return justCounts{}, nil, fmt.Errorf("release savepoint: %w", err)
+	}
+	return counts, failed, nil
+}
+
+// classifyJustRows says for every batch row whether it is new, would change the
+// existing just row under mode, or would leave it as it is. A user repeated in
+// the spreadsheet is compared with its earlier occurrence.
+func classifyJustRows(ctx context.Context, tx *sql.Tx, batch []justRow, mode string) ([]int, error) {
+	type stored struct{ userName, dataReg string }
+	existing := make(map[int64]stored, len(batch))
+	for start := 0; start < len(batch); start += maxInParams {
+		chunk := batch[start:min(start+maxInParams, len(batch))]
+		args := make([]interface{}, len(chunk))
+		for i, r := range chunk {
+			args[i] = r.userID
+		}
+		q := `SELECT id_user, userName, dataRegistred FROM just WHERE id_user IN (?` + strings.Repeat(",?", len(chunk)-1) + `)`
+		rows, err := tx.QueryContext(ctx, q, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var st stored
+			if err := rows.Scan(&id, &st.userName, &st.dataReg); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			existing[id] = st
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	kinds := make([]int, len(batch))
+	for i, r := range batch {
+		st, ok := existing[r.userID]
+		switch {
+		case !ok:
+			kinds[i] = rowNew
+			existing[r.userID] = stored{userName: r.userName, dataReg: r.dataReg}
+			continue
+		case mode == modeUpsert && st.userName != r.userName:
+			kinds[i] = rowChanged
+			st.userName = r.userName
+		case mode == modeReplace && (st.userName != r.userName || st.dataReg != r.dataReg):
+			kinds[i] = rowChanged
+			st = stored{userName: r.userName, dataReg: r.dataReg}
+		default:
+			kinds[i] = rowSame
+		}
+		existing[r.userID] = st
+	}
+	return kinds, nil
+}
+
+// justConflictClause is what each mode does when id_user is already in just;
+// the WHERE keeps rows that already hold the values from being rewritten
+var justConflictClause = map[string]string{
+	modeUpsert: ` ON CONFLICT(id_user) DO UPDATE SET userName = excluded.userName, updated_at = datetime('now')
+		WHERE just.userName IS NOT excluded.userName`,
+	modeReplace: ` ON CONFLICT(id_user) DO UPDATE SET userName = excluded.userName, dataRegistred = excluded.dataRegistred, updated_at = datetime('now')
+		WHERE just.userName IS NOT excluded.userName OR just.dataRegistred IS NOT excluded.dataRegistred`,
+}
+
+func writeJustChunks(ctx context.Context, tx *sql.Tx, rows []justRow, mode string) error {
+	verb := "INSERT OR IGNORE INTO"
+	conflict, ok := justConflictClause[mode]
+	if ok {
+		verb = "INSERT INTO"
+	}
+	for start := 0; start < len(rows); start += insertChunkRows {
+		chunk := rows[start:min(start+insertChunkRows, len(rows))]
+		var q strings.Builder
+		q.WriteString(verb + " just (id_user, userName, dataRegistred, updated_at) VALUES ")
+		args := make([]interface{}, 0, len(chunk)*3)
+		for i, r := range chunk {
+			if i > 0 {
+				q.WriteString(", ")
+			}
+			q.WriteString("(?, ?, ?, datetime('now'))")
+			args = append(args, r.userID, r.userName, r.dataReg)
+		}
+		q.WriteString(conflict)
+		if _, err := tx.ExecContext(ctx, q.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRejects saves the rejected rows with their reason so they can be fixed and re-imported
+func writeRejects(path string, header []string, rejected []rejectedRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(append([]string{"row", "kind", "reason"}, header...))
+	for _, r := range rejected {
+		w.Write(append([]string{strconv.Itoa(r.row), r.kind, r.reason}, r.values...))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// pickSheet returns the requested sheet, or the first one when name is empty
+func pickSheet(f *excelize.File, name string) (string, error) {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+	if name == "" {
+		return sheets[0], nil
+	}
+	if idx, err := f.GetSheetIndex(name); err != nil || idx < 0 {
+		return "", fmt.Errorf("sheet %q not found, available sheets: %s", name, strings.Join(sheets, ", "))
+	}
+	return name, nil
+}
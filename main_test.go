@@ -0,0 +1,412 @@
+package main
+
+import (
+	"aika/internal/repository"
+	"aika/traits/database"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// newMigrateDB opens a migrated SQLite database the way main does
+func newMigrateDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// writeSheet writes a CSV spreadsheet in our export layout and returns its path
+func writeSheet(t *testing.T, rows ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "just.csv")
+	data := "№,User ID,Username,Date Registered\n" + strings.Join(rows, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testMigrateOptions() migrateOptions {
+	return migrateOptions{SkipIDs: idSet{}, Format: formatAuto, BatchSize: 2, Mode: modeInsert}
+}
+
+// justDates returns dataRegistred by id_user
+func justDates(t *testing.T, db *sql.DB) map[int64]string {
+	t.Helper()
+	rows, err := db.Query(`SELECT id_user, dataRegistred FROM just;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	dates := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var d string
+		if err := rows.Scan(&id, &d); err != nil {
+			t.Fatal(err)
+		}
+		dates[id] = d
+	}
+	return dates
+}
+
+func TestMigrateNormalizesDates(t *testing.T) {
+	db := newMigrateDB(t)
+	path := writeSheet(t,
+		"1,101,serial,45356.5",
+		"2,102,dotted,05.03.2024",
+		`3,103,iso,2024-03-05T14:30:15`,
+		"4,104,us,3/5/2024 14:30",
+		"5,105,canonical,2024-03-05 14:30:15",
+		"6,106,garbage,someday",
+		"7,107,empty,",
+	)
+	opts := testMigrateOptions()
+	opts.RejectsPath = filepath.Join(t.TempDir(), "rejects.csv")
+
+	before := time.Now().Add(-time.Second)
+	if err := migrateExcelToJust(context.Background(), db, path, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	dates := justDates(t, db)
+	want := map[int64]string{
+		101: "2024-03-05 12:00:00",
+		102: "2024-03-05 00:00:00",
+		103: "2024-03-05 14:30:15",
+		104: "2024-03-05 14:30:00",
+		105: "2024-03-05 14:30:15",
+	}
+	for id, d := range want {
+		if dates[id] != d {
+			t.Errorf("user %d: dataRegistred %q, want %q", id, dates[id], d)
+		}
+	}
+	// unparseable and missing dates are imported with the current time
+	for _, id := range []int64{106, 107} {
+		d, err := time.ParseInLocation(repository.RegDateLayout, dates[id], time.Local)
+		if err != nil || d.Before(before.Truncate(time.Second)) {
+			t.Errorf("user %d: dataRegistred %q, want now", id, dates[id])
+		}
+	}
+
+	report, err := os.ReadFile(opts.RejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "someday") || strings.Contains(string(report), "canonical") {
+		t.Errorf("report should list only the unparseable date:\n%s", report)
+	}
+}
+
+func TestMigrateDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		rows    []string
+		invalid bool
+	}{
+		{"valid", []string{"1,101,a,2024-03-05", "2,102,b,2024-03-06", "3,103,c,2024-03-07"}, false},
+		{"invalid rows", []string{"1,101,a,2024-03-05", "2,,b,2024-03-06", "3,abc,c,2024-03-07", "4,104,d,someday"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no report file either, wherever the tool runs from
+			cwd := t.TempDir()
+			t.Chdir(cwd)
+			db := newMigrateDB(t)
+			if _, err := db.Exec(`INSERT INTO just (id_user, userName, dataRegistred) VALUES (101, 'old', '2020-01-01 00:00:00');`); err != nil {
+				t.Fatal(err)
+			}
+			for _, mode := range []string{modeInsert, modeUpsert, modeReplace} {
+				opts := testMigrateOptions()
+				opts.DryRun, opts.Verbose, opts.Mode = true, true, mode
+				err := migrateExcelToJust(ctx, db, writeSheet(t, tt.rows...), opts)
+				if tt.invalid != errors.Is(err, errInvalidRows) || (!tt.invalid && err != nil) {
+					t.Fatalf("%s: err = %v, want invalid=%v", mode, err, tt.invalid)
+				}
+
+				dates := justDates(t, db)
+				if len(dates) != 1 || dates[101] != "2020-01-01 00:00:00" {
+					t.Fatalf("%s: just = %v after a dry run, want only the original row", mode, dates)
+				}
+				var name string
+				db.QueryRow(`SELECT userName FROM just WHERE id_user = 101;`).Scan(&name)
+				if name != "old" {
+					t.Fatalf("%s: userName = %q after a dry run", mode, name)
+				}
+			}
+			if files, _ := os.ReadDir(cwd); len(files) != 0 {
+				t.Errorf("dry run wrote %v", files)
+			}
+		})
+	}
+}
+
+func TestCheckJustSchema(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"empty file", "", "does not exist"},
+		{"before migrations", `CREATE TABLE just (id INTEGER PRIMARY KEY, id_user INTEGER, userName TEXT, dataRegistred TEXT);`, "no updated_at column"},
+	}
+	for _, tt := range tests {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if tt.schema != "" {
+			if _, err := db.Exec(tt.schema); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := checkJustSchema(ctx, db); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		// the check leaves the schema alone
+		var tables int
+		db.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name != 'just';`).Scan(&tables)
+		if tables != 0 {
+			t.Errorf("%s: %d tables created by the check", tt.name, tables)
+		}
+	}
+
+	if err := checkJustSchema(ctx, newMigrateDB(t)); err != nil {
+		t.Errorf("migrated db: %v", err)
+	}
+}
+
+func TestMigrateSkipsEveryListedID(t *testing.T) {
+	db := newMigrateDB(t)
+	path := writeSheet(t,
+		"1,101,a,2024-03-05",
+		"2,102,b,2024-03-05",
+		"3,103,c,2024-03-05",
+		"4,104,d,2024-03-05",
+		"5,105,e,2024-03-05",
+		"6,106,f,2024-03-05",
+	)
+	skipFile := filepath.Join(t.TempDir(), "skip.txt")
+	if err := os.WriteFile(skipFile, []byte("# test accounts\n106\n\n999 # not in the sheet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testMigrateOptions()
+	opts.RejectsPath = filepath.Join(t.TempDir(), "rejects.csv")
+	// the same set collects -skip-ids, repeated -skip-id and -skip-file
+	if err := opts.SkipIDs.Set("102, 104"); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.SkipIDs.Set("105"); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.SkipIDs.load(skipFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := opts.SkipIDs.String(); got != "102,104,105,106,999" {
+		t.Fatalf("skip list = %s", got)
+	}
+
+	if err := migrateExcelToJust(context.Background(), db, path, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	dates := justDates(t, db)
+	for _, id := range []int64{101, 103} {
+		if _, ok := dates[id]; !ok {
+			t.Errorf("user %d was not imported", id)
+		}
+	}
+	for _, id := range []int64{102, 104, 105, 106} {
+		if _, ok := dates[id]; ok {
+			t.Errorf("user %d is on the skip list but was imported", id)
+		}
+	}
+	if len(dates) != 2 {
+		t.Errorf("imported %d rows, want 2", len(dates))
+	}
+
+	report, err := os.ReadFile(opts.RejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(report), rejectSkipID); n != 4 {
+		t.Errorf("report lists %d skipped rows, want 4:\n%s", n, report)
+	}
+}
+
+// writeTwoSheetWorkbook writes an xlsx whose first tab is a summary and whose
+// second tab holds the users in our export layout
+func writeTwoSheetWorkbook(t *testing.T) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Summary")
+	f.SetSheetRow("Summary", "A1", &[]any{"Report", "Total"})
+	f.SetSheetRow("Summary", "A2", &[]any{"just", 2})
+	if _, err := f.NewSheet("Users"); err != nil {
+		t.Fatal(err)
+	}
+	f.SetSheetRow("Users", "A1", &[]any{"№", "User ID", "Username", "Date Registered"})
+	f.SetSheetRow("Users", "A2", &[]any{1, 201, "first", "2024-03-05"})
+	f.SetSheetRow("Users", "A3", &[]any{2, 202, "second", "2024-03-06"})
+	path := filepath.Join(t.TempDir(), "two-sheets.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateTwoSheetWorkbook(t *testing.T) {
+	path := writeTwoSheetWorkbook(t)
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.GetSheetList(); !reflect.DeepEqual(got, []string{"Summary", "Users"}) {
+		t.Fatalf("sheets = %v", got)
+	}
+	for sheet, want := range map[string][]string{
+		"Summary": {"Report", "Total"},
+		"Users":   {"№", "User ID", "Username", "Date Registered"},
+	} {
+		rows, err := f.GetRows(sheet)
+		if err != nil || len(rows) == 0 || !reflect.DeepEqual(rows[0], want) {
+			t.Errorf("%s header = %v (%v), want %v", sheet, rows, err, want)
+		}
+	}
+	f.Close()
+
+	db := newMigrateDB(t)
+	opts := testMigrateOptions()
+	opts.Sheet = "Users"
+	if err := migrateExcelToJust(context.Background(), db, path, opts); err != nil {
+		t.Fatal(err)
+	}
+	dates := justDates(t, db)
+	want := map[int64]string{201: "2024-03-05 00:00:00", 202: "2024-03-06 00:00:00"}
+	if !reflect.DeepEqual(dates, want) {
+		t.Errorf("just = %v, want %v", dates, want)
+	}
+
+	opts.Sheet = "Missing"
+	err = migrateExcelToJust(context.Background(), db, path, opts)
+	if err == nil || !strings.Contains(err.Error(), `"Missing"`) || !strings.Contains(err.Error(), "Summary, Users") {
+		t.Errorf("unknown sheet: err = %v, want it to list the available sheets", err)
+	}
+}
+
+// writeLargeWorkbook generates an xlsx in our export layout with n user rows. It is
+// written through a StreamWriter, so the fixture itself doesn't need n rows in memory.
+func writeLargeWorkbook(tb testing.TB, n int) string {
+	tb.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := sw.SetRow("A1", []any{"№", "User ID", "Username", "Date Registered"}); err != nil {
+		tb.Fatal(err)
+	}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= n; i++ {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		row := []any{i, 1_000_000 + i, "user" + strconv.Itoa(i), start.Add(time.Duration(i) * time.Minute).Format("2006-01-02 15:04:05")}
+		if err := sw.SetRow(cell, row); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(tb.TempDir(), "large.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// peakHeap samples the heap in use until stop is called and returns the largest value seen
+func peakHeap() (stop func() uint64) {
+	var peak uint64
+	var mu sync.Mutex
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			mu.Lock()
+			peak = max(peak, m.HeapInuse)
+			mu.Unlock()
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak
+	}
+}
+
+// BenchmarkMigrateLargeWorkbook imports generated workbooks of growing size; the
+// peak-heap-MB metric should stay roughly the same from 50k to 500k rows.
+func BenchmarkMigrateLargeWorkbook(b *testing.B) {
+	for _, n := range []int{50_000, 500_000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			path := writeLargeWorkbook(b, n)
+			opts := testMigrateOptions()
+			opts.BatchSize = 5000
+			b.ResetTimer()
+			var peak uint64
+			for range b.N {
+				b.StopTimer()
+				db := newMigrateDB(b)
+				runtime.GC()
+				stop := peakHeap()
+				b.StartTimer()
+				if err := migrateExcelToJust(context.Background(), db, path, opts); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				peak = max(peak, stop())
+				var count int
+				if err := db.QueryRow(`SELECT COUNT(*) FROM just;`).Scan(&count); err != nil || count != n {
+					b.Fatalf("imported %d rows (%v), want %d", count, err, n)
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+		})
+	}
+}
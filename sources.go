@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Input formats accepted by -format
+const (
+	formatAuto = "auto"
+	formatXLSX = "xlsx"
+	formatCSV  = "csv"
+)
+
+// rowSource streams the rows of an input file, header included
+type rowSource interface {
+	Next() bool
+	Columns() ([]string, error)
+	Err() error
+	Close() error
+}
+
+// openRowSource opens path as xlsx or csv; formatAuto picks by file extension
+func openRowSource(path, format, sheet string) (rowSource, error) {
+	if format == formatAuto {
+		format = formatXLSX
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = formatCSV
+		}
+	}
+	switch format {
+	case formatXLSX:
+		return openXLSXSource(path, sheet)
+	case formatCSV:
+		return openCSVSource(path)
+	default:
+		return nil, fmt.Errorf("unknown format %q (want %s, %s or %s)", format, formatAuto, formatXLSX, formatCSV)
+	}
+}
+
+type xlsxSource struct {
+	f    *excelize.File
+	rows *excelize.Rows
+}
+
+func openXLSXSource(path, sheetName string) (*xlsxSource, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	sheet, err := pickSheet(f, sheetName)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	log.Printf("Reading sheet %q", sheet)
+	// rows are streamed one at a time so large workbooks are never held in memory
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+	return &xlsxSource{f: f, rows: rows}, nil
+}
+
+func (s *xlsxSource) Next() bool { return s.rows.Next() }
+
+// Columns returns raw values so date cells stay serial numbers instead of the cell's display format
+func (s *xlsxSource) Columns() ([]string, error) {
+	return s.rows.Columns(excelize.Options{RawCellValue: true})
+}
+
+func (s *xlsxSource) Err() error { return s.rows.Error() }
+
+func (s *xlsxSource) Close() error {
+	s.rows.Close()
+	return s.f.Close()
+}
+
+type csvSource struct {
+	file *os.File
+	r    *csv.Reader
+	row  []string
+	err  error
+}
+
+// csvSniffSize is how much of a CSV file is inspected for its encoding and delimiter
+const csvSniffSize = 64 * 1024
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// openCSVSource reads UTF-8 (with or without BOM) or Windows-1251 CSV,
+// delimited by commas or semicolons
+func openCSVSource(path string) (*csvSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	br := bufio.NewReaderSize(file, csvSniffSize)
+	head, err := br.Peek(csvSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		file.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var r io.Reader = br
+	encoding := "UTF-8"
+	switch {
+	case bytes.HasPrefix(head, utf8BOM):
+		br.Discard(len(utf8BOM))
+		head = head[len(utf8BOM):]
+		encoding = "UTF-8 with BOM"
+	case !validUTF8Prefix(head):
+		r = transform.NewReader(br, charmap.Windows1251.NewDecoder())
+		head, _ = charmap.Windows1251.NewDecoder().Bytes(head)
+		encoding = "Windows-1251"
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = sniffDelimiter(head)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	log.Printf("Reading CSV (%s, delimiter %q)", encoding, cr.Comma)
+	return &csvSource{file: file, r: cr}, nil
+}
+
+// validUTF8Prefix reports whether b is UTF-8, allowing a rune cut off by the sniff window
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
+
+// sniffDelimiter picks ';' when the first line has more semicolons than commas (outside quotes)
+func sniffDelimiter(head []byte) rune {
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	var commas, semicolons int
+	quoted := false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ',':
+			commas++
+		case c == ';':
+			semicolons++
+		}
+	}
+	if semicolons > commas {
+		return ';'
+	}
+	return ','
+}
+
+func (s *csvSource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	s.row, s.err = s.r.Read()
+	return s.err == nil
+}
+
+func (s *csvSource) Columns() ([]string, error) { return s.row, nil }
+
+func (s *csvSource) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+func (s *csvSource) Close() error { return s.file.Close() }
+
+// columnMap says where the user id, username and registration date are in a row
+type columnMap struct {
+	id, name, date int
+}
+
+// defaultColumns is the layout of our own exports: № | User ID | Username | Date Registered
+var defaultColumns = columnMap{id: 1, name: 2, date: 3}
+
+// headerAliases maps normalized header names to the just column they fill
+var headerAliases = map[string]string{
+	"userid": "id", "iduser": "id", "telegramid": "id", "tgid": "id",
+	"username": "name", "name": "name", "nickname": "name",
+	"dateregistered": "date", "dataregistred": "date", "dataregistered": "date",
+	"registered": "date", "registeredat": "date", "date": "date", "тіркелгенкүні": "date",
+	// Windows-1251 files from partners usually come with Russian headers
+	"пользователь": "name", "имя": "name", "имяпользователя": "name", "датарегистрации": "date",
+}
+
+func normalizeHeader(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "\uFEFF")))
+	return strings.NewReplacer(" ", "", "_", "", "-", "", ".", "").Replace(s)
+}
+
+// matchHeader finds the columns by header name. Files whose header has no
+// recognizable user id column fall back to defaultColumns.
+func matchHeader(header []string) columnMap {
+	cols := columnMap{id: -1, name: -1, date: -1}
+	for i, h := range header {
+		switch headerAliases[normalizeHeader(h)] {
+		case "id":
+			if cols.id < 0 {
+				cols.id = i
+			}
+		case "name":
+			if cols.name < 0 {
+				cols.name = i
+			}
+		case "date":
+			if cols.date < 0 {
+				cols.date = i
+			}
+		}
+	}
+	if cols.id < 0 {
+		return defaultColumns
+	}
+	return cols
+}
+
+// cell returns the trimmed value at i, "" when the row is shorter or i is unset
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
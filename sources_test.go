@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// csvFixtureRows has Cyrillic, commas, quotes and a newline inside cells. Every
+// letter is in Windows-1251 too, so the same rows serve both encodings.
+var csvFixtureRows = [][]string{
+	{"№", "User ID", "Username", "Дата регистрации"},
+	{"1", "101", "Айгерім", "05.03.2024"},
+	{"2", "102", "Иванов, Пётр", "2024-03-06"},
+	{"3", "103", `"Босс"`, "2024-03-07"},
+	{"4", "104", "бір\nекі", "2024-03-08"},
+}
+
+const (
+	csvFixtureComma = "№,User ID,Username,Дата регистрации\n" +
+		"1,101,Айгерім,05.03.2024\n" +
+		"2,102,\"Иванов, Пётр\",2024-03-06\n" +
+		"3,103,\"\"\"Босс\"\"\",2024-03-07\n" +
+		"4,104,\"бір\nекі\",2024-03-08\n"
+	csvFixtureSemicolon = "№;User ID;Username;Дата регистрации\n" +
+		"1;101;Айгерім;05.03.2024\n" +
+		"2;102;Иванов, Пётр;2024-03-06\n" +
+		"3;103;\"\"\"Босс\"\"\";2024-03-07\n" +
+		"4;104;\"бір\nекі\";2024-03-08\n"
+)
+
+func TestCSVSourceEncodings(t *testing.T) {
+	win1251 := func(s string) []byte {
+		b, err := charmap.Windows1251.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := map[string][]byte{
+		"utf-8 comma":              []byte(csvFixtureComma),
+		"utf-8 with BOM":           append([]byte("\uFEFF"), csvFixtureComma...),
+		"utf-8 semicolon":          []byte(csvFixtureSemicolon),
+		"windows-1251 comma":       win1251(csvFixtureComma),
+		"windows-1251 semicolon":   win1251(csvFixtureSemicolon),
+		"utf-8 with BOM semicolon": append([]byte("\uFEFF"), csvFixtureSemicolon...),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "just.csv")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			src, err := openCSVSource(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			var got [][]string
+			for src.Next() {
+				row, _ := src.Columns()
+				got = append(got, row)
+			}
+			if err := src.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, csvFixtureRows) {
+				t.Errorf("rows = %q\nwant %q", got, csvFixtureRows)
+			}
+		})
+	}
+}
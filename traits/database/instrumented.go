@@ -0,0 +1,47 @@
+package database
+
+import (
+	"aika/internal/metrics"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// instrumentedDriverName is the go-sqlite3 driver with statement timings in metrics.SQLiteDuration
+const instrumentedDriverName = "sqlite3_instrumented"
+
+func init() {
+	sql.Register(instrumentedDriverName, instrumentedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+type instrumentedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// instrumentedConn times ExecContext and QueryContext; every other method is the
+// embedded connection's, so errors (e.g. sqlite3.Error constraint checks) pass through unchanged.
+// A query is timed until its first row is ready, not until the rows are read.
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer metrics.ObserveSQLite("exec", time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer metrics.ObserveSQLite("query", time.Now())
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx so schema steps can run inside a migration
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// migration is one schema step. Plain DDL goes in sql; steps SQL can't express
+// (e.g. adding a column only if missing) use up, and then sql holds the statements
+// up runs on a fresh database so they still feed the checksum.
+type migration struct {
+	version int
+	name    string
+	sql     string
+	up      func(execer) error
+}
+
+// checksum fingerprints an applied migration so later edits to it are caught at startup
+func (m migration) checksum() string {
+	sum := sha256.Sum256([]byte(m.name + "\n" + m.sql))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m migration) apply(tx execer) error {
+	if m.up != nil {
+		return m.up(tx)
+	}
+	_, err := tx.Exec(m.sql)
+	return err
+}
+
+// migrations is the ordered schema history. Append new entries; never edit or reorder applied ones.
+var migrations = []migration{
+	{version: 1, name: "initial schema", sql: createJustTable + createUsersTable, up: CreateTables},
+	{version: 2, name: "likes", sql: createLikesTable},
+	// deleted profiles keep their just row but drop out of audiences
+	{version: 3, name: "just is_active", sql: "ALTER TABLE just ADD COLUMN is_active INTEGER NOT NULL DEFAULT 1", up: func(db execer) error {
+		return addColumnIfMissing(db, "just", "is_active", "INTEGER NOT NULL DEFAULT 1")
+	}},
+	// processed avatar dimensions for layout
+	{version: 4, name: "users avatar size", sql: "ALTER TABLE users ADD COLUMN avatar_width INTEGER NOT NULL DEFAULT 0; ALTER TABLE users ADD COLUMN avatar_height INTEGER NOT NULL DEFAULT 0", up: func(db execer) error {
+		if err := addColumnIfMissing(db, "users", "avatar_width", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		return addColumnIfMissing(db, "users", "avatar_height", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	// which profile fields are hidden from non-matches
+	{version: 5, name: "users visibility", sql: "ALTER TABLE users ADD COLUMN hide_age INTEGER NOT NULL DEFAULT 0; ALTER TABLE users ADD COLUMN hide_about INTEGER NOT NULL DEFAULT 0; ALTER TABLE users ADD COLUMN hide_distance INTEGER NOT NULL DEFAULT 0", up: func(db execer) error {
+		for _, col := range []string{"hide_age", "hide_about", "hide_distance"} {
+			if err := addColumnIfMissing(db, "users", col, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{version: 6, name: "skips", sql: createSkipsTable},
+	{version: 7, name: "users city", sql: "ALTER TABLE users ADD COLUMN city TEXT NOT NULL DEFAULT ''", up: func(db execer) error {
+		return addColumnIfMissing(db, "users", "city", "TEXT NOT NULL DEFAULT ''")
+	}},
+	{version: 8, name: "messages", sql: `
+	CREATE TABLE IF NOT EXISTS messages (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		from_user_id TEXT NOT NULL,
+		to_user_id   TEXT NOT NULL,
+		text         TEXT NOT NULL,
+		created_at   DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_to_user_id ON messages(to_user_id, created_at);
+	`},
+	{version: 9, name: "blocks", sql: `
+	CREATE TABLE IF NOT EXISTS blocks (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		blocker_user_id TEXT NOT NULL,
+		blocked_user_id TEXT NOT NULL,
+		created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(blocker_user_id, blocked_user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_blocks_blocked_user_id ON blocks(blocked_user_id);
+	`},
+	{version: 10, name: "broadcast runs", sql: `
+	CREATE TABLE IF NOT EXISTS broadcast_runs (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		admin_id   INTEGER NOT NULL,
+		audience   TEXT NOT NULL,
+		msg_type   TEXT NOT NULL,
+		file_id    TEXT NOT NULL DEFAULT '',
+		caption    TEXT NOT NULL DEFAULT '',
+		total      INTEGER NOT NULL DEFAULT 0,
+		next_index INTEGER NOT NULL DEFAULT 0,
+		sent       INTEGER NOT NULL DEFAULT 0,
+		failed     INTEGER NOT NULL DEFAULT 0,
+		status     TEXT NOT NULL DEFAULT 'running',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_broadcast_runs_status ON broadcast_runs(status);
+	CREATE TABLE IF NOT EXISTS broadcast_recipients (
+		run_id   INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		user_id  INTEGER NOT NULL,
+		PRIMARY KEY (run_id, position)
+	);
+	`},
+	{version: 11, name: "just broadcast opt-out", sql: "ALTER TABLE just ADD COLUMN broadcast_opt_out INTEGER NOT NULL DEFAULT 0", up: func(db execer) error {
+		return addColumnIfMissing(db, "just", "broadcast_opt_out", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{version: 12, name: "just last_active_at", sql: "ALTER TABLE just ADD COLUMN last_active_at DATETIME; UPDATE just SET last_active_at = updated_at WHERE last_active_at IS NULL", up: func(db execer) error {
+		if err := addColumnIfMissing(db, "just", "last_active_at", "DATETIME"); err != nil {
+			return err
+		}
+		_, err := db.Exec(`UPDATE just SET last_active_at = updated_at WHERE last_active_at IS NULL;`)
+		return err
+	}},
+	{version: 13, name: "broadcast run payload", sql: "ALTER TABLE broadcast_runs ADD COLUMN payload TEXT NOT NULL DEFAULT ''", up: func(db execer) error {
+		return addColumnIfMissing(db, "broadcast_runs", "payload", "TEXT NOT NULL DEFAULT ''")
+	}},
+	{version: 14, name: "user preferences", sql: `
+	CREATE TABLE IF NOT EXISTS user_preferences (
+		user_id    INTEGER PRIMARY KEY,
+		pref_sex   TEXT NOT NULL DEFAULT '',
+		age_min    INTEGER,
+		age_max    INTEGER,
+		radius_km  REAL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`},
+	{version: 15, name: "reports", sql: `
+	CREATE TABLE IF NOT EXISTS reports (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		reporter_tg_id   INTEGER NOT NULL,
+		reported_user_id TEXT NOT NULL,
+		reported_tg_id   INTEGER NOT NULL,
+		reason           TEXT NOT NULL,
+		context          TEXT NOT NULL DEFAULT '',
+		status           TEXT NOT NULL DEFAULT 'pending',
+		resolved_by      INTEGER,
+		created_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at      DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status, created_at);
+	`},
+	{version: 16, name: "banned users", sql: `
+	CREATE TABLE IF NOT EXISTS banned_users (
+		telegram_id INTEGER PRIMARY KEY,
+		reason      TEXT NOT NULL DEFAULT '',
+		created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`},
+	{version: 17, name: "broadcast templates", sql: `
+	CREATE TABLE IF NOT EXISTS broadcast_templates (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT NOT NULL UNIQUE,
+		msg_type   TEXT NOT NULL,
+		file_id    TEXT NOT NULL DEFAULT '',
+		caption    TEXT NOT NULL DEFAULT '',
+		payload    TEXT NOT NULL DEFAULT '',
+		created_by INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`},
+	// run_at is unix seconds so the due check compares numbers, not timestamp strings
+	{version: 18, name: "scheduled broadcasts", sql: `
+	CREATE TABLE IF NOT EXISTS scheduled_broadcasts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		admin_id   INTEGER NOT NULL,
+		msg_type   TEXT NOT NULL,
+		file_id    TEXT NOT NULL DEFAULT '',
+		caption    TEXT NOT NULL DEFAULT '',
+		payload    TEXT NOT NULL DEFAULT '',
+		audience   TEXT NOT NULL,
+		run_at     INTEGER NOT NULL,
+		status     TEXT NOT NULL DEFAULT 'pending',
+		error      TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_broadcasts_due ON scheduled_broadcasts(status, run_at);
+	`},
+	{version: 19, name: "orders", sql: `
+	CREATE TABLE IF NOT EXISTS orders (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id         INTEGER NOT NULL,
+		count           INTEGER NOT NULL,
+		amount          INTEGER NOT NULL,
+		contact         TEXT NOT NULL,
+		receipt_type    TEXT NOT NULL,
+		receipt_file_id TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'new',
+		created_at      DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+	`},
+	{version: 20, name: "just is_unreachable", sql: "ALTER TABLE just ADD COLUMN is_unreachable INTEGER NOT NULL DEFAULT 0", up: func(db execer) error {
+		return addColumnIfMissing(db, "just", "is_unreachable", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	// boosted_until is UTC in SQLite's datetime format, so it compares with CURRENT_TIMESTAMP
+	{version: 21, name: "users verified and boost", sql: "ALTER TABLE users ADD COLUMN verified INTEGER NOT NULL DEFAULT 0; ALTER TABLE users ADD COLUMN boosted_until DATETIME", up: func(db execer) error {
+		if err := addColumnIfMissing(db, "users", "verified", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		return addColumnIfMissing(db, "users", "boosted_until", "DATETIME")
+	}},
+}
+
+// Migrate applies every migration that hasn't been recorded yet, each in its own
+// transaction. Running it again is a no-op. It refuses to continue when an applied
+// migration no longer matches its recorded checksum.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	const stmt = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	// databases migrated before checksums existed get theirs filled in below
+	if err := addColumnIfMissing(db, "schema_migrations", "checksum", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("add schema_migrations.checksum: %w", err)
+	}
+
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		sum, ok := applied[m.version]
+		switch {
+		case !ok:
+			log.Printf("Applying migration %d: %s", m.version, m.name)
+			if err := applyMigration(ctx, db, m); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		case sum == "":
+			if _, err := db.ExecContext(ctx, `UPDATE schema_migrations SET checksum = ? WHERE version = ?;`, m.checksum(), m.version); err != nil {
+				return fmt.Errorf("backfill checksum for migration %d: %w", m.version, err)
+			}
+		case sum != m.checksum():
+			return fmt.Errorf("migration %d (%s) was changed after it was applied: checksum mismatch", m.version, m.name)
+		}
+	}
+
+	log.Printf("Database schema at version %d", migrations[len(migrations)-1].version)
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, checksum FROM schema_migrations;`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var v int
+		var sum string
+		if err := rows.Scan(&v, &sum); err != nil {
+			return nil, err
+		}
+		applied[v] = sum
+	}
+	return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?);`, m.version, m.name, m.checksum()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion returns the highest applied migration version, 0 for a fresh database
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var v int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateTwice(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	latest := migrations[len(migrations)-1].version
+
+	for run := 1; run <= 2; run++ {
+		db, err := InitDatabase(ctx, path, Options{})
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if err := Migrate(ctx, db); err != nil {
+			t.Fatalf("run %d: migrate again: %v", run, err)
+		}
+		v, err := SchemaVersion(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != latest {
+			t.Fatalf("run %d: version %d, want %d", run, v, latest)
+		}
+		var n int
+		db.QueryRowContext(ctx, `SELECT COUNT(1) FROM schema_migrations;`).Scan(&n)
+		if n != len(migrations) {
+			t.Fatalf("run %d: %d recorded migrations, want %d", run, n, len(migrations))
+		}
+		if ok, err := columnExists(db, "users", "city"); err != nil || !ok {
+			t.Fatalf("run %d: users.city missing: %v", run, err)
+		}
+		db.Close()
+	}
+}
+
+// TestMigrateLegacyDatabase covers a database created by CreateTables before
+// schema_migrations existed
+func TestMigrateLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO just (id_user, userName, dataRegistred) VALUES (1, 'aru', '2024-01-02 15:04:05');`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM just;`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("just rows = %d, %v; want the legacy row kept", n, err)
+	}
+}
+
+func TestMigrateRejectsEditedMigration(t *testing.T) {
+	ctx := context.Background()
+	db, err := InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'stale' WHERE version = 2;`); err != nil {
+		t.Fatal(err)
+	}
+	err = Migrate(ctx, db)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Migrate = %v, want a checksum mismatch", err)
+	}
+}
+
+// TestMigrationSQLMatchesUp checks that the checksum of every migration with an up
+// function covers what up really runs: its sql alone must build the same schema
+func TestMigrationSQLMatchesUp(t *testing.T) {
+	schema := func(setup func(db *sql.DB) error) string {
+		t.Helper()
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "schema.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := setup(db); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.Query(`SELECT type, name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' ORDER BY name;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var sb strings.Builder
+		for rows.Next() {
+			var typ, name, ddl string
+			if err := rows.Scan(&typ, &name, &ddl); err != nil {
+				t.Fatal(err)
+			}
+			sb.WriteString(typ + " " + name + ": " + ddl + "\n")
+		}
+		return sb.String()
+	}
+
+	for i, m := range migrations {
+		if m.up == nil {
+			continue
+		}
+		// both databases get the migrations before m, then m one way or the other
+		before := func(db *sql.DB) error {
+			for _, prev := range migrations[:i] {
+				if err := prev.apply(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		fromUp := schema(func(db *sql.DB) error {
+			if err := before(db); err != nil {
+				return err
+			}
+			return m.up(db)
+		})
+		fromSQL := schema(func(db *sql.DB) error {
+			if err := before(db); err != nil {
+				return err
+			}
+			_, err := db.Exec(m.sql)
+			return err
+		})
+		if fromUp != fromSQL {
+			t.Errorf("migration %d (%s): sql differs from up:\n--- up\n%s--- sql\n%s", m.version, m.name, fromUp, fromSQL)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,29 +13,92 @@ import (
 
 // Existing CreateTables function remains the same...
 
-// ConnectRedis creates a new Redis client connection
-func ConnectRedis(ctx context.Context, logger *zap.Logger) (*redis.Client, error) {
-	// Redis connection options matching your docker-compose
-	rdb := redis.NewClient(&redis.Options{
-		Addr:         "localhost:6379", // Redis server address
-		Password:     "",               // No password set
-		DB:           0,                // Use default DB
-		DialTimeout:  5 * time.Second,  // Connection timeout
-		ReadTimeout:  3 * time.Second,  // Read timeout
-		WriteTimeout: 3 * time.Second,  // Write timeout
-		PoolSize:     10,               // Connection pool size
-		MinIdleConns: 2,                // Minimum idle connections
-	})
+// RedisOptions configures the Redis connection; zero values keep the go-redis defaults
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	// TLS connects over TLS, as managed Redis services require
+	TLS bool
+	// PoolSize caps the connections per CPU pool; 0 keeps 10 per CPU
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Dialer replaces the TCP dial to Addr when set, e.g. to go through a tunnel
+	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+const (
+	// redisConnectAttempts and redisConnectBackoff bound the initial ping retries:
+	// Redis often comes up after the bot in docker-compose
+	redisConnectAttempts = 5
+	redisConnectBackoff  = 500 * time.Millisecond
+)
+
+// OpenRedis creates a Redis client without checking the connection; go-redis dials
+// lazily, so it works once Redis is reachable
+func OpenRedis(opts RedisOptions) *redis.Client {
+	redisOpts := &redis.Options{
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: 2, // Minimum idle connections
+		Dialer:       opts.Dialer,
+	}
+	if opts.TLS {
+		redisOpts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(redisOpts)
+}
+
+// ConnectRedis creates a new Redis client connection, retrying the first ping with
+// exponential backoff before giving up. It never exits: what a failure means is up
+// to the caller.
+func ConnectRedis(ctx context.Context, opts RedisOptions, logger *zap.Logger) (*redis.Client, error) {
+	return connectRedis(ctx, opts, logger, time.After)
+}
+
+// connectRedis is ConnectRedis with after waiting out the backoffs
+func connectRedis(ctx context.Context, opts RedisOptions, logger *zap.Logger, after func(time.Duration) <-chan time.Time) (*redis.Client, error) {
+	rdb := OpenRedis(opts)
 
 	// Test the connection
-	_, err := rdb.Ping(ctx).Result()
+	var err error
+	backoff := redisConnectBackoff
+	for attempt := 1; attempt <= redisConnectAttempts; attempt++ {
+		if err = rdb.Ping(ctx).Err(); err == nil {
+			break
+		}
+		if attempt == redisConnectAttempts {
+			break
+		}
+		logger.Warn("Redis is not reachable yet, retrying",
+			zap.String("addr", opts.Addr),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			rdb.Close()
+			return nil, fmt.Errorf("failed to connect to Redis at %s: %w", opts.Addr, ctx.Err())
+		case <-after(backoff):
+		}
+		backoff *= 2
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s after %d attempts: %w", opts.Addr, redisConnectAttempts, err)
 	}
 
 	logger.Info("Successfully connected to Redis",
-		zap.String("addr", "localhost:6379"),
-		zap.Int("db", 0))
+		zap.String("addr", opts.Addr),
+		zap.Int("db", opts.DB),
+		zap.Bool("tls", opts.TLS))
 
 	return rdb, nil
 }
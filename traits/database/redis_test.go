@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestConnectRedisBackoff(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  string
+		delays   []time.Duration
+	}{
+		{"up at once", 0, "", nil},
+		{"up after three refusals", 3, "", []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}},
+		{"never up", redisConnectAttempts, "after 5 attempts",
+			[]time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var delays []time.Duration
+			after := func(d time.Duration) <-chan time.Time {
+				mu.Lock()
+				defer mu.Unlock()
+				delays = append(delays, d)
+				c := make(chan time.Time, 1)
+				c <- time.Time{}
+				return c
+			}
+			// Redis refuses connections until the client has backed off tt.failures times
+			dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+				mu.Lock()
+				refused := len(delays) < tt.failures
+				mu.Unlock()
+				if refused {
+					return nil, errors.New("connection refused")
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, network, mr.Addr())
+			}
+			core, logs := observer.New(zapcore.WarnLevel)
+
+			rdb, err := connectRedis(context.Background(), RedisOptions{Addr: "redis:6379", Dialer: dialer}, zap.New(core), after)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				rdb.Close()
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+
+			retries := logs.FilterMessage("Redis is not reachable yet, retrying").All()
+			if len(retries) != len(tt.delays) {
+				t.Errorf("%d retries logged, want %d", len(retries), len(tt.delays))
+			}
+			for i, entry := range retries {
+				if got := entry.ContextMap()["attempt"]; got != int64(i+1) {
+					t.Errorf("retry %d logged attempt %v", i, got)
+				}
+			}
+			if !reflect.DeepEqual(delays, tt.delays) {
+				t.Errorf("delays = %v, want %v", delays, tt.delays)
+			}
+		})
+	}
+}
+
+func TestConnectRedisCancelledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var waits int
+	after := func(time.Duration) <-chan time.Time {
+		waits++
+		cancel()
+		return nil
+	}
+	dialer := func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	_, err := connectRedis(ctx, RedisOptions{Addr: "redis:6379", Dialer: dialer}, zap.NewNop(), after)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if waits != 1 {
+		t.Errorf("waited %d times, want to stop during the first backoff", waits)
+	}
+}
@@ -1,47 +1,114 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-
-	_ "github.com/mattn/go-sqlite3"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Options tunes the SQLite connection; zero values keep the driver defaults
+type Options struct {
+	// JournalMode is passed as _journal_mode, e.g. "WAL" so readers don't block the writer
+	JournalMode string
+	// BusyTimeout makes a locked database wait instead of failing with "database is locked"
+	BusyTimeout time.Duration
+	// MaxOpenConns caps the pool; 1 serialises every query through a single connection
+	MaxOpenConns int
+	// ForeignKeys turns on FOREIGN KEY enforcement, which SQLite leaves off by default
+	ForeignKeys bool
+}
+
 // InitDatabase initializes the SQLite database
-func InitDatabase(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+func InitDatabase(ctx context.Context, dbPath string, opts Options) (*sql.DB, error) {
+	db, err := sql.Open(instrumentedDriverName, sqliteDSN(dbPath, opts))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
 
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Create tables
-	if err := CreateTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	logPragmas(ctx, db)
+
+	// Apply pending schema migrations
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	log.Println("Database initialized successfully")
 	return db, nil
 }
 
-// CreateTables creates all necessary tables
-func CreateTables(db *sql.DB) error {
+// sqliteDSN adds the connection pragmas as go-sqlite3 DSN parameters so that
+// every pooled connection gets them, not just the first one.
+func sqliteDSN(dbPath string, opts Options) string {
+	params := url.Values{}
+	if opts.JournalMode != "" {
+		params.Set("_journal_mode", opts.JournalMode)
+	}
+	if opts.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	}
+	if opts.ForeignKeys {
+		params.Set("_foreign_keys", "on")
+	}
+	if len(params) == 0 {
+		return dbPath
+	}
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + params.Encode()
+}
+
+// logPragmas prints the settings SQLite actually applied, which can differ from
+// the requested ones (e.g. WAL is unavailable for in-memory databases)
+func logPragmas(ctx context.Context, db *sql.DB) {
+	var journal string
+	var busy, fk int
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode;").Scan(&journal); err != nil {
+		log.Printf("read journal_mode: %v", err)
+		return
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA busy_timeout;").Scan(&busy); err != nil {
+		log.Printf("read busy_timeout: %v", err)
+		return
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA foreign_keys;").Scan(&fk); err != nil {
+		log.Printf("read foreign_keys: %v", err)
+		return
+	}
+	log.Printf("SQLite pragmas: journal_mode=%s busy_timeout=%dms foreign_keys=%d", journal, busy, fk)
+}
+
+// CreateTables creates the just and users tables. It is migration 1 and safe to
+// re-run on databases created before schema_migrations existed; every later table
+// and column is a migration of its own.
+func CreateTables(db execer) error {
 	tables := []struct {
 		name string
-		fn   func(*sql.DB) error
-	}{  
+		sql  string
+	}{
 		{"just", createJustTable},
 		{"users", createUsersTable},
 	}
 
 	for _, table := range tables {
 		log.Printf("Creating table: %s", table.name)
-		if err := table.fn(db); err != nil {
+		if _, err := db.Exec(table.sql); err != nil {
 			return fmt.Errorf("create %s table: %w", table.name, err)
 		}
 	}
@@ -50,9 +117,8 @@ func CreateTables(db *sql.DB) error {
 	return nil
 }
 
-// createJustTable creates the just table (existing)
-func createJustTable(db *sql.DB) error {
-	const stmt = `
+// createJustTable is the original just table
+const createJustTable = `
 	CREATE TABLE IF NOT EXISTS just (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		id_user BIGINT NOT NULL UNIQUE,
@@ -62,12 +128,8 @@ func createJustTable(db *sql.DB) error {
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	`
-	_, err := db.Exec(stmt)
-	return err
-}
 
-func createUsersTable(db *sql.DB) error {
-	const stmt = `
+const createUsersTable = `
 	CREATE TABLE IF NOT EXISTS users (
 		id           TEXT PRIMARY KEY,
 		user_id      INTEGER NOT NULL UNIQUE,
@@ -90,6 +152,66 @@ func createUsersTable(db *sql.DB) error {
 	  UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
 	END;
 	`
-	_, err := db.Exec(stmt)
+
+// createLikesTable stores who liked whom; the unique pair makes repeated likes a no-op
+const createLikesTable = `
+	CREATE TABLE IF NOT EXISTS likes (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		from_user_id TEXT NOT NULL,
+		to_user_id   TEXT NOT NULL,
+		created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(from_user_id, to_user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_likes_to_user_id ON likes(to_user_id);
+	`
+
+// createSkipsTable stores who passed on whom, one row per pair
+const createSkipsTable = `
+	CREATE TABLE IF NOT EXISTS skips (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		from_user_id TEXT NOT NULL,
+		to_user_id   TEXT NOT NULL,
+		created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(from_user_id, to_user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_skips_to_user_id ON skips(to_user_id);
+	`
+
+// addColumnIfMissing adds a column to an existing table; CREATE TABLE IF NOT EXISTS can't do that
+func addColumnIfMissing(db execer, table, column, definition string) error {
+	exists, err := columnExists(db, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
 	return err
 }
+
+func columnExists(db execer, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitDatabaseConcurrentInserts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"single connection", Options{MaxOpenConns: 1}},
+		{"WAL with busy timeout", Options{JournalMode: "WAL", BusyTimeout: 5 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			const goroutines, perGoroutine = 40, 25
+			errs := make(chan error, goroutines*perGoroutine)
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						id := g*perGoroutine + i + 1
+						if _, err := db.ExecContext(ctx, `INSERT INTO just (id_user, userName, dataRegistred) VALUES (?, ?, ?);`, id, fmt.Sprint("u", id), "2024-01-02 15:04:05"); err != nil {
+							errs <- err
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+			var n int
+			if err := db.QueryRow(`SELECT COUNT(1) FROM just;`).Scan(&n); err != nil || n != goroutines*perGoroutine {
+				t.Fatalf("just has %d rows, %v; want %d", n, err, goroutines*perGoroutine)
+			}
+		})
+	}
+}
+
+func TestInitDatabaseAppliesPragmas(t *testing.T) {
+	ctx := context.Background()
+	db, err := InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), Options{JournalMode: "WAL", BusyTimeout: 1500 * time.Millisecond, ForeignKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// hold one connection so the pragmas are also read on a second one
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	for _, conn := range []*sql.Conn{first, second} {
+		var journal string
+		var busy, fk int
+		if err := conn.QueryRowContext(ctx, `PRAGMA journal_mode;`).Scan(&journal); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, `PRAGMA busy_timeout;`).Scan(&busy); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys;`).Scan(&fk); err != nil {
+			t.Fatal(err)
+		}
+		if journal != "wal" || busy != 1500 || fk != 1 {
+			t.Errorf("journal_mode=%s busy_timeout=%d foreign_keys=%d, want wal, 1500 and 1", journal, busy, fk)
+		}
+	}
+}
+
+func TestInitDatabaseCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if db, err := InitDatabase(ctx, filepath.Join(t.TempDir(), "test.db"), Options{}); !errors.Is(err, context.Canceled) {
+		if db != nil {
+			db.Close()
+		}
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}